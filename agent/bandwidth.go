@@ -0,0 +1,42 @@
+package agent
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// bandwidthLimiter paces writes so that no more than bps bytes are sent per second,
+// across all the requests sharing it.
+type bandwidthLimiter struct {
+	mu   sync.Mutex
+	bps  int64
+	next time.Time
+}
+
+// wait blocks until n more bytes can be sent without exceeding the byte rate budget.
+func (l *bandwidthLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bps))
+	d := l.next.Sub(now)
+	l.mu.Unlock()
+	time.Sleep(d)
+}
+
+// limitedReader throttles reads from a request body.
+type limitedReader struct {
+	io.ReadCloser
+	limiter *bandwidthLimiter
+}
+
+func (r limitedReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
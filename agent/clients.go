@@ -0,0 +1,47 @@
+package agent
+
+import "fmt"
+
+// clientNetworks are public /16 networks in different countries, so that geo-IP enrichment finds a location
+// for client IPs.
+var clientNetworks = []string{
+	"81.2",    // GB
+	"89.160",  // SE
+	"175.16",  // CN
+	"216.160", // US
+	"2.125",   // GB
+	"67.43",   // US
+	"202.196", // PH
+	"186.2",   // BR
+	"78.46",   // DE
+	"46.226",  // FR
+	"103.21",  // IN
+	"41.203",  // ZA
+	"126.0",   // JP
+}
+
+// userAgents are common browser User-Agent strings, rotated in RUM mode so that user agent parsing
+// handles a realistic variety.
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.150 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0.3 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:85.0) Gecko/20100101 Firefox/85.0",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.146 Safari/537.36",
+	"Mozilla/5.0 (iPhone; CPU iPhone OS 14_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (Linux; Android 11; Pixel 5) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.152 Mobile Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.150 Safari/537.36 Edg/88.0.705.63",
+	"Mozilla/5.0 (Linux; Android 10; SM-G973F) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/13.2 Chrome/83.0.4103.106 Mobile Safari/537.36",
+	"Mozilla/5.0 (iPad; CPU OS 14_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/88.0.4324.152 Mobile/15E148 Safari/604.1",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:85.0) Gecko/20100101 Firefox/85.0",
+	"Mozilla/5.0 (Windows NT 6.1; Trident/7.0; rv:11.0) like Gecko",
+}
+
+// clientIPs returns n distinct IPv4 addresses spread across clientNetworks.
+func clientIPs(n int) []string {
+	ips := make([]string, n)
+	for i := range ips {
+		network, host := clientNetworks[i%len(clientNetworks)], i/len(clientNetworks)+1
+		ips[i] = fmt.Sprintf("%s.%d.%d", network, host>>8&0xff, host&0xff)
+	}
+	return ips
+}
@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/types"
+)
+
+// spanCompressor is a rewriter merging consecutive exit spans with the same parent, name, type and subtype into
+// composite spans, as agents with span compression do.
+// A composite span keeps the Id and context of the first span, lasts from the start of the first span to the end of
+// the last one, and reports their number and the sum of their durations with the exact_match strategy.
+type spanCompressor struct {
+	// last exit span and its event, held back until a span that can't be merged into it
+	last      types.M
+	lastEvent []byte
+	// spans merged into others
+	merged int
+}
+
+func (c *spanCompressor) rewrite(event []byte, emit func([]byte)) {
+	span := compressible(event)
+	if span != nil && c.last != nil && sameSpanKind(c.last, span) {
+		merge(c.last, span)
+		c.merged++
+		return
+	}
+	c.flush(emit)
+	if span == nil {
+		emit(event)
+		return
+	}
+	c.last, c.lastEvent = span, event
+}
+
+func (c *spanCompressor) flush(emit func([]byte)) {
+	if c.last == nil {
+		return
+	}
+	event := c.lastEvent
+	if _, ok := c.last["composite"]; ok {
+		if b, err := json.Marshal(types.M{"span": c.last}); err == nil {
+			event = append(b, '\n')
+		}
+	}
+	c.last, c.lastEvent = nil, nil
+	emit(event)
+}
+
+// compressible returns a decoded span event if it is an exit span, or nil otherwise.
+func compressible(event []byte) types.M {
+	if !bytes.HasPrefix(event, []byte(`{"span"`)) {
+		return nil
+	}
+	var doc map[string]types.M
+	if err := json.Unmarshal(event, &doc); err != nil {
+		return nil
+	}
+	span := doc["span"]
+	ctx, _ := span["context"].(types.M)
+	if ctx["db"] == nil && ctx["destination"] == nil {
+		return nil
+	}
+	return span
+}
+
+func sameSpanKind(a, b types.M) bool {
+	for _, k := range []string{"parent_id", "name", "type", "subtype", "outcome"} {
+		if a[k] != b[k] {
+			return false
+		}
+	}
+	return true
+}
+
+// merge adds span to the composite span c. Timestamps are in microseconds, and durations in milliseconds.
+func merge(c, span types.M) {
+	composite, ok := c["composite"].(types.M)
+	if !ok {
+		composite = types.M{"compression_strategy": "exact_match", "count": 1, "sum": c["duration"]}
+		c["composite"] = composite
+	}
+	composite["count"] = composite["count"].(int) + 1
+	composite["sum"] = conv.AsFloat64(composite, "sum") + conv.AsFloat64(span, "duration")
+	end := conv.AsFloat64(span, "timestamp")/1000 + conv.AsFloat64(span, "duration")
+	if d := end - conv.AsFloat64(c, "timestamp")/1000; d > conv.AsFloat64(c, "duration") {
+		c["duration"] = d
+	}
+}
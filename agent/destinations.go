@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/types"
+)
+
+// DestinationStats are the exit spans sent to a destination resource, as apm-server aggregates them
+// into service destination metrics.
+type DestinationStats struct {
+	Count int64
+	// sum of the span durations, in microseconds
+	DurationSum float64
+}
+
+// destinationCounter is a rewriter counting the exit spans per destination resource in the events it passes on
+// untouched. Spans merged into composite spans and dropped spans summarized in dropped_spans_stats are counted
+// as well.
+type destinationCounter map[string]DestinationStats
+
+func (counts destinationCounter) rewrite(event []byte, emit func([]byte)) {
+	emit(event)
+	isSpan := bytes.HasPrefix(event, []byte(`{"span"`))
+	if !isSpan && !bytes.HasPrefix(event, []byte(`{"transaction"`)) || !bytes.Contains(event, []byte("destination")) {
+		return
+	}
+	var doc map[string]types.M
+	if err := json.Unmarshal(event, &doc); err != nil {
+		return
+	}
+	if isSpan {
+		span := doc["span"]
+		resource := conv.AsString(lookup(span, "context", "destination", "service"), "resource")
+		if composite, ok := span["composite"].(types.M); ok {
+			counts.add(resource, int64(conv.AsFloat64(composite, "count")), conv.AsFloat64(composite, "sum")*1000)
+		} else {
+			counts.add(resource, 1, conv.AsFloat64(span, "duration")*1000)
+		}
+		return
+	}
+	for _, s := range conv.AsSlice(doc["transaction"], "dropped_spans_stats") {
+		s, _ := s.(types.M)
+		duration := lookup(s, "duration")
+		counts.add(conv.AsString(s, "destination_service_resource"), int64(conv.AsFloat64(duration, "count")),
+			conv.AsFloat64(lookup(duration, "sum"), "us"))
+	}
+}
+
+func (destinationCounter) flush(func([]byte)) {}
+
+func (counts destinationCounter) add(resource string, count int64, sum float64) {
+	if resource == "" || count <= 0 {
+		return
+	}
+	s := counts[resource]
+	s.Count += count
+	s.DurationSum += sum
+	counts[resource] = s
+}
+
+// lookup returns the object nested in m under the given keys, or nil if there is none.
+func lookup(m types.M, keys ...string) types.M {
+	for _, k := range keys {
+		m, _ = m[k].(types.M)
+	}
+	return m
+}
@@ -0,0 +1,63 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/hey-apm/types"
+)
+
+// DroppedSpanResources are the destination resources of the spans dropped by transactions for exceeding
+// the max spans: the nth dropped span of a transaction calls the nth resource, modulo their number.
+var DroppedSpanResources = []string{"mysql", "redis", "elasticsearch"}
+
+// droppedSpanDuration is the duration accounted to each dropped span.
+const droppedSpanDuration = time.Millisecond
+
+// addDroppedSpansStats adds dropped_spans_stats to a transaction with dropped spans, as newer agents do,
+// grouping them by destination resource as given by DroppedSpanResources.
+// Other events, and transactions without dropped spans or already with stats, are returned untouched.
+func addDroppedSpansStats(event []byte) []byte {
+	if !bytes.HasPrefix(event, []byte(`{"transaction"`)) || !bytes.Contains(event, []byte(`"dropped":`)) {
+		return event
+	}
+	var doc map[string]types.M
+	if err := json.Unmarshal(event, &doc); err != nil {
+		return event
+	}
+	tx := doc["transaction"]
+	spanCount, _ := tx["span_count"].(types.M)
+	dropped, _ := spanCount["dropped"].(float64)
+	if dropped <= 0 || tx["dropped_spans_stats"] != nil {
+		return event
+	}
+	tx["dropped_spans_stats"] = droppedSpansStats(int(dropped))
+	if b, err := json.Marshal(doc); err == nil {
+		return append(b, '\n')
+	}
+	return event
+}
+
+// droppedSpansStats returns the dropped_spans_stats of n dropped spans.
+func droppedSpansStats(n int) []types.M {
+	var stats []types.M
+	for i, resource := range DroppedSpanResources {
+		count := n / len(DroppedSpanResources)
+		if i < n%len(DroppedSpanResources) {
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		stats = append(stats, types.M{
+			"destination_service_resource": resource,
+			"outcome":                      "success",
+			"duration": types.M{
+				"count": count,
+				"sum":   types.M{"us": int64(count) * int64(droppedSpanDuration/time.Microsecond)},
+			},
+		})
+	}
+	return stats
+}
@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/hey-apm/server"
+)
+
+// mirror sends a copy of every intake request to a second apm-server, and accounts for its responses separately.
+type mirror struct {
+	url *url.URL
+	// Authorization header value, empty if none
+	auth  string
+	stats *statsCollector
+}
+
+func newMirror(serverUrl, secret, apiKey string, verbose bool) (*mirror, error) {
+	u, err := url.Parse(serverUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &mirror{url: u, auth: server.Authorization(secret, apiKey), stats: newStatsCollector(verbose)}, nil
+}
+
+// send starts sending a copy of req with body, streamed from the body of req as it is read,
+// and returns a channel closed once the mirrored request completes.
+func (m *mirror) send(req *http.Request, body io.ReadCloser) (<-chan struct{}, error) {
+	u := *m.url
+	u.Path = req.URL.Path
+	u.RawQuery = req.URL.RawQuery
+	counted := &countingReader{ReadCloser: body}
+	mreq, err := http.NewRequest(req.Method, u.String(), counted)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	for k, v := range req.Header {
+		mreq.Header[k] = v
+	}
+	// requests without credentials, as RUM ones, are mirrored without them
+	if req.Header.Get("Authorization") != "" {
+		mreq.Header.Del("Authorization")
+		if m.auth != "" {
+			mreq.Header.Set("Authorization", m.auth)
+		}
+	}
+	if m.stats.verbose {
+		q := mreq.URL.Query()
+		q.Set("verbose", "")
+		mreq.URL.RawQuery = q.Encode()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		sample := RequestSample{Timestamp: time.Now()}
+		resp, err := http.DefaultTransport.RoundTrip(mreq)
+		sample.BytesSent = atomic.LoadInt64(&counted.n)
+		if err != nil {
+			sample.Duration = time.Since(sample.Timestamp)
+			m.stats.add(sample, nil)
+			return
+		}
+		defer resp.Body.Close()
+		var b []byte
+		if m.stats.verbose {
+			b, _ = ioutil.ReadAll(resp.Body)
+		}
+		sample.Duration = time.Since(sample.Timestamp)
+		sample.Status = resp.StatusCode
+		m.stats.add(sample, b)
+	}()
+	return done, nil
+}
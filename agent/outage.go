@@ -0,0 +1,79 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// outage simulates the agent being stopped: while it lasts requests are held, and when it starts
+// the requests in flight are aborted. Held requests are all released when it ends, as restarted agents
+// reconnecting at once.
+type outage struct {
+	mu      sync.Mutex
+	ended   chan struct{}
+	cancels map[*http.Request]context.CancelFunc
+}
+
+func newOutage() *outage {
+	return &outage{cancels: make(map[*http.Request]context.CancelFunc)}
+}
+
+// start aborts the requests in flight and holds new ones for d, unless an outage is already ongoing.
+func (o *outage) start(d time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for req, cancel := range o.cancels {
+		cancel()
+		delete(o.cancels, req)
+	}
+	if o.ended == nil {
+		ended := make(chan struct{})
+		o.ended = ended
+		time.AfterFunc(d, func() {
+			o.mu.Lock()
+			o.ended = nil
+			o.mu.Unlock()
+			close(ended)
+		})
+	}
+}
+
+// track waits until the outage ends, if any, and returns req with a context canceled if another one starts
+// before it completes.
+func (o *outage) track(req *http.Request) (*http.Request, context.CancelFunc) {
+	o.mu.Lock()
+	ended := o.ended
+	o.mu.Unlock()
+	if ended != nil {
+		select {
+		case <-ended:
+		case <-req.Context().Done():
+		}
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	req = req.WithContext(ctx)
+	o.mu.Lock()
+	o.cancels[req] = cancel
+	o.mu.Unlock()
+	return req, func() {
+		o.mu.Lock()
+		delete(o.cancels, req)
+		o.mu.Unlock()
+		cancel()
+	}
+}
+
+// cancelOnClose releases a tracked request once its response body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
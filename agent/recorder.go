@@ -0,0 +1,25 @@
+package agent
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// accepted returns a response as apm-server gives when all the events of a request are accepted,
+// for requests recorded but not sent.
+func accepted(req *http.Request, events int) *http.Response {
+	body := fmt.Sprintf(`{"accepted":%d}`, events)
+	return &http.Response{
+		Status:        "202 Accepted",
+		StatusCode:    http.StatusAccepted,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          ioutil.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
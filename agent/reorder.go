@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"math/rand"
+)
+
+// shuffleWindow is the most events held back by an eventShuffler, so that they are sent at most that many events
+// later.
+const shuffleWindow = 100
+
+// eventShuffler is a rewriter holding back a fraction of events, picked at random, to send them after later events
+// of the same request in random order, so that spans and transactions arrive before or after their parents and
+// children regardless of when they ended.
+type eventShuffler struct {
+	rand  *rand.Rand
+	ratio float64
+	held  [][]byte
+}
+
+func (s *eventShuffler) rewrite(event []byte, emit func([]byte)) {
+	if s.rand.Float64() < s.ratio {
+		s.held = append(s.held, event)
+		if len(s.held) <= shuffleWindow {
+			return
+		}
+		event = s.release()
+	}
+	emit(event)
+	if len(s.held) > 0 && s.rand.Float64() < s.ratio {
+		emit(s.release())
+	}
+}
+
+func (s *eventShuffler) flush(emit func([]byte)) {
+	for len(s.held) > 0 {
+		emit(s.release())
+	}
+}
+
+// release removes a random event from the held back ones and returns it.
+func (s *eventShuffler) release() []byte {
+	i := s.rand.Intn(len(s.held))
+	event := s.held[i]
+	last := len(s.held) - 1
+	s.held[i], s.held[last] = s.held[last], nil
+	s.held = s.held[:last]
+	return event
+}
@@ -0,0 +1,156 @@
+package agent
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/elastic/hey-apm/record"
+)
+
+var (
+	// line readers of decompressed request bodies, reused across requests
+	lineReaders = sync.Pool{New: func() interface{} { return bufio.NewReaderSize(nil, 64*1024) }}
+	// compressors, reused across requests as they allocate large buffers
+	gzipWriters = sync.Pool{New: func() interface{} { return gzip.NewWriter(nil) }}
+	zlibWriters = sync.Pool{New: func() interface{} { return zlib.NewWriter(nil) }}
+)
+
+// rewriter rewrites the events of an intake request one at a time, as they are streamed.
+// Events are NDJSON lines, with their trailing newline.
+type rewriter interface {
+	// rewrite passes the events replacing event on to emit, if any, now or in a later call.
+	rewrite(event []byte, emit func([]byte))
+	// flush passes the events held back by rewrite on to emit, after the last event.
+	flush(emit func([]byte))
+}
+
+// eventRewriter is a rewriter replacing each event with the one it returns.
+type eventRewriter func(event []byte) []byte
+
+func (f eventRewriter) rewrite(event []byte, emit func([]byte)) {
+	emit(f(event))
+}
+
+func (eventRewriter) flush(func([]byte)) {}
+
+// rewriteEvents replaces the body of an intake request with its events rewritten by each of rewriters in turn,
+// compressed as the original body. The metadata line is kept as is.
+// The body is decompressed, rewritten and compressed again in a single pass, a line at a time, as it is streamed to
+// apm-server, so only events held back by rewriters are kept in memory.
+// It returns a channel closed once the body is streamed or the request failed, after which rewriters are done.
+// On error, the request is left untouched.
+func rewriteEvents(req *http.Request, rewriters ...rewriter) (<-chan struct{}, error) {
+	done := make(chan struct{})
+	if req.Body == nil || len(rewriters) == 0 {
+		close(done)
+		return done, nil
+	}
+	body := req.Body
+	rd, release, err := record.Decompressor(req.Header, body)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		defer close(done)
+		lines := lineReaders.Get().(*bufio.Reader)
+		lines.Reset(rd)
+		w := compressor(req.Header.Get("Content-Encoding"), pw)
+		err := streamEvents(w, lines, rewriters)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		// an error fails the request, unless the transport closed the body already
+		pw.CloseWithError(err)
+		lines.Reset(nil)
+		lineReaders.Put(lines)
+		release()
+		body.Close()
+	}()
+	// streamed with chunked encoding, and not replayable
+	req.ContentLength = -1
+	req.Body = pr
+	req.GetBody = nil
+	return done, nil
+}
+
+// streamEvents writes to w the metadata line read from r, followed by the rest of lines passed through rewriters.
+func streamEvents(w io.Writer, r *bufio.Reader, rewriters []rewriter) error {
+	var werr error
+	write := func(line []byte) {
+		if werr == nil {
+			_, werr = w.Write(line)
+		}
+	}
+	// emit[i] passes events on to rewriters[i], and the last one writes them
+	emit := make([]func([]byte), len(rewriters)+1)
+	emit[len(rewriters)] = write
+	for i := len(rewriters) - 1; i >= 0; i-- {
+		rw, next := rewriters[i], emit[i+1]
+		emit[i] = func(event []byte) { rw.rewrite(event, next) }
+	}
+
+	for metadata := true; werr == nil; metadata = false {
+		// lines are not reused, as rewriters might hold them back
+		line, err := r.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(line) > 0 {
+			if line[len(line)-1] != '\n' {
+				line = append(line, '\n')
+			}
+			if metadata {
+				write(line)
+			} else {
+				emit[0](line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	for i, rw := range rewriters {
+		rw.flush(emit[i+1])
+	}
+	return werr
+}
+
+// compressor returns a writer compressing to w as given by a Content-Encoding header value.
+// Pooled compressors are put back when closed.
+func compressor(encoding string, w io.Writer) io.WriteCloser {
+	switch encoding {
+	case "deflate":
+		zw := zlibWriters.Get().(*zlib.Writer)
+		zw.Reset(w)
+		return pooledWriter{zw, &zlibWriters}
+	case "gzip":
+		gw := gzipWriters.Get().(*gzip.Writer)
+		gw.Reset(w)
+		return pooledWriter{gw, &gzipWriters}
+	}
+	return nopWriteCloser{w}
+}
+
+type pooledWriter struct {
+	io.WriteCloser
+	pool *sync.Pool
+}
+
+func (w pooledWriter) Close() error {
+	err := w.WriteCloser.Close()
+	w.pool.Put(w.WriteCloser)
+	return err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,108 @@
+package agent
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/elastic/hey-apm/record"
+	"github.com/stretchr/testify/assert"
+)
+
+// intakeRequest returns an intake request with a metadata line and n spans, compressed with encoding.
+func intakeRequest(n int, encoding string) *http.Request {
+	var buf bytes.Buffer
+	var w io.WriteCloser = nopWriteCloser{&buf}
+	switch encoding {
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	}
+	fmt.Fprintln(w, `{"metadata":{"service":{"name":"hey-apm","agent":{"name":"go","version":"1.7.2"}}}}`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(w, `{"span":{"id":"%016x","transaction_id":"0123456789abcdef",`+
+			`"trace_id":"0123456789abcdef0123456789abcdef","parent_id":"0123456789abcdef","name":"I'm a span",`+
+			`"type":"gen.era.ted","timestamp":%d,"duration":1.5,"context":{"tags":{"run_id":"x"}}}}`+"\n",
+			i, 1600000000000000+i)
+	}
+	w.Close()
+	req, _ := http.NewRequest("POST", "http://localhost:8200/intake/v2/events", bytes.NewReader(buf.Bytes()))
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	return req
+}
+
+// dropFirst is a rewriter dropping the first event, and counting them.
+type dropFirst struct {
+	events int
+}
+
+func (d *dropFirst) rewrite(event []byte, emit func([]byte)) {
+	d.events++
+	if d.events > 1 {
+		emit(event)
+	}
+}
+
+func (d *dropFirst) flush(func([]byte)) {}
+
+func TestRewriteEvents(t *testing.T) {
+	for _, encoding := range []string{"", "deflate", "gzip"} {
+		// pooled readers and compressors must not leak across requests
+		for n := 3; n > 0; n-- {
+			req := intakeRequest(n, encoding)
+			first, second := &dropFirst{}, &dropFirst{}
+			done, err := rewriteEvents(req, first, second)
+			assert.NoError(t, err)
+
+			body, err := ioutil.ReadAll(req.Body)
+			assert.NoError(t, err)
+			<-done
+			assert.Equal(t, n, first.events)
+			assert.Equal(t, n-1, second.events)
+			ndjson, err := record.Decompress(req.Header, body)
+			assert.NoError(t, err)
+			events := n - 2
+			if events < 0 {
+				events = 0
+			}
+			assert.Equal(t, 1+events, bytes.Count(ndjson, []byte("\n")), encoding)
+			assert.Equal(t, 1, bytes.Count(ndjson, []byte(`"metadata"`)), encoding)
+		}
+	}
+}
+
+func TestRewriteEventsClosed(t *testing.T) {
+	req := intakeRequest(1000, "gzip")
+	done, err := rewriteEvents(req, eventRewriter(func(event []byte) []byte { return event }))
+	assert.NoError(t, err)
+	// as the transport does if a request fails, rewriting must stop
+	req.Body.Close()
+	<-done
+}
+
+func benchmarkRewriteEvents(b *testing.B, n int) {
+	body, _ := ioutil.ReadAll(intakeRequest(n, "deflate").Body)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, _ := http.NewRequest("POST", "http://localhost:8200/intake/v2/events", bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "deflate")
+		if _, err := rewriteEvents(req, eventRewriter(func(event []byte) []byte { return event })); err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(ioutil.Discard, req.Body)
+	}
+}
+
+func BenchmarkRewriteEvents10(b *testing.B)   { benchmarkRewriteEvents(b, 10) }
+func BenchmarkRewriteEvents100(b *testing.B)  { benchmarkRewriteEvents(b, 100) }
+func BenchmarkRewriteEvents1000(b *testing.B) { benchmarkRewriteEvents(b, 1000) }
@@ -0,0 +1,29 @@
+package agent
+
+import (
+	"encoding/json"
+
+	"github.com/elastic/hey-apm/script"
+)
+
+// runScript returns a rewriter applying a script to each event.
+// Only the events changed by the script are encoded again.
+func runScript(s *script.Script) eventRewriter {
+	return func(event []byte) []byte {
+		var doc map[string]map[string]interface{}
+		if err := json.Unmarshal(event, &doc); err != nil {
+			return event
+		}
+		var changed bool
+		for eventType, e := range doc {
+			changed = s.Apply(eventType, e) || changed
+		}
+		if !changed {
+			return event
+		}
+		if b, err := json.Marshal(doc); err == nil {
+			return append(b, '\n')
+		}
+		return event
+	}
+}
@@ -0,0 +1,31 @@
+package agent
+
+import (
+	"net/http"
+
+	"go.elastic.co/apm"
+)
+
+// Sender creates events and delivers them to apm-server, accounting for them,
+// so that event generators don't depend on how events reach apm-server.
+// Tracer is the Sender creating events with the Go agent API, and sending them with its transport over HTTP.
+type Sender interface {
+	// StartTransactionOptions starts a transaction, sent along with its spans once ended.
+	StartTransactionOptions(name, transactionType string, opts apm.TransactionOptions) *apm.Transaction
+	// NewError returns an error event for err, sent once its Send method is called.
+	NewError(err error) *apm.Error
+	// NewErrorLog returns an error event for a log record, sent once its Send method is called.
+	NewErrorLog(r apm.ErrorLogRecord) *apm.Error
+	// CaptureHTTPRequestBody returns the body of req as captured for transactions, if configured.
+	CaptureHTTPRequestBody(req *http.Request) *apm.BodyCapturer
+	// Flush waits until all the events created so far are sent, or abort is closed.
+	Flush(abort <-chan struct{})
+	// Stats returns the events sent and dropped so far.
+	Stats() apm.TracerStats
+	// TransportStats returns the requests and responses to apm-server so far.
+	TransportStats() TransportStats
+	// Close stops sending events.
+	Close()
+}
+
+var _ Sender = (*Tracer)(nil)
@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/random"
+)
+
+// errReset is returned by bodies of requests whose connection is reset on purpose.
+var errReset = errors.New("connection reset by traffic shaping")
+
+// delay returns latency plus a random jitter between -jitter and +jitter, never negative.
+func delay(r *rand.Rand, latency, jitter time.Duration) time.Duration {
+	d := latency
+	if jitter > 0 {
+		d += time.Duration(r.Int63n(2*int64(jitter)+1)) - jitter
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// resetReader fails reading a request body after n bytes, so that the request is aborted midway
+// as if the connection was reset.
+type resetReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *resetReader) Read(p []byte) (int, error) {
+	if r.n <= 0 {
+		return 0, errReset
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.n -= int64(n)
+	return n, err
+}
+
+// lockedSource is a seeded source of randomness safe for concurrent use, as the global one is,
+// since request bodies are rewritten while they are sent.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+// newLockedRand returns a random number generator with a lockedSource seeded with a seed derived from seed.
+func newLockedRand(seed int64) *rand.Rand {
+	return rand.New(&lockedSource{src: rand.NewSource(random.Derive(seed, "agent"))})
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
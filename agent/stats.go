@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/conv"
+)
+
+const (
+	// maxErrorMessages bounds the number of distinct server error messages kept.
+	// Messages seen after that are only counted.
+	maxErrorMessages = 100
+	// topErrors is the number of most frequent server error messages in a snapshot.
+	topErrors = 10
+	// maxSamples bounds the number of request samples kept, about 40MB worth.
+	maxSamples = 1 << 20
+)
+
+// TransportStats are captured by reading apm-server responses.
+// It is a point in time snapshot, safe to read while requests are still being sent.
+type TransportStats struct {
+	Accepted uint64
+	// number of events rejected by apm-server, as reported in the response errors
+	Rejected     uint64
+	TopErrors    []string
+	NumRequests  uint64
+	AuthFailures uint64
+	Samples      []RequestSample
+	// number of requests not sampled because the maximum number of samples was reached
+	SamplesDropped uint64
+	// whether Accepted and Rejected were read from verbose apm-server responses
+	Verbose bool
+	// whether the agent also sends metricsets, which apm-server acknowledges but aren't accounted as sent events
+	Metrics bool
+	// exit spans per destination resource in the requests accepted by apm-server, if counted
+	Destinations map[string]DestinationStats
+}
+
+// RequestSample describes a single intake request.
+type RequestSample struct {
+	// when the request started
+	Timestamp time.Time
+	// from sending the request until reading its response
+	Duration time.Duration
+	// HTTP status code, 0 if no response was received
+	Status int
+	// request body size, in bytes
+	BytesSent int64
+}
+
+// statsCollector accumulates transport stats from concurrent requests, using bounded memory.
+type statsCollector struct {
+	verbose        bool
+	metrics        bool
+	mu             sync.Mutex
+	accepted       uint64
+	rejected       uint64
+	numRequests    uint64
+	authFailures   uint64
+	errors         map[string]uint64
+	otherErrors    uint64
+	samples        []RequestSample
+	samplesDropped uint64
+	destinations   map[string]DestinationStats
+}
+
+// newStatsCollector returns a collector that either reads verbose responses, or only accounts for their status.
+func newStatsCollector(verbose bool) *statsCollector {
+	return &statsCollector{verbose: verbose, errors: make(map[string]uint64)}
+}
+
+// add records a request and its response body, if any.
+func (s *statsCollector) add(sample RequestSample, body []byte) {
+	var m map[string]interface{}
+	decoded := body != nil && json.Unmarshal(body, &m) == nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) < maxSamples {
+		s.samples = append(s.samples, sample)
+	} else {
+		s.samplesDropped += 1
+	}
+	if sample.Status == http.StatusUnauthorized || sample.Status == http.StatusForbidden {
+		s.authFailures += 1
+	}
+	if !s.verbose && sample.Status > 0 {
+		s.numRequests += 1
+	}
+	if !decoded {
+		return
+	}
+	s.accepted += conv.AsUint64(m, "accepted")
+	s.numRequests += 1
+	errors := conv.AsSlice(m, "errors")
+	s.rejected += uint64(len(errors))
+	for _, i := range errors {
+		e := conv.AsString(i, "message")
+		if _, ok := s.errors[e]; ok || len(s.errors) < maxErrorMessages {
+			s.errors[e] += 1
+		} else {
+			s.otherErrors += 1
+		}
+	}
+}
+
+// addCompressed accounts spans merged into composite spans of a request accepted by apm-server as accepted,
+// as they were sent as part of them.
+func (s *statsCollector) addCompressed(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepted += uint64(n)
+}
+
+// addDestinations accounts the exit spans per destination of a request accepted by apm-server.
+func (s *statsCollector) addDestinations(counts map[string]DestinationStats) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.destinations == nil {
+		s.destinations = make(map[string]DestinationStats)
+	}
+	for resource, c := range counts {
+		total := s.destinations[resource]
+		total.Count += c.Count
+		total.DurationSum += c.DurationSum
+		s.destinations[resource] = total
+	}
+}
+
+// snapshot returns a copy of the stats collected so far.
+// Samples are shared with the collector, but only appended to, so they are never modified after being returned.
+func (s *statsCollector) snapshot() TransportStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return TransportStats{
+		Accepted:       s.accepted,
+		Rejected:       s.rejected,
+		TopErrors:      s.topErrors(),
+		NumRequests:    s.numRequests,
+		AuthFailures:   s.authFailures,
+		Samples:        s.samples[:len(s.samples):len(s.samples)],
+		SamplesDropped: s.samplesDropped,
+		Verbose:        s.verbose,
+		Metrics:        s.metrics,
+		Destinations:   s.destinationsCopy(),
+	}
+}
+
+// topErrors returns the most frequent error messages, most frequent first.
+func (s *statsCollector) topErrors() []string {
+	var messages []string
+	for e := range s.errors {
+		messages = append(messages, e)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if s.errors[messages[i]] != s.errors[messages[j]] {
+			return s.errors[messages[i]] > s.errors[messages[j]]
+		}
+		return messages[i] < messages[j]
+	})
+	if len(messages) > topErrors {
+		messages = messages[:topErrors]
+	}
+	return messages
+}
+
+func (s *statsCollector) destinationsCopy() map[string]DestinationStats {
+	if s.destinations == nil {
+		return nil
+	}
+	m := make(map[string]DestinationStats, len(s.destinations))
+	for resource, c := range s.destinations {
+		m[resource] = c
+	}
+	return m
+}
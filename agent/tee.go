@@ -0,0 +1,69 @@
+package agent
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// errNotSentWhole aborts mirrored requests whose original request body was not sent whole.
+var errNotSentWhole = errors.New("request body not sent whole")
+
+// teeReader copies a request body as it is read, eg. while streamed to apm-server,
+// so that recording, sampling or mirroring requests doesn't hold them back.
+type teeReader struct {
+	io.ReadCloser
+	// accumulates the body for the functions that need it whole, if any
+	buf   bytes.Buffer
+	whole []func(body []byte) error
+	// streams the body to a mirrored request, nil if none
+	mirror *io.PipeWriter
+	eof    bool
+}
+
+// wholeBody calls f with the body once read whole, returning its error from the last read.
+// Bodies not read whole, eg. because their request failed, are not passed to f.
+func (t *teeReader) wholeBody(f func(body []byte) error) {
+	t.whole = append(t.whole, f)
+}
+
+// mirrorBody returns a reader streaming the body at the pace it is read, which fails if it is not read whole.
+// Failing to write to it, eg. because the mirrored request failed, doesn't fail the original one.
+func (t *teeReader) mirrorBody() io.ReadCloser {
+	pr, pw := io.Pipe()
+	t.mirror = pw
+	return pr
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		if len(t.whole) > 0 {
+			t.buf.Write(p[:n])
+		}
+		if t.mirror != nil {
+			t.mirror.Write(p[:n])
+		}
+	}
+	if err == io.EOF && !t.eof {
+		t.eof = true
+		if t.mirror != nil {
+			t.mirror.Close()
+		}
+		for _, f := range t.whole {
+			if ferr := f(t.buf.Bytes()); ferr != nil {
+				return n, ferr
+			}
+		}
+	}
+	return n, err
+}
+
+// Close is safe to call concurrently with Read, as transports do.
+func (t *teeReader) Close() error {
+	if t.mirror != nil {
+		// no-op once closed at EOF
+		t.mirror.CloseWithError(errNotSentWhole)
+	}
+	return t.ReadCloser.Close()
+}
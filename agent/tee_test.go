@@ -0,0 +1,55 @@
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeeReader(t *testing.T) {
+	body := strings.Repeat("event\n", 10000)
+	tee := &teeReader{ReadCloser: ioutil.NopCloser(strings.NewReader(body))}
+	var whole string
+	tee.wholeBody(func(b []byte) error {
+		whole = string(b)
+		return nil
+	})
+	mirrored := make(chan string)
+	mirror := tee.mirrorBody()
+	go func() {
+		b, _ := ioutil.ReadAll(mirror)
+		mirrored <- string(b)
+	}()
+
+	sent, err := ioutil.ReadAll(tee)
+	assert.NoError(t, err)
+	assert.NoError(t, tee.Close())
+	assert.Equal(t, body, string(sent))
+	assert.Equal(t, body, whole)
+	assert.Equal(t, body, <-mirrored)
+}
+
+func TestTeeReaderNotReadWhole(t *testing.T) {
+	tee := &teeReader{ReadCloser: ioutil.NopCloser(strings.NewReader("event\n"))}
+	tee.wholeBody(func(b []byte) error {
+		t.Error("body not read whole")
+		return nil
+	})
+	mirror := tee.mirrorBody()
+	assert.NoError(t, tee.Close())
+	_, err := ioutil.ReadAll(mirror)
+	assert.Equal(t, errNotSentWhole, err)
+}
+
+func TestTeeReaderError(t *testing.T) {
+	tee := &teeReader{ReadCloser: ioutil.NopCloser(strings.NewReader("event\n"))}
+	failed := errors.New("disk full")
+	tee.wholeBody(func(b []byte) error {
+		return failed
+	})
+	_, err := ioutil.ReadAll(tee)
+	assert.Equal(t, failed, err)
+}
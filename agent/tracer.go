@@ -2,91 +2,351 @@ package agent
 
 import (
 	"bytes"
-	"encoding/json"
+	"io"
 	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/elastic/hey-apm/conv"
-	"github.com/elastic/hey-apm/strcoll"
-
 	"go.elastic.co/apm"
 	apmtransport "go.elastic.co/apm/transport"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/record"
+	"github.com/elastic/hey-apm/script"
 )
 
 type Tracer struct {
 	*apm.Tracer
-	TransportStats *TransportStats
+	stats        *statsCollector
+	flushTimeout time.Duration
+	logger       apm.Logger
+	recorder     *record.Recorder
+	sampler      *record.Sampler
+	outage       *outage
+	mirror       *mirror
+}
+
+// TransportStats returns a snapshot of the stats captured so far.
+func (t Tracer) TransportStats() TransportStats {
+	return t.stats.snapshot()
 }
 
-// TransportStats are captured by reading apm-server responses.
-type TransportStats struct {
-	Accepted    uint64
-	TopErrors   []string
-	NumRequests uint64
+// MirrorTransportStats returns a snapshot of the stats captured so far from the requests mirrored to a second
+// apm-server, and false if requests are not mirrored.
+func (t Tracer) MirrorTransportStats() (TransportStats, bool) {
+	if t.mirror == nil {
+		return TransportStats{}, false
+	}
+	return t.mirror.stats.snapshot(), true
+}
+
+// Flush waits until all the events created so far are sent, abort is closed, or the flush timeout expires.
+func (t Tracer) Flush(abort <-chan struct{}) {
+	if t.flushTimeout <= 0 {
+		t.Tracer.Flush(abort)
+		return
+	}
+	timeout := time.NewTimer(t.flushTimeout)
+	defer timeout.Stop()
+	stop := make(chan struct{})
+	flushed := make(chan struct{})
+	go func() {
+		t.Tracer.Flush(stop)
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-abort:
+		close(stop)
+	case <-timeout.C:
+		close(stop)
+		t.logger.Errorf("timed out waiting for flush to complete")
+	}
 }
 
+// Close stops sending events, and closes the record and sent events files if any.
 func (t Tracer) Close() {
 	t.Tracer.Close()
-	rt := t.Transport.(*apmtransport.HTTPTransport).Client.Transport.(*roundTripper)
-	rt.wg.Wait()
-	close(rt.c)
+	if t.recorder != nil {
+		if err := t.recorder.Close(); err != nil {
+			t.logger.Errorf("error closing record file: %s", err.Error())
+		}
+	}
+	if t.sampler != nil {
+		if err := t.sampler.Close(); err != nil {
+			t.logger.Errorf("error closing sent events file: %s", err.Error())
+		}
+	}
 }
 
-// NewTracer returns a wrapper with a new Go agent instance and its transport stats.
-func NewTracer(logger apm.Logger, serverUrl, serverSecret, apiKey, serviceName string, maxSpans int) *Tracer {
-	// version can be set with ELASTIC_APM_SERVICE_VERSION
-	goTracer, _ := apm.NewTracer(serviceName, "")
-	goTracer.SetLogger(logger)
-	goTracer.SetMetricsInterval(0) // disable metrics
-	goTracer.SetSpanFramesMinDuration(1 * time.Nanosecond)
-	goTracer.SetMaxSpans(maxSpans)
+// Interrupt simulates the agent being stopped for d and restarted: requests in flight are aborted,
+// and new ones are held until d elapses, so that they are sent all at once as if reconnecting.
+// Events created in the meantime are buffered, and dropped when the buffer is full.
+// It has no effect with CaptureNone.
+func (t Tracer) Interrupt(d time.Duration) {
+	if t.outage != nil {
+		t.outage.start(d)
+	}
+}
+
+// ResponseCapture defines what is captured from apm-server responses.
+type ResponseCapture int
 
-	transport := goTracer.Transport.(*apmtransport.HTTPTransport)
+const (
+	// CaptureVerbose requests verbose responses, to account for accepted and rejected events
+	CaptureVerbose ResponseCapture = iota
+	// CaptureStatus only accounts for response status codes, for maximum throughput
+	CaptureStatus
+	// CaptureNone leaves the transport untouched, no transport stats are collected
+	CaptureNone
+)
+
+// Config holds the settings of a Tracer.
+type Config struct {
+	ServerUrl    string
+	ServerSecret string
+	APIKey       string
+
+	ServiceName        string
+	ServiceVersion     string
+	ServiceEnvironment string
+
+	// Maximum number of spans per transaction, the agent default if 0 and not limited if negative
+	MaxSpans int
+	// If 0, metrics are disabled
+	MetricsInterval time.Duration
+	// Whether transactions and spans are accounted in breakdown metrics, sent every MetricsInterval
+	BreakdownMetrics bool
+	// If greater than 0, Flush gives up waiting after this duration
+	FlushTimeout time.Duration
+
+	Capture ResponseCapture
+	// If greater than 0, limits the bytes per second sent to apm-server, ignored with CaptureNone
+	MaxBytesPerSecond int64
+	// Extra latency added before every request, plus a random jitter between -LatencyJitter and +LatencyJitter,
+	// ignored with CaptureNone
+	Latency       time.Duration
+	LatencyJitter time.Duration
+	// Fraction of requests aborted midway as if their connection was reset, ignored with CaptureNone
+	ResetRatio float64
+	// Fraction of events sent after later random events of the same request, to deliver them out of order.
+	// Ignored with CaptureNone
+	OutOfOrderRatio float64
+	// Seed of the random jitter, resets and out of order events, so that they can be reproduced
+	Seed int64
+	// If true, dropped_spans_stats are added to transactions with dropped spans, as agents since 1.15 do.
+	// Ignored with CaptureNone
+	DroppedSpansStats bool
+	// If true, consecutive identical exit spans are sent as composite spans, as agents since 1.15 can do.
+	// Ignored with CaptureNone
+	CompressSpans bool
+	// If true, OpenTelemetry span kinds and semantic convention attributes are added to transactions and spans,
+	// as agents bridging OpenTelemetry do. Ignored with CaptureNone
+	OTelAttributes bool
+	// If not empty, every event is customized with the script in this file, seeded with Seed.
+	// Ignored with CaptureNone
+	ScriptFile string
+	// Data feeds the script can refer to, as name=path pairs, and whether their rows are sampled at random
+	// rather than given to events in order
+	Feeds       []string
+	SampleFeeds bool
+	// If true, exit spans are counted per destination resource in the requests accepted by apm-server,
+	// to compare them with its service destination metrics. Ignored with CaptureNone
+	CountDestinations bool
+	// If true, events are sent to the RUM intake endpoint without credentials and with browser User-Agent strings,
+	// as anonymous agents do. Ignored with CaptureNone
+	RUM bool
+	// If greater than 0, requests are attributed round robin to this many client IPs with X-Forwarded-For,
+	// ignored with CaptureNone
+	ClientIPs int
+	// If not empty, a copy of every intake request is sent at the same time to this other apm-server, with its own
+	// credentials, and its responses are accounted for separately. Ignored with CaptureNone and RecordOnly
+	MirrorUrl    string
+	MirrorSecret string
+	MirrorAPIKey string
+	// If not empty, the uncompressed body of every intake request is written to this file, ignored with CaptureNone
+	RecordFile string
+	// If true, requests are recorded but not sent, and all their events are considered accepted
+	RecordOnly bool
+	// If not empty, a random sample of the events sent is written to this file, 1 in SentEventsEvery,
+	// ignored with CaptureNone
+	SentEventsFile  string
+	SentEventsEvery int
+	// If not empty, recorded requests are scrubbed with the rules in this file, or the default ones if "default"
+	ScrubRules string
+}
+
+// NewTracer returns a wrapper with a new Go agent instance and its transport stats.
+// Every tracer has its own transport, independent of other tracers.
+func NewTracer(logger apm.Logger, cfg Config) (*Tracer, error) {
+	transport, err := apmtransport.NewHTTPTransport()
+	if err != nil {
+		return nil, err
+	}
 	transport.SetUserAgent("hey-apm")
-	if apiKey != "" {
-		transport.SetAPIKey(apiKey)
-	} else if serverSecret != "" {
-		transport.SetSecretToken(serverSecret)
+	if cfg.APIKey != "" {
+		transport.SetAPIKey(conv.EncodeAPIKey(cfg.APIKey))
+	} else if cfg.ServerSecret != "" {
+		transport.SetSecretToken(cfg.ServerSecret)
 	}
-	if serverUrl != "" {
-		u, err := url.Parse(serverUrl)
+	if cfg.ServerUrl != "" {
+		u, err := url.Parse(cfg.ServerUrl)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
 		transport.SetServerURL(u)
 	}
-	rt := &roundTripper{c: make(chan []byte, 0)}
-	transport.Client.Transport = rt
 
-	tracer := &Tracer{goTracer, &TransportStats{}}
+	// unset fields can be set with ELASTIC_APM_SERVICE_NAME, ELASTIC_APM_SERVICE_VERSION and ELASTIC_APM_ENVIRONMENT
+	goTracer, err := newGoTracer(apm.TracerOptions{
+		ServiceName:        cfg.ServiceName,
+		ServiceVersion:     cfg.ServiceVersion,
+		ServiceEnvironment: cfg.ServiceEnvironment,
+		Transport:          transport,
+	}, cfg.BreakdownMetrics)
+	if err != nil {
+		return nil, err
+	}
+	goTracer.SetLogger(logger)
+	goTracer.SetMetricsInterval(cfg.MetricsInterval)
+	goTracer.SetSpanFramesMinDuration(1 * time.Nanosecond)
+	if cfg.MaxSpans != 0 {
+		goTracer.SetMaxSpans(cfg.MaxSpans)
+	}
 
-	// TODO confirm that synchronization is wired up correctly
-	go func() {
-		for response := range rt.c {
-			var m map[string]interface{}
-			if err := json.Unmarshal(response, &m); err != nil {
-				return
+	stats := newStatsCollector(cfg.Capture == CaptureVerbose)
+	stats.metrics = cfg.MetricsInterval > 0
+	var rec *record.Recorder
+	var sampler *record.Sampler
+	var out *outage
+	var mir *mirror
+	if cfg.Capture != CaptureNone {
+		rt := &roundTripper{
+			stats:         stats,
+			rum:           cfg.RUM,
+			clientIPs:     clientIPs(cfg.ClientIPs),
+			latency:       cfg.Latency,
+			latencyJitter: cfg.LatencyJitter,
+			resetRatio:    cfg.ResetRatio,
+			outOfOrder:    cfg.OutOfOrderRatio,
+			droppedStats:  cfg.DroppedSpansStats,
+			compressSpans: cfg.CompressSpans,
+			otel:          cfg.OTelAttributes,
+			destinations:  cfg.CountDestinations,
+			outage:        newOutage(),
+			rand:          newLockedRand(cfg.Seed),
+		}
+		out = rt.outage
+		if cfg.ScriptFile != "" {
+			var feeds script.Feeds
+			if feeds, err = script.LoadFeeds(cfg.Feeds, cfg.SampleFeeds); err == nil {
+				rt.script, err = script.Load(cfg.ScriptFile, cfg.Seed, feeds)
+			}
+			if err != nil {
+				goTracer.Close()
+				return nil, err
 			}
-			tracer.TransportStats.Accepted += conv.AsUint64(m, "accepted")
-			tracer.TransportStats.NumRequests += 1
-			for _, i := range conv.AsSlice(m, "errors") {
-				e := conv.AsString(i, "message")
-				if !strcoll.Contains(e, tracer.TransportStats.TopErrors) {
-					tracer.TransportStats.TopErrors = append(tracer.TransportStats.TopErrors, e)
+		}
+		if cfg.MaxBytesPerSecond > 0 {
+			rt.limiter = &bandwidthLimiter{bps: cfg.MaxBytesPerSecond}
+		}
+		if cfg.RecordFile != "" {
+			var scrubber *record.Scrubber
+			if cfg.ScrubRules != "" {
+				if scrubber, err = record.LoadScrubber(cfg.ScrubRules); err != nil {
+					goTracer.Close()
+					return nil, err
 				}
 			}
-			rt.wg.Done()
+			if rec, err = record.New(cfg.RecordFile); err != nil {
+				goTracer.Close()
+				return nil, err
+			}
+			rec.Scrubber = scrubber
+			rt.recorder, rt.recordOnly = rec, cfg.RecordOnly
 		}
-	}()
-	return tracer
+		if cfg.MirrorUrl != "" && !cfg.RecordOnly {
+			if mir, err = newMirror(cfg.MirrorUrl, cfg.MirrorSecret, cfg.MirrorAPIKey, stats.verbose); err != nil {
+				goTracer.Close()
+				if rec != nil {
+					rec.Close()
+				}
+				return nil, err
+			}
+			rt.mirror = mir
+		}
+		if cfg.SentEventsFile != "" {
+			if sampler, err = record.NewSampler(cfg.SentEventsFile, cfg.SentEventsEvery, cfg.Seed); err != nil {
+				goTracer.Close()
+				if rec != nil {
+					rec.Close()
+				}
+				return nil, err
+			}
+			rt.sampler = sampler
+		}
+		transport.Client.Transport = rt
+	}
+
+	return &Tracer{
+		Tracer:       goTracer,
+		stats:        stats,
+		flushTimeout: cfg.FlushTimeout,
+		logger:       logger,
+		recorder:     rec,
+		sampler:      sampler,
+		outage:       out,
+		mirror:       mir,
+	}, nil
+}
+
+// envBreakdownMetrics is only read by the Go agent when creating a tracer, guarded by breakdownEnv.
+const envBreakdownMetrics = "ELASTIC_APM_BREAKDOWN_METRICS"
+
+var breakdownEnv sync.Mutex
+
+// newGoTracer returns a Go agent tracer created with opts, sending breakdown metrics if breakdown is true.
+func newGoTracer(opts apm.TracerOptions, breakdown bool) (*apm.Tracer, error) {
+	breakdownEnv.Lock()
+	defer breakdownEnv.Unlock()
+	prev, ok := os.LookupEnv(envBreakdownMetrics)
+	os.Setenv(envBreakdownMetrics, strconv.FormatBool(breakdown))
+	if ok {
+		defer os.Setenv(envBreakdownMetrics, prev)
+	} else {
+		defer os.Unsetenv(envBreakdownMetrics)
+	}
+	return apm.NewTracerOptions(opts)
 }
 
 type roundTripper struct {
-	c  chan []byte
-	wg sync.WaitGroup
+	// number of requests sent, to pick client IPs and user agents; first for 64 bit alignment
+	n          uint64
+	stats      *statsCollector
+	limiter    *bandwidthLimiter
+	rum        bool
+	clientIPs  []string
+	recorder   *record.Recorder
+	recordOnly bool
+	sampler    *record.Sampler
+	mirror     *mirror
+
+	latency, latencyJitter time.Duration
+	resetRatio             float64
+	rand                   *rand.Rand
+	outOfOrder             float64
+	droppedStats           bool
+	compressSpans          bool
+	otel                   bool
+	script                 *script.Script
+	destinations           bool
+	outage                 *outage
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -96,14 +356,128 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 		return http.DefaultTransport.RoundTrip(req)
 	}
 
-	q := req.URL.Query()
-	q.Set("verbose", "")
-	req.URL.RawQuery = q.Encode()
+	n := atomic.AddUint64(&rt.n, 1)
+	if rt.rum {
+		req.URL.Path = "/intake/v2/rum/events"
+		req.Header.Del("Authorization")
+		req.Header.Set("User-Agent", userAgents[n%uint64(len(userAgents))])
+	}
+	if len(rt.clientIPs) > 0 {
+		req.Header.Set("X-Forwarded-For", rt.clientIPs[n%uint64(len(rt.clientIPs))])
+	}
+	// the transport closes the body once sent, and so does this on errors before, so that rewriting stops
+	var sending bool
+	defer func() {
+		if !sending && req.Body != nil {
+			req.Body.Close()
+		}
+	}()
 
-	resp, err := http.DefaultTransport.RoundTrip(req)
+	var rewriters []rewriter
+	if rt.droppedStats {
+		rewriters = append(rewriters, eventRewriter(addDroppedSpansStats))
+	}
+	var spans *spanCompressor
+	if rt.compressSpans {
+		spans = &spanCompressor{}
+		rewriters = append(rewriters, spans)
+	}
+	if rt.otel {
+		rewriters = append(rewriters, eventRewriter(addOTelAttributes))
+	}
+	if rt.script != nil {
+		rewriters = append(rewriters, runScript(rt.script))
+	}
+	if rt.outOfOrder > 0 {
+		rewriters = append(rewriters, &eventShuffler{rand: rt.rand, ratio: rt.outOfOrder})
+	}
+	var destinations destinationCounter
+	if rt.destinations {
+		destinations = make(destinationCounter)
+		rewriters = append(rewriters, destinations)
+	}
+	rewritten, err := rewriteEvents(req, rewriters...)
 	if err != nil {
+		return nil, err
+	}
+	// bodies are sampled, recorded and mirrored as they are sent, rather than held back until read whole
+	var recorded int
+	if req.Body != nil && (rt.sampler != nil || rt.recorder != nil || rt.mirror != nil) {
+		tee := &teeReader{ReadCloser: req.Body}
+		req.Body = tee
+		if rt.sampler != nil {
+			tee.wholeBody(func(body []byte) error {
+				return rt.sampler.Sample(req.Header, body)
+			})
+		}
+		if rt.recorder != nil {
+			tee.wholeBody(func(body []byte) error {
+				var err error
+				recorded, err = rt.recorder.Record(req.Header, body)
+				return err
+			})
+		}
+		if rt.mirror != nil {
+			done, err := rt.mirror.send(req, tee.mirrorBody())
+			if err != nil {
+				return nil, err
+			}
+			// both apm-servers receive requests at the same pace
+			defer func() { <-done }()
+		}
+	}
+	if rt.stats.verbose {
+		q := req.URL.Query()
+		q.Set("verbose", "")
+		req.URL.RawQuery = q.Encode()
+	}
+	body := &countingReader{ReadCloser: req.Body}
+	if req.Body != nil {
+		req.Body = body
+		if rt.limiter != nil {
+			req.Body = limitedReader{body, rt.limiter}
+		}
+		if rt.resetRatio > 0 && rt.rand.Float64() < rt.resetRatio {
+			// reset the connection after sending at most 1KB
+			req.Body = &resetReader{req.Body, rt.rand.Int63n(1024)}
+		}
+	}
+
+	req, release := rt.outage.track(req)
+	sample := RequestSample{Timestamp: time.Now()}
+	if rt.latency > 0 || rt.latencyJitter > 0 {
+		time.Sleep(delay(rt.rand, rt.latency, rt.latencyJitter))
+	}
+	var resp *http.Response
+	sending = true
+	if rt.recordOnly {
+		// bodies are recorded once read whole
+		if req.Body != nil {
+			_, err = io.Copy(ioutil.Discard, req.Body)
+			req.Body.Close()
+		}
+		if err == nil {
+			resp = accepted(req, recorded)
+		}
+	} else {
+		resp, err = http.DefaultTransport.RoundTrip(req)
+	}
+	if err != nil {
+		release()
+		sample.Duration = time.Since(sample.Timestamp)
+		sample.BytesSent = atomic.LoadInt64(&body.n)
+		rt.stats.add(sample, nil)
+		return resp, err
+	}
+	if !rt.stats.verbose {
+		resp.Body = cancelOnClose{resp.Body, release}
+		sample.Duration = time.Since(sample.Timestamp)
+		sample.Status = resp.StatusCode
+		sample.BytesSent = atomic.LoadInt64(&body.n)
+		rt.stats.add(sample, nil)
 		return resp, err
 	}
+	defer release()
 	defer resp.Body.Close()
 
 	if resp.Body == http.NoBody {
@@ -112,10 +486,34 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	b, rerr := ioutil.ReadAll(resp.Body)
 	if rerr == nil {
-		rt.wg.Add(1)
-		rt.c <- b
+		sample.Duration = time.Since(sample.Timestamp)
+		sample.Status = resp.StatusCode
+		sample.BytesSent = atomic.LoadInt64(&body.n)
+		rt.stats.add(sample, b)
+		if (spans != nil || destinations != nil) && resp.StatusCode < 300 {
+			// the body was sent whole, rewriters are done with it
+			<-rewritten
+			if spans != nil && spans.merged > 0 {
+				rt.stats.addCompressed(spans.merged)
+			}
+			if len(destinations) > 0 {
+				rt.stats.addDestinations(destinations)
+			}
+		}
 		resp.Body = ioutil.NopCloser(bytes.NewReader(b))
 	}
 
 	return resp, err
 }
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
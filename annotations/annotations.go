@@ -0,0 +1,126 @@
+// Package annotations marks the time span of runs in external dashboards,
+// so that server-side metrics can be correlated with hey-apm runs.
+package annotations
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/types"
+)
+
+// Index is the Elasticsearch index where annotations are written to.
+const Index = "hey-bench-annotations"
+
+// Annotation describes a run.
+type Annotation struct {
+	RunId string
+	Time  time.Time
+	Text  string
+	Tags  []string
+	// run configuration
+	Input interface{}
+}
+
+// Sink records annotations.
+type Sink interface {
+	// Start records the start of a run, and returns a function to record its end.
+	Start(a Annotation) (stop func(end time.Time) error, err error)
+}
+
+// Grafana records annotations with the Grafana HTTP API, as regions spanning each run.
+type Grafana struct {
+	Url string
+	// API key or service account token, optional
+	Token string
+}
+
+func (g Grafana) Start(a Annotation) (func(time.Time) error, error) {
+	var created struct {
+		Id int64 `json:"id"`
+	}
+	err := g.do("POST", "/api/annotations", types.M{
+		"time": millis(a.Time),
+		"tags": a.Tags,
+		"text": a.Text,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return func(end time.Time) error {
+		return g.do("PATCH", fmt.Sprintf("/api/annotations/%d", created.Id), types.M{"timeEnd": millis(end)}, nil)
+	}, nil
+}
+
+func (g Grafana) do(method, path string, body interface{}, v interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(g.Url, "/")+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if g.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rb, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("grafana status not OK: %s %s", resp.Status, rb))
+	}
+	if v != nil {
+		return json.Unmarshal(rb, v)
+	}
+	return nil
+}
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Elasticsearch records annotations as documents in Index, one when a run starts and another when it stops.
+type Elasticsearch struct {
+	es.Connection
+}
+
+func (e Elasticsearch) Start(a Annotation) (func(time.Time) error, error) {
+	err := e.index(a, "start")
+	return func(end time.Time) error {
+		a.Time = end
+		return e.index(a, "stop")
+	}, err
+}
+
+func (e Elasticsearch) index(a Annotation, event string) error {
+	resp, err := e.Index(Index, esutil.NewJSONReader(types.M{
+		"@timestamp": a.Time,
+		"event":      event,
+		"run_id":     a.RunId,
+		"text":       a.Text,
+		"tags":       a.Tags,
+		"input":      a.Input,
+	}))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return errors.New(resp.String())
+	}
+	return nil
+}
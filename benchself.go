@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/worker"
+)
+
+const benchSelfUsage = `usage: hey-apm bench-self [options]
+
+Runs microbenchmarks of hey-apm itself on the current machine, and prints the highest rates it can achieve
+generating events, compressing them and dispatching requests, regardless of apm-server.
+Runs asking for more than these rates are limited by hey-apm: use more CPUs, -procs, or more hosts.
+
+options:
+`
+
+// benchSelfCommand runs the `bench-self` subcommand with the given arguments, and returns the exit code.
+func benchSelfCommand(args []string) int {
+	fs := flag.NewFlagSet("bench-self", flag.ExitOnError)
+	duration := fs.Duration("duration", 3*time.Second, "how long to run each microbenchmark")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), benchSelfUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *duration <= 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	fmt.Printf("%d CPUs, GOMAXPROCS %d\n", runtime.NumCPU(), runtime.GOMAXPROCS(0))
+	ceilings, err := worker.MeasureCeilings(*duration)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	metrics := strcoll.NewTuples()
+	for _, c := range ceilings {
+		metrics.Add(c.Component, c.String())
+	}
+	fmt.Println(metrics.Format(30))
+	return exitSuccess
+}
@@ -0,0 +1,28 @@
+// Package buildinfo describes the build of hey-apm, as set when linking it, eg.
+// go build -ldflags "-X github.com/elastic/hey-apm/buildinfo.Version=1.0.0 -X github.com/elastic/hey-apm/buildinfo.Commit=$(git rev-parse HEAD)"
+package buildinfo
+
+import (
+	"runtime"
+
+	"go.elastic.co/apm"
+)
+
+var (
+	// Version of hey-apm, "dev" if not set
+	Version = "dev"
+	// Commit SHA hey-apm was built from, empty if not set
+	Commit = ""
+	// Date hey-apm was built, as RFC3339, empty if not set
+	Date = ""
+)
+
+// GoVersion returns the version of Go hey-apm was built with.
+func GoVersion() string {
+	return runtime.Version()
+}
+
+// AgentVersion returns the version of the Go agent generating events, which affects what is sent and how.
+func AgentVersion() string {
+	return apm.AgentVersion
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/elastic/hey-apm/es"
+)
+
+const cleanupUsage = `usage: hey-apm cleanup -run-id <id> [options]
+
+Deletes the transactions, spans and errors generated by a run from the elasticsearch used by apm-server.
+Run Ids are the Ids of their reports.
+
+options:
+`
+
+// cleanupCommand runs the `cleanup` subcommand with the given arguments, and returns the exit code.
+func cleanupCommand(args []string) int {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	runId := fs.String("run-id", "", "Id of the run to delete documents of")
+	apmElasticsearchUrl := fs.String("apm-es-url", "http://localhost:9200", "elasticsearch output host for apm-server")
+	apmElasticsearchAuth := fs.String("apm-es-auth", "", "elasticsearch output username:password for apm-server")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), cleanupUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *runId == "" {
+		fs.Usage()
+		return exitError
+	}
+
+	conn, err := es.NewConnection(*apmElasticsearchUrl, *apmElasticsearchAuth)
+	if err == nil {
+		var deleted int64
+		if deleted, err = es.DeleteRun(conn, *runId); err == nil {
+			fmt.Printf("%d documents of run %s deleted\n", deleted, *runId)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	return exitSuccess
+}
@@ -0,0 +1,204 @@
+// Package cloud resolves Elastic Cloud deployments with the Elastic Cloud API.
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+// DefaultApiUrl is the URL of the Elastic Cloud API.
+const DefaultApiUrl = "https://api.elastic-cloud.com"
+
+// Deployment is an Elastic Cloud deployment as described by the Elastic Cloud API, trimmed to what hey-apm uses.
+// APM Server runs as a standalone resource up to 7.x, and within the Integrations Server since 8.0.
+type Deployment struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// whether all of its resources are up and running
+	Healthy   bool `json:"healthy"`
+	Resources struct {
+		Elasticsearch      []resource `json:"elasticsearch"`
+		Apm                []resource `json:"apm"`
+		IntegrationsServer []resource `json:"integrations_server"`
+	} `json:"resources"`
+}
+
+type resource struct {
+	Region string `json:"region"`
+	Info   struct {
+		// eg. initializing, started or stopped
+		Status   string `json:"status"`
+		Metadata struct {
+			ServiceUrl   string `json:"service_url"`
+			ServicesUrls []struct {
+				Service string `json:"service"`
+				Url     string `json:"url"`
+			} `json:"services_urls"`
+		} `json:"metadata"`
+		PlanInfo struct {
+			Current struct {
+				Plan plan `json:"plan"`
+			} `json:"current"`
+		} `json:"plan_info"`
+	} `json:"info"`
+}
+
+type plan struct {
+	ClusterTopology []struct {
+		Id        string `json:"id"`
+		ZoneCount int    `json:"zone_count"`
+		// memory per instance, in MB
+		Size struct {
+			Value int `json:"value"`
+		} `json:"size"`
+	} `json:"cluster_topology"`
+	Elasticsearch struct {
+		Version string `json:"version"`
+	} `json:"elasticsearch"`
+}
+
+// GetDeployment queries the Elastic Cloud API at apiUrl for the deployment with the given Id, along with its
+// current plan. apiKey is an Elastic Cloud API key, not an Elasticsearch or APM one.
+func GetDeployment(apiUrl, apiKey, id string) (Deployment, error) {
+	var d Deployment
+	err := call("GET", apiUrl, "/api/v1/deployments/"+url.PathEscape(id)+"?show_plans=true", apiKey, nil, &d)
+	return d, err
+}
+
+// Ready returns whether all resources of the deployment are healthy and started, and their urls known.
+func (d Deployment) Ready() bool {
+	if !d.Healthy {
+		return false
+	}
+	var resources []resource
+	resources = append(resources, d.Resources.Elasticsearch...)
+	resources = append(resources, d.Resources.Apm...)
+	resources = append(resources, d.Resources.IntegrationsServer...)
+	for _, r := range resources {
+		if r.Info.Status != "started" {
+			return false
+		}
+	}
+	_, aerr := d.ApmUrl()
+	_, eerr := d.ElasticsearchUrl()
+	return aerr == nil && eerr == nil
+}
+
+// call sends a request with the given JSON body, if any, to the Elastic Cloud API and decodes its response
+// into parsed, if not nil.
+func call(method, apiUrl, path, apiKey string, body []byte, parsed interface{}) error {
+	req, err := http.NewRequest(method, strings.TrimSuffix(apiUrl, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "ApiKey "+apiKey)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rb, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("elastic cloud API %s %s: %s %s", method, path, resp.Status, rb)
+	}
+	if parsed == nil {
+		return nil
+	}
+	return json.Unmarshal(rb, parsed)
+}
+
+// ApmUrl returns the URL of the APM Server of the deployment, or an error if it has none.
+func (d Deployment) ApmUrl() (string, error) {
+	for _, r := range d.Resources.IntegrationsServer {
+		for _, s := range r.Info.Metadata.ServicesUrls {
+			if s.Service == "apm" && s.Url != "" {
+				return s.Url, nil
+			}
+		}
+	}
+	for _, r := range d.Resources.Apm {
+		if r.Info.Metadata.ServiceUrl != "" {
+			return r.Info.Metadata.ServiceUrl, nil
+		}
+	}
+	return "", errors.New("elastic cloud deployment " + d.Id + " has no APM")
+}
+
+// ElasticsearchUrl returns the URL of the Elasticsearch cluster of the deployment, or an error if it has none.
+func (d Deployment) ElasticsearchUrl() (string, error) {
+	for _, r := range d.Resources.Elasticsearch {
+		if r.Info.Metadata.ServiceUrl != "" {
+			return r.Info.Metadata.ServiceUrl, nil
+		}
+	}
+	return "", errors.New("elastic cloud deployment " + d.Id + " has no Elasticsearch")
+}
+
+// Summary returns the size and plan of the deployment, to tag reports with.
+func (d Deployment) Summary() models.CloudDeployment {
+	summary := models.CloudDeployment{Id: d.Id, Name: d.Name}
+	apm := d.Resources.IntegrationsServer
+	if len(apm) == 0 {
+		apm = d.Resources.Apm
+	}
+	if len(apm) > 0 {
+		summary.ApmSize = apm[0].Info.PlanInfo.Current.Plan.size()
+		summary.MemoryGB += apm[0].Info.PlanInfo.Current.Plan.memoryGB()
+	}
+	if len(d.Resources.Elasticsearch) > 0 {
+		es := d.Resources.Elasticsearch[0]
+		summary.Region = es.Region
+		summary.Version = es.Info.PlanInfo.Current.Plan.Elasticsearch.Version
+		summary.ElasticsearchSize = es.Info.PlanInfo.Current.Plan.size()
+		summary.MemoryGB += es.Info.PlanInfo.Current.Plan.memoryGB()
+	}
+	return summary
+}
+
+// size describes the instances of a plan, eg. "hot_content 8GB x 2 zones", skipping tiers with no instances.
+func (p plan) size() string {
+	var tiers []string
+	for _, t := range p.ClusterTopology {
+		if t.Size.Value == 0 || t.ZoneCount == 0 {
+			continue
+		}
+		tier := fmt.Sprintf("%s x %d zones", memory(t.Size.Value), t.ZoneCount)
+		if t.ZoneCount == 1 {
+			tier = memory(t.Size.Value) + " x 1 zone"
+		}
+		if t.Id != "" && len(p.ClusterTopology) > 1 {
+			tier = t.Id + " " + tier
+		}
+		tiers = append(tiers, tier)
+	}
+	return strings.Join(tiers, ", ")
+}
+
+// memoryGB returns the memory of all the instances of a plan, in all zones, in GB.
+func (p plan) memoryGB() float64 {
+	var mb int
+	for _, t := range p.ClusterTopology {
+		mb += t.Size.Value * t.ZoneCount
+	}
+	return float64(mb) / 1024
+}
+
+// memory formats a size in MB, as given by the Elastic Cloud API.
+func memory(mb int) string {
+	if mb%1024 == 0 {
+		return fmt.Sprintf("%dGB", mb/1024)
+	}
+	return fmt.Sprintf("%dMB", mb)
+}
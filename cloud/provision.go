@@ -0,0 +1,92 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/elastic/hey-apm/types"
+)
+
+// readyPollInterval is the interval at which a new deployment is polled until it is ready.
+const readyPollInterval = 15 * time.Second
+
+// Credentials of a deployment, only given by the Elastic Cloud API when creating it.
+type Credentials struct {
+	// <username:password> of the elastic superuser
+	ElasticsearchAuth string
+	// secret token of APM Server, empty if it isn't enabled
+	ApmSecret string
+}
+
+// CreateDeployment creates a deployment with the Elastic Cloud API at apiUrl, as described by request
+// (the JSON body of a create deployment request, as shown by the Elastic Cloud console), and returns its Id
+// and credentials. Deployments are named hey-apm-<timestamp> unless the request names them.
+func CreateDeployment(apiUrl, apiKey string, request []byte) (string, Credentials, error) {
+	var credentials Credentials
+	var body types.M
+	if err := json.Unmarshal(request, &body); err != nil {
+		return "", credentials, fmt.Errorf("invalid create deployment request: %s", err)
+	}
+	if _, ok := body["name"]; !ok {
+		body["name"] = fmt.Sprintf("hey-apm-%d", time.Now().Unix())
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return "", credentials, err
+	}
+
+	var created struct {
+		Id        string `json:"id"`
+		Resources []struct {
+			Kind        string `json:"kind"`
+			SecretToken string `json:"secret_token"`
+			Credentials *struct {
+				Username string `json:"username"`
+				Password string `json:"password"`
+			} `json:"credentials"`
+		} `json:"resources"`
+	}
+	if err := call("POST", apiUrl, "/api/v1/deployments", apiKey, b, &created); err != nil {
+		return "", credentials, err
+	}
+	if created.Id == "" {
+		return "", credentials, errors.New("elastic cloud API didn't return the Id of the new deployment")
+	}
+	for _, r := range created.Resources {
+		if r.Kind == "elasticsearch" && r.Credentials != nil {
+			credentials.ElasticsearchAuth = r.Credentials.Username + ":" + r.Credentials.Password
+		}
+		if (r.Kind == "apm" || r.Kind == "integrations_server") && r.SecretToken != "" {
+			credentials.ApmSecret = r.SecretToken
+		}
+	}
+	return created.Id, credentials, nil
+}
+
+// WaitReady polls a deployment until it is ready, and returns it, or an error if it isn't ready after timeout.
+func WaitReady(apiUrl, apiKey, id string, timeout time.Duration) (Deployment, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		d, err := GetDeployment(apiUrl, apiKey, id)
+		if err != nil {
+			return d, err
+		}
+		if d.Ready() {
+			return d, nil
+		}
+		if !deadline.After(time.Now()) {
+			return d, fmt.Errorf("elastic cloud deployment %s not ready after %s", id, timeout)
+		}
+		time.Sleep(readyPollInterval)
+	}
+}
+
+// ShutdownDeployment shuts down a deployment and all its resources, without taking a snapshot.
+// Shut down deployments are not billed, and are deleted by Elastic Cloud after a while.
+func ShutdownDeployment(apiUrl, apiKey, id string) error {
+	return call("POST", apiUrl, "/api/v1/deployments/"+url.PathEscape(id)+"/_shutdown?skip_snapshot=true",
+		apiKey, []byte("{}"), nil)
+}
@@ -1,6 +1,7 @@
 package conv
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -31,6 +32,34 @@ func ByteCountDecimal(z int64) string {
 	return fmt.Sprintf("%s%.1f%cb", neg, float64(n)/float64(div), "kMGTPE"[exp])
 }
 
+// EncodeAPIKey returns an API key as sent in Authorization headers.
+// Keys given as id:key, as returned by the Elasticsearch create API key API, are base64 encoded,
+// and already encoded keys are returned as is.
+func EncodeAPIKey(key string) string {
+	if !strings.Contains(key, ":") {
+		return key
+	}
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// ParseByteCount parses human readable byte sizes like 50MB or 1.5kb, with decimal units.
+func ParseByteCount(raw string) (int64, error) {
+	s := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(raw)), "b")
+	var mult float64 = 1
+	if n := len(s); n > 0 {
+		if exp := strings.IndexByte("kmgtpe", s[n-1]); exp >= 0 {
+			mult = math.Pow(1000, float64(exp+1))
+			s = s[:n-1]
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	// NaN and values beyond int64 too, as their conversion is undefined
+	if err != nil || !(f >= 0 && f*mult < math.MaxInt64) {
+		return 0, fmt.Errorf("invalid byte count %q", raw)
+	}
+	return int64(f * mult), nil
+}
+
 // ToMap transforms a marshallable interface into a JSON-like map.
 func ToMap(i interface{}) types.M {
 	m := make(types.M)
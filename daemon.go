@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/elastic/hey-apm/daemon"
+	"github.com/elastic/hey-apm/models"
+)
+
+// daemonCommand runs the `daemon` subcommand with the given arguments, and returns the exit code.
+// The daemon takes the same flags as a run, which are the defaults for runs submitted to it.
+func daemonCommand(args []string) int {
+	listen := flag.String("listen", "localhost:8234", "address to serve the daemon API on")
+	retention := flag.Duration("retention", 0, "forget finished runs and remove their reports from -reports-dir "+
+		"after this time (disabled by default)")
+	os.Args = append(os.Args[:1], args...)
+	base := parseFlags()
+	if base.IsBenchmark || base.Iterations > 1 || len(base.Targets) > 0 {
+		fmt.Fprintln(os.Stderr, "-bench, -iterations and -target are not supported in daemon mode")
+		return exitError
+	}
+	setAgentEnv(base)
+
+	logger := log.New(os.Stderr, "[daemon] ", log.Ldate|log.Ltime)
+	server := daemon.NewServer(logger, func(options string) (models.Input, error) {
+		if options == "" {
+			return base, nil
+		}
+		return parseTarget(base, options)
+	})
+	server.Retention = *retention
+	logger.Printf("listening on %s", *listen)
+	if err := http.ListenAndServe(*listen, server.Handler()); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	return exitSuccess
+}
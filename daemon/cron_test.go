@@ -0,0 +1,77 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCronNext(t *testing.T) {
+	// a Monday
+	from := time.Date(2024, 1, 1, 0, 7, 0, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+	for _, tc := range []struct {
+		expr string
+		next time.Time
+	}{
+		{"* * * * *", at(1, 1, 0, 8)},
+		{"*/15 * * * *", at(1, 1, 0, 15)},
+		{"5/20 * * * *", at(1, 1, 0, 25)},
+		{"0,30 * * * *", at(1, 1, 0, 30)},
+		{"0 9-17 * * *", at(1, 1, 9, 0)},
+		{"0 9-17/4 * * *", at(1, 1, 9, 0)},
+		{"0 0 15 * *", at(1, 15, 0, 0)},
+		{"0 0 1 3 *", at(3, 1, 0, 0)},
+		{"0 0 * * 0", at(1, 7, 0, 0)},
+		// sunday as 7
+		{"0 0 * * 7", at(1, 7, 0, 0)},
+		{"0 0 * * 5-7", at(1, 5, 0, 0)},
+		// either the 4th or a friday
+		{"0 0 4 * 5", at(1, 4, 0, 0)},
+		{"0 0 13 * 5", at(1, 5, 0, 0)},
+		// odd days that are also mondays, as */2 doesn't restrict days on its own
+		{"0 0 */2 * 1", at(1, 15, 0, 0)},
+		{"0 0 * * */3", at(1, 3, 0, 0)},
+		{"@hourly", at(1, 1, 1, 0)},
+		{"@daily", at(1, 2, 0, 0)},
+		{"@midnight", at(1, 2, 0, 0)},
+		{"@weekly", at(1, 7, 0, 0)},
+		{"@monthly", at(2, 1, 0, 0)},
+		// leap day
+		{"0 0 29 2 *", at(2, 29, 0, 0)},
+		// never
+		{"0 0 30 2 *", time.Time{}},
+		{"0 0 31 4,6,9,11 *", time.Time{}},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			c, err := ParseCron(tc.expr)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.next, c.Next(from))
+		})
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"@yearly",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	} {
+		_, err := ParseCron(expr)
+		assert.Error(t, err, expr)
+	}
+}
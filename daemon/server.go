@@ -0,0 +1,589 @@
+// Package daemon exposes an HTTP API to start, stop and schedule runs remotely, follow their progress,
+// and fetch their reports.
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/reports"
+	"github.com/elastic/hey-apm/worker"
+)
+
+const progressInterval = time.Second
+
+// Status of a run
+type Status string
+
+const (
+	Scheduled Status = "scheduled"
+	Running   Status = "running"
+	Succeeded Status = "succeeded"
+	Failed    Status = "failed"
+	Cancelled Status = "cancelled"
+)
+
+// Progress summarizes the events generated and sent so far by a run.
+type Progress struct {
+	Elapsed        float64 `json:"elapsed"`
+	Requests       uint64  `json:"requests"`
+	EventsSent     uint64  `json:"events_sent"`
+	EventsDropped  uint64  `json:"events_dropped"`
+	EventsAccepted uint64  `json:"events_accepted"`
+	EventsRejected uint64  `json:"events_rejected"`
+}
+
+func newProgress(r worker.Result) Progress {
+	return Progress{
+		Elapsed:        r.ElapsedSeconds(),
+		Requests:       r.NumRequests,
+		EventsSent:     r.EventsSent(),
+		EventsDropped:  r.TransactionsDropped + r.SpansDropped + r.ErrorsDropped,
+		EventsAccepted: r.Accepted,
+		EventsRejected: r.Rejected,
+	}
+}
+
+// Run is a run submitted to the daemon.
+type Run struct {
+	Id       string         `json:"id"`
+	Options  string         `json:"options,omitempty"`
+	Status   Status         `json:"status"`
+	StartAt  time.Time      `json:"start_at"`
+	Started  *time.Time     `json:"started,omitempty"`
+	Ended    *time.Time     `json:"ended,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Progress *Progress      `json:"progress,omitempty"`
+	Report   *models.Report `json:"report,omitempty"`
+
+	input  models.Input
+	cancel context.CancelFunc
+}
+
+func (r *Run) done() bool {
+	return r.Status == Succeeded || r.Status == Failed || r.Status == Cancelled
+}
+
+// Request is the body of a request to submit a run.
+type Request struct {
+	// Options override those the daemon was started with, as comma separated key=value pairs,
+	// in the same format as -target.
+	Options string `json:"options"`
+	// StartAt schedules the run to start at the given time, rather than right away.
+	StartAt time.Time `json:"start_at"`
+}
+
+// Schedule submits runs periodically, as given by a cron expression.
+type Schedule struct {
+	Id      string    `json:"id"`
+	Cron    string    `json:"cron"`
+	Options string    `json:"options,omitempty"`
+	Next    time.Time `json:"next"`
+	// Ids of the runs submitted so far, oldest first
+	Runs []string `json:"runs"`
+
+	cron   Cron
+	cancel context.CancelFunc
+}
+
+// ScheduleRequest is the body of a request to schedule recurring runs.
+type ScheduleRequest struct {
+	// Cron is a cron expression, as accepted by ParseCron.
+	Cron string `json:"cron"`
+	// Options are the same as for a single run.
+	Options string `json:"options"`
+}
+
+// Server runs benchmarks submitted through its HTTP API, one at a time.
+type Server struct {
+	// Retention is how long finished runs are kept, along with their reports saved with -reports-dir.
+	// Zero keeps them forever.
+	Retention time.Duration
+
+	// parse returns the input for a run with the given options
+	parse  func(options string) (models.Input, error)
+	logger *log.Logger
+
+	mu             sync.Mutex
+	runs           map[string]*Run
+	nextId         int
+	schedules      map[string]*Schedule
+	nextScheduleId int
+	// held by the run in progress
+	running chan struct{}
+}
+
+// NewServer returns a server that creates the input of each run with parse.
+func NewServer(logger *log.Logger, parse func(options string) (models.Input, error)) *Server {
+	return &Server{
+		parse:     parse,
+		logger:    logger,
+		runs:      make(map[string]*Run),
+		schedules: make(map[string]*Schedule),
+		running:   make(chan struct{}, 1),
+	}
+}
+
+// Handler returns the HTTP handler serving the API:
+//
+//	POST   /runs                 submits a run, as described by a Request
+//	GET    /runs                 lists all the runs
+//	GET    /runs/{id}            returns a run, including its report when done
+//	DELETE /runs/{id}            cancels a scheduled run, or stops a running one
+//	GET    /runs/{id}/progress   streams the run as newline delimited JSON every second, until it is done
+//	GET    /runs/{id}/report     returns the report of a run
+//	POST   /schedules            schedules recurring runs, as described by a ScheduleRequest
+//	GET    /schedules            lists all the schedules
+//	GET    /schedules/{id}       returns a schedule
+//	DELETE /schedules/{id}       stops submitting runs for a schedule
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/runs", s.handleRuns)
+	mux.HandleFunc("/runs/", s.handleRun)
+	mux.HandleFunc("/schedules", s.handleSchedules)
+	mux.HandleFunc("/schedules/", s.handleSchedule)
+	return mux
+}
+
+func (s *Server) handleRuns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.list())
+	case http.MethodPost:
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		run, err := s.Submit(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, run)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleRun(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/runs/"), "/")
+	id, sub := parts[0], ""
+	if len(parts) > 2 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s not found", r.URL.Path))
+		return
+	} else if len(parts) == 2 {
+		sub = parts[1]
+	}
+	if _, ok := s.get(id); !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run %q not found", id))
+		return
+	}
+
+	switch {
+	case sub == "" && r.Method == http.MethodGet:
+		run, _ := s.get(id)
+		writeJSON(w, http.StatusOK, run)
+	case sub == "" && r.Method == http.MethodDelete:
+		run, err := s.Cancel(id)
+		if err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, run)
+	case sub == "progress" && r.Method == http.MethodGet:
+		s.streamProgress(w, r, id)
+	case sub == "report" && r.Method == http.MethodGet:
+		run, _ := s.get(id)
+		if run.Report == nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("run %q has no report (%s)", id, run.Status))
+			return
+		}
+		writeJSON(w, http.StatusOK, run.Report)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("%s %s not found", r.Method, r.URL.Path))
+	}
+}
+
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.listSchedules())
+	case http.MethodPost:
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		sched, err := s.AddSchedule(req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, sched)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/schedules/")
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		sched, ok := s.schedules[id]
+		var ret Schedule
+		if ok {
+			ret = sched.copy()
+		}
+		s.mu.Unlock()
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("schedule %q not found", id))
+			return
+		}
+		writeJSON(w, http.StatusOK, ret)
+	case http.MethodDelete:
+		sched, err := s.RemoveSchedule(id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, sched)
+	default:
+		w.Header().Set("Allow", "GET, DELETE")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+	}
+}
+
+// streamProgress writes a run every progressInterval until it is done, it is pruned, or the client goes away.
+func (s *Server) streamProgress(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	enc := json.NewEncoder(w)
+	for {
+		run, ok := s.get(id)
+		if !ok {
+			return
+		}
+		if err := enc.Encode(run); err != nil || run.done() {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Submit validates and schedules a run.
+func (s *Server) Submit(req Request) (Run, error) {
+	input, err := s.parse(req.Options)
+	if err != nil {
+		return Run{}, err
+	}
+	if err := worker.Validate(input); err != nil {
+		return Run{}, err
+	}
+	if req.StartAt.IsZero() {
+		req.StartAt = time.Now()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.nextId++
+	// every run sends events of its own, rather than the same Ids as the previous ones
+	input = input.Reseed(fmt.Sprintf("run %d", s.nextId))
+	run := &Run{
+		Id:      fmt.Sprintf("%d", s.nextId),
+		Options: req.Options,
+		Status:  Scheduled,
+		StartAt: req.StartAt,
+		input:   input,
+		cancel:  cancel,
+	}
+	s.runs[run.Id] = run
+	ret := *run
+	s.mu.Unlock()
+
+	s.logger.Printf("run %s scheduled at %s", run.Id, run.StartAt.Format(time.RFC3339))
+	go s.execute(ctx, run)
+	return ret, nil
+}
+
+// Cancel stops a run, or prevents it from starting if it is scheduled.
+func (s *Server) Cancel(id string) (Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return Run{}, fmt.Errorf("run %q not found", id)
+	}
+	if run.done() {
+		return *run, fmt.Errorf("run %q is already %s", id, run.Status)
+	}
+	run.cancel()
+	return *run, nil
+}
+
+// AddSchedule validates a schedule and starts submitting its runs.
+func (s *Server) AddSchedule(req ScheduleRequest) (Schedule, error) {
+	cron, err := ParseCron(req.Cron)
+	if err != nil {
+		return Schedule{}, err
+	}
+	input, err := s.parse(req.Options)
+	if err != nil {
+		return Schedule{}, err
+	}
+	if err := worker.Validate(input); err != nil {
+		return Schedule{}, err
+	}
+	next := cron.Next(time.Now())
+	if next.IsZero() {
+		return Schedule{}, fmt.Errorf("cron expression %q never matches", req.Cron)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.nextScheduleId++
+	sched := &Schedule{
+		Id:      fmt.Sprintf("%d", s.nextScheduleId),
+		Cron:    req.Cron,
+		Options: req.Options,
+		Next:    next,
+		cron:    cron,
+		cancel:  cancel,
+	}
+	s.schedules[sched.Id] = sched
+	ret := sched.copy()
+	s.mu.Unlock()
+
+	s.logger.Printf("schedule %s added, next run at %s", sched.Id, next.Format(time.RFC3339))
+	go s.repeat(ctx, sched)
+	return ret, nil
+}
+
+// RemoveSchedule stops submitting runs for a schedule. Runs already submitted are not affected.
+func (s *Server) RemoveSchedule(id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sched, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, fmt.Errorf("schedule %q not found", id)
+	}
+	sched.cancel()
+	delete(s.schedules, id)
+	return sched.copy(), nil
+}
+
+// repeat submits a run each time the schedule is due, until ctx is done.
+// Runs due while the previous one still waits to start, eg. behind a long run, are coalesced into it
+// rather than queued one after another.
+func (s *Server) repeat(ctx context.Context, sched *Schedule) {
+	for {
+		s.mu.Lock()
+		next := sched.Next
+		s.mu.Unlock()
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			s.logger.Printf("schedule %s removed", sched.Id)
+			return
+		case <-timer.C:
+		}
+
+		if pending, ok := s.pending(sched); ok {
+			s.logger.Printf("schedule %s: run %s has not started yet, skipping the run due at %s",
+				sched.Id, pending, next.Format(time.RFC3339))
+			s.mu.Lock()
+		} else {
+			run, err := s.Submit(Request{Options: sched.Options, StartAt: next})
+			s.mu.Lock()
+			if err != nil {
+				s.logger.Printf("schedule %s: %s", sched.Id, err.Error())
+			} else {
+				sched.Runs = append(sched.Runs, run.Id)
+			}
+		}
+		sched.Next = sched.cron.Next(time.Now())
+		s.mu.Unlock()
+		if sched.Next.IsZero() {
+			return
+		}
+	}
+}
+
+// pending returns the Id of the last run submitted for a schedule if it has not started yet.
+func (s *Server) pending(sched *Schedule) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(sched.Runs) == 0 {
+		return "", false
+	}
+	id := sched.Runs[len(sched.Runs)-1]
+	run, ok := s.runs[id]
+	return id, ok && run.Status == Scheduled
+}
+
+func (sched *Schedule) copy() Schedule {
+	ret := *sched
+	ret.Runs = append([]string{}, sched.Runs...)
+	return ret
+}
+
+// execute waits until the run is due and no other run is in progress, and then runs it.
+func (s *Server) execute(ctx context.Context, run *Run) {
+	defer run.cancel()
+	timer := time.NewTimer(time.Until(run.StartAt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		s.finish(run, models.Report{}, ctx.Err())
+		return
+	case <-timer.C:
+	}
+	select {
+	case <-ctx.Done():
+		s.finish(run, models.Report{}, ctx.Err())
+		return
+	case s.running <- struct{}{}:
+	}
+	defer func() { <-s.running }()
+
+	s.mu.Lock()
+	started := time.Now()
+	run.Started = &started
+	run.Status = Running
+	s.mu.Unlock()
+	s.logger.Printf("run %s started", run.Id)
+
+	report, err := worker.RunWithProgress(ctx, run.input, func(result worker.Result) {
+		progress := newProgress(result)
+		s.mu.Lock()
+		run.Progress = &progress
+		s.mu.Unlock()
+	})
+	s.finish(run, report, err)
+}
+
+func (s *Server) finish(run *Run, report models.Report, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ended := time.Now()
+	run.Ended = &ended
+	switch {
+	case err == context.Canceled:
+		run.Status = Cancelled
+	case err != nil:
+		run.Status = Failed
+		run.Error = err.Error()
+	default:
+		run.Status = Succeeded
+	}
+	if report.ReportId != "" {
+		run.Report = &report
+	}
+	s.logger.Printf("run %s %s", run.Id, run.Status)
+	if s.Retention > 0 {
+		s.prune(ended.Add(-s.Retention), run.input.ReportsDir)
+	}
+}
+
+// prune forgets the runs that ended before the given time, and removes their reports from dir, if any.
+// It must be called with s.mu held.
+func (s *Server) prune(before time.Time, dir string) {
+	for id, run := range s.runs {
+		if run.done() && run.Ended.Before(before) {
+			delete(s.runs, id)
+		}
+	}
+	for _, sched := range s.schedules {
+		var kept []string
+		for _, id := range sched.Runs {
+			if _, ok := s.runs[id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		sched.Runs = kept
+	}
+	if dir == "" {
+		return
+	}
+	if n, err := reports.Dir(dir).Prune(before); err != nil {
+		s.logger.Println(err.Error())
+	} else if n > 0 {
+		s.logger.Printf("%d reports older than %s removed from %s", n, s.Retention, dir)
+	}
+}
+
+func (s *Server) get(id string) (Run, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return Run{}, false
+	}
+	return *run, true
+}
+
+// listSchedules returns all the schedules, in creation order.
+func (s *Server) listSchedules() []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scheds := make([]Schedule, 0, len(s.schedules))
+	for _, sched := range s.schedules {
+		scheds = append(scheds, sched.copy())
+	}
+	sort.Slice(scheds, func(i, j int) bool {
+		return byId(scheds[i].Id, scheds[j].Id)
+	})
+	return scheds
+}
+
+// list returns all the runs, without their reports, in submission order.
+func (s *Server) list() []Run {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := make([]Run, 0, len(s.runs))
+	for _, run := range s.runs {
+		r := *run
+		r.Report = nil
+		runs = append(runs, r)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return byId(runs[i].Id, runs[j].Id)
+	})
+	return runs
+}
+
+// byId orders sequential Ids.
+func byId(id1, id2 string) bool {
+	return len(id1) < len(id2) || len(id1) == len(id2) && id1 < id2
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
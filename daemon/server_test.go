@@ -0,0 +1,168 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// newApmServer returns a server accepting all intake requests, and answering any other with an empty object.
+func newApmServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(ioutil.Discard, r.Body)
+		if strings.HasPrefix(r.URL.Path, "/intake/") {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+}
+
+func newTestServer(t *testing.T) (*Server, *httptest.Server) {
+	apm := newApmServer()
+	t.Cleanup(apm.Close)
+	s := NewServer(log.New(ioutil.Discard, "", 0), func(options string) (models.Input, error) {
+		return models.Input{
+			ApmServerUrl:         apm.URL,
+			ApmElasticsearchUrl:  apm.URL,
+			ServiceName:          "hey-service",
+			RunTimeout:           500 * time.Millisecond,
+			FlushTimeout:         time.Second,
+			TransactionLimit:     10,
+			TransactionFrequency: 10 * time.Millisecond,
+		}, nil
+	})
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+// do sends a request to the daemon, expecting a response with the given status, and decodes its body into v if not nil.
+func do(t *testing.T, method, url, body string, status int, v interface{}) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if !assert.Equal(t, status, resp.StatusCode, "%s %s", method, url) {
+		t.FailNow()
+	}
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// progress returns the runs streamed until the stream ends, or ctx is done.
+func progress(ctx context.Context, url string) ([]Run, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var runs []Run
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var run Run
+		if err := json.Unmarshal(scanner.Bytes(), &run); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
+
+func TestServer(t *testing.T) {
+	_, srv := newTestServer(t)
+
+	var run Run
+	do(t, http.MethodPost, srv.URL+"/runs", `{}`, http.StatusAccepted, &run)
+	assert.Equal(t, "1", run.Id)
+
+	runs, err := progress(context.Background(), srv.URL+"/runs/1/progress")
+	if err != nil || len(runs) == 0 {
+		t.Fatal(runs, err)
+	}
+	last := runs[len(runs)-1]
+	assert.Equal(t, Succeeded, last.Status, last.Error)
+	assert.NotNil(t, last.Report)
+
+	var report models.Report
+	do(t, http.MethodGet, srv.URL+"/runs/1/report", "", http.StatusOK, &report)
+	assert.NotEmpty(t, report.ReportId)
+	assert.Equal(t, uint64(10), report.TransactionsSent)
+
+	// scheduled, and cancelled before it starts
+	do(t, http.MethodPost, srv.URL+"/runs", `{"start_at": "2100-01-01T00:00:00Z"}`, http.StatusAccepted, &run)
+	assert.Equal(t, Scheduled, run.Status)
+	do(t, http.MethodDelete, srv.URL+"/runs/2", "", http.StatusOK, nil)
+	runs, err = progress(context.Background(), srv.URL+"/runs/2/progress")
+	if err != nil || len(runs) == 0 {
+		t.Fatal(runs, err)
+	}
+	assert.Equal(t, Cancelled, runs[len(runs)-1].Status)
+	do(t, http.MethodGet, srv.URL+"/runs/2/report", "", http.StatusNotFound, nil)
+	do(t, http.MethodDelete, srv.URL+"/runs/2", "", http.StatusConflict, nil)
+
+	do(t, http.MethodGet, srv.URL+"/runs/3", "", http.StatusNotFound, nil)
+	var list []Run
+	do(t, http.MethodGet, srv.URL+"/runs", "", http.StatusOK, &list)
+	assert.Len(t, list, 2)
+}
+
+func TestProgressPruned(t *testing.T) {
+	s, srv := newTestServer(t)
+
+	var run Run
+	do(t, http.MethodPost, srv.URL+"/runs", `{"start_at": "2100-01-01T00:00:00Z"}`, http.StatusAccepted, &run)
+	go func() {
+		time.Sleep(progressInterval / 2)
+		s.mu.Lock()
+		delete(s.runs, run.Id)
+		s.mu.Unlock()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*progressInterval)
+	defer cancel()
+	runs, err := progress(ctx, srv.URL+"/runs/"+run.Id+"/progress")
+	assert.NoError(t, err, "progress not stopped after the run was pruned")
+	assert.Len(t, runs, 1)
+}
+
+func TestPending(t *testing.T) {
+	s := NewServer(log.New(ioutil.Discard, "", 0), func(string) (models.Input, error) { return models.Input{}, nil })
+	sched := &Schedule{Id: "1"}
+	_, ok := s.pending(sched)
+	assert.False(t, ok)
+
+	s.runs["1"] = &Run{Id: "1", Status: Succeeded}
+	s.runs["2"] = &Run{Id: "2", Status: Scheduled}
+	sched.Runs = []string{"1", "2"}
+	id, ok := s.pending(sched)
+	assert.True(t, ok)
+	assert.Equal(t, "2", id)
+
+	s.runs["2"].Status = Running
+	_, ok = s.pending(sched)
+	assert.False(t, ok)
+}
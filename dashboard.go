@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/elastic/hey-apm/kibana"
+)
+
+const dashboardUsage = `usage: hey-apm dashboard [options]
+
+Installs in Kibana an index pattern for the reports indexed with -es-url, and a dashboard
+with their throughput, drops and latency over time, and throughput per apm-server version.
+Existing objects with the same Ids are overwritten.
+
+options:
+`
+
+// dashboardCommand runs the `dashboard` subcommand with the given arguments, and returns the exit code.
+func dashboardCommand(args []string) int {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	kibanaUrl := fs.String("kibana-url", "http://localhost:5601", "kibana url, including the space path if any")
+	kibanaAuth := fs.String("kibana-auth", "", "kibana username:password")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), dashboardUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := kibana.InstallDashboard(*kibanaUrl, *kibanaAuth); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	fmt.Printf("dashboard installed: %s/app/kibana#/dashboard/%s\n", strings.TrimSuffix(*kibanaUrl, "/"), kibana.DashboardId)
+	return exitSuccess
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/presets"
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/worker"
+)
+
+const describeUsage = `usage: hey-apm describe [flags]   prints the configuration resolved from the given flags
+       hey-apm describe presets   lists the built-in presets
+`
+
+// describeCommand runs the `describe` subcommand with the given arguments, and returns the exit code.
+func describeCommand(args []string) int {
+	if len(args) > 0 && (args[0] == "presets" || args[0] == "-h" || args[0] == "-help") {
+		if args[0] != "presets" {
+			fmt.Fprint(os.Stderr, describeUsage)
+			return exitSuccess
+		}
+		describePresets(os.Stdout)
+		return exitSuccess
+	}
+
+	os.Args = append(os.Args[:1], args...)
+	input := parseFlags()
+	if err := worker.Validate(input); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	writeYAML(os.Stdout, input, 0)
+	return exitSuccess
+}
+
+func describePresets(w io.Writer) {
+	for _, name := range presets.Names() {
+		p, _ := presets.Get(name)
+		fmt.Fprintf(w, "%s:\n  description: %s\n  flags:\n", name, strconv.Quote(p.Description))
+		var flags []string
+		for k := range p.Flags {
+			flags = append(flags, k)
+		}
+		sort.Strings(flags)
+		for _, k := range flags {
+			fmt.Fprintf(w, "    %s: %s\n", k, strconv.Quote(p.Flags[k]))
+		}
+	}
+}
+
+// writeYAML writes the attributes of an input as YAML, named after their JSON counterparts.
+// Secrets and attributes not describing the workload are omitted, as are empty optional attributes.
+// Targets are listed last, under "targets".
+func writeYAML(w io.Writer, input models.Input, indent int) {
+	pad := strings.Repeat(" ", indent)
+	v, t := reflect.ValueOf(input), reflect.TypeOf(input)
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		name, field := tag[0], v.Field(i)
+		if name == "-" || name == "" {
+			continue
+		}
+		if strcoll.Contains("omitempty", tag[1:]) && isEmpty(field) {
+			continue
+		}
+		fmt.Fprintf(w, "%s%s: %s\n", pad, name, yamlValue(field.Interface()))
+	}
+	if len(input.Targets) > 0 {
+		fmt.Fprintf(w, "%stargets:\n", pad)
+		for _, target := range input.Targets {
+			fmt.Fprintf(w, "%s  -\n", pad)
+			writeYAML(w, target, indent+4)
+		}
+	}
+}
+
+func isEmpty(v reflect.Value) bool {
+	if v.Kind() == reflect.Slice {
+		return v.Len() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
+
+func yamlValue(v interface{}) string {
+	switch x := v.(type) {
+	case time.Duration:
+		return x.String()
+	case string:
+		return strconv.Quote(x)
+	case []string:
+		quoted := make([]string, len(x))
+		for i, s := range x {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
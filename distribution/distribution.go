@@ -0,0 +1,77 @@
+package distribution
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// Duration generates random durations.
+type Duration interface {
+	Sample(r *rand.Rand) time.Duration
+}
+
+// Parse returns a Duration distribution described by spec, one of:
+// fixed:<duration>, eg. fixed:10ms
+// normal:<mean>:<stddev>, eg. normal:100ms:20ms
+// lognormal:<median>:<sigma>, eg. lognormal:50ms:0.5
+// An empty spec returns nil.
+func Parse(spec string) (Duration, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	kind, params := strcoll.SplitKV(spec, ":")
+	p1, p2 := strcoll.SplitKV(params, ":")
+	d1, err := time.ParseDuration(p1)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration distribution %q: %s", spec, err)
+	}
+	switch kind {
+	case "fixed":
+		return fixed(d1), nil
+	case "normal":
+		d2, err := time.ParseDuration(p2)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration distribution %q: %s", spec, err)
+		}
+		return normal{d1, d2}, nil
+	case "lognormal":
+		sigma, err := strconv.ParseFloat(strings.TrimSpace(p2), 64)
+		if err != nil || d1 <= 0 {
+			return nil, fmt.Errorf("invalid duration distribution %q", spec)
+		}
+		return lognormal{d1, sigma}, nil
+	default:
+		return nil, fmt.Errorf("invalid duration distribution %q: unknown kind %q", spec, kind)
+	}
+}
+
+type fixed time.Duration
+
+func (d fixed) Sample(*rand.Rand) time.Duration {
+	return time.Duration(d)
+}
+
+type normal struct {
+	mean, stddev time.Duration
+}
+
+// Sample returns a normally distributed duration, truncated at 0.
+func (d normal) Sample(r *rand.Rand) time.Duration {
+	f := r.NormFloat64()*float64(d.stddev) + float64(d.mean)
+	return time.Duration(math.Max(f, 0))
+}
+
+type lognormal struct {
+	median time.Duration
+	sigma  float64
+}
+
+func (d lognormal) Sample(r *rand.Rand) time.Duration {
+	return time.Duration(float64(d.median) * math.Exp(r.NormFloat64()*d.sigma))
+}
@@ -0,0 +1,172 @@
+package es
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/hey-apm/types"
+)
+
+// Totals are a number of events and the sum of their durations, in microseconds.
+type Totals struct {
+	Count       float64
+	DurationSum float64
+}
+
+// IndexedTransactions returns the totals of the transaction events of a service labelled with the given run Id.
+func IndexedTransactions(conn Connection, service, runId string) (Totals, error) {
+	var parsed struct {
+		Aggregations totalsAggs `json:"aggregations"`
+	}
+	err := searchAggs(conn, []types.M{
+		{"term": types.M{"processor.event": "transaction"}},
+		{"term": types.M{"service.name": service}},
+		{"term": types.M{"labels.run_id": runId}},
+	}, totalsAggs{}.request("value_count", "transaction.duration.us", "sum", "transaction.duration.us"), &parsed)
+	return parsed.Aggregations.totals(), err
+}
+
+// AggregatedTransactions returns the totals of the transaction metrics aggregated by apm-server for a service
+// between from and to, in 1 minute intervals. Metrics are timestamped with the start of their interval and don't carry
+// labels, so they include any other transactions of the same service in the same intervals.
+func AggregatedTransactions(conn Connection, service string, from, to time.Time) (Totals, error) {
+	var parsed struct {
+		Aggregations totalsAggs `json:"aggregations"`
+	}
+	err := searchAggs(conn, metricsFilters("transaction", service, from, to),
+		totalsAggs{}.request("value_count", "transaction.duration.histogram", "sum", "transaction.duration.histogram"),
+		&parsed)
+	return parsed.Aggregations.totals(), err
+}
+
+// overflowName is the transaction name of the metrics aggregating transactions over the max groups of apm-server.
+const overflowName = "_other"
+
+// TransactionGroups returns the approximate number of transaction groups (distinct transaction names) aggregated
+// by apm-server for a service between from and to, and the number of transactions aggregated into the overflow
+// bucket once it reached its max groups, with the same caveats as AggregatedTransactions.
+// apm-server 7 doesn't have an overflow bucket, so the latter is always 0 with it.
+func TransactionGroups(conn Connection, service string, from, to time.Time) (float64, float64, error) {
+	var parsed struct {
+		Aggregations struct {
+			Groups struct {
+				Names aggValue `json:"names"`
+			} `json:"groups"`
+			Overflow struct {
+				Count aggValue `json:"count"`
+			} `json:"overflow"`
+		} `json:"aggregations"`
+	}
+	overflow := types.M{"term": types.M{"transaction.name": overflowName}}
+	err := searchAggs(conn, metricsFilters("transaction", service, from, to), types.M{
+		"groups": types.M{
+			"filter": types.M{"bool": types.M{"must_not": overflow}},
+			"aggs":   types.M{"names": types.M{"cardinality": types.M{"field": "transaction.name"}}},
+		},
+		"overflow": types.M{
+			"filter": overflow,
+			"aggs":   types.M{"count": types.M{"sum": types.M{"field": "transaction.aggregation.overflow_count"}}},
+		},
+	}, &parsed)
+	var groups, overflowed float64
+	if v := parsed.Aggregations.Groups.Names.Value; v != nil {
+		groups = *v
+	}
+	if v := parsed.Aggregations.Overflow.Count.Value; v != nil {
+		overflowed = *v
+	}
+	return groups, overflowed, err
+}
+
+// AggregatedDestinations returns the totals of the service destination metrics aggregated by apm-server for a service
+// between from and to, per destination resource, with the same caveats as AggregatedTransactions.
+func AggregatedDestinations(conn Connection, service string, from, to time.Time) (map[string]Totals, error) {
+	var parsed struct {
+		Aggregations struct {
+			Resources struct {
+				Buckets []struct {
+					Key string `json:"key"`
+					totalsAggs
+				} `json:"buckets"`
+			} `json:"resources"`
+		} `json:"aggregations"`
+	}
+	err := searchAggs(conn, metricsFilters("service_destination", service, from, to), types.M{
+		"resources": types.M{
+			"terms": types.M{"field": "span.destination.service.resource", "size": 1000},
+			"aggs": totalsAggs{}.request("sum", "span.destination.service.response_time.count",
+				"sum", "span.destination.service.response_time.sum.us"),
+		},
+	}, &parsed)
+	totals := make(map[string]Totals)
+	for _, b := range parsed.Aggregations.Resources.Buckets {
+		totals[b.Key] = b.totals()
+	}
+	return totals, err
+}
+
+// metricsFilters match the metrics of the given metricset aggregated by apm-server for a service between from and to,
+// in 1 minute intervals.
+func metricsFilters(metricset, service string, from, to time.Time) []types.M {
+	return []types.M{
+		{"term": types.M{"metricset.name": metricset}},
+		{"term": types.M{"service.name": service}},
+		{"range": types.M{"@timestamp": types.M{"gte": from, "lte": to}}},
+		// apm-server 8 aggregates in 10m and 60m intervals as well, while 7 has no metricset.interval
+		{"bool": types.M{"should": []types.M{
+			{"term": types.M{"metricset.interval": "1m"}},
+			{"bool": types.M{"must_not": types.M{"exists": types.M{"field": "metricset.interval"}}}},
+		}}},
+	}
+}
+
+// totalsAggs are the results of a count and a sum aggregation.
+type totalsAggs struct {
+	Count aggValue `json:"count"`
+	Sum   aggValue `json:"sum"`
+}
+
+// request returns the count and sum aggregations, each one with its type and field.
+// Histogram fields can be counted with value_count and summed with sum.
+func (totalsAggs) request(countType, countField, sumType, sumField string) types.M {
+	return types.M{
+		"count": types.M{countType: types.M{"field": countField}},
+		"sum":   types.M{sumType: types.M{"field": sumField}},
+	}
+}
+
+func (a totalsAggs) totals() Totals {
+	var totals Totals
+	if a.Count.Value != nil {
+		totals.Count = *a.Count.Value
+	}
+	if a.Sum.Value != nil {
+		totals.DurationSum = *a.Sum.Value
+	}
+	return totals
+}
+
+// searchAggs runs a search with the given filters and aggregations in apm-server indices,
+// and decodes its response into parsed.
+func searchAggs(conn Connection, filters []types.M, aggs types.M, parsed interface{}) error {
+	body := types.M{
+		"size":  0,
+		"query": types.M{"bool": types.M{"filter": filters}},
+		"aggs":  aggs,
+	}
+	resp, err := conn.Search(
+		conn.Search.WithIndex(apmIndices...),
+		conn.Search.WithBody(esutil.NewJSONReader(body)),
+	)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return errors.New(resp.String())
+	}
+	return json.NewDecoder(resp.Body).Decode(parsed)
+}
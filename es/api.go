@@ -3,12 +3,14 @@ package es
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/elastic/go-elasticsearch/v7/esutil"
 
 	"github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/hey-apm/models"
 	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
 	"github.com/pkg/errors"
 )
 
@@ -103,6 +105,34 @@ func Count(conn Connection, index string) uint64 {
 	return 0
 }
 
+// CountEvents returns the number of documents of the given processor.event in apm-server indices and data streams,
+// or 0 if they can't be counted.
+func CountEvents(conn Connection, event string) uint64 {
+	query := types.M{"query": types.M{"term": types.M{"processor.event": event}}}
+	n, _ := CountQuery(conn, strings.Join(apmIndices, ","), query)
+	return n
+}
+
+// CountQuery returns the number of documents matching a query in the given index.
+func CountQuery(conn Connection, index string, body interface{}) (uint64, error) {
+	resp, err := conn.Count(
+		conn.Count.WithIndex(index),
+		conn.Count.WithBody(esutil.NewJSONReader(body)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return 0, errors.New(resp.String())
+	}
+	var parsed struct {
+		Count uint64 `json:"count"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	return parsed.Count, err
+}
+
 func Delete(conn Connection, indices ...string) error {
 	resp, err := conn.Indices.Delete(indices)
 	if err != nil {
@@ -113,3 +143,125 @@ func Delete(conn Connection, indices ...string) error {
 	}
 	return nil
 }
+
+// FetchReport retrieves a performance report by its document Id.
+func FetchReport(conn Connection, id string) (models.Report, error) {
+	resp, err := conn.Get(reportingIndex, id)
+	if err != nil {
+		return models.Report{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.IsError() {
+		return models.Report{}, errors.New(resp.String())
+	}
+
+	var hit ActualHit
+	err = json.NewDecoder(resp.Body).Decode(&hit)
+	hit.Source.ReportId = hit.Id
+	return hit.Source, err
+}
+
+// apmIndices match the indices and data streams written by apm-server.
+var apmIndices = []string{"apm*", "traces-apm*", "logs-apm*", "metrics-apm*"}
+
+// ApmIndicesSize returns the bytes stored by the primary shards of apm-server indices.
+func ApmIndicesSize(conn Connection) (int64, error) {
+	resp, err := conn.Indices.Stats(
+		conn.Indices.Stats.WithIndex(apmIndices...),
+		conn.Indices.Stats.WithMetric("store"),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return 0, errors.New(resp.String())
+	}
+	var parsed struct {
+		All struct {
+			Primaries struct {
+				Store struct {
+					SizeInBytes int64 `json:"size_in_bytes"`
+				} `json:"store"`
+			} `json:"primaries"`
+		} `json:"_all"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	return parsed.All.Primaries.Store.SizeInBytes, err
+}
+
+// ForcemergeApmIndices refreshes and force merges apm-server indices into a single segment,
+// so that their size doesn't depend on pending merges.
+func ForcemergeApmIndices(conn Connection) error {
+	resp, err := conn.Indices.Refresh(conn.Indices.Refresh.WithIndex(apmIndices...))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.IsError() {
+		return errors.New(resp.String())
+	}
+	resp, err = conn.Indices.Forcemerge(
+		conn.Indices.Forcemerge.WithIndex(apmIndices...),
+		conn.Indices.Forcemerge.WithMaxNumSegments(1),
+	)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.IsError() {
+		return errors.New(resp.String())
+	}
+	return nil
+}
+
+// DeleteRun deletes the documents labelled with the given run Id from apm-server indices,
+// and returns how many.
+func DeleteRun(conn Connection, runId string) (int64, error) {
+	query := types.M{"query": types.M{"term": types.M{"labels.run_id": runId}}}
+	resp, err := conn.DeleteByQuery(apmIndices, esutil.NewJSONReader(query),
+		conn.DeleteByQuery.WithConflicts("proceed"),
+		conn.DeleteByQuery.WithRefresh(true),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return 0, errors.New(resp.String())
+	}
+	var parsed struct {
+		Deleted int64 `json:"deleted"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	return parsed.Deleted, err
+}
+
+// SearchApm returns the source of the documents in apm-server indices matching a search request body.
+func SearchApm(conn Connection, body interface{}) ([]types.M, error) {
+	resp, err := conn.Search(
+		conn.Search.WithIndex(apmIndices...),
+		conn.Search.WithBody(esutil.NewJSONReader(body)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return nil, errors.New(resp.String())
+	}
+	var parsed struct {
+		Hits struct {
+			Hits []struct {
+				Source types.M `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&parsed)
+	docs := make([]types.M, len(parsed.Hits.Hits))
+	for i, hit := range parsed.Hits.Hits {
+		docs[i] = hit.Source
+	}
+	return docs, err
+}
@@ -0,0 +1,120 @@
+package es
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/elastic/go-elasticsearch/v7/esutil"
+	"github.com/pkg/errors"
+
+	"github.com/elastic/hey-apm/types"
+)
+
+// HostMetrics summarizes the system metrics collected by Metricbeat from a host over some time.
+// Attributes are nil when no metrics were found.
+type HostMetrics struct {
+	// average CPU usage, as a percentage of all cores
+	CPUPct *float64
+	Cores  *int64
+	// max memory usage, as a percentage
+	MemoryPct *float64
+	// bytes read from and written to all disks
+	DiskReadBytes  *int64
+	DiskWriteBytes *int64
+}
+
+type aggValue struct {
+	Value *float64 `json:"value"`
+}
+
+type hostMetricsResult struct {
+	Aggregations struct {
+		CPU    aggValue `json:"cpu"`
+		Cores  aggValue `json:"cores"`
+		Memory aggValue `json:"memory"`
+		Disks  struct {
+			Buckets []struct {
+				ReadMin  aggValue `json:"read_min"`
+				ReadMax  aggValue `json:"read_max"`
+				WriteMin aggValue `json:"write_min"`
+				WriteMax aggValue `json:"write_max"`
+			} `json:"buckets"`
+		} `json:"disks"`
+	} `json:"aggregations"`
+}
+
+// FetchHostMetrics queries the Metricbeat system metrics of a host in the given index pattern between from and to.
+// If host is empty, metrics of all hosts are aggregated.
+func FetchHostMetrics(conn Connection, index, host string, from, to time.Time) (HostMetrics, error) {
+	filters := []types.M{{"range": types.M{"@timestamp": types.M{"gte": from, "lte": to}}}}
+	if host != "" {
+		filters = append(filters, types.M{"term": types.M{"host.name": host}})
+	}
+	minMax := func(field string) types.M {
+		return types.M{
+			field + "_min": types.M{"min": types.M{"field": "system.diskio." + field + ".bytes"}},
+			field + "_max": types.M{"max": types.M{"field": "system.diskio." + field + ".bytes"}},
+		}
+	}
+	diskAggs := minMax("read")
+	for k, v := range minMax("write") {
+		diskAggs[k] = v
+	}
+	body := types.M{
+		"size":  0,
+		"query": types.M{"bool": types.M{"filter": filters}},
+		"aggs": types.M{
+			"cpu":    types.M{"avg": types.M{"field": "system.cpu.total.norm.pct"}},
+			"cores":  types.M{"max": types.M{"field": "system.cpu.cores"}},
+			"memory": types.M{"max": types.M{"field": "system.memory.actual.used.pct"}},
+			"disks": types.M{
+				"terms": types.M{"field": "system.diskio.name", "size": 100},
+				"aggs":  diskAggs,
+			},
+		},
+	}
+
+	resp, err := conn.Search(
+		conn.Search.WithIndex(index),
+		conn.Search.WithBody(esutil.NewJSONReader(body)),
+	)
+	if err != nil {
+		return HostMetrics{}, err
+	}
+	defer resp.Body.Close()
+	if resp.IsError() {
+		return HostMetrics{}, errors.New(resp.String())
+	}
+
+	var parsed hostMetricsResult
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return HostMetrics{}, err
+	}
+	aggs := parsed.Aggregations
+	var metrics HostMetrics
+	if aggs.CPU.Value != nil {
+		pct := *aggs.CPU.Value * 100
+		metrics.CPUPct = &pct
+	}
+	if aggs.Cores.Value != nil {
+		cores := int64(*aggs.Cores.Value)
+		metrics.Cores = &cores
+	}
+	if aggs.Memory.Value != nil {
+		pct := *aggs.Memory.Value * 100
+		metrics.MemoryPct = &pct
+	}
+	var read, written int64
+	for _, disk := range aggs.Disks.Buckets {
+		if disk.ReadMin.Value != nil && disk.ReadMax.Value != nil {
+			read += int64(*disk.ReadMax.Value - *disk.ReadMin.Value)
+		}
+		if disk.WriteMin.Value != nil && disk.WriteMax.Value != nil {
+			written += int64(*disk.WriteMax.Value - *disk.WriteMin.Value)
+		}
+	}
+	if len(aggs.Disks.Buckets) > 0 {
+		metrics.DiskReadBytes, metrics.DiskWriteBytes = &read, &written
+	}
+	return metrics, nil
+}
@@ -0,0 +1,115 @@
+package es
+
+import (
+	"time"
+
+	"github.com/elastic/hey-apm/types"
+)
+
+// Traffic summarizes the events indexed by apm-server in a time window.
+type Traffic struct {
+	Transactions, Spans, Errors float64
+	// percentiles of transaction and span durations, in microseconds, by percentile ("50.0", "90.0")
+	TransactionDuration, SpanDuration map[string]float64
+	// approximate number of distinct span types, users and error groups
+	SpanTypes, Users, ErrorGroups float64
+	// events of the services with most events, most events first
+	Services []ServiceEvents
+}
+
+// ServiceEvents is the number of events of a service.
+type ServiceEvents struct {
+	Name   string
+	Events float64
+}
+
+// QueryTraffic returns the traffic indexed by apm-server between from and to, for the given service or all of them,
+// including the top maxServices services.
+func QueryTraffic(conn Connection, service string, from, to time.Time, maxServices int) (Traffic, error) {
+	filters := []types.M{{"range": types.M{"@timestamp": types.M{"gte": from, "lt": to}}}}
+	if service != "" {
+		filters = append(filters, types.M{"term": types.M{"service.name": service}})
+	}
+	percentiles := func(field string) types.M {
+		return types.M{"percentiles": types.M{"field": field, "percents": []float64{50, 90}}}
+	}
+	event := func(name string, aggs types.M) types.M {
+		return types.M{"filter": types.M{"term": types.M{"processor.event": name}}, "aggs": aggs}
+	}
+	aggs := types.M{
+		"transaction": event("transaction", types.M{"duration": percentiles("transaction.duration.us")}),
+		"span": event("span", types.M{
+			"duration": percentiles("span.duration.us"),
+			"types":    types.M{"cardinality": types.M{"field": "span.type"}},
+		}),
+		"error": event("error", types.M{"groups": types.M{"cardinality": types.M{"field": "error.grouping_key"}}}),
+		"users": types.M{"cardinality": types.M{"field": "user.id"}},
+		"services": types.M{
+			"filter": types.M{"terms": types.M{"processor.event": []string{"transaction", "span", "error"}}},
+			"aggs":   types.M{"names": types.M{"terms": types.M{"field": "service.name", "size": maxServices}}},
+		},
+	}
+	type durationAgg struct {
+		Values map[string]*float64 `json:"values"`
+	}
+	var parsed struct {
+		Aggregations struct {
+			Transaction struct {
+				DocCount float64     `json:"doc_count"`
+				Duration durationAgg `json:"duration"`
+			} `json:"transaction"`
+			Span struct {
+				DocCount float64     `json:"doc_count"`
+				Duration durationAgg `json:"duration"`
+				Types    aggValue    `json:"types"`
+			} `json:"span"`
+			Error struct {
+				DocCount float64  `json:"doc_count"`
+				Groups   aggValue `json:"groups"`
+			} `json:"error"`
+			Users    aggValue `json:"users"`
+			Services struct {
+				Names struct {
+					Buckets []struct {
+						Key      string  `json:"key"`
+						DocCount float64 `json:"doc_count"`
+					} `json:"buckets"`
+				} `json:"names"`
+			} `json:"services"`
+		} `json:"aggregations"`
+	}
+	if err := searchAggs(conn, filters, aggs, &parsed); err != nil {
+		return Traffic{}, err
+	}
+
+	a := parsed.Aggregations
+	value := func(v aggValue) float64 {
+		if v.Value == nil {
+			return 0
+		}
+		return *v.Value
+	}
+	durations := func(d durationAgg) map[string]float64 {
+		m := make(map[string]float64)
+		for k, v := range d.Values {
+			if v != nil {
+				m[k] = *v
+			}
+		}
+		return m
+	}
+	traffic := Traffic{
+		Transactions:        a.Transaction.DocCount,
+		Spans:               a.Span.DocCount,
+		Errors:              a.Error.DocCount,
+		TransactionDuration: durations(a.Transaction.Duration),
+		SpanDuration:        durations(a.Span.Duration),
+		SpanTypes:           value(a.Span.Types),
+		Users:               value(a.Users),
+		ErrorGroups:         value(a.Error.Groups),
+	}
+	for _, b := range a.Services.Names.Buckets {
+		traffic.Services = append(traffic.Services, ServiceEvents{b.Key, b.DocCount})
+	}
+	return traffic, nil
+}
@@ -0,0 +1,139 @@
+// Package fuzz sends intake events exercising the edges of the intake schema to apm-server,
+// and records which of them are accepted or rejected.
+package fuzz
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/server"
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
+)
+
+// Result is the response of apm-server to a variant.
+type Result struct {
+	Event    string `json:"event"`
+	Variant  string `json:"variant"`
+	Accepted bool   `json:"accepted"`
+	Status   int    `json:"status"`
+	// first error given by apm-server, if rejected
+	Error string `json:"error,omitempty"`
+}
+
+// Matrix holds the results of all the variants sent to an apm-server version.
+type Matrix struct {
+	ApmVersion string   `json:"apm_version,omitempty"`
+	Results    []Result `json:"results"`
+}
+
+// Config holds the apm-server to fuzz and its credentials.
+type Config struct {
+	ServerUrl    string
+	ServerSecret string
+	APIKey       string
+	ServiceName  string
+}
+
+// Run sends each variant in its own request to apm-server, and returns the results.
+// An error is returned only if apm-server can't be reached.
+func Run(cfg Config) (Matrix, error) {
+	var m Matrix
+	if info, err := server.QueryInfo(server.Authorization(cfg.ServerSecret, cfg.APIKey), cfg.ServerUrl); err == nil {
+		m.ApmVersion = info.Version
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, v := range Variants() {
+		r, err := send(client, cfg, v)
+		if err != nil {
+			return m, err
+		}
+		m.Results = append(m.Results, r)
+	}
+	return m, nil
+}
+
+func send(client *http.Client, cfg Config, v Variant) (Result, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.Encode(types.M{"metadata": types.M{"service": types.M{
+		"name":  cfg.ServiceName,
+		"agent": types.M{"name": "go", "version": "1.7.2"},
+	}}})
+	enc.Encode(types.M{v.Event: v.doc})
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(cfg.ServerUrl, "/")+"/intake/v2/events?verbose", &body)
+	if err != nil {
+		return Result{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if auth := server.Authorization(cfg.ServerSecret, cfg.APIKey); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+	rb, _ := ioutil.ReadAll(resp.Body)
+
+	r := Result{Event: v.Event, Variant: v.Name, Status: resp.StatusCode}
+	var verbose struct {
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	json.Unmarshal(rb, &verbose)
+	r.Accepted = resp.StatusCode < 300 && len(verbose.Errors) == 0
+	switch {
+	case len(verbose.Errors) > 0:
+		r.Error = verbose.Errors[0].Message
+	case !r.Accepted:
+		r.Error = strings.TrimSpace(string(rb))
+	}
+	return r, nil
+}
+
+// Print writes the results as a table per event type, with the errors of rejected variants.
+func (m Matrix) Print(out io.Writer) {
+	if m.ApmVersion != "" {
+		fmt.Fprintf(out, "apm-server version %s\n", m.ApmVersion)
+	}
+	var accepted int
+	tuples := strcoll.NewTuples()
+	for i, r := range m.Results {
+		if i > 0 && m.Results[i-1].Event != r.Event {
+			fmt.Fprintf(out, "\n%s\n%s\n", m.Results[i-1].Event, tuples.Format(45))
+			tuples = strcoll.NewTuples()
+		}
+		result := "accepted"
+		if r.Accepted {
+			accepted++
+		} else {
+			result = fmt.Sprintf("rejected (%d)", r.Status)
+			if r.Error != "" {
+				result += ": " + r.Error
+			}
+		}
+		tuples.Add(" - "+r.Variant, result)
+	}
+	if len(m.Results) > 0 {
+		fmt.Fprintf(out, "\n%s\n%s\n", m.Results[len(m.Results)-1].Event, tuples.Format(45))
+	}
+	fmt.Fprintf(out, "\n%d variants accepted, %d rejected\n", accepted, len(m.Results)-accepted)
+}
+
+// Write saves the results as JSON to a file, to compare them across apm-server versions.
+func (m Matrix) Write(path string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
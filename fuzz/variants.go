@@ -0,0 +1,157 @@
+package fuzz
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/types"
+)
+
+// Variant is an intake event derived from a valid one, exercising an edge of the intake schema.
+type Variant struct {
+	// event type, eg. transaction
+	Event string
+	// description of the change made to the valid event, eg. "duration: -1"
+	Name string
+	doc  types.M
+}
+
+// eventTypes are the intake event types, in the order they are fuzzed.
+var eventTypes = []string{"transaction", "span", "error", "metricset"}
+
+// validEvent returns a minimal event of the given type accepted by apm-server.
+func validEvent(event string) types.M {
+	ts := time.Now().UnixNano() / int64(time.Microsecond)
+	switch event {
+	case "transaction":
+		return types.M{
+			"id":         "0123456789abcdef",
+			"trace_id":   "0123456789abcdef0123456789abcdef",
+			"name":       "fuzzed",
+			"type":       "fuzz",
+			"duration":   10.5,
+			"timestamp":  ts,
+			"span_count": types.M{"started": 1},
+			"context":    types.M{"tags": types.M{"fuzz": "true"}},
+		}
+	case "span":
+		return types.M{
+			"id":             "fedcba9876543210",
+			"trace_id":       "0123456789abcdef0123456789abcdef",
+			"parent_id":      "0123456789abcdef",
+			"transaction_id": "0123456789abcdef",
+			"name":           "fuzzed",
+			"type":           "db.mysql.query",
+			"duration":       2.5,
+			"timestamp":      ts,
+			"context":        types.M{"tags": types.M{"fuzz": "true"}},
+		}
+	case "error":
+		return types.M{
+			"id":        "0123456789abcdef0123456789abcdef",
+			"timestamp": ts,
+			"culprit":   "fuzzed",
+			"exception": types.M{"message": "fuzzed", "type": "FuzzError"},
+			"context":   types.M{"tags": types.M{"fuzz": "true"}},
+		}
+	default:
+		return types.M{
+			"timestamp": ts,
+			"samples":   types.M{"fuzzed.count": types.M{"value": 1}},
+			"tags":      types.M{"fuzz": "true"},
+		}
+	}
+}
+
+// boundary values for numbers, strings and objects, and their descriptions
+var (
+	numbers = []struct {
+		name  string
+		value interface{}
+	}{
+		{"0", 0},
+		{"-1", -1},
+		{"2^53+1", uint64(1<<53 + 1)},
+		{"max uint64", uint64(math.MaxUint64)},
+		{"max float64", math.MaxFloat64},
+		{"smallest float64", math.SmallestNonzeroFloat64},
+		{"string", "10"},
+	}
+	strs = []struct {
+		name  string
+		value interface{}
+	}{
+		{"empty string", ""},
+		{"1024 characters", strings.Repeat("x", 1024)},
+		{"1025 characters", strings.Repeat("x", 1025)},
+		{"number", 10},
+		{"array", []string{"fuzzed"}},
+	}
+	objects = []struct {
+		name  string
+		value interface{}
+	}{
+		{"empty object", types.M{}},
+		{"string", "fuzzed"},
+		{"array", []interface{}{}},
+	}
+)
+
+// Variants returns the valid event of each type, followed by variants of it missing each field,
+// with each field set to null and to boundary values of its type, and with extra unknown fields.
+func Variants() []Variant {
+	var variants []Variant
+	for _, event := range eventTypes {
+		valid := validEvent(event)
+		add := func(name string, mutate func(doc types.M)) {
+			doc := copyDoc(valid)
+			mutate(doc)
+			variants = append(variants, Variant{Event: event, Name: name, doc: doc})
+		}
+		add("valid", func(types.M) {})
+
+		var fields []string
+		for k := range valid {
+			fields = append(fields, k)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			field := field
+			add("without "+field, func(doc types.M) { delete(doc, field) })
+			add(field+": null", func(doc types.M) { doc[field] = nil })
+			boundaries := strs
+			switch valid[field].(type) {
+			case int, int64, float64:
+				boundaries = numbers
+			case types.M:
+				boundaries = objects
+			}
+			for _, b := range boundaries {
+				b := b
+				add(fmt.Sprintf("%s: %s", field, b.name), func(doc types.M) { doc[field] = b.value })
+			}
+		}
+		add("unknown field", func(doc types.M) { doc["hey_apm_unknown"] = "fuzzed" })
+		add("unknown nested field", func(doc types.M) {
+			ctx, _ := doc["context"].(types.M)
+			if ctx == nil {
+				ctx = types.M{}
+				doc["context"] = ctx
+			}
+			ctx["hey_apm_unknown"] = types.M{"fuzzed": true}
+		})
+	}
+	return variants
+}
+
+// copyDoc returns a deep copy of a JSON document.
+func copyDoc(doc types.M) types.M {
+	b, _ := json.Marshal(doc)
+	var c types.M
+	json.Unmarshal(b, &c)
+	return c
+}
@@ -15,28 +15,32 @@
 // of a set of related goroutines.
 package workgroup
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // A Group manages a set of goroutines with related lifetimes.
 // The zero value for a Group is fully usable without initalisation.
 type Group struct {
-	fn []func(<-chan struct{}) error
+	fn []func(context.Context) error
 }
 
 // Add adds a function to the Group.
 // The function will be exectuted in its own goroutine when Run is called.
 // Add must be called before Run.
-func (g *Group) Add(fn func(<-chan struct{}) error) {
+func (g *Group) Add(fn func(context.Context) error) {
 	g.fn = append(g.fn, fn)
 }
 
 // Run exectues each function registered via Add in its own goroutine.
 // Run blocks until all functions have returned.
-// The first function to return will trigger the closure of the channel
-// passed to each function, who should in turn, return.
+// The first function to return, or the cancellation of ctx, will trigger
+// the cancellation of the context passed to each function, who should in
+// turn, return.
 // The return value from the first function to exit will be returned to
 // the caller of Run.
-func (g *Group) Run() error {
+func (g *Group) Run(ctx context.Context) error {
 
 	// if there are no registered functions, return immediately.
 	if len(g.fn) < 1 {
@@ -46,16 +50,16 @@ func (g *Group) Run() error {
 	var wg sync.WaitGroup
 	wg.Add(len(g.fn))
 
-	stop := make(chan struct{})
+	ctx, cancel := context.WithCancel(ctx)
 	result := make(chan error, len(g.fn))
 	for _, fn := range g.fn {
-		go func(fn func(<-chan struct{}) error) {
+		go func(fn func(context.Context) error) {
 			defer wg.Done()
-			result <- fn(stop)
+			result <- fn(ctx)
 		}(fn)
 	}
 
 	defer wg.Wait()
-	defer close(stop)
+	defer cancel()
 	return <-result
 }
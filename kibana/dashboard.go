@@ -0,0 +1,253 @@
+// Package kibana installs saved objects to explore performance reports in Kibana.
+package kibana
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
+)
+
+const (
+	// IndexPatternId is the Id of the index pattern matching the reports index.
+	IndexPatternId = "hey-bench"
+	// DashboardId is the Id of the dashboard with all the visualizations.
+	DashboardId = "hey-bench-dashboard"
+)
+
+type savedObject struct {
+	Type       string      `json:"type"`
+	Id         string      `json:"id"`
+	Attributes types.M     `json:"attributes"`
+	References []reference `json:"references,omitempty"`
+}
+
+type reference struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Id   string `json:"id"`
+}
+
+// metric is an average of a report attribute
+type metric struct {
+	field, label string
+}
+
+// InstallDashboard creates or overwrites an index pattern for reports, and a dashboard visualizing their throughput,
+// drops and latency over time, and throughput per apm-server version, with the Kibana saved objects API.
+// auth is an optional username:password.
+func InstallDashboard(url, auth string) error {
+	objects := []savedObject{{
+		Type: "index-pattern",
+		Id:   IndexPatternId,
+		Attributes: types.M{
+			"title":         "hey-bench",
+			"timeFieldName": "@timestamp",
+		},
+	}}
+	visualizations := []savedObject{
+		overTime("hey-bench-throughput", "Throughput (events per second)",
+			metric{"event_send_rate", "sent"}, metric{"event_accept_rate", "accepted"}, metric{"event_index_rate", "indexed"}),
+		overTime("hey-bench-drops", "Dropped and rejected events",
+			metric{"event_loss_ratio", "loss %"}, metric{"events_rejected", "rejected"},
+			metric{"events_unacknowledged", "unacknowledged"}),
+		overTime("hey-bench-latency", "Request latency (ms)",
+			metric{"request_latency_p50", "p50"}, metric{"request_latency_p90", "p90"}, metric{"request_latency_p99", "p99"}),
+		byVersion("hey-bench-versions", "Throughput per apm-server version",
+			metric{"event_accept_rate", "accepted"}, metric{"event_index_rate", "indexed"}),
+	}
+	objects = append(objects, visualizations...)
+	objects = append(objects, dashboard(visualizations))
+
+	body, err := json.Marshal(objects)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(url, "/")+"/api/saved_objects/_bulk_create?overwrite=true",
+		bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("kbn-xsrf", "true")
+	if auth != "" {
+		req.SetBasicAuth(strcoll.SplitKV(auth, ":"))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	rb, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		return errors.New(fmt.Sprintf("kibana status not OK: %s %s", resp.Status, rb))
+	}
+
+	var created struct {
+		SavedObjects []struct {
+			Id    string `json:"id"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"saved_objects"`
+	}
+	if err := json.Unmarshal(rb, &created); err != nil {
+		return err
+	}
+	var failed []string
+	for _, obj := range created.SavedObjects {
+		if obj.Error != nil {
+			failed = append(failed, obj.Id+": "+obj.Error.Message)
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New("error creating saved objects: " + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// overTime returns a line chart of the average of the given metrics over time.
+func overTime(id, title string, metrics ...metric) savedObject {
+	return visualization(id, title, "line", metrics, types.M{
+		"id":      "segment",
+		"enabled": true,
+		"type":    "date_histogram",
+		"schema":  "segment",
+		"params":  types.M{"field": "@timestamp", "interval": "auto", "min_doc_count": 1, "extended_bounds": types.M{}},
+	})
+}
+
+// byVersion returns a bar chart of the average of the given metrics per apm-server version.
+func byVersion(id, title string, metrics ...metric) savedObject {
+	return visualization(id, title, "histogram", metrics, types.M{
+		"id":      "segment",
+		"enabled": true,
+		"type":    "terms",
+		"schema":  "segment",
+		"params":  types.M{"field": "apm_version.keyword", "size": 20, "order": "desc", "orderBy": "_key"},
+	})
+}
+
+func visualization(id, title, chart string, metrics []metric, segment types.M) savedObject {
+	aggs := []types.M{}
+	series := []types.M{}
+	for i, m := range metrics {
+		aggId := fmt.Sprintf("%d", i+1)
+		aggs = append(aggs, types.M{
+			"id":      aggId,
+			"enabled": true,
+			"type":    "avg",
+			"schema":  "metric",
+			"params":  types.M{"field": m.field, "customLabel": m.label},
+		})
+		series = append(series, types.M{
+			"show":                   true,
+			"type":                   chart,
+			"mode":                   "normal",
+			"data":                   types.M{"id": aggId, "label": m.label},
+			"valueAxis":              "ValueAxis-1",
+			"drawLinesBetweenPoints": true,
+			"showCircles":            true,
+		})
+	}
+	aggs = append(aggs, segment)
+	visState, _ := json.Marshal(types.M{
+		"title": title,
+		"type":  chart,
+		"aggs":  aggs,
+		"params": types.M{
+			"type":           chart,
+			"addLegend":      true,
+			"legendPosition": "right",
+			"addTooltip":     true,
+			"times":          []interface{}{},
+			"addTimeMarker":  false,
+			"grid":           types.M{"categoryLines": false},
+			"categoryAxes": []types.M{{
+				"id":       "CategoryAxis-1",
+				"type":     "category",
+				"position": "bottom",
+				"show":     true,
+				"scale":    types.M{"type": "linear"},
+				"labels":   types.M{"show": true, "truncate": 100},
+				"title":    types.M{},
+			}},
+			"valueAxes": []types.M{{
+				"id":       "ValueAxis-1",
+				"name":     "LeftAxis-1",
+				"type":     "value",
+				"position": "left",
+				"show":     true,
+				"scale":    types.M{"type": "linear", "mode": "normal"},
+				"labels":   types.M{"show": true, "rotate": 0, "filter": false, "truncate": 100},
+				"title":    types.M{"text": ""},
+			}},
+			"seriesParams": series,
+		},
+	})
+	searchSource, _ := json.Marshal(types.M{
+		"query":        types.M{"query": "", "language": "kuery"},
+		"filter":       []interface{}{},
+		"indexRefName": "kibanaSavedObjectMeta.searchSourceJSON.index",
+	})
+	return savedObject{
+		Type: "visualization",
+		Id:   id,
+		Attributes: types.M{
+			"title":                 title,
+			"visState":              string(visState),
+			"uiStateJSON":           "{}",
+			"description":           "",
+			"version":               1,
+			"kibanaSavedObjectMeta": types.M{"searchSourceJSON": string(searchSource)},
+		},
+		References: []reference{{
+			Name: "kibanaSavedObjectMeta.searchSourceJSON.index",
+			Type: "index-pattern",
+			Id:   IndexPatternId,
+		}},
+	}
+}
+
+// dashboard returns a dashboard with the given visualizations, two per row.
+func dashboard(visualizations []savedObject) savedObject {
+	var panels []types.M
+	var refs []reference
+	for i, vis := range visualizations {
+		panelId := fmt.Sprintf("%d", i+1)
+		panels = append(panels, types.M{
+			"panelIndex":       panelId,
+			"gridData":         types.M{"x": i % 2 * 24, "y": i / 2 * 15, "w": 24, "h": 15, "i": panelId},
+			"embeddableConfig": types.M{},
+			"panelRefName":     fmt.Sprintf("panel_%d", i),
+		})
+		refs = append(refs, reference{Name: fmt.Sprintf("panel_%d", i), Type: "visualization", Id: vis.Id})
+	}
+	panelsJSON, _ := json.Marshal(panels)
+	searchSource, _ := json.Marshal(types.M{
+		"query":  types.M{"query": "", "language": "kuery"},
+		"filter": []interface{}{},
+	})
+	return savedObject{
+		Type: "dashboard",
+		Id:   DashboardId,
+		Attributes: types.M{
+			"title":                 "hey-apm",
+			"description":           "hey-apm performance reports",
+			"panelsJSON":            string(panelsJSON),
+			"optionsJSON":           `{"useMargins":true,"hidePanelTitles":false}`,
+			"timeRestore":           true,
+			"timeFrom":              "now-30d",
+			"timeTo":                "now",
+			"version":               1,
+			"kibanaSavedObjectMeta": types.M{"searchSourceJSON": string(searchSource)},
+		},
+		References: refs,
+	}
+}
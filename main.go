@@ -1,58 +1,315 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"math"
-	"math/rand"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/elastic/hey-apm/benchmark"
+	"github.com/elastic/hey-apm/cloud"
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/distribution"
+	"github.com/elastic/hey-apm/fuzz"
 
 	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/notify"
+	"github.com/elastic/hey-apm/presets"
+	"github.com/elastic/hey-apm/random"
+	"github.com/elastic/hey-apm/strcoll"
 
 	"github.com/elastic/hey-apm/worker"
 )
 
+// Exit codes
+const (
+	exitSuccess = iota
+	// any error not covered by other exit codes
+	exitError
+	// the run was aborted by a stop condition or a signal
+	exitAborted
+	// the run completed but its report exceeded some threshold
+	exitThresholds
+	// apm-server rejected requests as unauthorized
+	exitAuth
+)
+
 func main() {
 
 	var err error
+	var reports []models.Report
+
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		os.Exit(reportCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "describe" {
+		os.Exit(describeCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cleanup" {
+		os.Exit(cleanupCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dashboard" {
+		os.Exit(dashboardCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "daemon" {
+		os.Exit(daemonCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "proxy" {
+		os.Exit(proxyCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verifyCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "plan" {
+		os.Exit(planCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "model" {
+		os.Exit(modelCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench-self" {
+		os.Exit(benchSelfCommand(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		os.Exit(versionCommand(os.Args[2:]))
+	}
 
 	input := parseFlags()
+	if err := worker.Validate(input); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(exitError)
+	}
+	setAgentEnv(input)
+	if input.ShardOutput != "" {
+		os.Exit(exitCode(worker.RunShard(input)))
+	}
+	if input.Fuzz {
+		os.Exit(runFuzz(input))
+	}
+	if input.CloudProvision != "" {
+		if input, err = provisionDeployment(input); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+	}
 	if input.IsBenchmark {
 		err = benchmark.Run(input)
+	} else if input.Iterations > 1 {
+		reports, err = worker.RunIterations(input)
+	} else if len(input.Targets) > 0 {
+		reports, err = worker.RunTargets(input)
 	} else {
-		_, err = worker.Run(input)
+		var report models.Report
+		report, err = worker.Run(input)
+		reports = append(reports, report)
+	}
+	if input.CloudProvision != "" && !input.CloudKeep {
+		shutdownDeployment(input)
 	}
 
+	if input.NotifyUrl != "" {
+		if nerr := notify.Send(input.NotifyUrl, reports, err); nerr != nil {
+			fmt.Fprintln(os.Stderr, nerr.Error())
+		}
+	}
+
+	os.Exit(exitCode(err))
+}
+
+// runFuzz sends the intake schema variants to apm-server and prints the results, and returns the exit code.
+func runFuzz(input models.Input) int {
+	matrix, err := fuzz.Run(fuzz.Config{
+		ServerUrl:    input.ApmServerUrl,
+		ServerSecret: input.ApmServerSecret,
+		APIKey:       input.APIKey,
+		ServiceName:  input.ServiceName,
+	})
 	if err != nil {
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	matrix.Print(os.Stdout)
+	if input.FuzzOutput != "" {
+		if err := matrix.Write(input.FuzzOutput); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return exitError
+		}
+	}
+	return exitSuccess
+}
+
+// exitCode maps the outcome of a run to a process exit code.
+func exitCode(err error) int {
+	switch err.(type) {
+	case nil:
+		return exitSuccess
+	case worker.StopError:
+		return exitAborted
+	case worker.ThresholdError:
+		return exitThresholds
+	case worker.AuthError:
+		return exitAuth
+	default:
+		return exitError
 	}
 }
 
 func parseFlags() models.Input {
 	// run options
 	runTimeout := flag.Duration("run", 30*time.Second, "stop run after this duration")
+	probeInterval := flag.Duration("probe-interval", 0, "send a sentinel transaction at this interval and measure "+
+		"the time until it is searchable in the elasticsearch used by apm-server (disabled by default)")
+	configAgents := flag.Int("config-agents", 0, "simulate this many agents polling apm-server for their "+
+		"central configuration, alongside the intake load (disabled by default)")
+	configPollInterval := flag.Duration("config-poll-interval", 30*time.Second, "interval at which each "+
+		"simulated agent polls apm-server for its central configuration")
+	idleAgents := flag.Int("idle-agents", 0, "simulate this many agents with almost no traffic, each one keeping "+
+		"a connection open to apm-server, alongside the intake load (disabled by default)")
+	idleHeartbeat := flag.Duration("idle-heartbeat", 30*time.Second, "interval at which each idle agent sends "+
+		"its metadata and a metricset")
+	infoInterval := flag.Duration("info-interval", 0, "send a request to the apm-server root endpoint at this "+
+		"interval, as agents do on startup, alongside the intake load (disabled by default)")
+	sourcemapInterval := flag.Duration("sourcemap-interval", 0, "upload a sourcemap and send a RUM error "+
+		"referencing it at this interval, with -ex stacktrace frames (disabled by default)")
+	clockSkew := flag.Duration("clock-skew", 0, "offset the timestamps of generated events by this duration, "+
+		"as agents with a bad clock do, eg. 1h or -5m")
+	idCollisions := flag.Float64("id-collisions", 0, "fraction of transactions reusing the trace, transaction "+
+		"and span Ids of a previous transaction, between 0 and 1")
+	tracestate := flag.String("tracestate", "", "comma separated W3C tracestate entries propagated to transactions "+
+		"from an upstream service, eg. es=s:0.5,vendor=opaque (agents since 1.9 take the sample rate from es=s:<rate>)")
+	baggage := flag.String("baggage", "", "comma separated key=value baggage members propagated to transactions "+
+		"from an upstream service, attached to them as labels")
+	edgeStrings := flag.Float64("edge-strings", 0, "fraction of names, labels and messages replaced with "+
+		"multibyte, zero width, very long, control character or invalid UTF-8 strings, between 0 and 1")
+	chaos := flag.String("chaos", "", "comma separated offsets from the start of the run at which agents are "+
+		"stopped and restarted all at once, eg. 30s,1m")
+	chaosDowntime := flag.Duration("chaos-downtime", 5*time.Second, "time agents are stopped for at each -chaos offset")
 	flushTimeout := flag.Duration("flush", 10*time.Second, "wait timeout for agent flush")
+	drainTimeout := flag.Duration("drain", 10*time.Second, "wait timeout for apm-server to acknowledge "+
+		"all events sent, after flushing")
 	seed := flag.Int64("seed", time.Now().Unix(), "random seed")
+	replaySeed := flag.Int64("replay-seed", 0, "seed of a previous run, as reported, to generate the exact same "+
+		"events again under a new run id, rather than with -seed")
+	iterations := flag.Int("iterations", 1, "run the workload this many times, one after another, "+
+		"and report statistics across iterations (only if -bench is not passed)")
+	cooldown := flag.Duration("cooldown", 10*time.Second, "wait time between iterations")
+	pushgatewayUrl := flag.String("pushgateway-url", "", "prometheus pushgateway url to push report metrics to")
+	notifyUrl := flag.String("notify-url", "", "webhook url (eg. slack) to post a summary to at the end of the run, "+
+		"or an alert if it fails")
+	kibanaUrl := flag.String("kibana-url", "", "kibana url to upload sourcemaps to, instead of apm-server "+
+		"(required since 8.0)")
+	kibanaAuth := flag.String("kibana-auth", "", "kibana username:password")
+	grafanaUrl := flag.String("grafana-url", "", "grafana url to annotate runs in")
+	grafanaToken := flag.String("grafana-token", "", "grafana API key or service account token")
+	annotate := flag.Bool("annotate", false, "annotate runs in the elasticsearch instance for reports (-es-url)")
+	renderFile := flag.String("render", "", "render the report with charts over time to this file, "+
+		"as HTML if its extension is .html, Markdown otherwise")
+	recordFile := flag.String("record", "", "write the uncompressed NDJSON body of every intake request to this file, "+
+		"one after another (the target name is added to the file name when running several targets)")
+	recordOnly := flag.Bool("record-only", false, "record intake requests without sending them to apm-server, "+
+		"all their events are considered accepted (only in combination with -record)")
+	scrubRules := flag.String("scrub", "", "scrub recorded requests with the rules in this JSON file, or with rules "+
+		"removing IPs, user fields, db statements, headers and bodies if \"default\" (only in combination with -record)")
+	sentEventsFile := flag.String("sent-events", "", "write a random sample of the events sent, as sent and with "+
+		"their Ids, to this file, to be checked with `hey-apm verify` (the target name is added to the file name "+
+		"when running several targets)")
+	sentEventsEvery := flag.Int("sent-events-every", 1000, "events sent per event written to -sent-events, on average")
+	reportsDir := flag.String("reports-dir", "", "directory to save reports to as JSON files, "+
+		"to be compared with `hey-apm report`, along with the manifest of each run")
+	progress := flag.Bool("progress", false, "print the events sent, accepted and rejected so far every second")
+	manifestFile := flag.String("manifest", "", "write the provenance of the run to this JSON file: hey-apm build, "+
+		"effective flags, seed, host and apm-server version (the target name is added to the file name "+
+		"when running several targets)")
+	samplesFile := flag.String("samples", "", "write every request's timestamp, duration, status and bytes "+
+		"to this file, as .csv, .tsv or .ndjson.gz")
+	maxRequestErrors := flag.Int("max-errors", 0, "abort the run when failed requests exceed this number (disabled by default)")
+	maxErrorRate := flag.Float64("max-error-rate", 0, "abort the run when the percentage of failed requests "+
+		"in the last 10 seconds exceeds this value (disabled by default)")
+	assertMaxDropRate := flag.Float64("assert-max-drop-rate", 0, "fail the run when the percentage of events "+
+		"dropped by the agent exceeds this value (disabled by default)")
+	assertP99Latency := flag.Duration("assert-p99-latency", 0, "fail the run when the 99th percentile "+
+		"of request latencies exceeds this value (disabled by default)")
+	assertMinThroughput := flag.Float64("assert-min-throughput", 0, "fail the run when the events accepted "+
+		"per second are fewer than this value (disabled by default)")
+	apdexThreshold := flag.Duration("apdex-threshold", 0, "request latency up to which requests are satisfying, "+
+		"and up to 4 times which they are tolerable, to score requests with Apdex (disabled by default)")
+	assertMinApdex := flag.Float64("assert-min-apdex", 0, "fail the run when the Apdex score of requests "+
+		"is lower than this value, between 0 and 1 (disabled by default, requires -apdex-threshold)")
+	latency := flag.Duration("latency", 0, "extra latency added before every request to apm-server, "+
+		"as for remote agents")
+	latencyJitter := flag.Duration("latency-jitter", 0, "random variation of -latency, in both directions")
+	resetRate := flag.Float64("reset-rate", 0, "fraction of requests aborted midway as if their connection "+
+		"was reset, between 0 and 1")
+	outOfOrder := flag.Float64("out-of-order", 0, "fraction of events sent after later random events of the "+
+		"same request, so that children and parents arrive in any order, between 0 and 1")
+	otelAttributes := flag.Bool("otel-attributes", false, "add OpenTelemetry span kinds and http.*, db.* and "+
+		"messaging.* attributes to transactions and spans, as agents bridging OpenTelemetry do")
+	maxBps := flag.String("max-bps", "", "max bytes per second sent to apm-server, eg. 50MB (unlimited by default)")
+	rum := flag.Bool("rum", false, "send events to the RUM intake endpoint without credentials, as anonymous agents do "+
+		"(apm-server must allow the go agent for anonymous access)")
+	clientIPs := flag.Int("client-ips", 0, "attribute requests round robin to this many client IPs with X-Forwarded-For, "+
+		"to exercise per IP rate limits (disabled by default)")
+	statusOnly := flag.Bool("status-only", false, "don't read apm-server responses, only their status, "+
+		"for maximum throughput (events accepted and rejected, needed by -assert-min-throughput, are not reported)")
 
 	// convenience for https://www.elastic.co/guide/en/apm/agent/go/current/configuration.html
 	serviceName := os.Getenv("ELASTIC_APM_SERVICE_NAME")
 	if serviceName == "" {
 		serviceName = *flag.String("service-name", "hey-service", "service name") // ELASTIC_APM_SERVICE_NAME
 	}
+	serviceVersion := flag.String("service-version", "", "service version")             // ELASTIC_APM_SERVICE_VERSION
+	serviceEnvironment := flag.String("service-environment", "", "service environment") // ELASTIC_APM_ENVIRONMENT
+	kubernetes := flag.Bool("kubernetes", false, "add synthetic kubernetes metadata (namespace, node, pod)")
 	// apm-server options
 	apmServerSecret := flag.String("apm-secret", "", "apm server secret token") // ELASTIC_APM_SECRET_TOKEN
-	apmServerAPIKey := flag.String("api-key", "", "APM API yey")
+	apmServerAPIKey := flag.String("api-key", "", "APM API key, base64 encoded or as id:key")
 	apmServerUrl := flag.String("apm-url", "http://localhost:8200", "apm server url") // ELASTIC_APM_SERVER_URL
 
+	selfApmServerUrl := flag.String("self-apm-url", "", "apm server url to instrument hey-apm itself (disabled by default)")
+	selfApmServerSecret := flag.String("self-apm-secret", "", "secret token of the apm server instrumenting hey-apm")
+	selfApmServerAPIKey := flag.String("self-api-key", "", "API key of the apm server instrumenting hey-apm")
+
 	elasticsearchUrl := flag.String("es-url", "http://localhost:9200", "elasticsearch url for reporting")
 	elasticsearchAuth := flag.String("es-auth", "", "elasticsearch username:password reporting")
 
 	apmElasticsearchUrl := flag.String("apm-es-url", "http://localhost:9200", "elasticsearch output host for apm-server under load")
 	apmElasticsearchAuth := flag.String("apm-es-auth", "", "elasticsearch output username:password for apm-server under load")
+	mirrorUrl := flag.String("mirror-url", "", "second apm-server receiving a copy of every request at the same time, "+
+		"eg. a Fleet managed one to compare with a standalone one, reported alongside the apm-server under load")
+	mirrorSecret := flag.String("mirror-secret", "", "secret token of the -mirror-url apm-server")
+	mirrorAPIKey := flag.String("mirror-api-key", "", "API key of the -mirror-url apm-server")
+	mirrorElasticsearchUrl := flag.String("mirror-es-url", "", "elasticsearch output host for the -mirror-url apm-server "+
+		"(-apm-es-url by default)")
+	mirrorElasticsearchAuth := flag.String("mirror-es-auth", "", "elasticsearch output username:password "+
+		"for the -mirror-url apm-server")
+	expvar := flag.Bool("expvar", true, "query apm-server memory stats and queued events from its /debug/vars endpoint "+
+		"(-E apm-server.expvar.enabled=true), not exposed under Elastic Agent")
+	monitoringUrl := flag.String("monitoring-url", "", "apm-server monitoring endpoint (http.enabled), "+
+		"eg. http://localhost:5066, to report its cpu and memory usage")
+	metricsIndex := flag.String("metrics-index", "", "index pattern with metricbeat system metrics of the apm-server host "+
+		"in the elasticsearch used by apm-server, eg. metricbeat-*, to report host cpu, memory and disk usage")
+	apmLogs := flag.String("apm-logs", "", "apm-server log file, or docker:<container>, to count the errors and warnings "+
+		"it logs during the run")
+	cleanup := flag.Bool("cleanup", false, "delete the transactions, spans and errors generated by the run "+
+		"from the elasticsearch used by apm-server, once the report is created")
+	indexStats := flag.Bool("index-stats", false, "report the bytes stored by apm-server indices during the run, "+
+		"and per event indexed")
+	forcemerge := flag.Bool("forcemerge", false, "refresh and force merge apm-server indices before measuring their size "+
+		"(only in combination with -index-stats)")
+	checkAggregation := flag.Bool("check-aggregation", false, "compare the transaction and service destination metrics "+
+		"aggregated by apm-server for -service-name with the transactions indexed and the exit spans sent per destination, "+
+		"and fail the run when their counts or duration sums differ by more than -aggregation-tolerance "+
+		"(use a service name not shared with other runs)")
+	aggregationTolerance := flag.Float64("aggregation-tolerance", 1, "percentage by which aggregated counts and "+
+		"duration sums may differ from the expected ones (only in combination with -check-aggregation)")
+	metricsHost := flag.String("metrics-host", "", "host.name of the apm-server host in -metrics-index (all hosts by default)")
 
+	isFuzz := flag.Bool("fuzz", false, "send events exercising the edges of the intake schema, one per request, "+
+		"and print which ones are accepted or rejected instead of running a workload")
+	fuzzOutput := flag.String("fuzz-output", "", "file to save the results of -fuzz to as JSON")
 	isBench := flag.Bool("bench", false, "execute a benchmark with fixed parameters")
 	regressionMargin := flag.Float64("rm", 1.1, "margin of acceptable performance decrease to not consider a regression (only in combination with -bench)")
 	regressionDays := flag.String("rd", "7", "number of days back to check for regressions (only in combination with -bench)")
@@ -63,31 +320,308 @@ func parseFlags() models.Input {
 		"generate errors up to once in this duration (only if -bench is not passed)")
 	errorFrameMaxLimit := flag.Int("ex", 10, "max error frames to per error (only if -bench is not passed)")
 	errorFrameMinLimit := flag.Int("em", 0, "max error frames to per error (only if -bench is not passed)")
+	errorLibraryFrames := flag.Float64("error-library-frames", 0, "fraction of error stacktrace frames "+
+		"belonging to vendored libraries, between 0 and 1 (only if -bench is not passed)")
+	errorSourceLines := flag.Int("error-source-lines", 0, "lines of source code before and after each "+
+		"error stacktrace frame (only if -bench is not passed)")
+	errorTypes := flag.Int("error-types", 1, "distinct exception types of generated errors (only if -bench is not passed)")
+	errorMessages := flag.Int("error-messages", 1, "distinct messages of generated errors (only if -bench is not passed)")
+	errorCulprits := flag.Int("error-culprits", 1, "distinct culprits of generated errors (only if -bench is not passed)")
+	errorCauseDepth := flag.Int("error-cause-depth", 0, "errors wrapped by each generated error (only if -bench is not passed)")
+	errorLogRatio := flag.Float64("error-log-ratio", 0, "fraction of errors generated as log records "+
+		"instead of exceptions, between 0 and 1 (only if -bench is not passed)")
 	spanMaxLimit := flag.Int("sx", 10, "max spans to per transaction (only if -bench is not passed)")
 	spanMinLimit := flag.Int("sm", 1, "min spans to per transaction (only if -bench is not passed)")
+	transactionNames := flag.String("tx-names", "", "catalog of transaction names picked in proportion to their "+
+		"weights: zipf:<n>[:<exponent>] for n endpoints with Zipf distributed weights, eg. zipf:20, or a file with "+
+		"a name and optional weight per line, eg. GET /users,5 (a single name by default, only if -bench is not passed)")
+	uniqueNames := flag.Float64("unique-tx-names", 0, "fraction of transactions with a name of their own, "+
+		"to explode the cardinality of transaction groups aggregated by apm-server, between 0 and 1 "+
+		"(only if -bench is not passed)")
+	transactionDuration := flag.String("td", "", "transaction duration distribution: fixed:<d>, normal:<mean>:<stddev> "+
+		"or lognormal:<median>:<sigma>, eg. normal:100ms:20ms (transactions end immediately by default, only if -bench is not passed)")
+	spanDuration := flag.String("sd", "", "span duration distribution, same format as -td (only if -bench is not passed)")
+	httpHeaders := flag.Int("http-headers", 0, "HTTP request headers set in the transaction context, "+
+		"on top of Content-Type and Authorization (only if -bench is not passed)")
+	httpBody := flag.String("http-body", "", "size of the HTTP request body captured in the transaction context, "+
+		"eg. 2kb (only if -bench is not passed)")
+	users := flag.Int("users", 0, "distinct users set in the context of transactions and errors "+
+		"(no user context by default, only if -bench is not passed)")
+	customDepth := flag.Int("custom-depth", 0, "nesting depth of a custom context object set in transactions "+
+		"and errors (no custom context by default, only if -bench is not passed)")
+	customSize := flag.Int("custom-size", 5, "fields per nesting level of the custom context object "+
+		"(only if -bench is not passed)")
+	spanTypes := flag.Int("st", 1, "distinct span types per transaction (only if -bench is not passed)")
+	spanDepth := flag.Int("span-depth", 1, "levels of the span trees under each transaction, spans are direct "+
+		"children of the transaction if 1 (only if -bench is not passed)")
+	spanFanOut := flag.Int("span-fan-out", 2, "children of each span but the deepest ones, with -span-depth "+
+		"greater than 1 (only if -bench is not passed)")
+	breakdown := flag.Bool("breakdown", false, "enable agent breakdown metrics, sent every -metrics-interval")
+	metricsInterval := flag.Duration("metrics-interval", 0, "interval at which the agent sends metrics, "+
+		"30s if unset and -breakdown is passed (disabled by default)")
+	exitSpans := flag.Int("xs", 0, "identical consecutive exit spans per transaction, on top of -sm/-sx, "+
+		"to exercise span compression (only if -bench is not passed)")
+	compressSpans := flag.Bool("compress-spans", false, "send consecutive identical exit spans, as given by -xs, "+
+		"as a composite span, as agents with span compression do (only if -bench is not passed)")
+	droppedSpans := flag.Float64("dropped-spans", 0, "fraction of transactions exceeding the max spans, "+
+		"that drop between 1 and -sx exit spans reported in span_count.dropped and dropped_spans_stats, between 0 and 1 "+
+		"(only if -bench is not passed)")
+	longTransactions := flag.Int("long-transactions", 0, "transactions kept open until the run stops, on top of "+
+		"the others, each one streaming a span every -long-span-interval (only if -bench is not passed)")
+	longSpanInterval := flag.Duration("long-span-interval", time.Second, "interval at which each long transaction "+
+		"ends a span (only if -bench is not passed)")
 	transactionLimit := flag.Int("t", math.MaxInt64, "max transactions to generate (only if -bench is not passed)")
 	transactionFrequency := flag.Duration("tf", 1*time.Nanosecond, "transaction frequency. "+
 		"generate transactions up to once in this duration (only if -bench is not passed)")
+	rateCurve := flag.String("rate-curve", "", "CSV file with a 24 hour curve of time of the day (HH:MM) and "+
+		"multiplier of the -tf and -ef rates, compressed into the -run duration to play day/night traffic patterns")
+	phases := flag.String("phases", "", "comma separated phases of the run as name:duration:multiplier of the "+
+		"-tf and -ef rates, or name:duration:from-to ramping the multiplier linearly, eg. ramp:1m:0-1,hold:5m:1, "+
+		"reporting stats per phase (the last one lasts until the run stops)")
+	procs := flag.Int("procs", 1, "processes generating the workload, each one its share of it, "+
+		"to sidestep contention of the Go runtime at extreme rates; their stats are merged into a single report")
+	shardIndex := flag.Int("shard", 0, "share of the workload generated by this process (internal, set by -procs)")
+	shardOutput := flag.String("shard-output", "", "file to write the stats of a shard to (internal, set by -procs)")
+	goMaxProcs := flag.Int("gomaxprocs", 0, "maximum CPUs hey-apm uses at once (all by default)")
+	generatorGoroutines := flag.Int("generator-goroutines", 1, "goroutines generating each event type, "+
+		"sharing their rate and limits")
+	lockThreads := flag.Bool("lock-threads", false, "lock every generator goroutine to its own OS thread, "+
+		"for reproducible scheduling of hey-apm across runs")
+	bucketSize := flag.Duration("buckets", 0, "record throughput, errors and latency in buckets of time "+
+		"of this duration into the report, eg. 1s or 10s (disabled by default)")
+	spikeAt := flag.Duration("spike-at", 0, "time since the start of the run at which the -tf and -ef rates spike")
+	spikeFor := flag.Duration("spike-for", 0, "how long the spike lasts, comparing stats before, during "+
+		"and after it (disabled by default)")
+	spikeFactor := flag.Float64("spike-factor", 10, "multiplier of the -tf and -ef rates during the spike")
+
+	scriptFile := flag.String("script", "", "customize every event sent with the script in this file, setting "+
+		"fields from expressions, eg. transaction.name = \"GET /users/\" + counter(\"users\") % 100 (see the README)")
+	var feeds stringsFlag
+	flag.Var(&feeds, "feed", "make the rows of a CSV or JSON file available to -script as a data feed, as name=path, "+
+		"eg. users=users.csv, referred to as feed(\"users\", \"id\") or \"{{users.id}}\" (can be repeated)")
+	feedOrder := flag.String("feed-order", "cycle", "whether rows of data feeds are given to events in order, "+
+		"starting over at the end (cycle), or at random, weighted by their weight column if any (sample)")
+	generatorCmd := flag.String("generator-cmd", "", "command generating custom events as JSON lines in its standard "+
+		"output, eg. {\"transaction\": {\"name\": \"GET /\", \"duration\": 12.5}}, sent as the external event type "+
+		"(see the README)")
+	generatorFrequency := flag.Duration("generator-freq", 1*time.Nanosecond, "send events of -generator-cmd "+
+		"up to once in this duration")
+	eventTypes := flag.String("events", "", "comma separated event types to generate, one or more of: "+
+		strings.Join(worker.EventTypes(), ", ")+" (all by default, only if -bench is not passed)")
+
+	var targets stringsFlag
+	flag.Var(&targets, "target", "run concurrently a workload of its own, overriding options as comma separated "+
+		"key=value pairs, eg: name=rum,apm-url=http://localhost:8201,tf=10ms; with targets, only they run, and are also "+
+		"reported in aggregate (can be repeated, only if -bench is not passed)")
+	scenarioFile := flag.String("scenario", "", "JSON file describing a fleet of services run as concurrent targets, "+
+		"each one with its own options named after flags, eg. rates, span counts and labels (see the README, "+
+		"only if -bench is not passed)")
+	tenants := flag.Int("tenants", 0, "simulate this many tenants as concurrent targets, each with its own "+
+		"service name, credentials and share of the transaction and error rates (only if -bench is not passed)")
+	tenantSecrets := flag.String("tenant-secrets", "", "comma separated secret tokens, one per tenant")
+	tenantAPIKeys := flag.String("tenant-api-keys", "", "comma separated API keys, one per tenant")
+	tenantShares := flag.String("tenant-shares", "", "comma separated relative shares of the rates given by -tf and -ef, "+
+		"one per tenant, eg. 50,30,20 (equal shares by default)")
+	eventsPerSecond := flag.Float64("eps", 0, "total events per second to generate, split by -mix, "+
+		"instead of -tf, -ef, -sm and -sx (only if -bench is not passed)")
+	mix := flag.String("mix", presets.DefaultMix, "percentage of -eps of each event type, as comma separated "+
+		"type=percentage pairs adding up to 100 (only in combination with -eps)")
+	preset := flag.String("preset", "", "named workload, overridden by any flags passed: "+
+		strings.Join(presets.Names(), ", ")+" (only if -bench is not passed)")
+	endpoint := flag.String("endpoint", "", "how apm-server runs, setting the options to reach it unless passed: "+
+		strings.Join(presets.EndpointNames(), ", "))
+	cloudDeployment := flag.String("cloud-deployment", "", "Elastic Cloud deployment Id, to resolve -apm-url and "+
+		"-apm-es-url with the Elastic Cloud API and tag reports with the deployment size and plan")
+	cloudAPIKey := flag.String("cloud-api-key", os.Getenv("EC_API_KEY"), "Elastic Cloud API key "+
+		"(only in combination with -cloud-deployment or -cloud-provision, $EC_API_KEY by default)")
+	cloudAPIUrl := flag.String("cloud-api-url", cloud.DefaultApiUrl, "Elastic Cloud API url "+
+		"(only in combination with -cloud-deployment or -cloud-provision)")
+	cloudProvision := flag.String("cloud-provision", "", "JSON file with an Elastic Cloud create deployment request, "+
+		"to create a deployment, run against it and shut it down afterwards (requires -cloud-api-key)")
+	hourlyCost := flag.Float64("hourly-cost", 0, "price per hour of the deployment under test, apm-server and "+
+		"elasticsearch, to report the cost per million events indexed (in any currency)")
+	costPerGBHour := flag.Float64("cost-per-gb-hour", 0, "price per hour of each GB of memory of the Elastic Cloud "+
+		"deployment under test, to estimate its price per hour if -hourly-cost is not passed "+
+		"(only in combination with -cloud-deployment or -cloud-provision)")
+	cloudKeep := flag.Bool("cloud-keep", false, "keep the deployment created with -cloud-provision running after the run")
 	flag.Parse()
+	if *endpoint != "" {
+		p, ok := presets.GetEndpoint(*endpoint)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown endpoint %q, must be one of: %s\n", *endpoint,
+				strings.Join(presets.EndpointNames(), ", "))
+			os.Exit(exitError)
+		}
+		if err := applyFlags(*endpoint, p); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+	}
+	if *cloudDeployment != "" && *cloudProvision != "" {
+		fmt.Fprintln(os.Stderr, "-cloud-deployment can't be combined with -cloud-provision")
+		os.Exit(exitError)
+	}
+	var deployment *models.CloudDeployment
+	if *cloudDeployment != "" {
+		d, err := applyCloudDeployment(*cloudAPIUrl, *cloudAPIKey, *cloudDeployment)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+		deployment = &d
+	}
+	if *eventsPerSecond != 0 {
+		if err := applyMix(*eventsPerSecond, *mix, *exitSpans); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+	}
+	if *preset != "" {
+		if err := applyPreset(*preset); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+	}
 
 	if *spanMaxLimit < *spanMinLimit {
 		spanMaxLimit = spanMinLimit
 	}
-
-	rand.Seed(*seed)
+	if *breakdown && *metricsInterval == 0 {
+		*metricsInterval = 30 * time.Second
+	}
 
 	input := models.Input{
-		IsBenchmark:          *isBench,
-		ApmServerUrl:         *apmServerUrl,
-		ApmServerSecret:      *apmServerSecret,
-		APIKey:               *apmServerAPIKey,
-		ElasticsearchUrl:     *elasticsearchUrl,
-		ElasticsearchAuth:    *elasticsearchAuth,
-		ApmElasticsearchUrl:  *apmElasticsearchUrl,
-		ApmElasticsearchAuth: *apmElasticsearchAuth,
-		ServiceName:          serviceName,
-		RunTimeout:           *runTimeout,
-		FlushTimeout:         *flushTimeout,
+		IsBenchmark:           *isBench,
+		ApmServerUrl:          *apmServerUrl,
+		ApmServerSecret:       *apmServerSecret,
+		APIKey:                *apmServerAPIKey,
+		ElasticsearchUrl:      *elasticsearchUrl,
+		ElasticsearchAuth:     *elasticsearchAuth,
+		ApmElasticsearchUrl:   *apmElasticsearchUrl,
+		ApmElasticsearchAuth:  *apmElasticsearchAuth,
+		SkipExpvar:            !*expvar,
+		MonitoringUrl:         *monitoringUrl,
+		MetricsIndex:          *metricsIndex,
+		MetricsHost:           *metricsHost,
+		IndexStats:            *indexStats,
+		Cleanup:               *cleanup,
+		ApmLogs:               *apmLogs,
+		Forcemerge:            *forcemerge,
+		CheckAggregation:      *checkAggregation,
+		AggregationTolerance:  *aggregationTolerance,
+		ServiceName:           serviceName,
+		ServiceVersion:        *serviceVersion,
+		ServiceEnvironment:    *serviceEnvironment,
+		KubernetesMetadata:    *kubernetes,
+		BreakdownMetrics:      *breakdown,
+		MetricsInterval:       *metricsInterval,
+		RunTimeout:            *runTimeout,
+		ProbeInterval:         *probeInterval,
+		ChaosDowntime:         *chaosDowntime,
+		ConfigAgents:          *configAgents,
+		ConfigPollInterval:    *configPollInterval,
+		IdleAgents:            *idleAgents,
+		IdleHeartbeatInterval: *idleHeartbeat,
+		InfoInterval:          *infoInterval,
+		SourcemapInterval:     *sourcemapInterval,
+		ClockSkew:             *clockSkew,
+		IDCollisionRatio:      *idCollisions,
+		EdgeStringRatio:       *edgeStrings,
+		FlushTimeout:          *flushTimeout,
+		DrainTimeout:          *drainTimeout,
+		SelfApmServerUrl:      *selfApmServerUrl,
+		SelfApmServerSecret:   *selfApmServerSecret,
+		SelfAPIKey:            *selfApmServerAPIKey,
+		PushgatewayUrl:        *pushgatewayUrl,
+		SamplesFile:           *samplesFile,
+		RecordFile:            *recordFile,
+		RecordOnly:            *recordOnly,
+		ScrubRules:            *scrubRules,
+		SentEventsFile:        *sentEventsFile,
+		SentEventsEvery:       *sentEventsEvery,
+		ReportsDir:            *reportsDir,
+		RenderFile:            *renderFile,
+		NotifyUrl:             *notifyUrl,
+		KibanaUrl:             *kibanaUrl,
+		KibanaAuth:            *kibanaAuth,
+		GrafanaUrl:            *grafanaUrl,
+		GrafanaToken:          *grafanaToken,
+		AnnotateElasticsearch: *annotate,
+		MaxRequestErrors:      *maxRequestErrors,
+		MaxErrorRate:          *maxErrorRate,
+		AssertMaxDropRate:     *assertMaxDropRate,
+		AssertP99Latency:      *assertP99Latency,
+		AssertMinThroughput:   *assertMinThroughput,
+		StatusOnly:            *statusOnly,
+		Latency:               *latency,
+		LatencyJitter:         *latencyJitter,
+		ResetRatio:            *resetRate,
+		OutOfOrderRatio:       *outOfOrder,
+		OTelAttributes:        *otelAttributes,
+		RUM:                   *rum,
+		ClientIPs:             *clientIPs,
+		Preset:                *preset,
+		Fuzz:                  *isFuzz,
+		FuzzOutput:            *fuzzOutput,
+	}
+	input.Cloud = deployment
+	input.HourlyCost, input.CostPerGBHour = *hourlyCost, *costPerGBHour
+	input.ApdexThreshold, input.AssertMinApdex = *apdexThreshold, *assertMinApdex
+	input.RateCurve, input.Phases, input.BucketSize = *rateCurve, *phases, *bucketSize
+	input.GoMaxProcs, input.GeneratorGoroutines, input.LockThreads = *goMaxProcs, *generatorGoroutines, *lockThreads
+	input.Procs, input.ShardIndex, input.ShardOutput = *procs, *shardIndex, *shardOutput
+	input.Seed = *seed
+	input.ManifestFile, input.Progress = *manifestFile, *progress
+	input.Config = make(map[string]string)
+	flag.VisitAll(func(f *flag.Flag) {
+		if !isCredential(f.Name) {
+			input.Config[f.Name] = f.Value.String()
+		}
+	})
+	flag.Visit(func(f *flag.Flag) {
+		input.FlagsSet = append(input.FlagsSet, f.Name)
+		if f.Name == "replay-seed" {
+			input.Seed = *replaySeed
+		}
+	})
+	if input.Procs > 1 && input.ShardOutput == "" {
+		input.ShardArgs = os.Args[1:]
+	}
+	if *spikeFor > 0 {
+		input.SpikeAt, input.SpikeDuration, input.SpikeFactor = *spikeAt, *spikeFor, *spikeFactor
+	}
+	if *eventsPerSecond != 0 {
+		input.EventsPerSecond, input.Mix = *eventsPerSecond, *mix
+	}
+	if *cloudProvision != "" {
+		input.CloudProvision, input.CloudKeep = *cloudProvision, *cloudKeep
+		input.CloudApiUrl, input.CloudApiKey = *cloudAPIUrl, *cloudAPIKey
+	}
+	if *mirrorUrl != "" {
+		input.MirrorUrl, input.MirrorSecret, input.MirrorAPIKey = *mirrorUrl, *mirrorSecret, *mirrorAPIKey
+		input.MirrorElasticsearchUrl, input.MirrorElasticsearchAuth = *mirrorElasticsearchUrl, *mirrorElasticsearchAuth
+	}
+	if *maxBps != "" {
+		bps, err := conv.ParseByteCount(*maxBps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -max-bps: "+err.Error())
+			os.Exit(exitError)
+		}
+		input.MaxBytesPerSecond = bps
+	}
+	if *tracestate != "" {
+		input.TraceState = strings.Split(*tracestate, ",")
+	}
+	if *baggage != "" {
+		input.Baggage = strings.Split(*baggage, ",")
+	}
+	for _, offset := range splitList(*chaos) {
+		d, err := time.ParseDuration(offset)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -chaos offset: "+err.Error())
+			os.Exit(exitError)
+		}
+		input.ChaosSchedule = append(input.ChaosSchedule, d)
 	}
 
 	if *isBench {
@@ -99,14 +633,396 @@ func parseFlags() models.Input {
 		return input
 	}
 
+	input.Iterations = *iterations
+	input.Cooldown = *cooldown
+	input.EventTypes = splitList(*eventTypes)
+	input.GeneratorCmd, input.GeneratorFrequency = *generatorCmd, *generatorFrequency
+	input.ScriptFile = *scriptFile
+	input.Feeds = feeds
+	input.FeedOrder = *feedOrder
 	input.TransactionFrequency = *transactionFrequency
 	input.TransactionLimit = *transactionLimit
 	input.SpanMaxLimit = *spanMaxLimit
 	input.SpanMinLimit = *spanMinLimit
+	input.TransactionNames = *transactionNames
+	input.UniqueNameRatio = *uniqueNames
+	input.TransactionDuration = *transactionDuration
+	input.SpanDuration = *spanDuration
+	input.SpanTypes = *spanTypes
+	input.SpanDepth = *spanDepth
+	input.SpanFanOut = *spanFanOut
+	input.HTTPHeaders = *httpHeaders
+	input.Users = *users
+	input.CustomContextDepth = *customDepth
+	input.CustomContextSize = *customSize
+	if *httpBody != "" {
+		size, err := conv.ParseByteCount(*httpBody)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -http-body: "+err.Error())
+			os.Exit(exitError)
+		}
+		input.HTTPBodySize = size
+	}
+	input.ExitSpans = *exitSpans
+	input.CompressSpans = *compressSpans
+	input.DroppedSpansRatio = *droppedSpans
+	input.LongTransactions = *longTransactions
+	input.LongSpanInterval = *longSpanInterval
 	input.ErrorFrequency = *errorFrequency
 	input.ErrorLimit = *errorLimit
 	input.ErrorFrameMaxLimit = *errorFrameMaxLimit
 	input.ErrorFrameMinLimit = *errorFrameMinLimit
+	input.ErrorLibraryFrames = *errorLibraryFrames
+	input.ErrorSourceLines = *errorSourceLines
+	input.ErrorTypes = *errorTypes
+	input.ErrorMessages = *errorMessages
+	input.ErrorCulprits = *errorCulprits
+	input.ErrorCauseDepth = *errorCauseDepth
+	input.ErrorLogRatio = *errorLogRatio
+
+	for idx, spec := range targets {
+		target, err := parseTarget(input, spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+		if target.TargetName == "" {
+			target.TargetName = strconv.Itoa(idx + 1)
+		}
+		input.Targets = append(input.Targets, target)
+	}
+	if *scenarioFile != "" {
+		services, err := scenarioTargets(input, *scenarioFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+		input.Targets = append(input.Targets, services...)
+	}
+	if *tenants > 0 {
+		tenantInputs, err := tenantTargets(input, *tenants, splitCredentials(*tenantSecrets),
+			splitCredentials(*tenantAPIKeys), splitList(*tenantShares))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			os.Exit(exitError)
+		}
+		input.Targets = append(input.Targets, tenantInputs...)
+	}
 
 	return input
 }
+
+// applyPreset sets the flags of the named preset, unless they were passed explicitly.
+func applyPreset(name string) error {
+	p, ok := presets.Get(name)
+	if !ok {
+		return fmt.Errorf("unknown preset %q, must be one of: %s", name, strings.Join(presets.Names(), ", "))
+	}
+	return applyFlags(name, p)
+}
+
+// applyMix sets the flags generating the given events per second in the percentages of mix.
+// It fails if any of them was passed explicitly, as they would contradict the mix.
+func applyMix(eventsPerSecond float64, mix string, exitSpans int) error {
+	p, err := presets.Mix(eventsPerSecond, mix, exitSpans)
+	if err != nil {
+		return errors.New("-mix: " + err.Error())
+	}
+	var conflicts []string
+	flag.Visit(func(f *flag.Flag) {
+		if _, ok := p.Flags[f.Name]; ok {
+			conflicts = append(conflicts, "-"+f.Name)
+		}
+	})
+	if len(conflicts) > 0 {
+		return fmt.Errorf("-eps can't be combined with %s", strings.Join(conflicts, ", "))
+	}
+	return applyFlags("-eps", p)
+}
+
+// applyFlags sets the flags of a preset, unless they were passed explicitly.
+func applyFlags(name string, p presets.Preset) error {
+	passed := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		passed[f.Name] = true
+	})
+	for k, v := range p.Flags {
+		if passed[k] {
+			continue
+		}
+		if err := flag.Set(k, v); err != nil {
+			return fmt.Errorf("invalid preset %s: -%s %s: %s", name, k, v, err)
+		}
+	}
+	return nil
+}
+
+// applyCloudDeployment sets the apm-server and elasticsearch urls of an Elastic Cloud deployment,
+// unless they were passed explicitly, and returns its size and plan.
+// apm-server doesn't expose its /debug/vars endpoint in Elastic Cloud.
+func applyCloudDeployment(apiUrl, apiKey, id string) (models.CloudDeployment, error) {
+	if apiKey == "" {
+		return models.CloudDeployment{}, errors.New("-cloud-deployment requires -cloud-api-key or $EC_API_KEY")
+	}
+	d, err := cloud.GetDeployment(apiUrl, apiKey, id)
+	if err != nil {
+		return models.CloudDeployment{}, err
+	}
+	apmUrl, err := d.ApmUrl()
+	if err != nil {
+		return models.CloudDeployment{}, err
+	}
+	esUrl, err := d.ElasticsearchUrl()
+	if err != nil {
+		return models.CloudDeployment{}, err
+	}
+	p := presets.Preset{Flags: map[string]string{"apm-url": apmUrl, "apm-es-url": esUrl, "expvar": "false"}}
+	return d.Summary(), applyFlags("cloud deployment "+id, p)
+}
+
+// isCredential returns whether a flag takes a secret token, API key, password or similar,
+// not to be written anywhere.
+func isCredential(name string) bool {
+	for _, s := range []string{"secret", "auth", "api-key", "token"} {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// setAgentEnv sets the Go agent options that can only be configured with environment variables.
+// See https://www.elastic.co/guide/en/apm/agent/go/current/configuration.html
+func setAgentEnv(input models.Input) {
+	os.Setenv("ELASTIC_APM_BREAKDOWN_METRICS", strconv.FormatBool(input.BreakdownMetrics))
+	if input.KubernetesMetadata {
+		b := make([]byte, 16)
+		random.New(input.Seed, "kubernetes").Read(b)
+		os.Setenv("KUBERNETES_NAMESPACE", "generated")
+		os.Setenv("KUBERNETES_NODE_NAME", "generated-node")
+		os.Setenv("KUBERNETES_POD_NAME", fmt.Sprintf("generated-%x", b[:4]))
+		os.Setenv("KUBERNETES_POD_UID", fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]))
+	}
+}
+
+// splitList splits a list of values separated by commas, or by colons when given as target options.
+func splitList(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ':' })
+}
+
+// splitCredentials splits comma separated secret tokens or API keys, which may contain colons, as id:key.
+func splitCredentials(v string) []string {
+	return strings.FieldsFunc(v, func(r rune) bool { return r == ',' })
+}
+
+// parseTarget returns a copy of input with the options in spec overridden.
+// spec is a comma separated list of key=value pairs, with keys named after command line flags.
+func parseTarget(input models.Input, spec string) (models.Input, error) {
+	// targets don't nest
+	input.Targets = nil
+	for _, kv := range strings.Split(spec, ",") {
+		k, v := strcoll.SplitKV(kv, "=")
+		if err := setTargetOption(&input, k, v); err != nil {
+			return input, fmt.Errorf("invalid target %q: %s", spec, err)
+		}
+	}
+	if input.SpanMaxLimit < input.SpanMinLimit {
+		input.SpanMaxLimit = input.SpanMinLimit
+	}
+	return input, nil
+}
+
+// setTargetOption overrides an option of a target, named after its command line flag.
+func setTargetOption(input *models.Input, k, v string) error {
+	var err error
+	switch k {
+	case "name":
+		input.TargetName = v
+	case "apm-url":
+		input.ApmServerUrl = v
+	case "apm-secret":
+		input.ApmServerSecret = v
+	case "api-key":
+		input.APIKey = v
+	case "service-name":
+		input.ServiceName = v
+	case "service-version":
+		input.ServiceVersion = v
+	case "service-environment":
+		input.ServiceEnvironment = v
+	case "t":
+		input.TransactionLimit, err = strconv.Atoi(v)
+	case "tf":
+		input.TransactionFrequency, err = time.ParseDuration(v)
+	case "rate-curve":
+		input.RateCurve = v
+	case "spike-at":
+		input.SpikeAt, err = time.ParseDuration(v)
+	case "spike-for":
+		input.SpikeDuration, err = time.ParseDuration(v)
+	case "spike-factor":
+		input.SpikeFactor, err = strconv.ParseFloat(v, 64)
+	case "sx":
+		input.SpanMaxLimit, err = strconv.Atoi(v)
+	case "sm":
+		input.SpanMinLimit, err = strconv.Atoi(v)
+	case "tx-names":
+		input.TransactionNames = v
+	case "unique-tx-names":
+		input.UniqueNameRatio, err = strconv.ParseFloat(v, 64)
+	case "td":
+		input.TransactionDuration = v
+		_, err = distribution.Parse(v)
+	case "sd":
+		input.SpanDuration = v
+		_, err = distribution.Parse(v)
+	case "http-headers":
+		input.HTTPHeaders, err = strconv.Atoi(v)
+	case "http-body":
+		input.HTTPBodySize, err = conv.ParseByteCount(v)
+	case "users":
+		input.Users, err = strconv.Atoi(v)
+	case "custom-depth":
+		input.CustomContextDepth, err = strconv.Atoi(v)
+	case "custom-size":
+		input.CustomContextSize, err = strconv.Atoi(v)
+	case "st":
+		input.SpanTypes, err = strconv.Atoi(v)
+	case "span-depth":
+		input.SpanDepth, err = strconv.Atoi(v)
+	case "span-fan-out":
+		input.SpanFanOut, err = strconv.Atoi(v)
+	case "xs":
+		input.ExitSpans, err = strconv.Atoi(v)
+	case "compress-spans":
+		input.CompressSpans, err = strconv.ParseBool(v)
+	case "dropped-spans":
+		input.DroppedSpansRatio, err = strconv.ParseFloat(v, 64)
+	case "long-transactions":
+		input.LongTransactions, err = strconv.Atoi(v)
+	case "long-span-interval":
+		input.LongSpanInterval, err = time.ParseDuration(v)
+	case "e":
+		input.ErrorLimit, err = strconv.Atoi(v)
+	case "ef":
+		input.ErrorFrequency, err = time.ParseDuration(v)
+	case "ex":
+		input.ErrorFrameMaxLimit, err = strconv.Atoi(v)
+	case "em":
+		input.ErrorFrameMinLimit, err = strconv.Atoi(v)
+	case "error-library-frames":
+		input.ErrorLibraryFrames, err = strconv.ParseFloat(v, 64)
+	case "error-source-lines":
+		input.ErrorSourceLines, err = strconv.Atoi(v)
+	case "error-types":
+		input.ErrorTypes, err = strconv.Atoi(v)
+	case "error-messages":
+		input.ErrorMessages, err = strconv.Atoi(v)
+	case "error-culprits":
+		input.ErrorCulprits, err = strconv.Atoi(v)
+	case "error-cause-depth":
+		input.ErrorCauseDepth, err = strconv.Atoi(v)
+	case "error-log-ratio":
+		input.ErrorLogRatio, err = strconv.ParseFloat(v, 64)
+	case "events":
+		input.EventTypes = splitList(v)
+	case "latency":
+		input.Latency, err = time.ParseDuration(v)
+	case "latency-jitter":
+		input.LatencyJitter, err = time.ParseDuration(v)
+	case "reset-rate":
+		input.ResetRatio, err = strconv.ParseFloat(v, 64)
+	case "out-of-order":
+		input.OutOfOrderRatio, err = strconv.ParseFloat(v, 64)
+	case "otel-attributes":
+		input.OTelAttributes, err = strconv.ParseBool(v)
+	case "max-bps":
+		input.MaxBytesPerSecond, err = conv.ParseByteCount(v)
+	case "status-only":
+		input.StatusOnly, err = strconv.ParseBool(v)
+	case "rum":
+		input.RUM, err = strconv.ParseBool(v)
+	case "client-ips":
+		input.ClientIPs, err = strconv.Atoi(v)
+	case "run":
+		input.RunTimeout, err = time.ParseDuration(v)
+	case "probe-interval":
+		input.ProbeInterval, err = time.ParseDuration(v)
+	case "config-agents":
+		input.ConfigAgents, err = strconv.Atoi(v)
+	case "idle-agents":
+		input.IdleAgents, err = strconv.Atoi(v)
+	case "info-interval":
+		input.InfoInterval, err = time.ParseDuration(v)
+	case "sourcemap-interval":
+		input.SourcemapInterval, err = time.ParseDuration(v)
+	case "clock-skew":
+		input.ClockSkew, err = time.ParseDuration(v)
+	case "id-collisions":
+		input.IDCollisionRatio, err = strconv.ParseFloat(v, 64)
+	case "edge-strings":
+		input.EdgeStringRatio, err = strconv.ParseFloat(v, 64)
+	default:
+		err = fmt.Errorf("unknown option %q", k)
+	}
+	return err
+}
+
+// tenantTargets returns n targets derived from input, one per tenant, with their own service name and,
+// if given, secret token or API key. Tenants split the transaction and error rates of the input by their shares.
+func tenantTargets(input models.Input, n int, secrets, apiKeys, shares []string) ([]models.Input, error) {
+	if len(secrets) > 0 && len(secrets) != n {
+		return nil, fmt.Errorf("-tenant-secrets has %d values, expected %d", len(secrets), n)
+	}
+	if len(apiKeys) > 0 && len(apiKeys) != n {
+		return nil, fmt.Errorf("-tenant-api-keys has %d values, expected %d", len(apiKeys), n)
+	}
+	if len(shares) > 0 && len(shares) != n {
+		return nil, fmt.Errorf("-tenant-shares has %d values, expected %d", len(shares), n)
+	}
+	weights := make([]float64, n)
+	var total float64
+	for i := range weights {
+		weights[i] = 1
+		if len(shares) > 0 {
+			w, err := strconv.ParseFloat(shares[i], 64)
+			if err != nil || w <= 0 {
+				return nil, fmt.Errorf("invalid tenant share %q, must be a positive number", shares[i])
+			}
+			weights[i] = w
+		}
+		total += weights[i]
+	}
+
+	targets := make([]models.Input, n)
+	for i := range targets {
+		target := input
+		target.Targets = nil
+		target.TargetName = fmt.Sprintf("tenant-%d", i+1)
+		target.ServiceName = fmt.Sprintf("%s-tenant-%d", input.ServiceName, i+1)
+		if len(secrets) > 0 {
+			target.ApmServerSecret = secrets[i]
+		}
+		if len(apiKeys) > 0 {
+			target.APIKey = apiKeys[i]
+		}
+		// a tenant with a fraction f of the total rate generates events 1/f times less frequently
+		scale := total / weights[i]
+		target.TransactionFrequency = time.Duration(float64(input.TransactionFrequency) * scale)
+		target.ErrorFrequency = time.Duration(float64(input.ErrorFrequency) * scale)
+		targets[i] = target
+	}
+	return targets, nil
+}
+
+// stringsFlag collects the values of a flag that can be passed several times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, " ")
+}
+
+func (f *stringsFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
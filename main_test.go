@@ -1,12 +1,17 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/models"
 	"github.com/elastic/hey-apm/strcoll"
 	"github.com/stretchr/testify/assert"
 )
@@ -37,3 +42,126 @@ func TestDefaultInput(t *testing.T) {
 			fmt.Sprintf("field %s has zero value %v", k, v))
 	}
 }
+
+// parseArgs returns the input parsed from the given command line arguments, with flags defined anew.
+func parseArgs(args ...string) models.Input {
+	commandLine, osArgs := flag.CommandLine, os.Args
+	defer func() { flag.CommandLine, os.Args = commandLine, osArgs }()
+	flag.CommandLine = flag.NewFlagSet(osArgs[0], flag.PanicOnError)
+	os.Args = append([]string{osArgs[0]}, args...)
+	return parseFlags()
+}
+
+func TestParseMetricsFlags(t *testing.T) {
+	input := parseArgs("-breakdown")
+	assert.True(t, input.BreakdownMetrics)
+	assert.Equal(t, 30*time.Second, input.MetricsInterval)
+
+	input = parseArgs("-breakdown", "-metrics-interval", "5s")
+	assert.True(t, input.BreakdownMetrics)
+	assert.Equal(t, 5*time.Second, input.MetricsInterval)
+
+	input = parseArgs("-metrics-interval", "10s")
+	assert.False(t, input.BreakdownMetrics)
+	assert.Equal(t, 10*time.Second, input.MetricsInterval)
+}
+
+func TestSetAgentEnv(t *testing.T) {
+	defer os.Unsetenv("ELASTIC_APM_BREAKDOWN_METRICS")
+	setAgentEnv(parseArgs("-breakdown"))
+	assert.Equal(t, "true", os.Getenv("ELASTIC_APM_BREAKDOWN_METRICS"))
+	setAgentEnv(parseArgs())
+	assert.Equal(t, "false", os.Getenv("ELASTIC_APM_BREAKDOWN_METRICS"))
+}
+
+func TestParseTarget(t *testing.T) {
+	base := models.Input{ApmServerUrl: "http://localhost:8200", SpanMinLimit: 1, SpanMaxLimit: 10}
+	target, err := parseTarget(base, "name=rum,apm-url=http://localhost:8201,tf=10ms,sm=20")
+	assert.NoError(t, err)
+	assert.Equal(t, "rum", target.TargetName)
+	assert.Equal(t, "http://localhost:8201", target.ApmServerUrl)
+	assert.Equal(t, 10*time.Millisecond, target.TransactionFrequency)
+	assert.Equal(t, 20, target.SpanMaxLimit)
+	assert.Equal(t, "http://localhost:8200", base.ApmServerUrl)
+
+	// targets don't nest
+	base.Targets = []models.Input{target}
+	target, err = parseTarget(base, "name=backend")
+	assert.NoError(t, err)
+	assert.Nil(t, target.Targets)
+	base.Targets = nil
+
+	target, err = parseTarget(base, "name=broken,em=20,error-log-ratio=2")
+	assert.NoError(t, err)
+	assert.Equal(t, 20, target.ErrorFrameMinLimit)
+	assert.Equal(t, 2.0, target.ErrorLogRatio)
+
+	_, err = parseTarget(base, "tf=often")
+	assert.Error(t, err)
+	_, err = parseTarget(base, "foo=bar")
+	assert.Error(t, err)
+}
+
+func TestTenantTargets(t *testing.T) {
+	base := models.Input{ServiceName: "svc", TransactionFrequency: time.Millisecond, ErrorFrequency: 10 * time.Millisecond}
+	tenants, err := tenantTargets(base, 2, nil, []string{"key1", "key2"}, []string{"3", "1"})
+	assert.NoError(t, err)
+	assert.Len(t, tenants, 2)
+	assert.Equal(t, "tenant-2", tenants[1].TargetName)
+	assert.Equal(t, "svc-tenant-2", tenants[1].ServiceName)
+	assert.Equal(t, "key2", tenants[1].APIKey)
+	assert.Equal(t, 1333333*time.Nanosecond, tenants[0].TransactionFrequency)
+	assert.Equal(t, 4*time.Millisecond, tenants[1].TransactionFrequency)
+	assert.Equal(t, 40*time.Millisecond, tenants[1].ErrorFrequency)
+
+	_, err = tenantTargets(base, 3, []string{"secret"}, nil, nil)
+	assert.Error(t, err)
+	_, err = tenantTargets(base, 2, nil, nil, []string{"1", "-1"})
+	assert.Error(t, err)
+}
+
+func TestTenantCredentials(t *testing.T) {
+	input := parseArgs("-tenants", "2", "-tenant-secrets", "s3cr:et,other", "-tenant-api-keys", "id1:key1,id2:key2")
+	if assert.Len(t, input.Targets, 2) {
+		assert.Equal(t, "s3cr:et", input.Targets[0].ApmServerSecret)
+		assert.Equal(t, "other", input.Targets[1].ApmServerSecret)
+		assert.Equal(t, "id2:key2", input.Targets[1].APIKey)
+	}
+}
+
+func TestScenarioTargets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "scenario")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "fleet.json")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(`{"services": [
+		{"name": "checkout", "tf": "1ms", "sm": 20, "labels": {"team": "payments", "tier": 1}},
+		{"name": "inventory", "count": 2, "tf": "1s"}
+	]}`), 0644))
+
+	base := models.Input{ServiceName: "svc", TransactionFrequency: time.Millisecond, SpanMinLimit: 1, SpanMaxLimit: 10,
+		Labels: map[string]string{"env": "test"}}
+	targets, err := scenarioTargets(base, path)
+	assert.NoError(t, err)
+	if assert.Len(t, targets, 3) {
+		assert.Equal(t, "checkout", targets[0].ServiceName)
+		assert.Equal(t, 20, targets[0].SpanMaxLimit)
+		assert.Equal(t, map[string]string{"env": "test", "team": "payments", "tier": "1"}, targets[0].Labels)
+		assert.Equal(t, "inventory-2", targets[2].ServiceName)
+		assert.Equal(t, "inventory-2", targets[2].TargetName)
+		assert.Equal(t, time.Second, targets[2].TransactionFrequency)
+		assert.Equal(t, map[string]string{"env": "test"}, targets[2].Labels)
+	}
+
+	for _, services := range []string{
+		`[{"tf": "1ms"}]`,
+		`[{"name": "a", "tf": "often"}]`,
+		`[{"name": "a", "count": 0}]`,
+		`[{"name": "a"}, {"name": "a"}]`,
+		`[]`,
+	} {
+		assert.NoError(t, ioutil.WriteFile(path, []byte(`{"services": `+services+`}`), 0644))
+		_, err = scenarioTargets(base, path)
+		assert.Error(t, err, services)
+	}
+}
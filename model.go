@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/presets"
+)
+
+const modelUsage = `usage: hey-apm model [options]
+
+Derives a workload from the events indexed by apm-server in a time window of an existing deployment,
+and prints the hey-apm flags replaying it synthetically: total events per second and their mix,
+spans per transaction, transaction and span duration distributions, span types, users, error groups,
+and the share of the busiest services as tenants.
+
+options:
+`
+
+// modelCommand runs the `model` subcommand with the given arguments, and returns the exit code.
+func modelCommand(args []string) int {
+	fs := flag.NewFlagSet("model", flag.ExitOnError)
+	apmElasticsearchUrl := fs.String("apm-es-url", "http://localhost:9200", "elasticsearch with the apm indices to model")
+	apmElasticsearchAuth := fs.String("apm-es-auth", "", "elasticsearch username:password")
+	window := fs.Duration("window", time.Hour, "length of the time window to model")
+	end := fs.String("end", "", "end of the time window, as RFC3339 (now by default)")
+	service := fs.String("service-name", "", "only model the events of this service")
+	maxServices := fs.Int("max-services", 20, "model the busiest services, up to this many, as tenants")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), modelUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *window <= 0 || *maxServices <= 0 {
+		fs.Usage()
+		return exitError
+	}
+	to := time.Now()
+	if *end != "" {
+		var err error
+		if to, err = time.Parse(time.RFC3339, *end); err != nil {
+			fmt.Fprintln(os.Stderr, "invalid -end: "+err.Error())
+			return exitError
+		}
+	}
+
+	conn, err := es.NewConnection(*apmElasticsearchUrl, *apmElasticsearchAuth)
+	if err == nil {
+		var traffic es.Traffic
+		if traffic, err = es.QueryTraffic(conn, *service, to.Add(-*window), to, *maxServices); err == nil {
+			var flags []string
+			if flags, err = modelFlags(traffic, *window); err == nil {
+				fmt.Printf("%.0f transactions, %.0f spans and %.0f errors from %s to %s\n",
+					traffic.Transactions, traffic.Spans, traffic.Errors,
+					to.Add(-*window).Format(time.RFC3339), to.Format(time.RFC3339))
+				fmt.Println(strings.Join(flags, " "))
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	return exitSuccess
+}
+
+// modelFlags returns the command line flags generating the given traffic over a window of time.
+func modelFlags(traffic es.Traffic, window time.Duration) ([]string, error) {
+	total := traffic.Transactions + traffic.Spans + traffic.Errors
+	if total == 0 {
+		return nil, fmt.Errorf("no events found")
+	}
+	// percentages are rounded so that they still add up to 100
+	tx := math.Round(10000*traffic.Transactions/total) / 100
+	spans := math.Round(10000*traffic.Spans/total) / 100
+	if tx == 0 {
+		spans = 0
+	}
+	mix := fmt.Sprintf("transactions=%v,spans=%v,errors=%v", tx, spans, math.Round(100*(100-tx-spans))/100)
+	eps := math.Round(100*total/window.Seconds()) / 100
+	if _, err := presets.Mix(eps, mix, 0); err != nil {
+		return nil, err
+	}
+	flags := []string{fmt.Sprintf("-eps %v", eps), "-mix " + mix}
+
+	if d, ok := lognormal(traffic.TransactionDuration); ok && traffic.Transactions > 0 {
+		flags = append(flags, "-td "+d)
+	}
+	if d, ok := lognormal(traffic.SpanDuration); ok && traffic.Spans > 0 {
+		flags = append(flags, "-sd "+d)
+	}
+	if traffic.SpanTypes > 1 {
+		flags = append(flags, fmt.Sprintf("-st %.0f", traffic.SpanTypes))
+	}
+	if traffic.Users > 0 {
+		flags = append(flags, fmt.Sprintf("-users %.0f", traffic.Users))
+	}
+	if traffic.ErrorGroups > 1 {
+		flags = append(flags, fmt.Sprintf("-error-types %.0f", traffic.ErrorGroups))
+	}
+	if len(traffic.Services) > 1 {
+		services := append([]es.ServiceEvents(nil), traffic.Services...)
+		sort.SliceStable(services, func(i, j int) bool { return services[i].Events > services[j].Events })
+		shares := make([]string, len(services))
+		for i, s := range services {
+			shares[i] = fmt.Sprintf("%.0f", math.Max(1, math.Round(1000*s.Events/total)))
+		}
+		flags = append(flags, fmt.Sprintf("-tenants %d", len(services)),
+			"-tenant-shares "+strings.Join(shares, ","))
+	}
+	return flags, nil
+}
+
+// lognormal returns a lognormal distribution with the median and 90th percentile of the given durations,
+// in microseconds, as given to -td and -sd, or false if they are not known.
+func lognormal(percentiles map[string]float64) (string, bool) {
+	p50, ok := percentiles["50.0"]
+	p90 := percentiles["90.0"]
+	if !ok || p50 <= 0 {
+		return "", false
+	}
+	median := time.Duration(p50 * float64(time.Microsecond)).Round(time.Microsecond)
+	if p90 <= p50 {
+		return "fixed:" + median.String(), true
+	}
+	// the 90th percentile of a lognormal distribution is median * e^(1.2816 * sigma)
+	sigma := math.Log(p90/p50) / 1.2816
+	return fmt.Sprintf("lognormal:%s:%.2f", median, sigma), true
+}
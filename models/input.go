@@ -1,7 +1,10 @@
 package models
 
 import (
+	"fmt"
 	"time"
+
+	"github.com/elastic/hey-apm/random"
 )
 
 // Input holds all the parameters given to a load test work.
@@ -22,6 +25,14 @@ type Input struct {
 	ApmServerSecret string `json:"-"`
 	// API Key for communication between APM Server and the Go agent
 	APIKey string `json:"-"`
+	// URL of a second APM Server receiving a copy of every request sent to the one under test, to compare them
+	MirrorUrl string `json:"mirror_url,omitempty"`
+	// Secret token and API Key of the mirror APM Server
+	MirrorSecret string `json:"-"`
+	MirrorAPIKey string `json:"-"`
+	// URL and <username:password> of the Elasticsearch instance used by the mirror APM Server
+	MirrorElasticsearchUrl  string `json:"-"`
+	MirrorElasticsearchAuth string `json:"-"`
 	// If true, it will index the performance report of a run in ElasticSearch
 	SkipIndexReport bool `json:"-"`
 	// URL of the Elasticsearch instance used for indexing the performance report
@@ -32,13 +43,221 @@ type Input struct {
 	ApmElasticsearchUrl string `json:"elastic_url,omitempty"`
 	// <username:password> of the Elasticsearch instance used by APM Server
 	ApmElasticsearchAuth string `json:"-"`
+	// If true, APM Server memory stats and queued events are not queried from its /debug/vars endpoint,
+	// which is not exposed under Elastic Agent
+	SkipExpvar bool `json:"-"`
+	// URL of the APM Server monitoring endpoint, to query its CPU and memory usage
+	MonitoringUrl string `json:"-"`
+	// Index pattern with Metricbeat system metrics of the APM Server host, in the Elasticsearch used by APM Server
+	MetricsIndex string `json:"-"`
+	// Host name of the APM Server host in the Metricbeat index, all hosts if empty
+	MetricsHost string `json:"-"`
+	// APM Server log file, or docker:<container>, to count the errors and warnings it logs during the run
+	ApmLogs string `json:"-"`
+	// If true, the bytes stored by APM Server indices during the run are reported
+	IndexStats bool `json:"-"`
+	// If true, APM Server indices are force merged before measuring their size
+	Forcemerge bool `json:"forcemerge,omitempty"`
+	// If true, the transaction and service destination metrics aggregated by APM Server are compared with the
+	// transactions indexed and the exit spans sent
+	CheckAggregation bool `json:"check_aggregation,omitempty"`
+	// Percentage by which aggregated counts and duration sums may differ from the expected ones
+	AggregationTolerance float64 `json:"aggregation_tolerance,omitempty"`
 	// Service name passed to the tracer
 	ServiceName string `json:"service_name,omitempty"`
+	// URL of an APM Server to send hey-apm own traces to, not the one under test
+	SelfApmServerUrl string `json:"-"`
+	// Secret token of the APM Server receiving hey-apm own traces
+	SelfApmServerSecret string `json:"-"`
+	// API Key of the APM Server receiving hey-apm own traces
+	SelfAPIKey string `json:"-"`
+	// URL of a Prometheus Pushgateway to push the performance report metrics to
+	PushgatewayUrl string `json:"-"`
+	// File to render the performance report to, as Markdown or HTML depending on its extension
+	RenderFile string `json:"-"`
+	// URL of a webhook to post a summary of the run to
+	NotifyUrl string `json:"-"`
+	// URL of the Kibana instance to upload sourcemaps to, instead of APM Server
+	KibanaUrl string `json:"-"`
+	// <username:password> of the Kibana instance
+	KibanaAuth string `json:"-"`
+	// URL of a Grafana instance to annotate runs in
+	GrafanaUrl string `json:"-"`
+	// API key or service account token of the Grafana instance
+	GrafanaToken string `json:"-"`
+	// If true, runs are annotated in the Elasticsearch instance used for indexing the performance report
+	AnnotateElasticsearch bool `json:"-"`
+	// Directory to save performance reports to, as JSON files
+	ReportsDir string `json:"-"`
+	// If true, the events sent, accepted and rejected so far are printed every second
+	Progress bool `json:"-"`
+	// File to write the manifest of the run to, as JSON, besides alongside reports in ReportsDir
+	ManifestFile string `json:"-"`
+	// Effective value of every command line flag, defaults included, except credentials, and the flags set
+	Config   map[string]string `json:"-"`
+	FlagsSet []string          `json:"-"`
+	// File to dump every request's timestamp, duration, status and bytes into, for offline analysis
+	SamplesFile string `json:"-"`
+	// File to write the uncompressed NDJSON body of every intake request to
+	RecordFile string `json:"-"`
+	// File to write a random sample of the events sent to, to verify the documents indexed for them
+	SentEventsFile string `json:"-"`
+	// Events sent per event written to SentEventsFile, on average
+	SentEventsEvery int `json:"sent_events_every,omitempty"`
+	// File with the rules to scrub recorded requests with, or "default" for the default rules
+	ScrubRules string `json:"-"`
+	// If true, intake requests are recorded but not sent to APM Server
+	RecordOnly bool `json:"record_only,omitempty"`
+	// Service version passed to the tracer
+	ServiceVersion string `json:"service_version,omitempty"`
+	// Service environment passed to the tracer
+	ServiceEnvironment string `json:"service_environment,omitempty"`
+	// Labels of all transactions, spans and errors generated, on top of run_id
+	Labels map[string]string `json:"labels,omitempty"`
+	// Whether the tracer reports synthetic kubernetes metadata
+	KubernetesMetadata bool `json:"kubernetes_metadata,omitempty"`
+	// Name of the preset workload the input is based on, if any
+	Preset string `json:"preset,omitempty"`
+	// Total events per second the transaction and error frequencies and spans per transaction are derived from,
+	// in the percentages of each event type given by Mix, if any
+	EventsPerSecond float64 `json:"events_per_second,omitempty"`
+	Mix             string  `json:"mix,omitempty"`
+	// Elastic Cloud deployment running APM Server and Elasticsearch, if any
+	Cloud *CloudDeployment `json:"cloud,omitempty"`
+	// File with the request to create an Elastic Cloud deployment with, to run against and shut down afterwards
+	CloudProvision string `json:"-"`
+	// If true, the deployment created with CloudProvision is kept running after the run
+	CloudKeep bool `json:"-"`
+	// URL and API key of the Elastic Cloud API
+	CloudApiUrl string `json:"-"`
+	CloudApiKey string `json:"-"`
+	// Price per hour of the deployment under test (APM Server and Elasticsearch), in any currency
+	HourlyCost float64 `json:"hourly_cost,omitempty"`
+	// Price per hour of each GB of memory of the Elastic Cloud deployment under test, if HourlyCost is not given
+	CostPerGBHour float64 `json:"cost_per_gb_hour,omitempty"`
+	// Id of the run, set as run_id label of all transactions, spans and errors generated
+	RunId string `json:"-"`
+	// Seed of all the randomness of the generated events and traffic shaping, reproducing them if reused
+	Seed int64 `json:"seed"`
+	// If true, documents labelled with the run Id are deleted from Elasticsearch once the report is created
+	Cleanup bool `json:"-"`
+	// If true, events exercising the edges of the intake schema are sent instead of a workload
+	Fuzz bool `json:"-"`
+	// File to save the results of Fuzz to, as JSON
+	FuzzOutput string `json:"-"`
+	// Name of the target, when running several targets concurrently
+	TargetName string `json:"target_name,omitempty"`
+	// Independent workloads to run concurrently, each one derived from this input
+	Targets []Input `json:"-"`
+	// Number of times the workload is run, one after another
+	Iterations int `json:"iterations,omitempty"`
+	// Time to wait between iterations
+	Cooldown time.Duration `json:"cooldown,omitempty"`
+	// Number of the iteration, starting at 1, when running several iterations
+	Iteration int `json:"iteration,omitempty"`
 
 	// Run timeout of the performance test (ends the test when reached)
 	RunTimeout time.Duration `json:"run_timeout"`
+	// Offsets from the start of the run at which agents are stopped and restarted
+	ChaosSchedule []time.Duration `json:"chaos_schedule,omitempty"`
+	// Time agents are stopped for, at each offset in ChaosSchedule
+	ChaosDowntime time.Duration `json:"chaos_downtime,omitempty"`
+	// Interval at which sentinel transactions are sent to measure the time until they are searchable, disabled if 0
+	ProbeInterval time.Duration `json:"probe_interval,omitempty"`
+	// Number of simulated agents polling APM Server for their central configuration, disabled if 0
+	ConfigAgents int `json:"config_agents,omitempty"`
+	// Interval at which each simulated agent polls APM Server for its central configuration
+	ConfigPollInterval time.Duration `json:"config_poll_interval,omitempty"`
+	// Number of simulated agents with almost no traffic, each one keeping a connection open to APM Server, disabled if 0
+	IdleAgents int `json:"idle_agents,omitempty"`
+	// Interval at which each idle agent sends a heartbeat with its metadata and a metricset
+	IdleHeartbeatInterval time.Duration `json:"idle_heartbeat_interval,omitempty"`
+	// Interval at which requests are sent to the APM Server root endpoint, as agents do on startup, disabled if 0
+	InfoInterval time.Duration `json:"info_interval,omitempty"`
+	// Interval at which RUM errors referencing an uploaded sourcemap are sent, disabled if 0
+	SourcemapInterval time.Duration `json:"sourcemap_interval,omitempty"`
+	// Offset added to the timestamps of generated events, as agents with a bad clock do, may be negative
+	ClockSkew time.Duration `json:"clock_skew,omitempty"`
+	// W3C tracestate entries propagated to transactions from an upstream service, as key=value, eg. es=s:0.5
+	TraceState []string `json:"tracestate,omitempty"`
+	// Baggage members propagated to transactions from an upstream service, as key=value
+	Baggage []string `json:"baggage,omitempty"`
+	// Fraction of transactions reusing the trace, transaction and span Ids of a previous one, between 0 and 1
+	IDCollisionRatio float64 `json:"id_collision_ratio,omitempty"`
+	// Fraction of names, labels and messages replaced with multibyte, zero width, long or control character strings
+	EdgeStringRatio float64 `json:"edge_string_ratio,omitempty"`
+	// Whether events are sent to the RUM intake endpoint without credentials, as anonymous agents do
+	RUM bool `json:"rum,omitempty"`
+	// Number of distinct client IPs requests are attributed to, with X-Forwarded-For
+	ClientIPs int `json:"client_ips,omitempty"`
+	// Maximum number of bytes per second sent to APM Server, unlimited if 0
+	MaxBytesPerSecond int64 `json:"max_bytes_per_second,omitempty"`
+	// Extra latency added before every request to APM Server
+	Latency time.Duration `json:"latency,omitempty"`
+	// Maximum random variation of the extra latency, in both directions
+	LatencyJitter time.Duration `json:"latency_jitter,omitempty"`
+	// Fraction of requests aborted midway as if their connection was reset, between 0 and 1
+	ResetRatio float64 `json:"reset_ratio,omitempty"`
+	// Fraction of events sent after later random events of the same request, to deliver them out of order
+	OutOfOrderRatio float64 `json:"out_of_order_ratio,omitempty"`
+	// Whether transactions and spans have OpenTelemetry span kinds and semantic convention attributes
+	OTelAttributes bool `json:"otel_attributes,omitempty"`
+	// Whether apm-server responses are read only for their status, instead of for accepted and rejected events
+	StatusOnly bool `json:"status_only,omitempty"`
+	// Aborts the test when the number of failed requests exceeds this value, disabled if 0
+	MaxRequestErrors int `json:"max_request_errors,omitempty"`
+	// Aborts the test when the rolling percentage of failed requests exceeds this value, disabled if 0
+	MaxErrorRate float64 `json:"max_error_rate,omitempty"`
+	// Fails the test when the percentage of events dropped by the agent exceeds this value, disabled if 0
+	AssertMaxDropRate float64 `json:"assert_max_drop_rate,omitempty"`
+	// Fails the test when the 99th percentile of request latencies exceeds this value, disabled if 0
+	AssertP99Latency time.Duration `json:"assert_p99_latency,omitempty"`
+	// Fails the test when the number of events accepted per second is lower than this value, disabled if 0
+	AssertMinThroughput float64 `json:"assert_min_throughput,omitempty"`
+	// Latency up to which requests are satisfying, and up to 4 times which they are tolerable, for the Apdex score
+	ApdexThreshold time.Duration `json:"apdex_threshold,omitempty"`
+	// Fails the test when the Apdex score of requests is lower than this value, disabled if 0
+	AssertMinApdex float64 `json:"assert_min_apdex,omitempty"`
 	// Timeout for flushing the workload to APM Server
 	FlushTimeout time.Duration `json:"flush_timeout"`
+	// Timeout for APM Server to acknowledge all events sent, once flushed
+	DrainTimeout time.Duration `json:"drain_timeout,omitempty"`
+	// File with a script customizing every event sent, see the script package
+	ScriptFile string `json:"script,omitempty"`
+	// Data feeds for the script, as name=path pairs of CSV or JSON files
+	Feeds []string `json:"feeds,omitempty"`
+	// Whether rows of the feeds are given to events in order (cycle) or at random (sample)
+	FeedOrder string `json:"feed_order,omitempty"`
+	// Names of the event types to generate, all of them if empty
+	EventTypes []string `json:"event_types,omitempty"`
+	// Command generating events described as JSON lines in its standard output, sent up to once in GeneratorFrequency
+	GeneratorCmd       string        `json:"generator_cmd,omitempty"`
+	GeneratorFrequency time.Duration `json:"generator_frequency,omitempty"`
+	// CSV file with a 24 hour curve of multipliers of the transaction and error frequencies, played over the run duration
+	RateCurve string `json:"rate_curve,omitempty"`
+	// Time since the start of the run at which the transaction and error rates are multiplied by SpikeFactor
+	SpikeAt time.Duration `json:"spike_at,omitempty"`
+	// How long the spike lasts, disabled if 0
+	SpikeDuration time.Duration `json:"spike_duration,omitempty"`
+	SpikeFactor   float64       `json:"spike_factor,omitempty"`
+	// Comma separated phases of the run multiplying the transaction and error rates, as name:duration:multiplier
+	// or name:duration:from-to ramping the multiplier linearly, eg. "ramp:1m:0-1,hold:5m:1,spike:30s:10,hold:2m:1"
+	Phases string `json:"phases,omitempty"`
+	// Duration of the buckets of time whose stats are recorded in the report, disabled if 0
+	BucketSize time.Duration `json:"bucket_size,omitempty"`
+	// GOMAXPROCS of hey-apm, Go's default if 0
+	GoMaxProcs int `json:"gomaxprocs,omitempty"`
+	// Goroutines generating each event type, sharing their rate and limits, 1 if 0
+	GeneratorGoroutines int `json:"generator_goroutines,omitempty"`
+	// Whether generator goroutines are locked to their own OS thread
+	LockThreads bool `json:"lock_threads,omitempty"`
+	// Processes generating the workload, each one its share of it, merged into a single report
+	Procs int `json:"procs,omitempty"`
+	// Command line arguments of hey-apm, to run the shards of the workload with
+	ShardArgs []string `json:"-"`
+	// Share of the workload generated by this process and file to write its stats to, if one of a sharded run
+	ShardIndex  int    `json:"-"`
+	ShardOutput string `json:"-"`
 	// Frequency at which the tracer will generate transactions
 	TransactionFrequency time.Duration `json:"transaction_generation_frequency"`
 	// Maximum number of transactions to push to the APM Server (ends the test when reached)
@@ -47,6 +266,45 @@ type Input struct {
 	SpanMaxLimit int `json:"spans_generated_max_limit"`
 	// Minimum number of spans per transaction
 	SpanMinLimit int `json:"spans_generated_min_limit"`
+	// Transaction names picked at random in proportion to their weights, from n Zipf distributed endpoints given as
+	// zipf:<n>[:<exponent>], or from a file with a name and an optional weight per line, eg. "GET /users,5"
+	TransactionNames string `json:"transaction_names,omitempty"`
+	// Fraction of transactions named after their own Id instead, to explode the cardinality of transaction groups
+	UniqueNameRatio float64 `json:"unique_name_ratio,omitempty"`
+	// Distribution of transaction durations, eg. fixed:10ms, normal:100ms:20ms or lognormal:50ms:0.5
+	TransactionDuration string `json:"transaction_duration,omitempty"`
+	// Distribution of span durations, in the same format as TransactionDuration
+	SpanDuration string `json:"span_duration,omitempty"`
+	// Number of HTTP request headers in the transaction context
+	HTTPHeaders int `json:"http_headers,omitempty"`
+	// Size in bytes of the HTTP request body in the transaction context
+	HTTPBodySize int64 `json:"http_body_size,omitempty"`
+	// Number of distinct users in the context of transactions and errors, no user context if 0
+	Users int `json:"users,omitempty"`
+	// Nesting depth of the custom context object of transactions and errors
+	CustomContextDepth int `json:"custom_context_depth,omitempty"`
+	// Number of fields per nesting level of the custom context object
+	CustomContextSize int `json:"custom_context_size,omitempty"`
+	// Number of distinct span types per transaction
+	SpanTypes int `json:"span_types,omitempty"`
+	// Number of levels of the span trees under each transaction, spans are direct children of the transaction if 1
+	SpanDepth int `json:"span_depth,omitempty"`
+	// Number of children of each span of a span tree, but the deepest ones
+	SpanFanOut int `json:"span_fan_out,omitempty"`
+	// Whether the Go agent computes and sends transaction breakdown metrics
+	BreakdownMetrics bool `json:"breakdown_metrics,omitempty"`
+	// Interval at which the Go agent sends metrics, disabled if 0
+	MetricsInterval time.Duration `json:"metrics_interval,omitempty"`
+	// Number of identical consecutive exit spans per transaction, on top of the other spans
+	ExitSpans int `json:"exit_spans_generated,omitempty"`
+	// Whether consecutive identical exit spans are sent as a composite span, as agents with span compression do
+	CompressSpans bool `json:"compress_spans,omitempty"`
+	// Fraction of transactions exceeding the max spans, that drop between 1 and SpanMaxLimit exit spans, between 0 and 1
+	DroppedSpansRatio float64 `json:"dropped_spans_ratio,omitempty"`
+	// Number of transactions kept open for the whole run, on top of the other transactions
+	LongTransactions int `json:"long_transactions,omitempty"`
+	// Interval at which each long transaction ends a span
+	LongSpanInterval time.Duration `json:"long_span_interval,omitempty"`
 	// Frequency at which the tracer will generate errors
 	ErrorFrequency time.Duration `json:"error_generation_frequency"`
 	// Maximum number of errors to push to the APM Server (ends the test when reached)
@@ -55,6 +313,20 @@ type Input struct {
 	ErrorFrameMaxLimit int `json:"error_generation_frames_max_limit"`
 	// Minimum number of stacktrace frames per error
 	ErrorFrameMinLimit int `json:"error_generation_frames_min_limit"`
+	// Fraction of stacktrace frames belonging to vendored libraries, between 0 and 1
+	ErrorLibraryFrames float64 `json:"error_library_frames,omitempty"`
+	// Number of lines of source code before and after each stacktrace frame
+	ErrorSourceLines int `json:"error_source_lines,omitempty"`
+	// Number of distinct exception types of generated errors
+	ErrorTypes int `json:"error_types,omitempty"`
+	// Number of distinct messages of generated errors
+	ErrorMessages int `json:"error_messages,omitempty"`
+	// Number of distinct culprits of generated errors
+	ErrorCulprits int `json:"error_culprits,omitempty"`
+	// Number of errors wrapped by each generated error
+	ErrorCauseDepth int `json:"error_cause_depth,omitempty"`
+	// Fraction of errors generated as log records instead of exceptions, between 0 and 1
+	ErrorLogRatio float64 `json:"error_log_ratio,omitempty"`
 }
 
 type Wrap struct {
@@ -84,3 +356,57 @@ func (w Wrap) WithSpans(s int) Wrap {
 	w.SpanMinLimit = s
 	return w
 }
+
+// Shard returns the share of the workload generated by shard i of n, generating transactions and errors
+// at 1/n of the rate and 1/n of the limits, the first shards taking the remainder so that they add up to them,
+// with a seed of its own derived from the input one.
+func (in Input) Shard(i, n int) Input {
+	if n <= 1 {
+		return in
+	}
+	in.Seed = random.Derive(in.Seed, fmt.Sprintf("shard %d", i))
+	in.TransactionFrequency *= time.Duration(n)
+	in.ErrorFrequency *= time.Duration(n)
+	in.GeneratorFrequency *= time.Duration(n)
+	in.TransactionLimit = share(in.TransactionLimit, i, n)
+	in.ErrorLimit = share(in.ErrorLimit, i, n)
+	in.LongTransactions = share(in.LongTransactions, i, n)
+	in.IdleAgents = share(in.IdleAgents, i, n)
+	return in
+}
+
+// Reseed returns a copy of the input with a seed derived from its own and name, eg. of a target or iteration,
+// so that inputs run concurrently or one after another don't generate the same Ids.
+func (in Input) Reseed(name string) Input {
+	in.Seed = random.Derive(in.Seed, name)
+	return in
+}
+
+// share returns the part i of n of total, the first parts taking the remainder.
+func share(total, i, n int) int {
+	s := total / n
+	if i < total%n {
+		s++
+	}
+	return s
+}
+
+// CloudDeployment describes the size and plan of an Elastic Cloud deployment.
+type CloudDeployment struct {
+	Id      string `json:"id"`
+	Name    string `json:"name,omitempty"`
+	Region  string `json:"region,omitempty"`
+	Version string `json:"version,omitempty"`
+	// instance memory and zones of APM Server (or the Integrations Server) and of each Elasticsearch tier
+	ApmSize           string `json:"apm_size,omitempty"`
+	ElasticsearchSize string `json:"elasticsearch_size,omitempty"`
+	// memory of all the instances of the deployment, in all zones, in GB
+	MemoryGB float64 `json:"memory_gb,omitempty"`
+	// whether the deployment was created for the run
+	Provisioned bool `json:"provisioned,omitempty"`
+}
+
+func (d CloudDeployment) String() string {
+	return fmt.Sprintf("elastic cloud deployment %s (%s) %s in %s, apm: %s, elasticsearch: %s",
+		d.Id, d.Name, d.Version, d.Region, d.ApmSize, d.ElasticsearchSize)
+}
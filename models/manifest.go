@@ -0,0 +1,76 @@
+package models
+
+import (
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/elastic/hey-apm/buildinfo"
+)
+
+// Manifest records the provenance of a run: everything needed to reproduce it later.
+type Manifest struct {
+	ReportId  string    `json:"report_id"`
+	RunId     string    `json:"run_id"`
+	Timestamp time.Time `json:"@timestamp"`
+
+	// hey-apm build
+	Version      string `json:"version"`
+	Commit       string `json:"commit,omitempty"`
+	BuildDate    string `json:"build_date,omitempty"`
+	GoVersion    string `json:"go_version"`
+	AgentVersion string `json:"agent_version"`
+
+	// hey-apm host
+	Host       string `json:"host"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	CPUs       int    `json:"cpus"`
+	GoMaxProcs int    `json:"gomaxprocs"`
+
+	// effective value of every command line flag, defaults included, except credentials
+	Config map[string]string `json:"config,omitempty"`
+	// flags set in the command line, the others taking their default value
+	FlagsSet []string `json:"flags_set,omitempty"`
+	// seed of the generated events, to pass to -replay-seed
+	Seed int64 `json:"seed"`
+
+	// apm-server under test
+	ApmVersion   string            `json:"apm_version,omitempty"`
+	ApmBuild     string            `json:"apm_build,omitempty"`
+	ApmBuildDate time.Time         `json:"apm_build_date,omitempty"`
+	ApmSettings  map[string]string `json:"apm_settings,omitempty"`
+	Cloud        *CloudDeployment  `json:"cloud,omitempty"`
+}
+
+// NewManifest returns the manifest of the run of a report, on the current host and hey-apm build.
+func NewManifest(report Report) Manifest {
+	host, _ := os.Hostname()
+	return Manifest{
+		ReportId:  report.ReportId,
+		RunId:     report.RunId,
+		Timestamp: report.Timestamp,
+
+		Version:      buildinfo.Version,
+		Commit:       buildinfo.Commit,
+		BuildDate:    buildinfo.Date,
+		GoVersion:    buildinfo.GoVersion(),
+		AgentVersion: buildinfo.AgentVersion(),
+
+		Host:       host,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		CPUs:       runtime.NumCPU(),
+		GoMaxProcs: runtime.GOMAXPROCS(0),
+
+		Config:   report.Config,
+		FlagsSet: report.FlagsSet,
+		Seed:     report.Seed,
+
+		ApmVersion:   report.ApmVersion,
+		ApmBuild:     report.ApmBuild,
+		ApmBuildDate: report.ApmBuildDate,
+		ApmSettings:  report.ApmSettings,
+		Cloud:        report.Cloud,
+	}
+}
@@ -38,6 +38,8 @@ type Report struct {
 
 	// total elapsed (timeout + flush)
 	Elapsed float64 `json:"elapsed"`
+	// stop condition that aborted the run, if any, in which case the report covers the run until then
+	StopReason string `json:"stop_reason,omitempty"`
 
 	// number of total requests to apm-server
 	Requests uint64 `json:"requests"`
@@ -47,6 +49,12 @@ type Report struct {
 	RequestSuccessRatio *float64 `json:"request_success_ratio,omitempty"`
 	// requests per second
 	RequestRate *float64 `json:"request_rate,omitempty"`
+	// request latency percentiles, in milliseconds
+	RequestLatencyP50 *float64 `json:"request_latency_p50,omitempty"`
+	RequestLatencyP90 *float64 `json:"request_latency_p90,omitempty"`
+	RequestLatencyP99 *float64 `json:"request_latency_p99,omitempty"`
+	// (satisfying + tolerable / 2) / total requests, between 0 and 1, as per Input.ApdexThreshold
+	Apdex *float64 `json:"apdex,omitempty"`
 
 	// TODO
 	// total number of responses
@@ -116,6 +124,74 @@ type Report struct {
 	EventsAccepted uint64 `json:"events_accepted"`
 	// accepted / sent
 	EventsAcceptedRatio *float64 `json:"events_accepted_ratio,omitempty"`
+	// total rejected by apm-server
+	EventsRejected uint64 `json:"events_rejected"`
+	// most frequent reasons given by apm-server for rejecting events
+	RejectionReasons []string `json:"rejection_reasons,omitempty"`
+	// total sent but neither accepted nor rejected, eg. because of failed requests
+	EventsUnacknowledged uint64 `json:"events_unacknowledged"`
+	// seconds from generation stop until apm-server acknowledged all events sent
+	DrainDuration float64 `json:"drain_duration"`
+	// events accepted or rejected by apm-server after generation stopped
+	EventsAcknowledgedAfterStop uint64 `json:"events_acknowledged_after_stop"`
+	// seconds waiting for apm-server to process its queued events, after draining
+	QuiesceDuration float64 `json:"quiesce_duration"`
+	// sentinel transactions sent to measure indexing latency, and how many were not found in time
+	IndexingProbes        uint64 `json:"indexing_probes,omitempty"`
+	IndexingProbesMissing uint64 `json:"indexing_probes_missing,omitempty"`
+	// percentiles of the time from sending a sentinel transaction until it is searchable, in milliseconds
+	IndexingLatencyP50 *float64 `json:"indexing_latency_p50,omitempty"`
+	IndexingLatencyP90 *float64 `json:"indexing_latency_p90,omitempty"`
+	IndexingLatencyP99 *float64 `json:"indexing_latency_p99,omitempty"`
+	// central configuration requests sent by simulated agents, how many were answered with not modified and how many failed
+	ConfigRequests    uint64 `json:"config_requests,omitempty"`
+	ConfigNotModified uint64 `json:"config_not_modified,omitempty"`
+	ConfigFailed      uint64 `json:"config_failed,omitempty"`
+	// 99th percentile of central configuration request latencies, in milliseconds
+	ConfigLatencyP99 *float64 `json:"config_latency_p99,omitempty"`
+	// simulated idle agents, the heartbeats they sent and how many failed
+	IdleAgents           int    `json:"idle_agents,omitempty"`
+	IdleHeartbeats       uint64 `json:"idle_heartbeats,omitempty"`
+	IdleHeartbeatsFailed uint64 `json:"idle_heartbeats_failed,omitempty"`
+	// 99th percentile of heartbeat latencies, in milliseconds
+	IdleHeartbeatLatencyP99 *float64 `json:"idle_heartbeat_latency_p99,omitempty"`
+	// requests sent to the apm-server root endpoint, and how many failed
+	InfoRequests uint64 `json:"info_requests,omitempty"`
+	InfoFailed   uint64 `json:"info_failed,omitempty"`
+	// 99th percentile of root endpoint request latencies, in milliseconds
+	InfoLatencyP99 *float64 `json:"info_latency_p99,omitempty"`
+	// requests with RUM errors referencing an uploaded sourcemap, and how many failed
+	SourcemapRequests uint64 `json:"sourcemap_requests,omitempty"`
+	SourcemapFailed   uint64 `json:"sourcemap_failed,omitempty"`
+	// percentiles of the latencies of requests with sourcemapped RUM errors, in milliseconds
+	SourcemapLatencyP50 *float64 `json:"sourcemap_latency_p50,omitempty"`
+	SourcemapLatencyP99 *float64 `json:"sourcemap_latency_p99,omitempty"`
+	// times agents were stopped and restarted during the run
+	Outages int `json:"outages,omitempty"`
+	// events accepted per second before the first outage, and after the last restart
+	ThroughputBeforeOutage *float64 `json:"throughput_before_outage,omitempty"`
+	ThroughputAfterOutage  *float64 `json:"throughput_after_outage,omitempty"`
+	// seconds after the last restart until 90% of the throughput before the first outage was reached
+	OutageRecovery *float64 `json:"outage_recovery,omitempty"`
+	// transactions counted by the transaction metrics of apm-server, and how much they and the sum of their durations
+	// differ from the transactions indexed, as a percentage
+	TransactionsAggregated *float64 `json:"transactions_aggregated,omitempty"`
+	AggregatedCountDiff    *float64 `json:"aggregated_count_diff,omitempty"`
+	AggregatedDurationDiff *float64 `json:"aggregated_duration_diff,omitempty"`
+	// approximate number of transaction groups aggregated by apm-server, and transactions aggregated into its
+	// overflow bucket once it reached its max groups
+	TransactionGroups      *float64 `json:"transaction_groups,omitempty"`
+	TransactionsOverflowed *float64 `json:"transactions_overflowed,omitempty"`
+	// largest differences between the exit spans accepted per destination, and the sum of their durations,
+	// and the service destination metrics of apm-server, as a percentage
+	DestinationCountDiff    *float64 `json:"destination_count_diff,omitempty"`
+	DestinationDurationDiff *float64 `json:"destination_duration_diff,omitempty"`
+	// destinations whose metrics differ from the exit spans accepted by more than the tolerance
+	DestinationDiscrepancies []string `json:"destination_discrepancies,omitempty"`
+	// bytes stored by the primary shards of apm-server indices during the run
+	IndexBytes *int64 `json:"index_bytes,omitempty"`
+	// index bytes / indexed
+	BytesPerEvent *float64 `json:"bytes_per_event,omitempty"`
 	// total accepted per second
 	EventAcceptRate *float64 `json:"event_accept_rate,omitempty"`
 	// total indexed
@@ -127,6 +203,21 @@ type Report struct {
 	// 1 - indexed / sent
 	EventLossRatio *float64 `json:"event_loss_ratio,omitempty"`
 
+	// how closely each generator kept up with the rate requested from it, if any
+	Pacing []Pacing `json:"pacing,omitempty"`
+
+	// stats of each phase of the run, if it has phases, such as before, during and after a spike
+	Phases []Phase `json:"phases,omitempty"`
+	// seconds from the end of the spike until the median request latency is back to its value before the spike
+	SpikeRecoveryTime *float64 `json:"spike_recovery_time,omitempty"`
+
+	// stats of every bucket of time of the run, if recorded, and their size in seconds
+	Buckets    []Interval `json:"buckets,omitempty"`
+	BucketSize float64    `json:"bucket_size,omitempty"`
+
+	// report of the mirror apm-server receiving the same requests, if any
+	Mirror *Report `json:"mirror,omitempty"`
+
 	// total memory allocated in bytes
 	TotalAlloc *int64 `json:"total_alloc,omitempty"`
 	// total memory allocated in the heap, in bytes
@@ -135,6 +226,86 @@ type Report struct {
 	Mallocs *int64 `json:"mallocs,omitempty"`
 	// number of GC runs
 	NumGC *int64 `json:"num_gc,omitempty"`
+
+	// CPUs of the host running hey-apm, and how many of them it could use at once
+	ClientCPUs       int `json:"client_cpus,omitempty"`
+	ClientGoMaxProcs int `json:"client_gomaxprocs,omitempty"`
+
+	// hey-apm build, and versions of Go and the Go agent it was built with
+	HeyApmVersion   string `json:"hey_apm_version,omitempty"`
+	HeyApmCommit    string `json:"hey_apm_commit,omitempty"`
+	HeyApmBuildDate string `json:"hey_apm_build_date,omitempty"`
+	GoVersion       string `json:"go_version,omitempty"`
+	AgentVersion    string `json:"agent_version,omitempty"`
+
+	// errors and warnings logged by apm-server during the run
+	ApmLogErrors   uint64 `json:"apm_log_errors,omitempty"`
+	ApmLogWarnings uint64 `json:"apm_log_warnings,omitempty"`
+	// most frequent errors and warnings logged by apm-server
+	ApmLogMessages []string `json:"apm_log_messages,omitempty"`
+
+	// number of CPU cores of the apm-server host
+	CPUCores *int64 `json:"cpu_cores,omitempty"`
+	// CPU time used by apm-server during the run, in seconds
+	ApmCPUSeconds *float64 `json:"apm_cpu_seconds,omitempty"`
+	// resident memory of apm-server at the end of the run, in bytes
+	ApmMemoryRSS *int64 `json:"apm_memory_rss,omitempty"`
+	// average CPU usage of the apm-server host during the run, as a percentage of all cores
+	HostCPUPct *float64 `json:"host_cpu_pct,omitempty"`
+	// max memory usage of the apm-server host during the run, as a percentage
+	HostMemoryPct *float64 `json:"host_memory_pct,omitempty"`
+	// bytes read from and written to disk by the apm-server host during the run
+	DiskReadBytes  *int64 `json:"disk_read_bytes,omitempty"`
+	DiskWriteBytes *int64 `json:"disk_write_bytes,omitempty"`
+	// events accepted per second of CPU time used by apm-server, or by its host if not known
+	EventsPerCPUSecond *float64 `json:"events_per_cpu_second,omitempty"`
+
+	// price per hour of the deployment under test, as given or estimated from its memory
+	DeploymentHourlyCost *float64 `json:"deployment_hourly_cost,omitempty"`
+	// price of indexing a million events at the measured index rate
+	CostPerMillionEvents *float64 `json:"cost_per_million_events,omitempty"`
+}
+
+// Pacing describes how closely a generator of events kept up with the rate requested from it.
+type Pacing struct {
+	// event type
+	Generator string `json:"generator"`
+	// events per second requested and generated
+	RequestedRate float64 `json:"requested_rate"`
+	AchievedRate  float64 `json:"achieved_rate"`
+	// fewest events generated in a second
+	WorstSecondRate *float64 `json:"worst_second_rate,omitempty"`
+	// percentiles of the delays of events from their scheduled time, in milliseconds
+	DelayP50 *float64 `json:"delay_p50,omitempty"`
+	DelayP99 *float64 `json:"delay_p99,omitempty"`
+	// hey-apm if the generator fell behind, apm-server if it kept up but the agent dropped events waiting to send them,
+	// empty otherwise
+	LimitedBy string `json:"limited_by,omitempty"`
+}
+
+// Phase holds stats of a phase of a run.
+type Phase struct {
+	Name string `json:"name"`
+	Interval
+}
+
+// Interval holds stats of an interval of time of a run.
+type Interval struct {
+	// seconds since the start of the run
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// events generated per second and dropped by the agent
+	EventsSentPerSecond float64 `json:"events_sent_per_second"`
+	EventsDropped       uint64  `json:"events_dropped"`
+	// events accepted by apm-server per second and rejected, if read from verbose responses
+	EventsAcceptedPerSecond *float64 `json:"events_accepted_per_second,omitempty"`
+	EventsRejected          uint64   `json:"events_rejected,omitempty"`
+	// requests started in the interval, and how many failed
+	Requests       uint64 `json:"requests"`
+	FailedRequests uint64 `json:"failed_requests"`
+	// percentiles of the latency of requests started in the interval, in milliseconds
+	RequestLatencyP50 *float64 `json:"request_latency_p50,omitempty"`
+	RequestLatencyP99 *float64 `json:"request_latency_p99,omitempty"`
 }
 
 func (r Report) date() time.Time {
@@ -182,6 +353,18 @@ func (r Report) WithDerivedAttributes() Report {
 	r.EventIndexRate = numbers.Div(r.EventsIndexed, r.Elapsed)
 	r.EventsIndexedRatio = numbers.Div(r.EventsIndexed, r.EventsAccepted)
 	r.EventLossRatio = numbers.CPerct(r.EventsIndexed, r.EventsGenerated)
+	if r.IndexBytes != nil {
+		r.BytesPerEvent = numbers.Div(*r.IndexBytes, r.EventsIndexed)
+	}
+
+	if r.ApmCPUSeconds != nil {
+		r.EventsPerCPUSecond = numbers.Div(r.EventsAccepted, *r.ApmCPUSeconds)
+	} else if r.HostCPUPct != nil && r.CPUCores != nil {
+		r.EventsPerCPUSecond = numbers.Div(r.EventsAccepted, *r.HostCPUPct/100*float64(*r.CPUCores)*r.Elapsed)
+	}
+	if r.DeploymentHourlyCost != nil && r.EventIndexRate != nil && *r.EventIndexRate > 0 {
+		r.CostPerMillionEvents = numbers.Divp(*r.DeploymentHourlyCost*1e6, *r.EventIndexRate*3600, 4)
+	}
 
 	return r
 }
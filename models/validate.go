@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/distribution"
+)
+
+// ValidationError lists all the problems found in an input.
+type ValidationError struct {
+	// name of the target, if any
+	Target   string
+	Problems []string
+}
+
+func (e ValidationError) Error() string {
+	what := "invalid options"
+	if e.Target != "" {
+		what += " for target " + e.Target
+	}
+	return what + ":\n - " + strings.Join(e.Problems, "\n - ")
+}
+
+// Validate checks that the input describes a feasible workload, and returns a ValidationError
+// naming the offending options (after their command line flags) otherwise.
+// Targets are validated too.
+func (in Input) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	nonNegative := func(flag string, v int) {
+		check(v >= 0, "-%s must not be negative, got %d", flag, v)
+	}
+	ratio := func(flag string, v float64) {
+		check(v >= 0 && v <= 1, "-%s must be between 0 and 1, got %v", flag, v)
+	}
+	percentage := func(flag string, v float64) {
+		check(v >= 0 && v <= 100, "-%s must be between 0 and 100, got %v", flag, v)
+	}
+	frequency := func(flag string, limit int, v time.Duration) {
+		check(limit == 0 || v > 0, "-%s must be positive, got %s", flag, v)
+	}
+
+	check(in.RunTimeout >= 0, "-run must not be negative, got %s", in.RunTimeout)
+	check(in.FlushTimeout >= 0, "-flush must not be negative, got %s", in.FlushTimeout)
+	check(in.DrainTimeout >= 0, "-drain must not be negative, got %s", in.DrainTimeout)
+	check(in.Latency >= 0, "-latency must not be negative, got %s", in.Latency)
+	check(in.LatencyJitter >= 0, "-latency-jitter must not be negative, got %s", in.LatencyJitter)
+	ratio("reset-rate", in.ResetRatio)
+	ratio("out-of-order", in.OutOfOrderRatio)
+	check(in.MaxBytesPerSecond >= 0, "-max-bps must not be negative, got %d", in.MaxBytesPerSecond)
+	nonNegative("max-errors", in.MaxRequestErrors)
+	percentage("max-error-rate", in.MaxErrorRate)
+	percentage("assert-max-drop-rate", in.AssertMaxDropRate)
+	check(in.AssertP99Latency >= 0, "-assert-p99-latency must not be negative, got %s", in.AssertP99Latency)
+	check(in.AssertMinThroughput >= 0, "-assert-min-throughput must not be negative, got %v", in.AssertMinThroughput)
+	check(in.RateCurve == "" || in.RunTimeout > 0, "-rate-curve requires -run, to play the curve over")
+	check(in.SpikeAt >= 0 && in.SpikeDuration >= 0, "-spike-at and -spike-for must not be negative")
+	check(in.SpikeDuration == 0 || in.SpikeFactor > 0, "-spike-factor must be positive, got %v", in.SpikeFactor)
+	check(in.SpikeDuration == 0 || in.RunTimeout == 0 || in.SpikeAt+in.SpikeDuration < in.RunTimeout,
+		"the spike must end before the run does, to recover from it")
+	check(in.Phases == "" || in.SpikeDuration == 0, "-phases can't be combined with -spike-for")
+	check(in.BucketSize == 0 || in.BucketSize >= time.Second, "-buckets must be at least 1s, got %s", in.BucketSize)
+	check(in.GoMaxProcs >= 0, "-gomaxprocs must not be negative, got %d", in.GoMaxProcs)
+	check(in.GeneratorGoroutines >= 0, "-generator-goroutines must not be negative, got %d", in.GeneratorGoroutines)
+	check(in.Procs >= 0, "-procs must not be negative, got %d", in.Procs)
+	if in.Procs > 1 {
+		check(in.Iterations <= 1 && len(in.Targets) == 0 && !in.IsBenchmark && !in.Fuzz && in.CloudProvision == "",
+			"-procs can't be combined with -iterations, -target, -bench, -fuzz or -cloud-provision")
+		check(in.Phases == "" && in.SpikeDuration == 0 && in.BucketSize == 0,
+			"-procs can't be combined with -phases, -spike-for or -buckets, as they are not recorded across processes")
+	}
+	check(in.ApdexThreshold >= 0, "-apdex-threshold must not be negative, got %s", in.ApdexThreshold)
+	ratio("assert-min-apdex", in.AssertMinApdex)
+	check(in.AssertMinApdex == 0 || in.ApdexThreshold > 0, "-assert-min-apdex requires -apdex-threshold")
+	nonNegative("iterations", in.Iterations)
+	nonNegative("client-ips", in.ClientIPs)
+	check(in.Iterations <= 1 || len(in.Targets) == 0, "-iterations can't be combined with -target")
+	check(in.Cooldown >= 0, "-cooldown must not be negative, got %s", in.Cooldown)
+	for _, offset := range in.ChaosSchedule {
+		check(offset > 0, "-chaos offsets must be positive, got %s", offset)
+	}
+	check(len(in.ChaosSchedule) == 0 || in.ChaosDowntime > 0, "-chaos-downtime must be positive, got %s", in.ChaosDowntime)
+	check(!in.CheckAggregation || !in.StatusOnly, "-check-aggregation can't be combined with -status-only")
+	check(in.AggregationTolerance >= 0, "-aggregation-tolerance must not be negative, got %v", in.AggregationTolerance)
+	check(in.ProbeInterval >= 0, "-probe-interval must not be negative, got %s", in.ProbeInterval)
+	nonNegative("config-agents", in.ConfigAgents)
+	frequency("config-poll-interval", in.ConfigAgents, in.ConfigPollInterval)
+	nonNegative("idle-agents", in.IdleAgents)
+	frequency("idle-heartbeat", in.IdleAgents, in.IdleHeartbeatInterval)
+	check(in.InfoInterval >= 0, "-info-interval must not be negative, got %s", in.InfoInterval)
+	check(in.SourcemapInterval >= 0, "-sourcemap-interval must not be negative, got %s", in.SourcemapInterval)
+	check(in.HourlyCost >= 0, "-hourly-cost must not be negative, got %v", in.HourlyCost)
+	check(in.CostPerGBHour >= 0, "-cost-per-gb-hour must not be negative, got %v", in.CostPerGBHour)
+	check(in.CloudProvision == "" || in.CloudApiKey != "", "-cloud-provision requires -cloud-api-key or $EC_API_KEY")
+	check(in.CloudProvision == "" || !in.Fuzz, "-cloud-provision can't be combined with -fuzz")
+	check(!in.RecordOnly || in.RecordFile != "", "-record-only requires -record")
+	check(in.SentEventsFile == "" || in.SentEventsEvery > 0, "-sent-events-every must be positive, got %d",
+		in.SentEventsEvery)
+	check(in.ScrubRules == "" || in.RecordFile != "", "-scrub requires -record")
+	for _, kv := range in.TraceState {
+		check(strings.Index(kv, "=") > 0, "-tracestate entries must be key=value, got %q", kv)
+	}
+	for _, kv := range in.Baggage {
+		check(strings.Index(kv, "=") > 0, "-baggage members must be key=value, got %q", kv)
+	}
+	ratio("id-collisions", in.IDCollisionRatio)
+	ratio("unique-tx-names", in.UniqueNameRatio)
+	ratio("edge-strings", in.EdgeStringRatio)
+	check(in.MetricsInterval >= 0, "-metrics-interval must not be negative, got %s", in.MetricsInterval)
+
+	nonNegative("t", in.TransactionLimit)
+	frequency("tf", in.TransactionLimit, in.TransactionFrequency)
+	nonNegative("sm", in.SpanMinLimit)
+	check(in.SpanMinLimit <= in.SpanMaxLimit, "-sm (%d) must not be greater than -sx (%d)", in.SpanMinLimit, in.SpanMaxLimit)
+	nonNegative("st", in.SpanTypes)
+	nonNegative("span-depth", in.SpanDepth)
+	check(in.SpanDepth <= 1 || in.SpanFanOut > 0, "-span-fan-out must be positive, got %d", in.SpanFanOut)
+	nonNegative("xs", in.ExitSpans)
+	ratio("dropped-spans", in.DroppedSpansRatio)
+	check(in.DroppedSpansRatio == 0 || in.LongTransactions == 0, "-dropped-spans can't be combined with -long-transactions")
+	nonNegative("long-transactions", in.LongTransactions)
+	frequency("long-span-interval", in.LongTransactions, in.LongSpanInterval)
+	check(len(in.Feeds) == 0 || in.ScriptFile != "", "-feed requires -script, to refer to the feeds")
+	check(in.FeedOrder == "" || in.FeedOrder == "cycle" || in.FeedOrder == "sample",
+		"-feed-order must be cycle or sample, got %q", in.FeedOrder)
+	check(in.GeneratorCmd == "" || in.GeneratorFrequency > 0, "-generator-freq must be positive, got %s",
+		in.GeneratorFrequency)
+	if _, err := distribution.Parse(in.TransactionDuration); err != nil {
+		check(false, "-td: %s", err.Error())
+	}
+	if _, err := distribution.Parse(in.SpanDuration); err != nil {
+		check(false, "-sd: %s", err.Error())
+	}
+	nonNegative("http-headers", in.HTTPHeaders)
+	check(in.HTTPBodySize >= 0, "-http-body must not be negative, got %d", in.HTTPBodySize)
+	nonNegative("users", in.Users)
+	nonNegative("custom-depth", in.CustomContextDepth)
+	nonNegative("custom-size", in.CustomContextSize)
+
+	nonNegative("e", in.ErrorLimit)
+	frequency("ef", in.ErrorLimit, in.ErrorFrequency)
+	nonNegative("em", in.ErrorFrameMinLimit)
+	check(in.ErrorFrameMinLimit <= in.ErrorFrameMaxLimit, "-em (%d) must not be greater than -ex (%d)",
+		in.ErrorFrameMinLimit, in.ErrorFrameMaxLimit)
+	ratio("error-library-frames", in.ErrorLibraryFrames)
+	nonNegative("error-source-lines", in.ErrorSourceLines)
+	nonNegative("error-types", in.ErrorTypes)
+	nonNegative("error-messages", in.ErrorMessages)
+	nonNegative("error-culprits", in.ErrorCulprits)
+	nonNegative("error-cause-depth", in.ErrorCauseDepth)
+	ratio("error-log-ratio", in.ErrorLogRatio)
+
+	if len(problems) > 0 {
+		return ValidationError{in.TargetName, problems}
+	}
+	for _, target := range in.Targets {
+		if err := target.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	base := Input{
+		TransactionLimit: 10, TransactionFrequency: time.Millisecond, SpanMinLimit: 1, SpanMaxLimit: 10,
+		ErrorLimit: 10, ErrorFrequency: time.Millisecond, ErrorFrameMinLimit: 0, ErrorFrameMaxLimit: 10,
+	}
+	assert.NoError(t, base.Validate())
+
+	target := base
+	target.TargetName, target.ErrorFrameMinLimit, target.ErrorLogRatio = "broken", 20, 2
+	base.Targets = append(base.Targets, target)
+	err := base.Validate()
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "target broken")
+		assert.Contains(t, err.Error(), "-em (20) must not be greater than -ex (10)")
+		assert.Contains(t, err.Error(), "-error-log-ratio must be between 0 and 1")
+	}
+
+	base.Targets = nil
+	base.TransactionFrequency = 0
+	assert.Error(t, base.Validate())
+	base.TransactionFrequency = time.Millisecond
+
+	base.MaxBytesPerSecond = -1
+	if err := base.Validate(); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "-max-bps must not be negative")
+	}
+	base.MaxBytesPerSecond = 0
+
+	base.HTTPBodySize = -1
+	if err := base.Validate(); assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "-http-body must not be negative")
+	}
+}
@@ -0,0 +1,79 @@
+// Package notify posts run summaries to webhooks.
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/types"
+)
+
+// Send posts a summary of the reports of a run, or an alert if err is not nil, to a webhook.
+// The payload is a JSON object with a "text" attribute as expected by Slack incoming webhooks,
+// plus "status", "error" and "reports" attributes for any other webhooks.
+func Send(url string, reports []models.Report, err error) error {
+	status := "success"
+	var errMsg string
+	if err != nil {
+		status = "failure"
+		errMsg = err.Error()
+	}
+	body, merr := json.Marshal(types.M{
+		"text":    Text(reports, err),
+		"status":  status,
+		"error":   errMsg,
+		"reports": reports,
+	})
+	if merr != nil {
+		return merr
+	}
+
+	resp, herr := http.Post(url, "application/json", bytes.NewReader(body))
+	if herr != nil {
+		return herr
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		rb, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("notification status not OK: %s %s", resp.Status, rb))
+	}
+	return nil
+}
+
+// Text returns a human readable summary of the reports of a run, or an alert if err is not nil.
+func Text(reports []models.Report, err error) string {
+	host, _ := os.Hostname()
+	var b strings.Builder
+	if err != nil {
+		fmt.Fprintf(&b, ":rotating_light: hey-apm run on %s failed: %s\n", host, err.Error())
+	} else {
+		fmt.Fprintf(&b, ":white_check_mark: hey-apm run on %s completed\n", host)
+	}
+	for _, r := range reports {
+		if r.ReportId == "" {
+			continue
+		}
+		name := r.ReportId
+		if r.TargetName != "" {
+			name += " (" + r.TargetName + ")"
+		}
+		fmt.Fprintf(&b, "• %s against %s %s: %d events sent, %s/s indexed, %s%% lost, p99 latency %sms\n",
+			name, r.ApmServerUrl, r.ApmVersion, r.EventsSent,
+			optional(r.EventIndexRate), optional(r.EventLossRatio), optional(r.RequestLatencyP99))
+	}
+	return b.String()
+}
+
+func optional(f *float64) string {
+	if f == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *f)
+}
@@ -2,6 +2,7 @@ package numbers
 
 import (
 	"math"
+	"sort"
 
 	"github.com/elastic/hey-apm/conv"
 )
@@ -50,3 +51,46 @@ func Sum(xs ...uint64) uint64 {
 	}
 	return i
 }
+
+// Percentile returns the pth percentile of xs with the nearest-rank method, or nil if xs is empty.
+func Percentile(xs []float64, p float64) *float64 {
+	if len(xs) == 0 {
+		return nil
+	}
+	sorted := make([]float64, len(xs))
+	copy(sorted, xs)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	f := truncate(sorted[rank-1], 2)
+	return &f
+}
+
+// Stats summarizes a sample of values.
+type Stats struct {
+	Mean, StdDev, Min, Max float64
+}
+
+// Summarize returns the mean, sample standard deviation, min and max of xs, or nil if xs is empty.
+func Summarize(xs []float64) *Stats {
+	if len(xs) == 0 {
+		return nil
+	}
+	s := Stats{Min: xs[0], Max: xs[0]}
+	for _, x := range xs {
+		s.Mean += x
+		s.Min = math.Min(s.Min, x)
+		s.Max = math.Max(s.Max, x)
+	}
+	s.Mean /= float64(len(xs))
+	if len(xs) > 1 {
+		for _, x := range xs {
+			s.StdDev += (x - s.Mean) * (x - s.Mean)
+		}
+		s.StdDev = math.Sqrt(s.StdDev / float64(len(xs)-1))
+	}
+	s.Mean, s.StdDev = truncate(s.Mean, 2), truncate(s.StdDev, 2)
+	return &s
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/reports"
+)
+
+const planUsage = `usage: hey-apm plan -events-per-second <rate> [options]
+
+Recommends how many apm-server instances of each size are needed to index a rate of events, from the throughput
+of stored reports of runs against different sizes: Elastic Cloud APM sizes, or hosts with different numbers of cores.
+Reports should be of the same workload, eg. selected with -preset, or saved to a directory of their own.
+
+options:
+`
+
+// planCommand runs the `plan` subcommand with the given arguments, and returns the exit code.
+func planCommand(args []string) int {
+	fs := flag.NewFlagSet("plan", flag.ExitOnError)
+	eventsPerSecond := fs.Float64("events-per-second", 0, "events per second to index")
+	headroom := fs.Float64("headroom", 20, "percentage of the capacity of the instances to keep spare")
+	dir := fs.String("dir", "", "directory with reports saved with -reports-dir")
+	elasticsearchUrl := fs.String("es-url", "", "elasticsearch url with indexed reports, used if -dir is not passed")
+	elasticsearchAuth := fs.String("es-auth", "", "elasticsearch username:password")
+	n := fs.Int("n", 500, "max reports to consider, most recent first")
+	preset := fs.String("preset", "", "only consider reports of runs with this preset")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), planUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *eventsPerSecond <= 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	var store reports.Store
+	switch {
+	case *dir != "":
+		store = reports.Dir(*dir)
+	case *elasticsearchUrl != "":
+		conn, err := es.NewConnection(*elasticsearchUrl, *elasticsearchAuth)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return exitError
+		}
+		store = reports.Index{Connection: conn}
+	default:
+		fmt.Fprintln(os.Stderr, "either -dir or -es-url is required")
+		return exitError
+	}
+
+	if err := printPlan(store, *n, *preset, *eventsPerSecond, *headroom); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	return exitSuccess
+}
+
+func printPlan(store reports.Store, n int, preset string, eventsPerSecond, headroom float64) error {
+	rs, err := store.List(n)
+	if err != nil {
+		return err
+	}
+	var selected []models.Report
+	for _, r := range rs {
+		if preset == "" || r.Preset == preset {
+			selected = append(selected, r)
+		}
+	}
+	plan, recommended, err := reports.Plan(selected, eventsPerSecond, headroom)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "SIZE\tREPORTS\tEVENTS/S PER INSTANCE\t95% CI\tINSTANCES\t95% CI\tCOST PER HOUR")
+	for _, s := range plan {
+		ci, instancesCI := "-", "-"
+		if s.Low != nil {
+			ci = fmt.Sprintf("%.0f - %.0f", *s.Low, *s.High)
+			high := "unbounded"
+			if s.InstancesHigh > 0 {
+				high = fmt.Sprint(s.InstancesHigh)
+			}
+			instancesCI = fmt.Sprintf("%d - %s", s.InstancesLow, high)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%.0f\t%s\t%d\t%s\t%s\n", s.Size, s.Reports, s.Mean, ci, s.Instances, instancesCI,
+			formatCost(s.TotalHourlyCost))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	best := plan[recommended]
+	fmt.Printf("\nrecommended for %.0f events/s with %.0f%% headroom: %d instances of %s", eventsPerSecond, headroom,
+		best.Recommended(), best.Size)
+	if best.TotalHourlyCost != nil {
+		fmt.Printf(", %.2f per hour", *best.TotalHourlyCost)
+	}
+	fmt.Println()
+	if best.Low == nil {
+		fmt.Println("(from a single report, run more to get confidence bounds)")
+	} else if best.InstancesHigh == 0 {
+		fmt.Println("(throughput varies too much across reports to bound the instances needed, run more)")
+	}
+	return nil
+}
+
+func formatCost(f *float64) string {
+	if f == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *f)
+}
@@ -0,0 +1,73 @@
+package presets
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMix is the share of each event type of the total events per second, unless given.
+const DefaultMix = "transactions=25,spans=70,errors=5"
+
+// Mix returns the transaction and error frequencies and the spans per transaction generating eventsPerSecond events,
+// in the percentages of each event type given by mix, eg. "transactions=25,spans=70,errors=5".
+// Spans are generated with transactions, on top of exitSpans identical exit spans per transaction,
+// so their share sets the spans per transaction, up to half a span.
+func Mix(eventsPerSecond float64, mix string, exitSpans int) (Preset, error) {
+	if eventsPerSecond <= 0 {
+		return Preset{}, fmt.Errorf("events per second must be positive, got %v", eventsPerSecond)
+	}
+	shares := make(map[string]float64)
+	var total float64
+	for _, kv := range strings.Split(mix, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return Preset{}, fmt.Errorf("invalid mix %q, must be comma separated type=percentage pairs", mix)
+		}
+		name := strings.TrimSuffix(strings.TrimSpace(parts[0]), "s")
+		if name != "transaction" && name != "span" && name != "error" {
+			return Preset{}, fmt.Errorf("invalid mix %q, event types must be transactions, spans or errors", mix)
+		}
+		pct, err := strconv.ParseFloat(strings.TrimSuffix(parts[1], "%"), 64)
+		if err != nil || pct < 0 {
+			return Preset{}, fmt.Errorf("invalid mix %q, percentages must be non negative numbers", mix)
+		}
+		shares[name] += pct
+		total += pct
+	}
+	if math.Abs(total-100) > 0.01 {
+		return Preset{}, fmt.Errorf("invalid mix %q, percentages must add up to 100, got %v", mix, total)
+	}
+
+	flags := map[string]string{"t": "0", "e": "0"}
+	txRate := eventsPerSecond * shares["transaction"] / 100
+	if txRate > 0 {
+		flags["t"] = strconv.Itoa(math.MaxInt64)
+		flags["tf"] = frequency(txRate)
+		spans := shares["span"]/shares["transaction"] - float64(exitSpans)
+		if spans < 0 {
+			return Preset{}, fmt.Errorf("invalid mix %q, the %d exit spans per transaction (-xs) exceed "+
+				"the share of spans", mix, exitSpans)
+		}
+		// spans per transaction are uniformly distributed between -sm and -sx
+		halves := int(math.Round(2 * spans))
+		flags["sm"], flags["sx"] = strconv.Itoa(halves/2), strconv.Itoa(halves-halves/2)
+	} else if shares["span"] > 0 {
+		return Preset{}, fmt.Errorf("invalid mix %q, spans are generated with transactions", mix)
+	}
+	if errorRate := eventsPerSecond * shares["error"] / 100; errorRate > 0 {
+		flags["e"] = strconv.Itoa(math.MaxInt64)
+		flags["ef"] = frequency(errorRate)
+	}
+	return Preset{
+		Description: fmt.Sprintf("%v events per second, %s", eventsPerSecond, mix),
+		Flags:       flags,
+	}, nil
+}
+
+// frequency returns the interval between events generated at the given rate per second.
+func frequency(rate float64) string {
+	return time.Duration(float64(time.Second) / rate).String()
+}
@@ -0,0 +1,111 @@
+// Package presets holds named workloads, expressed as command line flags.
+package presets
+
+import (
+	"sort"
+)
+
+// Preset is a named workload.
+type Preset struct {
+	Description string
+	// values of command line flags, by flag name
+	Flags map[string]string
+}
+
+var presets = map[string]Preset{
+	"rum-heavy": {
+		Description: "many short page loads with few spans, rich HTTP context, many users and deep stacktraces",
+		Flags: map[string]string{
+			"tf": "1ms", "sm": "5", "sx": "20", "st": "5",
+			"td": "lognormal:200ms:0.8", "sd": "lognormal:30ms:1",
+			"http-headers": "15", "users": "10000",
+			"ef": "50ms", "em": "10", "ex": "40", "error-library-frames": "0.7",
+		},
+	},
+	"error-storm": {
+		Description: "errors only, as fast as possible, with large stacktraces, causes and log records",
+		Flags: map[string]string{
+			"t": "0", "ef": "1ns", "em": "10", "ex": "50",
+			"error-library-frames": "0.5", "error-source-lines": "3",
+			"error-types": "50", "error-messages": "500", "error-culprits": "100",
+			"error-cause-depth": "2", "error-log-ratio": "0.3",
+		},
+	},
+	"high-cardinality": {
+		Description: "transactions and errors with many distinct users, span types, error groups and context fields",
+		Flags: map[string]string{
+			"tf": "1ms", "st": "50", "users": "100000", "http-headers": "30",
+			"custom-depth": "3", "custom-size": "10",
+			"ef": "10ms", "error-types": "1000", "error-messages": "10000", "error-culprits": "1000",
+		},
+	},
+	"steady-1k-tps": {
+		Description: "a steady rate of 1000 transactions per second with 2 spans each, and 10 errors per second, for 5 minutes",
+		Flags: map[string]string{
+			"run": "5m", "tf": "1ms", "sm": "2", "sx": "2",
+			"td": "normal:100ms:20ms", "sd": "normal:20ms:5ms",
+			"ef": "100ms", "em": "5", "ex": "15",
+		},
+	},
+	"spike": {
+		Description: "a steady rate of 100 transactions per second with 2 spans each, spiking 10 times for 30 seconds " +
+			"after 2 minutes, comparing stats before, during and after the spike",
+		Flags: map[string]string{
+			"run": "5m", "tf": "10ms", "sm": "2", "sx": "2",
+			"td": "normal:100ms:20ms", "sd": "normal:20ms:5ms", "ef": "1s",
+			"spike-at": "2m", "spike-for": "30s", "spike-factor": "10",
+		},
+	},
+}
+
+// endpoints are presets of the options to reach apm-server, depending on how it runs.
+var endpoints = map[string]Preset{
+	"standalone": {
+		Description: "apm-server binary or container, with its memory stats exposed at /debug/vars " +
+			"(-E apm-server.expvar.enabled=true)",
+		Flags: map[string]string{
+			"apm-url": "http://localhost:8200", "expvar": "true",
+		},
+	},
+	"fleet": {
+		Description: "APM integration run by a Fleet managed Elastic Agent, which doesn't expose /debug/vars, " +
+			"with process stats from the Elastic Agent monitoring endpoint (agent.monitoring.http.enabled) " +
+			"and events in data streams",
+		Flags: map[string]string{
+			"apm-url": "http://localhost:8200", "expvar": "false",
+			"monitoring-url": "http://localhost:6791/processes/apm-server-default",
+		},
+	},
+}
+
+// Get returns a preset by name.
+func Get(name string) (Preset, bool) {
+	p, ok := presets[name]
+	return p, ok
+}
+
+// Names returns the names of all presets, sorted.
+func Names() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetEndpoint returns an endpoint preset by name.
+func GetEndpoint(name string) (Preset, bool) {
+	p, ok := endpoints[name]
+	return p, ok
+}
+
+// EndpointNames returns the names of all endpoint presets, sorted.
+func EndpointNames() []string {
+	names := make([]string, 0, len(endpoints))
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
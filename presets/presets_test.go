@@ -0,0 +1,78 @@
+package presets
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// commandLineFlags returns the names of the flags defined by the hey-apm command, as found in its source.
+func commandLineFlags(t *testing.T) map[string]bool {
+	pkgs, err := parser.ParseDir(token.NewFileSet(), "..", nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]bool)
+	ast.Inspect(pkgs["main"], func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != "flag" {
+			return true
+		}
+		// flag.Var and flag.StringVar take the name after the value
+		arg := 0
+		if strings.HasSuffix(sel.Sel.Name, "Var") {
+			arg = 1
+		}
+		if len(call.Args) > arg {
+			if lit, ok := call.Args[arg].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				name, _ := strconv.Unquote(lit.Value)
+				names[name] = true
+			}
+		}
+		return true
+	})
+	return names
+}
+
+func TestPresets(t *testing.T) {
+	flags := commandLineFlags(t)
+	assert.True(t, flags["preset"])
+	for _, name := range Names() {
+		p, _ := Get(name)
+		for k := range p.Flags {
+			assert.True(t, flags[k], fmt.Sprintf("preset %s sets unknown flag -%s", name, k))
+		}
+	}
+}
+
+func TestMix(t *testing.T) {
+	p, err := Mix(10000, "transactions=20,spans=70,errors=10", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "500µs", p.Flags["tf"])
+	assert.Equal(t, "1ms", p.Flags["ef"])
+	// 3.5 spans per transaction on average
+	assert.Equal(t, "3", p.Flags["sm"])
+	assert.Equal(t, "4", p.Flags["sx"])
+
+	p, err = Mix(100, "transactions=100", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "0", p.Flags["e"])
+
+	_, err = Mix(100, "transactions=50,errors=40", 0)
+	assert.Error(t, err)
+	_, err = Mix(100, "transactions=10,spans=20,errors=70", 3)
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/elastic/hey-apm/cloud"
+	"github.com/elastic/hey-apm/models"
+)
+
+// provisionTimeout is how long a new Elastic Cloud deployment may take to be ready.
+const provisionTimeout = 30 * time.Minute
+
+// provisionDeployment creates the Elastic Cloud deployment requested by the input, waits until it is ready,
+// and returns the input (and its targets) pointed at its apm-server and elasticsearch.
+// The deployment is shut down if it doesn't get ready, unless it is to be kept.
+func provisionDeployment(input models.Input) (models.Input, error) {
+	request, err := ioutil.ReadFile(input.CloudProvision)
+	if err != nil {
+		return input, err
+	}
+	id, credentials, err := cloud.CreateDeployment(input.CloudApiUrl, input.CloudApiKey, request)
+	if err != nil {
+		return input, err
+	}
+	fmt.Printf("elastic cloud deployment %s created, waiting until it is ready\n", id)
+	d, err := cloud.WaitReady(input.CloudApiUrl, input.CloudApiKey, id, provisionTimeout)
+	if err != nil {
+		if !input.CloudKeep {
+			shutdownDeployment(models.Input{CloudApiUrl: input.CloudApiUrl, CloudApiKey: input.CloudApiKey,
+				Cloud: &models.CloudDeployment{Id: id}})
+		}
+		return input, err
+	}
+	apmUrl, _ := d.ApmUrl()
+	esUrl, _ := d.ElasticsearchUrl()
+	summary := d.Summary()
+	summary.Provisioned = true
+
+	point := func(in models.Input) models.Input {
+		in.ApmServerUrl, in.ApmElasticsearchUrl, in.ApmElasticsearchAuth = apmUrl, esUrl, credentials.ElasticsearchAuth
+		if in.APIKey == "" {
+			in.ApmServerSecret = credentials.ApmSecret
+		}
+		in.SkipExpvar = true
+		in.Cloud = &summary
+		return in
+	}
+	input = point(input)
+	for i, target := range input.Targets {
+		input.Targets[i] = point(target)
+	}
+	return input, nil
+}
+
+// shutdownDeployment shuts down the Elastic Cloud deployment of the input, printing any error.
+func shutdownDeployment(input models.Input) {
+	if input.Cloud == nil {
+		return
+	}
+	if err := cloud.ShutdownDeployment(input.CloudApiUrl, input.CloudApiKey, input.Cloud.Id); err != nil {
+		fmt.Fprintf(os.Stderr, "elastic cloud deployment %s not shut down: %s\n", input.Cloud.Id, err)
+		return
+	}
+	fmt.Printf("elastic cloud deployment %s shut down\n", input.Cloud.Id)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"github.com/elastic/hey-apm/proxy"
+	"github.com/elastic/hey-apm/record"
+)
+
+const proxyUsage = `usage: hey-apm proxy -record <file> [options]
+
+Forwards the traffic of real agents to apm-server, and writes the uncompressed body of their intake requests
+to a file, in the same format as -record. Request headers, including credentials, are not recorded.
+Stops on interrupt.
+
+options:
+`
+
+// proxyCommand runs the `proxy` subcommand with the given arguments, and returns the exit code.
+func proxyCommand(args []string) int {
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:8201", "address to listen on for agent requests")
+	apmUrl := fs.String("apm-url", "http://localhost:8200", "apm-server url to forward requests to")
+	recordFile := fs.String("record", "", "file to write intake request bodies to")
+	scrubRules := fs.String("scrub", "", "scrub recorded requests with the rules in this JSON file, "+
+		"or with the default rules if \"default\"")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), proxyUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *recordFile == "" {
+		fs.Usage()
+		return exitError
+	}
+	target, err := url.Parse(*apmUrl)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	var scrubber *record.Scrubber
+	if *scrubRules != "" {
+		if scrubber, err = record.LoadScrubber(*scrubRules); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return exitError
+		}
+	}
+	recorder, err := record.New(*recordFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	defer recorder.Close()
+	recorder.Scrubber = scrubber
+
+	logger := log.New(os.Stderr, "[proxy] ", log.Ldate|log.Ltime)
+	p := proxy.New(logger, target, recorder)
+	server := &http.Server{Addr: *listen, Handler: p}
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		server.Shutdown(context.Background())
+	}()
+	logger.Printf("listening on %s, forwarding to %s", *listen, *apmUrl)
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	requests, events := p.Recorded()
+	logger.Printf("%d requests with %d events recorded in %s", requests, events, *recordFile)
+	return exitSuccess
+}
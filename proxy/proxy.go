@@ -0,0 +1,60 @@
+// Package proxy forwards real agent traffic to apm-server, recording intake payloads to build replay corpora.
+package proxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/elastic/hey-apm/record"
+)
+
+// Proxy is a reverse proxy to apm-server recording the body of intake requests, but not their headers,
+// so that credentials are not stored.
+type Proxy struct {
+	// intake requests and events recorded, first for 64 bit alignment
+	requests, events uint64
+
+	proxy    *httputil.ReverseProxy
+	recorder *record.Recorder
+	logger   *log.Logger
+}
+
+// New returns a Proxy forwarding requests to target, and recording intake requests with recorder.
+func New(logger *log.Logger, target *url.URL, recorder *record.Recorder) *Proxy {
+	return &Proxy{
+		proxy:    httputil.NewSingleHostReverseProxy(target),
+		recorder: recorder,
+		logger:   logger,
+	}
+}
+
+// ServeHTTP records the body of intake requests and forwards all requests untouched.
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method == "POST" && strings.HasPrefix(req.URL.Path, "/intake/v2/") && req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		if events, err := p.recorder.Record(req.Header, body); err != nil {
+			p.logger.Printf("error recording request to %s: %s", req.URL.Path, err.Error())
+		} else {
+			atomic.AddUint64(&p.requests, 1)
+			atomic.AddUint64(&p.events, uint64(events))
+		}
+	}
+	p.proxy.ServeHTTP(w, req)
+}
+
+// Recorded returns the number of intake requests and events recorded so far.
+func (p *Proxy) Recorded() (uint64, uint64) {
+	return atomic.LoadUint64(&p.requests), atomic.LoadUint64(&p.events)
+}
@@ -0,0 +1,71 @@
+package pushgateway
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/models"
+)
+
+const job = "hey-apm"
+
+// Push sends every numeric attribute of a report as a gauge to a Prometheus Pushgateway,
+// replacing the metrics previously pushed for the same job and instance.
+func Push(gatewayUrl string, report models.Report) error {
+	u, err := url.Parse(gatewayUrl)
+	if err != nil {
+		return err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/metrics/job/" + job
+	if report.TargetName != "" {
+		u.Path += "/instance/" + url.PathEscape(report.TargetName)
+	}
+
+	req, _ := http.NewRequest("PUT", u.String(), bytes.NewReader(Format(report)))
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("pushgateway status not OK: %s %s", resp.Status, body))
+	}
+	return nil
+}
+
+// Format renders the numeric attributes of a report in the Prometheus text exposition format.
+func Format(report models.Report) []byte {
+	labels := fmt.Sprintf(`{report_id="%s",apm_version="%s",apm_url="%s"}`,
+		escape(report.ReportId), escape(report.ApmVersion), escape(report.ApmServerUrl))
+
+	m := conv.ToMap(report)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	for _, k := range keys {
+		v, ok := m[k].(float64)
+		if !ok {
+			continue
+		}
+		name := "hey_apm_" + strings.Replace(strings.TrimPrefix(k, "@"), ".", "_", -1)
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n%s%s %v\n", name, name, labels, v)
+	}
+	return buf.Bytes()
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
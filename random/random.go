@@ -0,0 +1,21 @@
+// Package random derives every source of randomness of a run from its seed, so that the same seed reproduces it.
+package random
+
+import (
+	"hash/fnv"
+	"math/rand"
+)
+
+// Derive returns a seed derived from seed and a name, so that sources of randomness with different names,
+// or runs of different targets, produce independent sequences.
+func Derive(seed int64, name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return seed ^ int64(h.Sum64())
+}
+
+// New returns a source of randomness seeded with the seed derived from seed and name.
+// It is not safe for concurrent use.
+func New(seed int64, name string) *rand.Rand {
+	return rand.New(rand.NewSource(Derive(seed, name)))
+}
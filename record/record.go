@@ -0,0 +1,120 @@
+// Package record writes intake request bodies to files, to inspect and replay workloads.
+package record
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Recorder writes the uncompressed NDJSON body of intake requests to a file, one after another.
+// Each body starts with a metadata line. It is safe for concurrent use.
+type Recorder struct {
+	// if not nil, applied to payloads before writing them
+	Scrubber *Scrubber
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// New returns a Recorder writing to path, which is truncated if it exists.
+func New(path string) (*Recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{f: f}, nil
+}
+
+// Record writes a request body, decompressed as given by the Content-Encoding header,
+// and returns the number of events in it.
+func (r *Recorder) Record(header http.Header, body []byte) (int, error) {
+	ndjson, err := Decompress(header, body)
+	if err != nil {
+		return 0, err
+	}
+	if len(ndjson) == 0 {
+		return 0, nil
+	}
+	if ndjson[len(ndjson)-1] != '\n' {
+		ndjson = append(ndjson, '\n')
+	}
+	if r.Scrubber != nil {
+		ndjson = r.Scrubber.Scrub(ndjson)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err := r.f.Write(ndjson); err != nil {
+		return 0, err
+	}
+	// all lines but the metadata one are events
+	return bytes.Count(ndjson, []byte("\n")) - 1, nil
+}
+
+// Decompress returns a request body decompressed as given by the Content-Encoding header.
+func Decompress(header http.Header, body []byte) ([]byte, error) {
+	buf := bytes.NewBuffer(make([]byte, 0, 4*len(body)))
+	if err := DecompressFrom(buf, header, bytes.NewReader(body)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gzipReaders and zlibReaders hold decompressors, reused across requests as they allocate large buffers.
+var gzipReaders, zlibReaders sync.Pool
+
+// DecompressFrom is like Decompress, streaming the body from r and appending it decompressed to buf,
+// so that callers can reuse buffers.
+func DecompressFrom(buf *bytes.Buffer, header http.Header, r io.Reader) error {
+	rd, release, err := Decompressor(header, r)
+	if err != nil {
+		return err
+	}
+	defer release()
+	_, err = buf.ReadFrom(rd)
+	return err
+}
+
+// Decompressor returns a reader decompressing a request body streamed from r as given by the Content-Encoding
+// header, and a function putting it back to the pool once read.
+func Decompressor(header http.Header, r io.Reader) (io.Reader, func(), error) {
+	switch header.Get("Content-Encoding") {
+	case "deflate":
+		var rd io.ReadCloser
+		var err error
+		if pooled, ok := zlibReaders.Get().(io.ReadCloser); ok {
+			rd, err = pooled, pooled.(zlib.Resetter).Reset(r, nil)
+		} else {
+			rd, err = zlib.NewReader(r)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return rd, func() { zlibReaders.Put(rd) }, nil
+	case "gzip":
+		gr, ok := gzipReaders.Get().(*gzip.Reader)
+		var err error
+		if ok {
+			err = gr.Reset(r)
+		} else {
+			gr, err = gzip.NewReader(r)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return gr, func() { gzipReaders.Put(gr) }, nil
+	}
+	return r, func() {}, nil
+}
+
+// Close closes the file.
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
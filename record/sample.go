@@ -0,0 +1,68 @@
+package record
+
+import (
+	"bytes"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/elastic/hey-apm/random"
+)
+
+// Sampler writes a random sample of the events sent in intake requests to a file, one NDJSON line per event
+// as sent, with their Ids, so that they can be compared with the documents indexed for them.
+// It is safe for concurrent use.
+type Sampler struct {
+	every int
+
+	mu   sync.Mutex
+	rand *rand.Rand
+	f    *os.File
+}
+
+// NewSampler returns a Sampler writing 1 in every events on average to path, which is truncated if it exists,
+// picked with randomness derived from seed.
+func NewSampler(path string, every int, seed int64) (*Sampler, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if every < 1 {
+		every = 1
+	}
+	return &Sampler{every: every, rand: random.New(seed, "sampler"), f: f}, nil
+}
+
+// Sample writes a random sample of the events of a request body, decompressed as given by the Content-Encoding header.
+// The metadata line is skipped.
+func (s *Sampler) Sample(header http.Header, body []byte) error {
+	ndjson, err := Decompress(header, body)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sample bytes.Buffer
+	var n int
+	for i, line := range bytes.Split(ndjson, []byte("\n")) {
+		if i == 0 || len(line) == 0 || s.rand.Intn(s.every) != 0 {
+			continue
+		}
+		sample.Write(line)
+		sample.WriteByte('\n')
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+	_, err = s.f.Write(sample.Bytes())
+	return err
+}
+
+// Close closes the file.
+func (s *Sampler) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
@@ -0,0 +1,149 @@
+package record
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// Rule scrubs a field of recorded events.
+type Rule struct {
+	// dotted path of the field, starting with the event type or * for all of them,
+	// eg. span.context.db.statement or *.context.user.email
+	Field string `json:"field"`
+	// one of remove, hash, redact or ip
+	Action string `json:"action"`
+	// replacement of redacted values, "REDACTED" if empty
+	Value string `json:"value,omitempty"`
+}
+
+// DefaultRules scrub IPs, user fields, db statements, headers, cookies and bodies.
+var DefaultRules = []Rule{
+	{Field: "metadata.system.hostname", Action: "hash"},
+	{Field: "metadata.system.detected_hostname", Action: "hash"},
+	{Field: "metadata.system.configured_hostname", Action: "hash"},
+	{Field: "metadata.user", Action: "remove"},
+	{Field: "*.context.request.headers", Action: "remove"},
+	{Field: "*.context.request.cookies", Action: "remove"},
+	{Field: "*.context.request.body", Action: "remove"},
+	{Field: "*.context.request.env", Action: "remove"},
+	{Field: "*.context.request.socket.remote_address", Action: "ip"},
+	{Field: "*.context.response.headers", Action: "remove"},
+	{Field: "*.context.user.id", Action: "hash"},
+	{Field: "*.context.user.email", Action: "hash"},
+	{Field: "*.context.user.username", Action: "hash"},
+	{Field: "*.context.user.ip", Action: "ip"},
+	{Field: "span.context.db.statement", Action: "redact"},
+	{Field: "span.context.db.user", Action: "hash"},
+	{Field: "span.context.http.url", Action: "redact"},
+}
+
+// Scrubber applies rules to NDJSON intake payloads.
+// Hashed values and IPs are replaced consistently, so that their cardinality is preserved.
+type Scrubber struct {
+	rules []Rule
+}
+
+// NewScrubber returns a Scrubber with the given rules, or an error if any of them is not valid.
+func NewScrubber(rules []Rule) (*Scrubber, error) {
+	for _, r := range rules {
+		if strings.Count(r.Field, ".") < 1 {
+			return nil, fmt.Errorf("invalid scrub field %q, expected <event type>.<path>", r.Field)
+		}
+		switch r.Action {
+		case "remove", "hash", "redact", "ip":
+		default:
+			return nil, fmt.Errorf("invalid scrub action %q for %s", r.Action, r.Field)
+		}
+	}
+	return &Scrubber{rules}, nil
+}
+
+// LoadScrubber returns a Scrubber with DefaultRules if path is "default", or with the rules in a JSON file otherwise.
+func LoadScrubber(path string) (*Scrubber, error) {
+	if path == "default" {
+		return NewScrubber(DefaultRules)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []Rule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing scrub rules in %s: %s", path, err.Error())
+	}
+	return NewScrubber(rules)
+}
+
+// Scrub applies the rules to every line of an NDJSON payload.
+// Lines that are not JSON objects are kept as they are.
+func (s *Scrubber) Scrub(ndjson []byte) []byte {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(ndjson, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			out.Write(line)
+			continue
+		}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			out.Write(line)
+			continue
+		}
+		for eventType, event := range doc {
+			event, ok := event.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, r := range s.rules {
+				path := strings.Split(r.Field, ".")
+				if path[0] == "*" || path[0] == eventType {
+					r.apply(event, path[1:])
+				}
+			}
+		}
+		b, _ := json.Marshal(doc)
+		out.Write(b)
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+func (r Rule) apply(obj map[string]interface{}, path []string) {
+	for len(path) > 1 {
+		var ok bool
+		if obj, ok = obj[path[0]].(map[string]interface{}); !ok {
+			return
+		}
+		path = path[1:]
+	}
+	v, ok := obj[path[0]]
+	if !ok || v == nil {
+		return
+	}
+	switch r.Action {
+	case "remove":
+		delete(obj, path[0])
+	case "hash":
+		obj[path[0]] = hash(v)[:16]
+	case "redact":
+		if r.Value != "" {
+			obj[path[0]] = r.Value
+		} else {
+			obj[path[0]] = "REDACTED"
+		}
+	case "ip":
+		h := sha256.Sum256([]byte(fmt.Sprint(v)))
+		obj[path[0]] = fmt.Sprintf("10.%d.%d.%d", h[0], h[1], h[2])
+	}
+}
+
+func hash(v interface{}) string {
+	h := sha256.Sum256([]byte(fmt.Sprint(v)))
+	return hex.EncodeToString(h[:])
+}
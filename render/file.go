@@ -0,0 +1,29 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+// File writes a report and its series to a file, as HTML if its extension is .html or .htm, Markdown otherwise.
+func File(path string, r models.Report, s Series) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm":
+		err = HTML(f, r, s)
+	default:
+		err = Markdown(f, r, s)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,86 @@
+package render
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+// chart dimensions, in pixels
+const (
+	chartWidth  = 600
+	chartHeight = 150
+)
+
+var page = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>hey-apm report {{.Report.ReportId}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+td { border: 1px solid #ddd; padding: 0.2em 0.6em; }
+svg { background: #fafafa; border: 1px solid #ddd; }
+polyline { fill: none; stroke: #07c; stroke-width: 1.5; }
+</style>
+</head>
+<body>
+<h1>hey-apm report {{.Report.ReportId}}</h1>
+<h2>Result</h2>
+<table>{{range .Summary}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+{{if .Charts}}<h2>Over time</h2>
+<p>One value every {{.Interval}}.</p>
+{{range .Charts}}<h3>{{.Title}}, max {{printf "%.2f" .Max}}</h3>
+<svg width="{{.Width}}" height="{{.Height}}"><polyline points="{{.Points}}"/></svg>
+{{end}}{{end}}<h2>Workload</h2>
+<table>{{range .Workload}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>{{end}}</table>
+</body>
+</html>
+`))
+
+type svgChart struct {
+	Title         string
+	Max           float64
+	Width, Height int
+	Points        string
+}
+
+// HTML writes a report, and the given series if any, as a standalone HTML page.
+// Series are charted with inline SVG.
+func HTML(w io.Writer, r models.Report, s Series) error {
+	var charts []svgChart
+	if len(s.Points) > 0 {
+		for _, c := range s.charts() {
+			charts = append(charts, svgChart{c.Title, c.max(), chartWidth, chartHeight, polyline(c)})
+		}
+	}
+	return page.Execute(w, map[string]interface{}{
+		"Report":   r,
+		"Summary":  summary(r),
+		"Workload": workload(r),
+		"Interval": s.Interval,
+		"Charts":   charts,
+	})
+}
+
+// polyline returns the coordinates of a chart values scaled to the chart dimensions.
+func polyline(c chart) string {
+	max := c.max()
+	step := float64(chartWidth)
+	if len(c.Values) > 1 {
+		step = float64(chartWidth) / float64(len(c.Values)-1)
+	}
+	points := make([]string, len(c.Values))
+	for idx, v := range c.Values {
+		y := float64(chartHeight)
+		if max > 0 {
+			y -= v / max * float64(chartHeight)
+		}
+		points[idx] = fmt.Sprintf("%.1f,%.1f", float64(idx)*step, y)
+	}
+	return strings.Join(points, " ")
+}
@@ -0,0 +1,56 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+var sparks = []rune("▁▂▃▄▅▆▇█")
+
+// Markdown writes a report, and the given series if any, as a Markdown document.
+// Series are charted with sparklines.
+func Markdown(w io.Writer, r models.Report, s Series) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# hey-apm report %s\n\n", r.ReportId)
+	table(&b, "Result", summary(r))
+	if len(s.Points) > 0 {
+		fmt.Fprintf(&b, "## Over time\n\nOne value every %s.\n\n", s.Interval)
+		for _, c := range s.charts() {
+			fmt.Fprintf(&b, "- %s, max %.2f: `%s`\n", c.Title, c.max(), sparkline(c))
+		}
+		b.WriteString("\n")
+	}
+	table(&b, "Workload", workload(r))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func table(b *strings.Builder, title string, rows []row) {
+	fmt.Fprintf(b, "## %s\n\n| | |\n|---|---|\n", title)
+	for _, r := range rows {
+		fmt.Fprintf(b, "| %s | %s |\n", r.Name, strings.Replace(r.Value, "|", "\\|", -1))
+	}
+	b.WriteString("\n")
+}
+
+// Sparkline charts values with block characters, scaled to their maximum.
+func Sparkline(values []float64) string {
+	return sparkline(chart{Values: values})
+}
+
+func sparkline(c chart) string {
+	max := c.max()
+	line := make([]rune, len(c.Values))
+	for idx, v := range c.Values {
+		level := 0
+		if max > 0 && v > 0 {
+			level = int(math.Round(v / max * float64(len(sparks)-1)))
+		}
+		line[idx] = sparks[level]
+	}
+	return string(line)
+}
@@ -0,0 +1,112 @@
+// Package render renders performance reports as shareable Markdown or HTML documents.
+package render
+
+import (
+	"time"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/numbers"
+)
+
+// maxPoints is the maximum number of intervals in a series, to keep charts readable.
+const maxPoints = 120
+
+// Point holds the stats of the requests started within an interval.
+type Point struct {
+	// since the start of the series
+	Offset   time.Duration
+	Requests int
+	Failed   int
+	// per second
+	RequestRate float64
+	BytesRate   float64
+	// request latency percentiles in milliseconds, nil if no request succeeded
+	LatencyP50 *float64
+	LatencyP99 *float64
+}
+
+// Series is a time series of request stats.
+type Series struct {
+	Interval time.Duration
+	Points   []Point
+}
+
+// NewSeries buckets request samples in intervals of at least one second, so that there are at most maxPoints.
+func NewSeries(samples []agent.RequestSample) Series {
+	if len(samples) == 0 {
+		return Series{}
+	}
+	start, end := samples[0].Timestamp, samples[0].Timestamp
+	for _, s := range samples {
+		if s.Timestamp.Before(start) {
+			start = s.Timestamp
+		}
+		if s.Timestamp.After(end) {
+			end = s.Timestamp
+		}
+	}
+	interval := time.Second
+	for end.Sub(start)/interval >= maxPoints {
+		interval *= 2
+	}
+
+	n := int(end.Sub(start)/interval) + 1
+	points := make([]Point, n)
+	latencies := make([][]float64, n)
+	for _, s := range samples {
+		idx := int(s.Timestamp.Sub(start) / interval)
+		p := &points[idx]
+		p.Requests++
+		p.BytesRate += float64(s.BytesSent)
+		if s.Status == 0 || s.Status >= 400 {
+			p.Failed++
+		} else {
+			latencies[idx] = append(latencies[idx], float64(s.Duration)/float64(time.Millisecond))
+		}
+	}
+	for idx := range points {
+		p := &points[idx]
+		p.Offset = time.Duration(idx) * interval
+		p.RequestRate = float64(p.Requests) / interval.Seconds()
+		p.BytesRate /= interval.Seconds()
+		p.LatencyP50 = numbers.Percentile(latencies[idx], 50)
+		p.LatencyP99 = numbers.Percentile(latencies[idx], 99)
+	}
+	return Series{interval, points}
+}
+
+// values returns a value per point, with missing values as 0.
+func (s Series) values(f func(Point) *float64) []float64 {
+	vs := make([]float64, len(s.Points))
+	for idx, p := range s.Points {
+		if v := f(p); v != nil {
+			vs[idx] = *v
+		}
+	}
+	return vs
+}
+
+// charts returns the charted metrics of the series.
+func (s Series) charts() []chart {
+	return []chart{
+		{"Requests per second", s.values(func(p Point) *float64 { return &p.RequestRate })},
+		{"Bytes sent per second", s.values(func(p Point) *float64 { return &p.BytesRate })},
+		{"Request latency p50 (ms)", s.values(func(p Point) *float64 { return p.LatencyP50 })},
+		{"Request latency p99 (ms)", s.values(func(p Point) *float64 { return p.LatencyP99 })},
+	}
+}
+
+type chart struct {
+	Title  string
+	Values []float64
+}
+
+func (c chart) max() float64 {
+	var max float64
+	for _, v := range c.Values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/models"
+)
+
+type row struct {
+	Name, Value string
+}
+
+// summary returns the main results of a report.
+func summary(r models.Report) []row {
+	rows := []row{
+		{"apm-server version", r.ApmVersion},
+		{"apm-server build", r.ApmBuild},
+		{"date", r.ReportDate},
+		{"elapsed (s)", conv.ToString(r.Elapsed)},
+		{"requests", conv.ToString(r.Requests)},
+		{"failed requests", conv.ToString(r.FailedRequests)},
+		{"request latency p50 (ms)", optional(r.RequestLatencyP50)},
+		{"request latency p99 (ms)", optional(r.RequestLatencyP99)},
+		{"events generated", conv.ToString(r.EventsGenerated)},
+		{"events sent", conv.ToString(r.EventsSent)},
+		{"events sent per second", optional(r.EventSendRate)},
+		{"events accepted", conv.ToString(r.EventsAccepted)},
+		{"events rejected", conv.ToString(r.EventsRejected)},
+		{"events unacknowledged", conv.ToString(r.EventsUnacknowledged)},
+		{"events indexed", conv.ToString(r.EventsIndexed)},
+		{"events indexed per second", optional(r.EventIndexRate)},
+		{"event loss %", optional(r.EventLossRatio)},
+	}
+	if r.CostPerMillionEvents != nil {
+		rows = append(rows, row{"cost per million events", fmt.Sprintf("%.4f", *r.CostPerMillionEvents)})
+	}
+	for _, reason := range r.RejectionReasons {
+		rows = append(rows, row{"rejection reason", reason})
+	}
+	return rows
+}
+
+// workload returns the input attributes of a report, sorted by name.
+func workload(r models.Report) []row {
+	var rows []row
+	for k, v := range conv.ToMap(r.Input) {
+		rows = append(rows, row{k, conv.ToString(v)})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].Name < rows[j].Name
+	})
+	return rows
+}
+
+func optional(f *float64) string {
+	if f == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *f)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/render"
+	"github.com/elastic/hey-apm/reports"
+)
+
+const reportUsage = `usage: hey-apm report [options] list|show <id>|diff <id> <id>|render <id>|trend
+
+  list   lists the most recent reports
+  show   prints a report as JSON
+  diff   prints the attributes that changed from the first report to the second
+  render prints a report as a Markdown or HTML document
+  trend  prints a metric of the most recent reports per apm-server commit, oldest first
+
+options:
+`
+
+// reportCommand runs the `report` subcommand with the given arguments, and returns the exit code.
+func reportCommand(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	dir := fs.String("dir", "", "directory with reports saved with -reports-dir")
+	elasticsearchUrl := fs.String("es-url", "", "elasticsearch url with indexed reports, used if -dir is not passed")
+	elasticsearchAuth := fs.String("es-auth", "", "elasticsearch username:password")
+	n := fs.Int("n", 20, "max reports to list")
+	format := fs.String("format", "md", "format of rendered reports, md or html")
+	metric := fs.String("metric", "throughput", "metric to trend: throughput, latency, loss, cost, "+
+		"or the JSON name of any numeric report attribute")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), reportUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	args = fs.Args()
+	if fs.Arg(0) == "trend" {
+		// options may follow the command, as in `report trend -metric latency`
+		fs.Parse(args[1:])
+		args = append([]string{"trend"}, fs.Args()...)
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return exitError
+	}
+
+	var store reports.Store
+	switch {
+	case *dir != "":
+		store = reports.Dir(*dir)
+	case *elasticsearchUrl != "":
+		conn, err := es.NewConnection(*elasticsearchUrl, *elasticsearchAuth)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+			return exitError
+		}
+		store = reports.Index{Connection: conn}
+	default:
+		fmt.Fprintln(os.Stderr, "either -dir or -es-url is required")
+		return exitError
+	}
+
+	var err error
+	switch cmd := args[0]; {
+	case cmd == "list" && len(args) == 1:
+		err = listReports(store, *n)
+	case cmd == "show" && len(args) == 2:
+		err = showReport(store, args[1])
+	case cmd == "diff" && len(args) == 3:
+		err = diffReports(store, args[1], args[2])
+	case cmd == "render" && len(args) == 2:
+		err = renderReport(store, args[1], *format)
+	case cmd == "trend" && len(args) == 1:
+		err = trendReports(store, *n, *metric)
+	default:
+		fs.Usage()
+		return exitError
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	return exitSuccess
+}
+
+func listReports(store reports.Store, n int) error {
+	rs, err := store.List(n)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tDATE\tAPM VERSION\tLABELS\tEVENTS SENT/S\tEVENTS INDEXED/S")
+	for _, r := range rs {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.ReportId, r.ReportDate, r.ApmVersion,
+			conv.ToString(r.Labels), formatRate(r.EventSendRate), formatRate(r.EventIndexRate))
+	}
+	return w.Flush()
+}
+
+func formatRate(f *float64) string {
+	if f == nil {
+		return "-"
+	}
+	return conv.ToString(*f)
+}
+
+func showReport(store reports.Store, id string) error {
+	r, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(r, "", "  ")
+	if err == nil {
+		fmt.Println(string(b))
+	}
+	return err
+}
+
+func diffReports(store reports.Store, id1, id2 string) error {
+	r1, err := store.Get(id1)
+	if err != nil {
+		return err
+	}
+	r2, err := store.Get(id2)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "ATTRIBUTE\t%s\t%s\tCHANGE %%\n", id1, id2)
+	for _, d := range reports.Diff(r1, r2) {
+		change := ""
+		if d.Change != nil {
+			change = fmt.Sprintf("%+.2f", *d.Change)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", d.Name, conv.ToString(d.Old), conv.ToString(d.New), change)
+	}
+	return w.Flush()
+}
+
+func renderReport(store reports.Store, id, format string) error {
+	r, err := store.Get(id)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "md":
+		return render.Markdown(os.Stdout, r, render.Series{})
+	case "html":
+		return render.HTML(os.Stdout, r, render.Series{})
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func trendReports(store reports.Store, n int, metric string) error {
+	rs, err := store.List(n)
+	if err != nil {
+		return err
+	}
+	trend, err := reports.Trend(rs, metric)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "APM BUILD\tBUILD DATE\tREPORTS\tMEAN\tMIN\tMAX\tCHANGE %")
+	means := make([]float64, len(trend))
+	for i, c := range trend {
+		change := ""
+		if c.Change != nil {
+			change = fmt.Sprintf("%+.2f", *c.Change)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%.2f\t%.2f\t%.2f\t%s\n", c.Build, c.BuildDate.Format("2006-01-02"), c.Reports,
+			c.Mean, c.Min, c.Max, change)
+		means[i] = c.Mean
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%s: %s\n", metric, render.Sparkline(means))
+	return nil
+}
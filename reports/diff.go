@@ -0,0 +1,55 @@
+package reports
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// attributes identifying a report rather than describing a run, not compared
+var identifiers = []string{"report_id", "report_date", "reporter_host", "@timestamp"}
+
+// Delta is the difference of an attribute between two reports.
+type Delta struct {
+	// JSON name of the attribute
+	Name     string
+	Old, New interface{}
+	// relative change as a percentage, nil if the values are not numeric or Old is 0
+	Change *float64
+}
+
+// Diff returns the attributes with different values in 2 reports, sorted by name.
+// Attributes missing in one of the reports have a nil value.
+func Diff(r1, r2 models.Report) []Delta {
+	m1, m2 := conv.ToMap(r1), conv.ToMap(r2)
+	names := make(map[string]bool)
+	for k := range m1 {
+		names[k] = true
+	}
+	for k := range m2 {
+		names[k] = true
+	}
+
+	var deltas []Delta
+	for name := range names {
+		old, new := m1[name], m2[name]
+		if strcoll.Contains(name, identifiers) || reflect.DeepEqual(old, new) {
+			continue
+		}
+		d := Delta{Name: name, Old: old, New: new}
+		f1, ok1 := old.(float64)
+		f2, ok2 := new.(float64)
+		if ok1 && ok2 {
+			d.Change = numbers.Div((f2-f1)*100, f1)
+		}
+		deltas = append(deltas, d)
+	}
+	sort.Slice(deltas, func(i, j int) bool {
+		return deltas[i].Name < deltas[j].Name
+	})
+	return deltas
+}
@@ -0,0 +1,140 @@
+package reports
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+)
+
+// Sizing is how many apm-server instances of a size are needed for a rate of events, as estimated from the throughput
+// of the reports of runs against that size.
+type Sizing struct {
+	// Elastic Cloud APM size, or number of cores of the apm-server host
+	Size string
+	// number of reports of the size
+	Reports int
+	// mean events indexed per second by one instance
+	Mean float64
+	// bounds of the 95% confidence interval of the mean, nil with a single report
+	Low, High *float64
+	// instances needed if the throughput is the mean
+	Instances int
+	// instances needed if the throughput is the high and low bound of its confidence interval,
+	// 0 if it is unbounded (a low bound not greater than 0)
+	InstancesLow, InstancesHigh int
+	// price per hour of one instance, as reported, and of the recommended instances
+	HourlyCost, TotalHourlyCost *float64
+}
+
+// Recommended returns the instances to plan for: the conservative estimate if known, the expected one otherwise.
+func (s Sizing) Recommended() int {
+	if s.InstancesHigh > 0 {
+		return s.InstancesHigh
+	}
+	return s.Instances
+}
+
+// Size returns the apm-server size of the run of a report: its Elastic Cloud APM size if any, or the number of cores
+// of its host if known, or an empty string otherwise.
+func Size(r models.Report) string {
+	if r.Cloud != nil && r.Cloud.ApmSize != "" {
+		return r.Cloud.ApmSize
+	}
+	if r.CPUCores != nil {
+		return fmt.Sprintf("%d cores", *r.CPUCores)
+	}
+	return ""
+}
+
+// Plan groups reports by apm-server size and estimates the instances of each size needed to index eventsPerSecond,
+// keeping a headroom percentage of their capacity spare. Sizings are sorted by throughput per instance, and the index
+// of the recommended one is returned too. Reports without a size or events indexed are skipped.
+func Plan(reports []models.Report, eventsPerSecond, headroom float64) ([]Sizing, int, error) {
+	if headroom < 0 || headroom >= 100 {
+		return nil, 0, fmt.Errorf("headroom must be between 0 and 100, got %v", headroom)
+	}
+	required := eventsPerSecond / (1 - headroom/100)
+	rates := make(map[string][]float64)
+	costs := make(map[string][]float64)
+	for _, r := range reports {
+		size := Size(r)
+		if size == "" || r.EventIndexRate == nil || *r.EventIndexRate <= 0 {
+			continue
+		}
+		rates[size] = append(rates[size], *r.EventIndexRate)
+		if r.DeploymentHourlyCost != nil {
+			costs[size] = append(costs[size], *r.DeploymentHourlyCost)
+		}
+	}
+	if len(rates) == 0 {
+		return nil, 0, errors.New("no reports with an apm-server size and events indexed")
+	}
+
+	var plan []Sizing
+	for size, xs := range rates {
+		stats := numbers.Summarize(xs)
+		s := Sizing{Size: size, Reports: len(xs), Mean: stats.Mean, Instances: instances(required, stats.Mean)}
+		if len(xs) > 1 {
+			margin := tCritical(len(xs)-1) * stats.StdDev / math.Sqrt(float64(len(xs)))
+			low, high := stats.Mean-margin, stats.Mean+margin
+			s.Low, s.High = &low, &high
+			s.InstancesLow, s.InstancesHigh = instances(required, high), instances(required, low)
+		}
+		if c := numbers.Summarize(costs[size]); c != nil {
+			total := c.Mean * float64(s.Recommended())
+			s.HourlyCost, s.TotalHourlyCost = &c.Mean, &total
+		}
+		plan = append(plan, s)
+	}
+	sort.Slice(plan, func(i, j int) bool {
+		return plan[i].Mean < plan[j].Mean
+	})
+
+	recommended := 0
+	for i, s := range plan {
+		if s.better(plan[recommended]) {
+			recommended = i
+		}
+	}
+	return plan, recommended, nil
+}
+
+// better returns whether s is a better recommendation than other: sizes with confidence bounds are preferred,
+// and then the cheapest or, if either has no price, the one needing fewest instances.
+func (s Sizing) better(other Sizing) bool {
+	if (s.Low != nil) != (other.Low != nil) {
+		return s.Low != nil
+	}
+	if s.TotalHourlyCost != nil && other.TotalHourlyCost != nil {
+		return *s.TotalHourlyCost < *other.TotalHourlyCost
+	}
+	return s.Recommended() < other.Recommended()
+}
+
+// instances returns how many instances with the given throughput are needed for the required one,
+// or 0 if the throughput is not positive.
+func instances(required, throughput float64) int {
+	if throughput <= 0 {
+		return 0
+	}
+	return int(math.Max(1, math.Ceil(required/throughput)))
+}
+
+// tCritical returns the two-tailed 95% critical value of the Student's t distribution with the given degrees of freedom.
+func tCritical(df int) float64 {
+	table := []float64{12.71, 4.30, 3.18, 2.78, 2.57, 2.45, 2.36, 2.31, 2.26, 2.23}
+	switch {
+	case df <= len(table):
+		return table[df-1]
+	case df <= 20:
+		return 2.09
+	case df <= 30:
+		return 2.04
+	default:
+		return 1.96
+	}
+}
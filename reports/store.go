@@ -0,0 +1,137 @@
+// Package reports stores performance reports and compares them.
+package reports
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/types"
+)
+
+// Store holds performance reports.
+type Store interface {
+	// List returns up to n reports, most recent first.
+	List(n int) ([]models.Report, error)
+	// Get returns the report with the given Id.
+	Get(id string) (models.Report, error)
+	// Save adds a report to the store.
+	Save(report models.Report) error
+}
+
+// Dir is a Store keeping each report as a JSON file named after its Id in a local directory.
+
+// Manifests of the runs are kept alongside, named after the report Id with a .manifest.json extension.
+type Dir string
+
+const manifestExt = ".manifest.json"
+
+func (d Dir) path(id string) string {
+	return filepath.Join(string(d), id+".json")
+}
+
+func (d Dir) List(n int) ([]models.Report, error) {
+	paths, err := filepath.Glob(filepath.Join(string(d), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var reports []models.Report
+	for _, path := range paths {
+		if strings.HasSuffix(path, manifestExt) {
+			continue
+		}
+		report, err := d.Get(strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		reports = append(reports, report)
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Timestamp.After(reports[j].Timestamp)
+	})
+	if len(reports) > n {
+		reports = reports[:n]
+	}
+	return reports, nil
+}
+
+func (d Dir) Get(id string) (models.Report, error) {
+	var report models.Report
+	b, err := ioutil.ReadFile(d.path(id))
+	if err == nil {
+		err = json.Unmarshal(b, &report)
+	}
+	return report, err
+}
+
+func (d Dir) Save(report models.Report) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(string(d), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(d.path(report.ReportId), b, 0644)
+}
+
+// SaveManifest writes the manifest of the run of a report alongside it.
+func (d Dir) SaveManifest(manifest models.Manifest) error {
+	if err := os.MkdirAll(string(d), 0755); err != nil {
+		return err
+	}
+	return WriteManifest(filepath.Join(string(d), manifest.ReportId+manifestExt), manifest)
+}
+
+// WriteManifest writes a manifest to a file, as indented JSON.
+func WriteManifest(path string, manifest models.Manifest) error {
+	b, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Prune removes the reports with a timestamp before the given time, and returns how many.
+func (d Dir) Prune(before time.Time) (int, error) {
+	reports, err := d.List(math.MaxInt32)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, report := range reports {
+		if !report.Timestamp.Before(before) {
+			continue
+		}
+		if err := os.Remove(d.path(report.ReportId)); err != nil {
+			return n, err
+		}
+		os.Remove(filepath.Join(string(d), report.ReportId+manifestExt))
+		n++
+	}
+	return n, nil
+}
+
+// Index is a Store keeping reports in the Elasticsearch index used for reporting.
+type Index struct {
+	es.Connection
+}
+
+func (i Index) List(n int) ([]models.Report, error) {
+	return es.FetchReports(i.Connection, types.M{"size": n})
+}
+
+func (i Index) Get(id string) (models.Report, error) {
+	return es.FetchReport(i.Connection, id)
+}
+
+func (i Index) Save(report models.Report) error {
+	return es.IndexReport(i.Connection, report)
+}
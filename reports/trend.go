@@ -0,0 +1,76 @@
+package reports
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+)
+
+// metricAliases are short names of commonly trended report attributes.
+var metricAliases = map[string]string{
+	"throughput": "event_index_rate",
+	"latency":    "request_latency_p99",
+	"loss":       "event_loss_ratio",
+	"cost":       "cost_per_million_events",
+}
+
+// Commit summarizes a metric over the reports of runs against the same apm-server build.
+type Commit struct {
+	// apm-server build SHA and its commit date
+	Build     string
+	BuildDate time.Time
+	// number of reports with the metric
+	Reports        int
+	Mean, Min, Max float64
+	// relative change of the mean from the previous commit as a percentage, nil for the first one
+	Change *float64
+}
+
+// Trend groups reports by apm-server build and summarizes the given metric for each build, oldest commit first.
+// The metric is the JSON name of a numeric report attribute, or one of throughput, latency, loss and cost.
+// Reports without a build SHA or without the metric are skipped.
+func Trend(reports []models.Report, metric string) ([]Commit, error) {
+	name := metric
+	if alias, ok := metricAliases[metric]; ok {
+		name = alias
+	}
+	values := make(map[string][]float64)
+	commits := make(map[string]*Commit)
+	for _, r := range reports {
+		if r.ApmBuild == "" {
+			continue
+		}
+		v, ok := conv.ToMap(r)[name].(float64)
+		if !ok {
+			continue
+		}
+		if _, ok := commits[r.ApmBuild]; !ok {
+			commits[r.ApmBuild] = &Commit{Build: r.ApmBuild, BuildDate: r.ApmBuildDate}
+		}
+		values[r.ApmBuild] = append(values[r.ApmBuild], v)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no reports with an apm-server build and %s", name)
+	}
+
+	var trend []Commit
+	for build, c := range commits {
+		s := numbers.Summarize(values[build])
+		c.Reports, c.Mean, c.Min, c.Max = len(values[build]), s.Mean, s.Min, s.Max
+		trend = append(trend, *c)
+	}
+	sort.Slice(trend, func(i, j int) bool {
+		if !trend[i].BuildDate.Equal(trend[j].BuildDate) {
+			return trend[i].BuildDate.Before(trend[j].BuildDate)
+		}
+		return trend[i].Build < trend[j].Build
+	})
+	for i := 1; i < len(trend); i++ {
+		trend[i].Change = numbers.Div((trend[i].Mean-trend[i-1].Mean)*100, trend[i-1].Mean)
+	}
+	return trend, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+// scenario describes a fleet of services, each one with its own options, eg:
+//
+//	{"services": [
+//	  {"name": "checkout", "tf": "1ms", "sx": 20, "labels": {"team": "payments"}},
+//	  {"name": "inventory", "count": 20, "tf": "1s", "ef": "10s", "labels": {"tier": "quiet"}}
+//	]}
+//
+// Options are named after command line flags, as in -target. count runs that many services with the same options,
+// named after the service with a numeric suffix.
+type scenario struct {
+	Services []map[string]interface{} `json:"services"`
+}
+
+// scenarioTargets returns a target derived from input per service of the scenario in a JSON file, running as
+// a service of its name, labelling its events with its labels and overriding the rest of options.
+func scenarioTargets(input models.Input, path string) ([]models.Input, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var sc scenario
+	if err := json.NewDecoder(f).Decode(&sc); err != nil {
+		return nil, fmt.Errorf("scenario %s: %s", path, err)
+	}
+	if len(sc.Services) == 0 {
+		return nil, fmt.Errorf("scenario %s: no services", path)
+	}
+
+	var targets []models.Input
+	names := make(map[string]bool)
+	for i, service := range sc.Services {
+		target, count, err := scenarioService(input, service)
+		if err != nil {
+			return nil, fmt.Errorf("scenario %s: service %d: %s", path, i+1, err)
+		}
+		for j := 1; j <= count; j++ {
+			t := target
+			if count > 1 {
+				t.ServiceName = fmt.Sprintf("%s-%d", target.ServiceName, j)
+				t.TargetName = fmt.Sprintf("%s-%d", target.TargetName, j)
+			}
+			t = t.Reseed("service " + t.ServiceName)
+			if names[t.TargetName] {
+				return nil, fmt.Errorf("scenario %s: duplicate service %s", path, t.TargetName)
+			}
+			names[t.TargetName] = true
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// scenarioService returns the target of a service of a scenario, and how many services run it.
+func scenarioService(input models.Input, service map[string]interface{}) (models.Input, int, error) {
+	target := input
+	target.Targets = nil
+	name, ok := service["name"].(string)
+	if !ok || name == "" {
+		return target, 0, fmt.Errorf("missing name")
+	}
+	target.TargetName, target.ServiceName = name, name
+
+	count := 1
+	if v, ok := service["count"]; ok {
+		f, ok := v.(float64)
+		if !ok || f < 1 || f != float64(int(f)) {
+			return target, 0, fmt.Errorf("count must be a positive integer, got %v", v)
+		}
+		count = int(f)
+	}
+
+	if v, ok := service["labels"]; ok {
+		labels, ok := v.(map[string]interface{})
+		if !ok {
+			return target, 0, fmt.Errorf("labels must be an object, got %v", v)
+		}
+		// merged with the labels of the input, if any
+		target.Labels = make(map[string]string)
+		for k, v := range input.Labels {
+			target.Labels[k] = v
+		}
+		for k, v := range labels {
+			target.Labels[k] = scenarioValue(v)
+		}
+	}
+
+	// sorted, so that errors are reproducible
+	var keys []string
+	for k := range service {
+		if k != "name" && k != "count" && k != "labels" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := setTargetOption(&target, k, scenarioValue(service[k])); err != nil {
+			return target, 0, fmt.Errorf("%s: %s", k, err)
+		}
+	}
+	if target.SpanMaxLimit < target.SpanMinLimit {
+		target.SpanMaxLimit = target.SpanMinLimit
+	}
+	return target, count, nil
+}
+
+// scenarioValue formats a JSON value as given in a command line flag.
+func scenarioValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,472 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEnd tokenKind = iota
+	tokenNumber
+	tokenString
+	// identifiers and dotted paths, including keywords
+	tokenPath
+	tokenOp
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// value of numbers and strings
+	value interface{}
+}
+
+// operators, longest first
+var operators = []string{"==", "!=", "<=", ">=", "&&", "||", "=", "<", ">", "+", "-", "*", "/", "%", "!", "(", ")", ","}
+
+// parser parses expressions with precedence climbing, from lowest to highest precedence:
+// ||, &&, comparisons, + and -, * / and %, unary - and !.
+type parser struct {
+	tokens []token
+	pos    int
+	// feeds that can be referred to
+	feeds Feeds
+}
+
+func (p *parser) tokenize(s string) error {
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return fmt.Errorf("unterminated string %s", s[i:])
+			}
+			v, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return fmt.Errorf("invalid string %s", s[i:j+1])
+			}
+			p.tokens = append(p.tokens, token{tokenString, s[i : j+1], v})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			f, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return fmt.Errorf("invalid number %s", s[i:j])
+			}
+			p.tokens = append(p.tokens, token{tokenNumber, s[i:j], f})
+			i = j
+		case isIdent(c) || (c == '*' && i == 0 && strings.HasPrefix(s, "*.")):
+			j := i + 1
+			for j < len(s) && (isIdent(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '.') {
+				j++
+			}
+			p.tokens = append(p.tokens, token{kind: tokenPath, text: s[i:j]})
+			i = j
+		default:
+			var op string
+			for _, o := range operators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op == "" {
+				return fmt.Errorf("unexpected %q", c)
+			}
+			p.tokens = append(p.tokens, token{kind: tokenOp, text: op})
+			i += len(op)
+		}
+	}
+	return nil
+}
+
+func isIdent(c rune) bool {
+	return unicode.IsLetter(c) || c == '_' || c == '@'
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokenEnd}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if p.pos < len(p.tokens) {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the next token if it is one of the given operators, and returns it.
+func (p *parser) accept(ops ...string) (string, bool) {
+	t := p.peek()
+	if t.kind != tokenOp {
+		return "", false
+	}
+	for _, op := range ops {
+		if t.text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func (p *parser) expression() (expr, error) {
+	return p.binary(0)
+}
+
+// binary operators by precedence level
+var levels = [][]string{{"||"}, {"&&"}, {"==", "!=", "<", "<=", ">", ">="}, {"+", "-"}, {"*", "/", "%"}}
+
+func (p *parser) binary(level int) (expr, error) {
+	if level == len(levels) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept(levels[level]...)
+		if !ok {
+			return left, nil
+		}
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binary{op, left, right}
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	if op, ok := p.accept("-", "!"); ok {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return unary{op, x}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenNumber:
+		return literal{t.value}, nil
+	case tokenString:
+		return p.template(t.value.(string))
+	case tokenPath:
+		switch t.text {
+		case "true":
+			return literal{true}, nil
+		case "false":
+			return literal{false}, nil
+		case "null":
+			return literal{nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.call(t.text)
+		}
+		return field(strings.Split(t.text, ".")), nil
+	case tokenOp:
+		if t.text == "(" {
+			x, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := p.accept(")"); !ok {
+				return nil, fmt.Errorf("missing )")
+			}
+			return x, nil
+		}
+	case tokenEnd:
+		return nil, fmt.Errorf("unexpected end of line")
+	}
+	return nil, fmt.Errorf("unexpected %q", t.text)
+}
+
+// arities of the functions, -1 if variadic
+var functions = map[string]int{"seq": 0, "counter": 1, "rand": 0, "pick": -1, "len": 1, "feed": 2}
+
+func (p *parser) call(name string) (expr, error) {
+	arity, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %s", name)
+	}
+	c := call{name: name}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.expression()
+			if err != nil {
+				return nil, err
+			}
+			c.args = append(c.args, arg)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if _, ok := p.accept(","); !ok {
+				return nil, fmt.Errorf("expected , or ) in the arguments of %s", name)
+			}
+		}
+	}
+	if (arity >= 0 && len(c.args) != arity) || (arity < 0 && len(c.args) == 0) {
+		return nil, fmt.Errorf("wrong number of arguments for %s: %d", name, len(c.args))
+	}
+	if name == "feed" {
+		return c, p.checkFeed(c.args[0], c.args[1])
+	}
+	return c, nil
+}
+
+// template parses the template variables of a string, eg. "GET {{urls.path}}", as the concatenation of
+// its text and calls to feed.
+func (p *parser) template(s string) (expr, error) {
+	var x expr = literal{""}
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated template variable in %q", s)
+		}
+		v := strings.SplitN(strings.TrimSpace(s[start+2:start+end]), ".", 2)
+		if len(v) != 2 {
+			return nil, fmt.Errorf("invalid template variable {{%s}}, must be {{feed.column}}", s[start+2:start+end])
+		}
+		name, column := literal{v[0]}, literal{v[1]}
+		if err := p.checkFeed(name, column); err != nil {
+			return nil, err
+		}
+		x = binary{"+", x, literal{s[:start]}}
+		x = binary{"+", x, call{"feed", []expr{name, column}}}
+		s = s[start+end+2:]
+	}
+	if _, ok := x.(literal); ok {
+		return literal{s}, nil
+	}
+	return binary{"+", x, literal{s}}, nil
+}
+
+// checkFeed checks that a feed and its column exist, if they are given as literals.
+func (p *parser) checkFeed(name, column expr) error {
+	n, ok := name.(literal)
+	if !ok {
+		return nil
+	}
+	f, ok := p.feeds[str(n.v)]
+	if !ok {
+		return fmt.Errorf("unknown feed %s", str(n.v))
+	}
+	if c, ok := column.(literal); ok && !f.columns[str(c.v)] {
+		return fmt.Errorf("feed %s has no column %s", str(n.v), str(c.v))
+	}
+	return nil
+}
+
+// env is what expressions are evaluated against.
+type env struct {
+	script    *Script
+	eventType string
+	event     map[string]interface{}
+	// rows of the feeds given to the event so far
+	rows map[string]map[string]interface{}
+}
+
+type expr interface {
+	eval(e *env) interface{}
+}
+
+type literal struct {
+	v interface{}
+}
+
+func (l literal) eval(*env) interface{} {
+	return l.v
+}
+
+// field is a field of the event.
+type field []string
+
+func (f field) eval(e *env) interface{} {
+	return get(e.event, f)
+}
+
+type unary struct {
+	op string
+	x  expr
+}
+
+func (u unary) eval(e *env) interface{} {
+	v := u.x.eval(e)
+	if u.op == "!" {
+		return !truthy(v)
+	}
+	return finite(-number(v))
+}
+
+// finite returns x, or null if it is infinite or NaN, as after a division by zero, which JSON can't encode.
+func finite(x float64) interface{} {
+	if math.IsInf(x, 0) || math.IsNaN(x) {
+		return nil
+	}
+	return x
+}
+
+type binary struct {
+	op          string
+	left, right expr
+}
+
+func (b binary) eval(e *env) interface{} {
+	l := b.left.eval(e)
+	// short circuit
+	switch b.op {
+	case "&&":
+		return truthy(l) && truthy(b.right.eval(e))
+	case "||":
+		return truthy(l) || truthy(b.right.eval(e))
+	}
+	r := b.right.eval(e)
+	_, ls := l.(string)
+	_, rs := r.(string)
+	switch b.op {
+	case "+":
+		if ls || rs {
+			return str(l) + str(r)
+		}
+		return finite(number(l) + number(r))
+	case "-":
+		return finite(number(l) - number(r))
+	case "*":
+		return finite(number(l) * number(r))
+	case "/":
+		return finite(number(l) / number(r))
+	case "%":
+		return finite(math.Mod(number(l), number(r)))
+	case "==":
+		return str(l) == str(r) && (l == nil) == (r == nil)
+	case "!=":
+		return str(l) != str(r) || (l == nil) != (r == nil)
+	}
+	// comparisons are numeric, unless both operands are strings
+	var cmp int
+	if ls && rs {
+		cmp = strings.Compare(l.(string), r.(string))
+	} else if ln, rn := number(l), number(r); ln < rn {
+		cmp = -1
+	} else if ln > rn {
+		cmp = 1
+	}
+	switch b.op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+type call struct {
+	name string
+	args []expr
+}
+
+func (c call) eval(e *env) interface{} {
+	s := e.script
+	switch c.name {
+	case "seq":
+		return s.seqs[e.eventType]
+	case "counter":
+		name := str(c.args[0].eval(e))
+		s.counters[name]++
+		return s.counters[name]
+	case "rand":
+		return s.rand.Float64()
+	case "pick":
+		return c.args[s.rand.Intn(len(c.args))].eval(e)
+	case "feed":
+		name := str(c.args[0].eval(e))
+		row, ok := e.rows[name]
+		if f := s.feeds[name]; !ok && f != nil {
+			row = f.row(s.rand)
+			if e.rows == nil {
+				e.rows = make(map[string]map[string]interface{})
+			}
+			e.rows[name] = row
+		}
+		return row[str(c.args[1].eval(e))]
+	default:
+		return float64(len(str(c.args[0].eval(e))))
+	}
+}
+
+// number converts a value to a number: strings are parsed, true is 1, and anything else is 0.
+func number(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case string:
+		f, _ := strconv.ParseFloat(v, 64)
+		return f
+	case bool:
+		if v {
+			return 1
+		}
+	}
+	return 0
+}
+
+// str converts a value to a string, formatting numbers without trailing zeros.
+func str(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// truthy returns whether a value is true as a condition: false, null, 0 and "" are not.
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
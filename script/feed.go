@@ -0,0 +1,152 @@
+package script
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Feed is a table of values, eg. service names, user IDs or URLs from a real environment, whose rows are given
+// to events in order, starting over at the end, or sampled at random.
+type Feed struct {
+	rows    []map[string]interface{}
+	columns map[string]bool
+	sample  bool
+	// cumulative weights of the rows, if sampled and the feed has a weight column
+	weights []float64
+	next    int
+}
+
+// Feeds are data feeds by name.
+type Feeds map[string]*Feed
+
+// LoadFeeds loads feeds given as name=path pairs, sampling their rows at random if sample is true,
+// or cycling through them otherwise.
+func LoadFeeds(specs []string, sample bool) (Feeds, error) {
+	feeds := make(Feeds)
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("invalid feed %q, must be name=path", spec)
+		}
+		if _, ok := feeds[kv[0]]; ok {
+			return nil, fmt.Errorf("duplicate feed %q", kv[0])
+		}
+		f, err := LoadFeed(kv[1], sample)
+		if err != nil {
+			return nil, fmt.Errorf("feed %s: %s", kv[0], err)
+		}
+		feeds[kv[0]] = f
+	}
+	return feeds, nil
+}
+
+// LoadFeed loads a feed from a file, in a format given by its extension: a JSON array of objects for .json,
+// one JSON object per line for .ndjson and .jsonl, and comma separated values with a header otherwise.
+// Rows are sampled proportionally to their weight column, if any.
+func LoadFeed(path string, sample bool) (*Feed, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var rows []map[string]interface{}
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.NewDecoder(file).Decode(&rows)
+	case ".ndjson", ".jsonl":
+		rows, err = readJSONLines(file)
+	default:
+		rows, err = readCSV(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%s has no rows", path)
+	}
+
+	f := &Feed{rows: rows, columns: make(map[string]bool), sample: sample}
+	for _, row := range rows {
+		for k := range row {
+			f.columns[k] = true
+		}
+	}
+	if sample && f.columns["weight"] {
+		var total float64
+		for i, row := range rows {
+			w := number(row["weight"])
+			if w < 0 {
+				return nil, fmt.Errorf("%s: negative weight in row %d", path, i+1)
+			}
+			total += w
+			f.weights = append(f.weights, total)
+		}
+		if total == 0 {
+			return nil, fmt.Errorf("%s: all weights are 0", path)
+		}
+	}
+	return f, nil
+}
+
+func readJSONLines(r io.Reader) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
+	dec := json.NewDecoder(r)
+	for {
+		var row map[string]interface{}
+		if err := dec.Decode(&row); err == io.EOF {
+			return rows, nil
+		} else if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readCSV reads rows of strings, except for numeric weights.
+func readCSV(r io.Reader) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(r).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, err
+	}
+	header := records[0]
+	var rows []map[string]interface{}
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(header))
+		for i, k := range header {
+			row[k] = record[i]
+		}
+		if w, ok := row["weight"].(string); ok {
+			f, err := strconv.ParseFloat(w, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight %q", w)
+			}
+			row["weight"] = f
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// row returns the next row of the feed. It is not safe for concurrent use.
+func (f *Feed) row(r *rand.Rand) map[string]interface{} {
+	switch {
+	case !f.sample:
+		row := f.rows[f.next]
+		f.next = (f.next + 1) % len(f.rows)
+		return row
+	case f.weights != nil:
+		x := r.Float64() * f.weights[len(f.weights)-1]
+		return f.rows[sort.Search(len(f.weights), func(i int) bool { return f.weights[i] > x })]
+	default:
+		return f.rows[r.Intn(len(f.rows))]
+	}
+}
@@ -0,0 +1,179 @@
+// Package script customizes generated events with a small scripting language, without recompiling hey-apm.
+//
+// A script is a list of assignments, one per line, setting a field of the events of a type (or * for all of them)
+// to the value of an expression, optionally only if a condition holds:
+//
+//	# comments start with #
+//	transaction.name = "GET /users/" + counter("users") % 100
+//	*.context.tags.tenant = pick("acme", "globex", "initech")
+//	transaction.result = "HTTP 5xx" if rand() < 0.05
+//	span.context.tags.slow = duration > 10
+//
+// Expressions combine numbers, "strings", true, false, null and fields of the event itself, eg. context.tags.spans,
+// with the operators + - * / % == != < <= > >= && || ! and parentheses. + concatenates if either operand is a string.
+// Arithmetic without a finite result, as divisions by zero, is null, since JSON has no infinities.
+// Functions are:
+//
+//	seq()             the number of events of the same type seen by the script so far, including this one
+//	counter("name")   increments a counter shared by all events, and returns its new value
+//	rand()            a random number between 0 and 1
+//	pick(a, b, ...)   one of its arguments, at random
+//	len(s)            the length of a string
+//	feed("name", "c") the value of column c of the row of a data feed given to this event, see Feeds
+//
+// Strings can also refer to columns of data feeds as template variables, eg. "GET {{urls.path}}". Every event gets
+// its own row of each feed it refers to, so all columns of the same feed come from the same row.
+package script
+
+import (
+	"bufio"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/elastic/hey-apm/random"
+)
+
+// Script applies assignments to events. It is safe for concurrent use.
+type Script struct {
+	statements []statement
+	feeds      Feeds
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	counters map[string]float64
+	seqs     map[string]float64
+}
+
+type statement struct {
+	// event type, or * for all of them
+	eventType string
+	// path of the assigned field within the event
+	path  []string
+	value expr
+	// nil if unconditional
+	cond expr
+}
+
+// Load parses the script in a file, with random functions seeded with seed and reading from feeds, which may be nil.
+func Load(path string, seed int64, feeds Feeds) (*Script, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var src strings.Builder
+	lines := bufio.NewScanner(f)
+	for lines.Scan() {
+		src.WriteString(lines.Text() + "\n")
+	}
+	if err := lines.Err(); err != nil {
+		return nil, err
+	}
+	s, err := Parse(src.String(), seed, feeds)
+	if err != nil {
+		return nil, fmt.Errorf("script %s: %s", path, err)
+	}
+	return s, nil
+}
+
+// Parse parses a script, with random functions seeded with seed and reading from feeds, which may be nil.
+func Parse(src string, seed int64, feeds Feeds) (*Script, error) {
+	s := &Script{
+		feeds:    feeds,
+		rand:     random.New(seed, "script"),
+		counters: make(map[string]float64),
+		seqs:     make(map[string]float64),
+	}
+	for i, line := range strings.Split(src, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		st, err := parseStatement(line, feeds)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+		s.statements = append(s.statements, st)
+	}
+	return s, nil
+}
+
+// parseStatement parses a line as target = value [if cond].
+func parseStatement(line string, feeds Feeds) (statement, error) {
+	p := &parser{feeds: feeds}
+	if err := p.tokenize(line); err != nil {
+		return statement{}, err
+	}
+	target := p.next()
+	if target.kind != tokenPath || !strings.Contains(target.text, ".") {
+		return statement{}, fmt.Errorf("expected <event type>.<field> at the start, got %q", target.text)
+	}
+	path := strings.Split(target.text, ".")
+	if t := p.next(); t.kind != tokenOp || t.text != "=" {
+		return statement{}, fmt.Errorf("expected = after %s", target.text)
+	}
+	st := statement{eventType: path[0], path: path[1:]}
+	var err error
+	if st.value, err = p.expression(); err != nil {
+		return statement{}, err
+	}
+	if t := p.peek(); t.kind == tokenPath && t.text == "if" {
+		p.next()
+		if st.cond, err = p.expression(); err != nil {
+			return statement{}, err
+		}
+	}
+	if t := p.peek(); t.kind != tokenEnd {
+		return statement{}, fmt.Errorf("unexpected %q", t.text)
+	}
+	return st, nil
+}
+
+// Apply applies the script to an event of a type, decoded from JSON, and returns whether it changed.
+func (s *Script) Apply(eventType string, event map[string]interface{}) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seqs[eventType]++
+	env := &env{script: s, eventType: eventType, event: event}
+	var changed bool
+	for _, st := range s.statements {
+		if st.eventType != "*" && st.eventType != eventType {
+			continue
+		}
+		if st.cond != nil && !truthy(st.cond.eval(env)) {
+			continue
+		}
+		set(event, st.path, st.value.eval(env))
+		changed = true
+	}
+	return changed
+}
+
+// set sets the field at path of obj, creating the objects in between if missing.
+func set(obj map[string]interface{}, path []string, v interface{}) {
+	for len(path) > 1 {
+		child, ok := obj[path[0]].(map[string]interface{})
+		if !ok {
+			child = make(map[string]interface{})
+			obj[path[0]] = child
+		}
+		obj, path = child, path[1:]
+	}
+	obj[path[0]] = v
+}
+
+// get returns the field at path of obj, or nil if missing.
+func get(obj map[string]interface{}, path []string) interface{} {
+	var v interface{} = obj
+	for _, k := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[k]
+	}
+	return v
+}
@@ -0,0 +1,111 @@
+package script
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	s, err := Parse(`
+# comment
+transaction.name = "GET /users/" + counter("users") % 2
+*.context.tags.seq = seq()
+transaction.result = "HTTP 5xx" if duration > 10 && !(name == "")
+span.name = name + "!" if len(name) < 3
+`, 1, nil)
+	assert.NoError(t, err)
+
+	tx := map[string]interface{}{"name": "tx", "duration": 12.5}
+	assert.True(t, s.Apply("transaction", tx))
+	assert.Equal(t, "GET /users/1", tx["name"])
+	assert.Equal(t, "HTTP 5xx", tx["result"])
+	assert.Equal(t, map[string]interface{}{"tags": map[string]interface{}{"seq": 1.0}}, tx["context"])
+
+	tx = map[string]interface{}{"name": "tx", "duration": 1.0}
+	s.Apply("transaction", tx)
+	assert.Equal(t, "GET /users/0", tx["name"])
+	assert.Nil(t, tx["result"])
+	assert.Equal(t, 2.0, tx["context"].(map[string]interface{})["tags"].(map[string]interface{})["seq"])
+
+	span := map[string]interface{}{"name": "db"}
+	s.Apply("span", span)
+	assert.Equal(t, "db!", span["name"])
+
+	// fields in the way are replaced
+	e := map[string]interface{}{"context": 1.0}
+	assert.True(t, s.Apply("error", e))
+	assert.Equal(t, map[string]interface{}{"tags": map[string]interface{}{"seq": 1.0}}, e["context"])
+}
+
+// Arithmetic without a finite result is null, so that events can still be encoded.
+func TestNonFinite(t *testing.T) {
+	s, err := Parse(`
+transaction.context.tags.ratio = duration / 0
+transaction.context.tags.rest = duration % 0
+transaction.context.tags.huge = duration * duration
+`, 1, nil)
+	assert.NoError(t, err)
+	tx := map[string]interface{}{"duration": 1e300}
+	s.Apply("transaction", tx)
+	tags := tx["context"].(map[string]interface{})["tags"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"ratio": nil, "rest": nil, "huge": nil}, tags)
+	_, err = json.Marshal(tx)
+	assert.NoError(t, err)
+}
+
+func TestFeeds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "feeds")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "users.csv")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("id,path\n1,/a\n2,/b\n"), 0644))
+
+	feeds, err := LoadFeeds([]string{"users=" + path}, false)
+	assert.NoError(t, err)
+	s, err := Parse(`
+transaction.name = "GET {{users.path}}/{{ users.id }}"
+transaction.context.tags.user = feed("users", "id")
+`, 1, feeds)
+	assert.NoError(t, err)
+
+	// columns of the same feed come from the same row, cycling through them
+	for _, expected := range []string{"GET /a/1", "GET /b/2", "GET /a/1"} {
+		tx := map[string]interface{}{}
+		s.Apply("transaction", tx)
+		assert.Equal(t, expected, tx["name"])
+		assert.Equal(t, expected[len(expected)-1:], tx["context"].(map[string]interface{})["tags"].(map[string]interface{})["user"])
+	}
+
+	for _, src := range []string{
+		`transaction.name = feed("nope", "id")`,
+		`transaction.name = feed("users", "nope")`,
+		`transaction.name = "{{users}}"`,
+		`transaction.name = "{{users.id"`,
+	} {
+		_, err := Parse(src, 0, feeds)
+		assert.Error(t, err, src)
+	}
+	_, err = LoadFeeds([]string{"users"}, false)
+	assert.Error(t, err)
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, src := range []string{
+		`name = "x"`,
+		`transaction.name "x"`,
+		`transaction.name = `,
+		`transaction.name = nope()`,
+		`transaction.name = counter()`,
+		`transaction.name = (1 + 2`,
+		`transaction.name = "unterminated`,
+		`transaction.name = 1 2`,
+	} {
+		_, err := Parse(src, 0, nil)
+		assert.Error(t, err, src)
+	}
+}
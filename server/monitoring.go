@@ -0,0 +1,51 @@
+package server
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BeatStats holds the process and host stats exposed by the beats HTTP monitoring endpoint.
+// See https://www.elastic.co/guide/en/apm/server/current/http-endpoint.html
+type BeatStats struct {
+	Beat struct {
+		CPU struct {
+			Total struct {
+				Time struct {
+					// cumulative CPU time of the process, in milliseconds
+					MS int64 `json:"ms"`
+				} `json:"time"`
+			} `json:"total"`
+		} `json:"cpu"`
+		Memstats struct {
+			RSS int64 `json:"rss"`
+		} `json:"memstats"`
+	} `json:"beat"`
+	System struct {
+		CPU struct {
+			Cores int64 `json:"cores"`
+		} `json:"cpu"`
+		Load struct {
+			One float64 `json:"1"`
+		} `json:"load"`
+	} `json:"system"`
+}
+
+// QueryStats sends a request to the /stats path of an apm-server monitoring endpoint and parses the result.
+func QueryStats(raw string) (BeatStats, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return BeatStats{}, err
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/stats"
+	body, err := request("", u.String())
+	stats := BeatStats{}
+	if err == nil {
+		err = json.Unmarshal(body, &stats)
+	}
+	return stats, errors.Wrap(err, "error querying "+u.String()+", ensure to start apm-server"+
+		" with -E http.enabled=true")
+}
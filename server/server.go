@@ -27,21 +27,36 @@ type Status struct {
 }
 
 // GetStatus returns apm-server info and memory stats, plus elasticsearch counts of apm documents.
-func GetStatus(logger *log.Logger, secret, url string, connection es.Connection) Status {
+// Memory stats are not queried if url is empty, as when apm-server runs under Elastic Agent.
+func GetStatus(logger *log.Logger, auth, url string, connection es.Connection) Status {
 	status := Status{}
 
-	metrics, err := QueryExpvar(secret, url)
-	if err == nil {
-		status.Metrics = &metrics
-	} else {
-		logger.Println(err.Error())
+	if url != "" {
+		metrics, err := QueryExpvar(auth, url)
+		if err == nil {
+			status.Metrics = &metrics
+		} else {
+			logger.Println(err.Error())
+		}
 	}
-	status.SpanIndexCount = es.Count(connection, "apm*span*")
-	status.TransactionIndexCount = es.Count(connection, "apm*transaction*")
-	status.ErrorIndexCount = es.Count(connection, "apm*error*")
+	status.SpanIndexCount = es.CountEvents(connection, "span")
+	status.TransactionIndexCount = es.CountEvents(connection, "transaction")
+	status.ErrorIndexCount = es.CountEvents(connection, "error")
 	return status
 }
 
+// Authorization returns the Authorization header value for apm-server requests with the given credentials,
+// preferring the API key, or an empty string if there are none.
+func Authorization(secret, apiKey string) string {
+	switch {
+	case apiKey != "":
+		return "ApiKey " + conv.EncodeAPIKey(apiKey)
+	case secret != "":
+		return "Bearer " + secret
+	}
+	return ""
+}
+
 type Info struct {
 	BuildDate time.Time `json:"build_date"`
 	BuildSha  string    `json:"build_sha"`
@@ -119,8 +134,9 @@ func (cmd Cmdline) Parse() map[string]string {
 }
 
 // QueryInfo sends a request to an apm-server health-check endpoint and parses the result.
-func QueryInfo(secret, url string) (Info, error) {
-	body, err := request(secret, url)
+// auth is the Authorization header value, as returned by Authorization.
+func QueryInfo(auth, url string) (Info, error) {
+	body, err := request(auth, url)
 	info := Info{}
 	if err == nil {
 		err = json.Unmarshal(body, &info)
@@ -129,10 +145,10 @@ func QueryInfo(secret, url string) (Info, error) {
 }
 
 // QueryExpvar sends a request to an apm-server /debug/vars endpoint and parses the result.
-func QueryExpvar(secret, raw string) (ExpvarMetrics, error) {
+func QueryExpvar(auth, raw string) (ExpvarMetrics, error) {
 	u, _ := url.Parse(raw)
 	u.Path = "/debug/vars"
-	body, err := request(secret, u.String())
+	body, err := request(auth, u.String())
 	metrics := ExpvarMetrics{}
 	if err == nil {
 		err = json.Unmarshal(body, &metrics)
@@ -141,10 +157,10 @@ func QueryExpvar(secret, raw string) (ExpvarMetrics, error) {
 		" with -E apm-server.expvar.enabled=true", u.Path))
 }
 
-func request(secret, url string) ([]byte, error) {
+func request(auth, url string) ([]byte, error) {
 	req, _ := http.NewRequest("GET", url, nil)
-	if secret != "" {
-		req.Header.Set("Authorization", "Beater "+secret)
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
 	}
 	req.Header.Set("Accept", "application/json")
 
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/verify"
+)
+
+const verifyUsage = `usage: hey-apm verify -sent-events <file> [options]
+
+Fetches the documents indexed for the events sampled with -sent-events from the elasticsearch used by apm-server,
+and reports the events not found and the fields indexed with a different value than sent.
+Exits with 3 if any event is missing or any field doesn't match.
+
+options:
+`
+
+// verifyCommand runs the `verify` subcommand with the given arguments, and returns the exit code.
+func verifyCommand(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	sentEvents := fs.String("sent-events", "", "file written by a run with -sent-events")
+	apmElasticsearchUrl := fs.String("apm-es-url", "http://localhost:9200", "elasticsearch output host for apm-server")
+	apmElasticsearchAuth := fs.String("apm-es-auth", "", "elasticsearch output username:password for apm-server")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), verifyUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *sentEvents == "" {
+		fs.Usage()
+		return exitError
+	}
+
+	events, err := verify.Load(*sentEvents)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	conn, err := es.NewConnection(*apmElasticsearchUrl, *apmElasticsearchAuth)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	result, err := verify.Verify(conn, events)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitError
+	}
+	result.Print(os.Stdout)
+	if !result.OK() {
+		return exitThresholds
+	}
+	return exitSuccess
+}
@@ -0,0 +1,326 @@
+// Package verify checks that the events sent to apm-server are indexed with the same values they were sent with.
+package verify
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
+)
+
+const (
+	// batchSize is the number of documents fetched per search request
+	batchSize = 500
+	// maxExamples bounds the number of missing events and mismatches kept
+	maxExamples = 10
+)
+
+// Event is an event as sent to apm-server.
+type Event struct {
+	// transaction, span or error
+	Type   string
+	Fields types.M
+}
+
+// Id returns the Id of the event.
+func (e Event) Id() string {
+	id, _ := e.Fields["id"].(string)
+	return id
+}
+
+// field maps an intake field to the document field it is indexed as.
+type field struct {
+	sent, indexed string
+	// the sent value is multiplied by scale before comparing, eg. to convert milliseconds to microseconds
+	scale float64
+}
+
+var common = []field{
+	{"trace_id", "trace.id", 1},
+	{"parent_id", "parent.id", 1},
+	{"timestamp", "timestamp.us", 1},
+}
+
+// fields are the intake fields checked per event type, besides common ones and labels.
+var fields = map[string][]field{
+	"transaction": {
+		{"id", "transaction.id", 1},
+		{"name", "transaction.name", 1},
+		{"type", "transaction.type", 1},
+		{"result", "transaction.result", 1},
+		{"outcome", "event.outcome", 1},
+		{"duration", "transaction.duration.us", 1000},
+		{"span_count.started", "transaction.span_count.started", 1},
+		{"span_count.dropped", "transaction.span_count.dropped", 1},
+		{"context.request.method", "http.request.method", 1},
+		{"context.response.status_code", "http.response.status_code", 1},
+		{"context.user.id", "user.id", 1},
+	},
+	"span": {
+		{"id", "span.id", 1},
+		{"transaction_id", "transaction.id", 1},
+		{"name", "span.name", 1},
+		{"type", "span.type", 1},
+		{"subtype", "span.subtype", 1},
+		{"action", "span.action", 1},
+		{"outcome", "event.outcome", 1},
+		{"duration", "span.duration.us", 1000},
+		{"context.db.instance", "span.db.instance", 1},
+		{"context.db.statement", "span.db.statement", 1},
+		{"context.db.type", "span.db.type", 1},
+		{"composite.count", "span.composite.count", 1},
+		{"composite.compression_strategy", "span.composite.compression_strategy", 1},
+	},
+	"error": {
+		{"id", "error.id", 1},
+		{"transaction_id", "transaction.id", 1},
+		{"culprit", "error.culprit", 1},
+		{"exception.message", "error.exception.0.message", 1},
+		{"exception.type", "error.exception.0.type", 1},
+		{"log.message", "error.log.message", 1},
+		{"log.level", "error.log.level", 1},
+		{"context.user.id", "user.id", 1},
+	},
+}
+
+// Mismatch is a field indexed with a different value than sent.
+type Mismatch struct {
+	Event   string
+	Id      string
+	Field   string
+	Sent    interface{}
+	Indexed interface{}
+}
+
+func (m Mismatch) String() string {
+	return fmt.Sprintf("%s %s %s: sent %v, indexed %v", m.Event, m.Id, m.Field, m.Sent, m.Indexed)
+}
+
+// Result holds the outcome of a verification.
+type Result struct {
+	Checked int
+	Found   int
+	// number of events not found, and some of them as "<type> <id>"
+	Missing         int
+	MissingExamples []string
+	// number of fields indexed with a different value than sent, per indexed field name
+	Mismatches map[string]int
+	// some of the mismatches, at most one per field
+	MismatchExamples []Mismatch
+}
+
+// OK returns whether all events were found and indexed as sent.
+func (r Result) OK() bool {
+	return r.Missing == 0 && len(r.Mismatches) == 0
+}
+
+// Load reads the events written with -sent-events, one NDJSON line per event.
+// Events of other types than transactions, spans and errors are skipped.
+func Load(path string) ([]Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var events []Event
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var doc map[string]types.M
+		if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err)
+		}
+		for typ, event := range doc {
+			if _, ok := event["id"].(string); ok && knownType(typ) {
+				events = append(events, Event{Type: typ, Fields: event})
+			}
+		}
+	}
+	return events, scanner.Err()
+}
+
+func knownType(typ string) bool {
+	_, ok := fields[typ]
+	return ok
+}
+
+// Verify fetches the documents indexed for the given events from the Elasticsearch used by apm-server,
+// and compares them with the events.
+func Verify(conn es.Connection, events []Event) (Result, error) {
+	r := Result{Mismatches: make(map[string]int)}
+	byType := make(map[string][]Event)
+	for _, e := range events {
+		byType[e.Type] = append(byType[e.Type], e)
+	}
+	var eventTypes []string
+	for typ := range byType {
+		eventTypes = append(eventTypes, typ)
+	}
+	sort.Strings(eventTypes)
+	for _, typ := range eventTypes {
+		events := byType[typ]
+		for start := 0; start < len(events); start += batchSize {
+			end := start + batchSize
+			if end > len(events) {
+				end = len(events)
+			}
+			if err := r.verifyBatch(conn, typ, events[start:end]); err != nil {
+				return r, err
+			}
+		}
+	}
+	return r, nil
+}
+
+func (r *Result) verifyBatch(conn es.Connection, typ string, events []Event) error {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.Id()
+	}
+	docs, err := es.SearchApm(conn, types.M{
+		"size": len(ids),
+		"query": types.M{"bool": types.M{"filter": []types.M{
+			{"term": types.M{"processor.event": typ}},
+			{"terms": types.M{typ + ".id": ids}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	byId := make(map[string]types.M)
+	for _, doc := range docs {
+		if id, ok := lookup(doc, typ+".id"); ok {
+			byId[fmt.Sprint(id)] = doc
+		}
+	}
+	for _, e := range events {
+		r.Checked++
+		doc, ok := byId[e.Id()]
+		if !ok {
+			r.Missing++
+			if len(r.MissingExamples) < maxExamples {
+				r.MissingExamples = append(r.MissingExamples, typ+" "+e.Id())
+			}
+			continue
+		}
+		r.Found++
+		r.compare(e, doc)
+	}
+	return nil
+}
+
+// compare counts the fields of doc with a different value than sent in e, including labels.
+func (r *Result) compare(e Event, doc types.M) {
+	checked := append(append([]field{}, common...), fields[e.Type]...)
+	if tags, ok := lookup(e.Fields, "context.tags"); ok {
+		if tags, ok := tags.(types.M); ok {
+			var keys []string
+			for k := range tags {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				checked = append(checked, field{"context.tags." + k, "labels." + k, 1})
+			}
+		}
+	}
+	for _, f := range checked {
+		sent, ok := lookup(e.Fields, f.sent)
+		if !ok || sent == nil {
+			continue
+		}
+		indexed, _ := lookup(doc, f.indexed)
+		if equal(sent, indexed, f.scale) {
+			continue
+		}
+		r.Mismatches[f.indexed]++
+		if r.Mismatches[f.indexed] == 1 && len(r.MismatchExamples) < maxExamples {
+			r.MismatchExamples = append(r.MismatchExamples, Mismatch{e.Type, e.Id(), f.indexed, sent, indexed})
+		}
+	}
+}
+
+// equal compares a sent and an indexed value. Scaled numbers may differ by 1, as durations are rounded.
+func equal(sent, indexed interface{}, scale float64) bool {
+	a, aok := sent.(float64)
+	b, bok := indexed.(float64)
+	if aok && bok {
+		if scale != 1 {
+			return math.Abs(a*scale-b) <= 1
+		}
+		return a == b
+	}
+	return fmt.Sprint(sent) == fmt.Sprint(indexed)
+}
+
+// lookup returns the value at a dotted path of doc, whose keys may be dotted themselves.
+// Numeric path segments index arrays.
+func lookup(doc interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	switch v := doc.(type) {
+	case types.M:
+		for i := len(parts); i > 0; i-- {
+			child, ok := v[strings.Join(parts[:i], ".")]
+			if !ok {
+				continue
+			}
+			if i == len(parts) {
+				return child, true
+			}
+			if found, ok := lookup(child, strings.Join(parts[i:], ".")); ok {
+				return found, true
+			}
+		}
+	case []interface{}:
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil || idx < 0 || idx >= len(v) {
+			return nil, false
+		}
+		if len(parts) == 1 {
+			return v[idx], true
+		}
+		return lookup(v[idx], strings.Join(parts[1:], "."))
+	}
+	return nil, false
+}
+
+// Print writes the results in a human readable format.
+func (r Result) Print(out io.Writer) {
+	t := strcoll.NewTuples()
+	t.Add("events checked", r.Checked)
+	t.Add(" - found", r.Found)
+	t.Add(" - missing", r.Missing)
+	var mismatched []string
+	var total int
+	for f, n := range r.Mismatches {
+		mismatched = append(mismatched, f)
+		total += n
+	}
+	sort.Strings(mismatched)
+	t.Add("field mismatches", total)
+	for _, f := range mismatched {
+		t.Add(" - "+f, r.Mismatches[f])
+	}
+	fmt.Fprintln(out, t.Format(45))
+	if len(r.MissingExamples) > 0 {
+		fmt.Fprintln(out, "missing events:")
+		for _, m := range r.MissingExamples {
+			fmt.Fprintln(out, "  "+m)
+		}
+	}
+	if len(r.MismatchExamples) > 0 {
+		fmt.Fprintln(out, "mismatches:")
+		for _, m := range r.MismatchExamples {
+			fmt.Fprintln(out, "  "+m.String())
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/elastic/hey-apm/buildinfo"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+const versionUsage = `usage: hey-apm version
+
+Prints the version of hey-apm, the commit and date it was built, and the versions of Go and the Go agent
+it was built with, as recorded in reports.
+`
+
+// versionCommand runs the `version` subcommand with the given arguments, and returns the exit code.
+func versionCommand(args []string) int {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), versionUsage)
+	}
+	fs.Parse(args)
+
+	info := strcoll.NewTuples()
+	info.Add("version", buildinfo.Version)
+	info.Add("commit", buildinfo.Commit)
+	info.Add("build date", buildinfo.Date)
+	info.Add("go version", buildinfo.GoVersion())
+	info.Add("go agent version", buildinfo.AgentVersion())
+	fmt.Println(info.Format(20))
+	return exitSuccess
+}
@@ -0,0 +1,149 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+const (
+	aggregationPollInterval = 5 * time.Second
+	// apm-server publishes metrics once their 1 minute interval is over
+	aggregationTimeout = 2 * time.Minute
+)
+
+// addAggregation adds to the report and prints how much the metrics aggregated by apm-server for the service of the
+// run differ from what it was sent, if so requested: transaction metrics are compared with the transactions indexed,
+// and service destination metrics with the exit spans accepted per destination, as counted by the transport.
+// It waits until the metrics account for all of them, ctx is done or aggregationTimeout elapses.
+func addAggregation(ctx context.Context, logger *log.Logger, input models.Input, conn es.Connection, result Result,
+	report models.Report, out io.Writer) models.Report {
+	if !input.CheckAggregation {
+		return report
+	}
+	from := result.Start.Truncate(time.Minute)
+	deadline := time.Now().Add(aggregationTimeout)
+	var indexed, aggregated es.Totals
+	var destinations map[string]es.Totals
+	for {
+		var err error
+		indexed, err = es.IndexedTransactions(conn, input.ServiceName, input.RunId)
+		if err == nil {
+			aggregated, err = es.AggregatedTransactions(conn, input.ServiceName, from, time.Now())
+		}
+		if err == nil && len(result.Destinations) > 0 {
+			destinations, err = es.AggregatedDestinations(conn, input.ServiceName, from, time.Now())
+		}
+		if err != nil {
+			logger.Println(err.Error())
+			return report
+		}
+		pending := indexed.Count == 0 || aggregated.Count < indexed.Count
+		for resource, sent := range result.Destinations {
+			pending = pending || destinations[resource].Count < float64(sent.Count)
+		}
+		if !pending || !deadline.After(time.Now()) {
+			break
+		}
+		logger.Printf("waiting for %.0f transactions to be aggregated, %.0f so far", indexed.Count, aggregated.Count)
+		select {
+		case <-ctx.Done():
+			return report
+		case <-time.After(aggregationPollInterval):
+		}
+	}
+	groups, overflowed, err := es.TransactionGroups(conn, input.ServiceName, from, time.Now())
+	if err != nil {
+		logger.Println(err.Error())
+	} else {
+		report.TransactionGroups, report.TransactionsOverflowed = &groups, &overflowed
+	}
+	report.TransactionsAggregated = &aggregated.Count
+	report.AggregatedCountDiff = diffPct(aggregated.Count, indexed.Count)
+	report.AggregatedDurationDiff = diffPct(aggregated.DurationSum, indexed.DurationSum)
+	report = addDestinationDiffs(input, result.Destinations, destinations, report)
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("transactions aggregated", aggregated.Count)
+	metrics.Add(" - indexed", indexed.Count)
+	if report.AggregatedCountDiff != nil {
+		metrics.Add(" - difference %", *report.AggregatedCountDiff)
+	}
+	if report.AggregatedDurationDiff != nil {
+		metrics.Add("aggregated duration diff %", *report.AggregatedDurationDiff)
+	}
+	if report.TransactionGroups != nil {
+		metrics.Add("transaction groups", groups)
+		metrics.Add(" - overflowed transactions", overflowed)
+	}
+	if report.DestinationCountDiff != nil {
+		metrics.Add("destination count diff %", *report.DestinationCountDiff)
+		metrics.Add("destination duration diff %", *report.DestinationDurationDiff)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	if len(report.DestinationDiscrepancies) > 0 {
+		fmt.Fprintln(out, "destination discrepancies:")
+		for _, d := range report.DestinationDiscrepancies {
+			fmt.Fprintln(out, "  "+d)
+		}
+	}
+	return report
+}
+
+// addDestinationDiffs adds to the report the largest differences between the exit spans sent per destination
+// and the aggregated ones, and the destinations differing by more than the tolerance.
+// Destinations aggregated but not sent are discrepancies too, as they aren't accounted for by the run.
+func addDestinationDiffs(input models.Input, sent map[string]agent.DestinationStats, aggregated map[string]es.Totals,
+	report models.Report) models.Report {
+	if len(sent) == 0 {
+		return report
+	}
+	var resources []string
+	for resource := range sent {
+		resources = append(resources, resource)
+	}
+	for resource := range aggregated {
+		if _, ok := sent[resource]; !ok {
+			resources = append(resources, resource)
+		}
+	}
+	sort.Strings(resources)
+	var maxCount, maxDuration float64
+	for _, resource := range resources {
+		expected, actual := sent[resource], aggregated[resource]
+		countDiff := diffPct(actual.Count, float64(expected.Count))
+		durationDiff := diffPct(actual.DurationSum, expected.DurationSum)
+		if countDiff == nil || *countDiff > input.AggregationTolerance ||
+			durationDiff != nil && *durationDiff > input.AggregationTolerance {
+			report.DestinationDiscrepancies = append(report.DestinationDiscrepancies,
+				fmt.Sprintf("%s: %d exit spans sent, %.0f aggregated", resource, expected.Count, actual.Count))
+		}
+		if countDiff != nil {
+			maxCount = math.Max(maxCount, *countDiff)
+		}
+		if durationDiff != nil {
+			maxDuration = math.Max(maxDuration, *durationDiff)
+		}
+	}
+	report.DestinationCountDiff, report.DestinationDurationDiff = &maxCount, &maxDuration
+	return report
+}
+
+// diffPct returns the absolute difference between actual and expected as a percentage of expected,
+// or nil if expected is 0.
+func diffPct(actual, expected float64) *float64 {
+	if expected == 0 {
+		return nil
+	}
+	pct := 100 * math.Abs(actual-expected) / expected
+	return &pct
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/elastic/hey-apm/annotations"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+)
+
+// annotate records the start of a run in the annotation sinks given by the input, and returns a function
+// to record its end. Failures are only logged.
+func annotate(logger *log.Logger, input models.Input, runId string, start time.Time) func(end time.Time) {
+	var sinks []annotations.Sink
+	if input.GrafanaUrl != "" {
+		sinks = append(sinks, annotations.Grafana{Url: input.GrafanaUrl, Token: input.GrafanaToken})
+	}
+	if input.AnnotateElasticsearch && input.ElasticsearchUrl != "" {
+		conn, err := es.NewConnection(input.ElasticsearchUrl, input.ElasticsearchAuth)
+		if err != nil {
+			logger.Println(err.Error())
+		} else {
+			sinks = append(sinks, annotations.Elasticsearch{Connection: conn})
+		}
+	}
+
+	config, _ := json.Marshal(input)
+	a := annotations.Annotation{
+		RunId: runId,
+		Time:  start,
+		Text:  "hey-apm run " + runId + "\n" + string(config),
+		Tags:  []string{"hey-apm", "run:" + runId},
+		Input: input,
+	}
+	if input.TargetName != "" {
+		a.Tags = append(a.Tags, "target:"+input.TargetName)
+	}
+
+	var stops []func(time.Time) error
+	for _, sink := range sinks {
+		stop, err := sink.Start(a)
+		if err != nil {
+			logger.Println("annotation failed: " + err.Error())
+			continue
+		}
+		stops = append(stops, stop)
+	}
+	return func(end time.Time) {
+		for _, stop := range stops {
+			if err := stop(end); err != nil {
+				logger.Println("annotation failed: " + err.Error())
+			}
+		}
+	}
+}
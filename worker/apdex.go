@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+)
+
+// apdex returns the Apdex score of the requests sent, or nil if there are none:
+// requests taking up to threshold are satisfying, those taking up to 4 times threshold are tolerable,
+// and slower or failed ones are frustrating.
+func (r Result) apdex(threshold time.Duration) *float64 {
+	var satisfied, tolerating int
+	for _, s := range r.Samples {
+		if s.Status == 0 || s.Status >= 300 {
+			continue
+		}
+		switch {
+		case s.Duration <= threshold:
+			satisfied++
+		case s.Duration <= 4*threshold:
+			tolerating++
+		}
+	}
+	return numbers.Div(float64(satisfied)+float64(tolerating)/2, len(r.Samples))
+}
+
+// addApdex adds to the report and prints the Apdex score of the requests sent, if a threshold is given.
+func addApdex(input models.Input, result Result, report models.Report, out io.Writer) models.Report {
+	if input.ApdexThreshold <= 0 {
+		return report
+	}
+	report.Apdex = result.apdex(input.ApdexThreshold)
+	if report.Apdex != nil {
+		fmt.Fprintf(out, "apdex (T=%s) %.2f\n", input.ApdexThreshold, *report.Apdex)
+	}
+	return report
+}
@@ -0,0 +1,103 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// ThresholdError is returned when a report doesn't meet the assertions given in the input.
+type ThresholdError struct {
+	Violations []string
+}
+
+func (e ThresholdError) Error() string {
+	return "thresholds exceeded: " + strings.Join(e.Violations, "; ")
+}
+
+// assertion compares an actual report value against an expected limit.
+type assertion struct {
+	name      string
+	actual    *float64
+	limit     float64
+	isMaximum bool
+}
+
+func (a assertion) pass() bool {
+	if a.isMaximum {
+		return *a.actual <= a.limit
+	}
+	return *a.actual >= a.limit
+}
+
+func (a assertion) String() string {
+	op := ">="
+	if a.isMaximum {
+		op = "<="
+	}
+	return fmt.Sprintf("%.2f %s %.2f", *a.actual, op, a.limit)
+}
+
+// checkAssertions evaluates the assertions given in the input against a report, prints pass/fail for each one
+// and returns a ThresholdError if any of them fails.
+// Assertions that can't be evaluated because the report lacks the needed data are considered failed.
+func checkAssertions(input models.Input, report models.Report, out io.Writer) error {
+	var assertions []assertion
+	if input.AssertMaxDropRate > 0 {
+		var dropRate *float64
+		if report.EventsSentRatio != nil {
+			f := 100 * (1 - *report.EventsSentRatio)
+			dropRate = &f
+		}
+		assertions = append(assertions, assertion{"max drop rate %", dropRate, input.AssertMaxDropRate, true})
+	}
+	if input.AssertP99Latency > 0 {
+		assertions = append(assertions, assertion{"max request latency p99 (ms)", report.RequestLatencyP99,
+			input.AssertP99Latency.Seconds() * 1000, true})
+	}
+	if input.AssertMinThroughput > 0 {
+		assertions = append(assertions, assertion{"min events accepted per second", report.EventAcceptRate,
+			input.AssertMinThroughput, false})
+	}
+	if input.AssertMinApdex > 0 {
+		assertions = append(assertions, assertion{"min apdex", report.Apdex, input.AssertMinApdex, false})
+	}
+	if input.CheckAggregation {
+		assertions = append(assertions,
+			assertion{"max aggregated count diff %", report.AggregatedCountDiff, input.AggregationTolerance, true},
+			assertion{"max aggregated sum diff %", report.AggregatedDurationDiff, input.AggregationTolerance, true})
+		// only if any exit spans were sent
+		if report.DestinationCountDiff != nil {
+			assertions = append(assertions,
+				assertion{"max destination count diff %", report.DestinationCountDiff, input.AggregationTolerance, true},
+				assertion{"max destination sum diff %", report.DestinationDurationDiff, input.AggregationTolerance, true})
+		}
+	}
+	if len(assertions) == 0 {
+		return nil
+	}
+
+	var violations []string
+	results := strcoll.NewTuples()
+	for _, a := range assertions {
+		switch {
+		case a.actual == nil:
+			results.Add(a.name, "FAIL (unknown)")
+			violations = append(violations, a.name+" unknown")
+		case a.pass():
+			results.Add(a.name, "PASS ("+a.String()+")")
+		default:
+			results.Add(a.name, "FAIL ("+a.String()+")")
+			violations = append(violations, a.name+": "+a.String()+" is false")
+		}
+	}
+	fmt.Fprintln(out, results.Format(30))
+
+	if len(violations) > 0 {
+		return ThresholdError{violations}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// nameCatalog is a list of transaction names picked at random in proportion to their weights.
+type nameCatalog struct {
+	names []string
+	// cumulative weights of names
+	weights []float64
+}
+
+// loadNameCatalog returns a catalog of transaction names described by spec, one of:
+// zipf:<n>[:<s>], n endpoints whose weights follow a Zipf distribution with exponent s (1 by default), eg. zipf:20
+// a file with a name per line, optionally followed by a comma and its weight (1 by default), eg. GET /users,5
+// It returns nil if spec is empty.
+func loadNameCatalog(spec string) (*nameCatalog, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	c := &nameCatalog{}
+	if kind, params := strcoll.SplitKV(spec, ":"); kind == "zipf" {
+		p1, p2 := strcoll.SplitKV(params, ":")
+		n, err := strconv.Atoi(p1)
+		s := 1.0
+		if err == nil && p2 != "" {
+			s, err = strconv.ParseFloat(p2, 64)
+		}
+		if err != nil || n <= 0 || s < 0 {
+			return nil, fmt.Errorf("invalid transaction names %q, expected zipf:<n>[:<s>]", spec)
+		}
+		for i := 1; i <= n; i++ {
+			c.add(fmt.Sprintf("GET /endpoint/%d", i), 1/math.Pow(float64(i), s))
+		}
+		return c, nil
+	}
+
+	f, err := os.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		name, weight := text, 1.0
+		if idx := strings.LastIndex(text, ","); idx >= 0 {
+			if weight, err = strconv.ParseFloat(strings.TrimSpace(text[idx+1:]), 64); err != nil || weight < 0 {
+				return nil, fmt.Errorf("transaction names %s line %d: invalid weight in %s", spec, line, text)
+			}
+			name = strings.TrimSpace(text[:idx])
+		}
+		c.add(name, weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(c.names) == 0 || c.weights[len(c.weights)-1] == 0 {
+		return nil, fmt.Errorf("transaction names %s: no names with a positive weight", spec)
+	}
+	return c, nil
+}
+
+func (c *nameCatalog) add(name string, weight float64) {
+	var total float64
+	if len(c.weights) > 0 {
+		total = c.weights[len(c.weights)-1]
+	}
+	c.names = append(c.names, name)
+	c.weights = append(c.weights, total+weight)
+}
+
+// pick returns a random name from the catalog, or the default if the catalog is nil.
+func (c *nameCatalog) pick(r *rand.Rand) string {
+	if c == nil {
+		return "generated"
+	}
+	x := r.Float64() * c.weights[len(c.weights)-1]
+	return c.names[sort.Search(len(c.weights), func(i int) bool { return c.weights[i] > x })]
+}
@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/transport"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+)
+
+// Ceiling is the highest rate at which a component of hey-apm works on the current machine.
+type Ceiling struct {
+	Component string
+	Rate      float64
+	Unit      string
+}
+
+func (c Ceiling) String() string {
+	return fmt.Sprintf("%.0f %s", c.Rate, c.Unit)
+}
+
+// MeasureCeilings runs microbenchmarks of the components of hey-apm for d each, and returns their ceilings:
+// events generated and encoded by the Go agent into request bodies, compressed, and requests dispatched
+// to a local HTTP server, which only reads them.
+func MeasureCeilings(d time.Duration) ([]Ceiling, error) {
+	generated, err := generationCeiling(d)
+	if err != nil {
+		return nil, err
+	}
+	ceilings := []Ceiling{{"event generation", generated, "events/s"}}
+	events, bytesPerSecond := compressionCeiling(d)
+	ceilings = append(ceilings,
+		Ceiling{"gzip compression", events, "events/s"},
+		Ceiling{"gzip compression", bytesPerSecond / (1 << 20), "MB/s"},
+		Ceiling{"request dispatch", dispatchCeiling(d), "requests/s"})
+	return ceilings, nil
+}
+
+// generationCeiling returns the events per second generated as fast as possible by the default workload,
+// and encoded by the Go agent into bodies that are discarded.
+func generationCeiling(d time.Duration) (float64, error) {
+	goTracer, err := apm.NewTracerOptions(apm.TracerOptions{ServiceName: "hey-apm", Transport: transport.Discard})
+	if err != nil {
+		return 0, err
+	}
+	tracer := agent.Tracer{Tracer: goTracer}
+	defer tracer.Close()
+	input := models.Input{
+		TransactionLimit: int(^uint(0) >> 1), TransactionFrequency: time.Nanosecond,
+		SpanMinLimit: 1, SpanMaxLimit: 10,
+		ErrorLimit: int(^uint(0) >> 1), ErrorFrequency: time.Nanosecond,
+		ErrorFrameMinLimit: 1, ErrorFrameMaxLimit: 10,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, generate := range []func(context.Context) error{
+		generateTransactions(tracer, input), generateErrors(tracer, input),
+	} {
+		wg.Add(1)
+		go func(generate func(context.Context) error) {
+			defer wg.Done()
+			generate(ctx)
+		}(generate)
+	}
+	start := time.Now()
+	wg.Wait()
+	tracer.Flush(nil)
+	stats := tracer.Stats()
+	sent := stats.TransactionsSent + stats.SpansSent + stats.ErrorsSent
+	return float64(sent) / time.Since(start).Seconds(), nil
+}
+
+// ceilingEvent is an uncompressed span as encoded by the Go agent.
+const ceilingEvent = `{"span":{"id":"0123456789abcdef","transaction_id":"0123456789abcdef",` +
+	`"trace_id":"0123456789abcdef0123456789abcdef","parent_id":"0123456789abcdef","name":"I'm a span",` +
+	`"type":"gen.era.ted","timestamp":1600000000000000,"duration":1.5,"context":{"tags":{"run_id":"x"}}}}` + "\n"
+
+// compressionCeiling returns the events and uncompressed bytes per second compressed with gzip,
+// in bodies of 1000 events.
+func compressionCeiling(d time.Duration) (float64, float64) {
+	body := bytes.Repeat([]byte(ceilingEvent), 1000)
+	w := gzip.NewWriter(ioutil.Discard)
+	var bodies int
+	start := time.Now()
+	for time.Since(start) < d {
+		w.Reset(ioutil.Discard)
+		w.Write(body)
+		w.Close()
+		bodies++
+	}
+	seconds := time.Since(start).Seconds()
+	return float64(bodies*1000) / seconds, float64(bodies*len(body)) / seconds
+}
+
+// dispatchCeiling returns the requests per second sent to a local HTTP server with small gzipped bodies,
+// from 4 goroutines per CPU.
+func dispatchCeiling(d time.Duration) float64 {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		io.Copy(ioutil.Discard, req.Body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+	var body bytes.Buffer
+	gw := gzip.NewWriter(&body)
+	gw.Write(bytes.Repeat([]byte(ceilingEvent), 10))
+	gw.Close()
+
+	concurrency := 4 * runtime.GOMAXPROCS(0)
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: concurrency}}
+	defer client.CloseIdleConnections()
+	var requests int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Since(start) < d {
+				req, _ := http.NewRequest("POST", server.URL+"/intake/v2/events", bytes.NewReader(body.Bytes()))
+				req.Header.Set("Content-Encoding", "gzip")
+				resp, err := client.Do(req)
+				if err != nil {
+					continue
+				}
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				atomic.AddInt64(&requests, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	return float64(requests) / time.Since(start).Seconds()
+}
@@ -0,0 +1,126 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// recoveredRatio is the fraction of the throughput before an outage considered as recovered
+const recoveredRatio = 0.9
+
+// interrupter is implemented by senders able to simulate agents being stopped and restarted.
+type interrupter interface {
+	Interrupt(d time.Duration)
+}
+
+// chaosMonitor samples the events accepted every second while agents are stopped and restarted.
+type chaosMonitor struct {
+	downtime time.Duration
+
+	mu sync.Mutex
+	// events accepted every second
+	rates []uint64
+	// seconds at which outages started
+	outages []int
+}
+
+// addChaos stops and restarts the agent at the offsets from the start of the work in ChaosSchedule,
+// each time for ChaosDowntime, and returns a monitor of the throughput around outages.
+// It returns nil if there is no schedule or the sender can't be interrupted.
+func (w *worker) addChaos(input models.Input) *chaosMonitor {
+	sender, ok := w.Sender.(interrupter)
+	if len(input.ChaosSchedule) == 0 || !ok {
+		return nil
+	}
+	schedule := append([]time.Duration(nil), input.ChaosSchedule...)
+	sort.Slice(schedule, func(i, j int) bool { return schedule[i] < schedule[j] })
+	m := &chaosMonitor{downtime: input.ChaosDowntime}
+	w.Add(func(ctx context.Context) error {
+		start := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		var accepted uint64
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			current := w.TransportStats().Accepted
+			m.mu.Lock()
+			m.rates = append(m.rates, current-accepted)
+			if len(schedule) > 0 && time.Since(start) >= schedule[0] {
+				sender.Interrupt(m.downtime)
+				m.outages = append(m.outages, len(m.rates))
+				schedule = schedule[1:]
+			}
+			m.mu.Unlock()
+			accepted = current
+		}
+	})
+	return m
+}
+
+// mean returns the average of rates, or nil if empty.
+func mean(rates []uint64) *float64 {
+	if len(rates) == 0 {
+		return nil
+	}
+	var sum uint64
+	for _, r := range rates {
+		sum += r
+	}
+	avg := float64(sum) / float64(len(rates))
+	return &avg
+}
+
+// addChaosStats adds to the report and prints the throughput before the first outage and after the last one,
+// and the seconds it took after the last restart to reach 90% of the throughput before the first outage.
+func addChaosStats(m *chaosMonitor, report models.Report, out io.Writer) models.Report {
+	if m == nil {
+		return report
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	report.Outages = len(m.outages)
+	if len(m.outages) == 0 {
+		return report
+	}
+	restart := m.outages[len(m.outages)-1] + int((m.downtime+time.Second-1)/time.Second)
+	report.ThroughputBeforeOutage = mean(m.rates[:m.outages[0]])
+	if restart < len(m.rates) {
+		report.ThroughputAfterOutage = mean(m.rates[restart:])
+		if report.ThroughputBeforeOutage != nil {
+			for i, r := range m.rates[restart:] {
+				if float64(r) >= recoveredRatio**report.ThroughputBeforeOutage {
+					recovery := float64(i)
+					report.OutageRecovery = &recovery
+					break
+				}
+			}
+		}
+	}
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("outages", report.Outages)
+	if report.ThroughputBeforeOutage != nil {
+		metrics.Add("accepted/s before outages", *report.ThroughputBeforeOutage)
+	}
+	if report.ThroughputAfterOutage != nil {
+		metrics.Add("accepted/s after outages", *report.ThroughputAfterOutage)
+	}
+	if report.OutageRecovery != nil {
+		metrics.Add("recovery (s)", *report.OutageRecovery)
+	} else {
+		metrics.Add("recovery (s)", "not recovered")
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"math/rand"
+
+	"go.elastic.co/apm"
+)
+
+// idCollider makes a fraction of transactions reuse the trace and transaction Ids of a previous transaction,
+// and their spans reuse the Ids of its spans, to observe how duplicated Ids are handled downstream.
+// It is not safe for concurrent use, Ids are recorded by the goroutine generating transactions.
+type idCollider struct {
+	ratio float64
+	rand  *rand.Rand
+
+	last  apm.TraceContext
+	spans []apm.SpanID
+}
+
+// newIdCollider returns nil if ratio is not positive. Transactions collide at random with r.
+func newIdCollider(ratio float64, r *rand.Rand) *idCollider {
+	if ratio <= 0 {
+		return nil
+	}
+	return &idCollider{ratio: ratio, rand: r}
+}
+
+// collide returns the Ids of a previous transaction and its spans with a probability given by the ratio,
+// and false otherwise.
+func (c *idCollider) collide() (apm.TraceContext, []apm.SpanID, bool) {
+	if c == nil || c.rand.Float64() >= c.ratio {
+		return apm.TraceContext{}, nil, false
+	}
+	if c.last.Trace.Validate() != nil {
+		return apm.TraceContext{}, nil, false
+	}
+	return c.last, c.spans, true
+}
+
+// setTransaction records the Ids of a new transaction and of its spans, picked beforehand, to be reused by later ones.
+func (c *idCollider) setTransaction(tx *apm.Transaction, spans []apm.SpanID) {
+	if c == nil {
+		return
+	}
+	c.last = tx.TraceContext()
+	c.spans = spans
+}
@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/record"
+	"github.com/stretchr/testify/assert"
+)
+
+// spanRecorder is a transport recording the trace, parent and span Ids of the spans sent.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []string
+}
+
+func (r *spanRecorder) SendStream(ctx context.Context, stream io.Reader) error {
+	rd, release, err := record.Decompressor(http.Header{"Content-Encoding": []string{"deflate"}}, stream)
+	if err != nil {
+		return err
+	}
+	defer release()
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		var event struct {
+			Span *struct {
+				TraceId  string `json:"trace_id"`
+				ParentId string `json:"parent_id"`
+				Id       string `json:"id"`
+			} `json:"span"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		if s := event.Span; s != nil {
+			r.mu.Lock()
+			r.spans = append(r.spans, s.TraceId+"/"+s.ParentId+"/"+s.Id)
+			r.mu.Unlock()
+		}
+	}
+	return scanner.Err()
+}
+
+// generatedSpans returns the trace, parent and span Ids of the spans generated for input, sorted.
+func generatedSpans(t *testing.T, input models.Input) []string {
+	recorder := &spanRecorder{}
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{ServiceName: "hey-apm", Transport: recorder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Close()
+	assert.NoError(t, generateTransactions(discardSender{tracer}, input)(context.Background()))
+	tracer.Flush(nil)
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	sort.Strings(recorder.spans)
+	return recorder.spans
+}
+
+func TestIDCollisions(t *testing.T) {
+	input := models.Input{TransactionLimit: 20, TransactionFrequency: time.Nanosecond, Seed: 42,
+		SpanMinLimit: 16, SpanMaxLimit: 16, SpanDepth: 2, SpanFanOut: 1, IDCollisionRatio: 0.5}
+	spans := generatedSpans(t, input)
+	assert.Len(t, spans, 320)
+
+	// colliding spans reuse the Ids of previous ones in the same trees, regardless of which goroutine started first
+	assert.Equal(t, spans, generatedSpans(t, input))
+	unique := make(map[string]bool)
+	for _, s := range spans {
+		unique[s] = true
+	}
+	assert.True(t, len(unique) < len(spans))
+}
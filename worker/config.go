@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/server"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+const pollTimeout = 10 * time.Second
+
+// pollStats counts the requests of a background load against an apm-server endpoint, and their latencies.
+type pollStats struct {
+	mu          sync.Mutex
+	requests    uint64
+	notModified uint64
+	failed      uint64
+	latencies   []float64
+}
+
+func (s *pollStats) add(status int, err error, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	switch {
+	case err != nil || status >= 400:
+		s.failed++
+	case status == http.StatusNotModified:
+		s.notModified++
+	}
+	s.latencies = append(s.latencies, float64(d)/float64(time.Millisecond))
+}
+
+// serverGet sends a GET request to apm-server with the credentials in input, and returns the response status and headers.
+func serverGet(client *http.Client, input models.Input, u string, header http.Header) (int, http.Header, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if auth := server.Authorization(input.ApmServerSecret, input.APIKey); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	return resp.StatusCode, resp.Header, nil
+}
+
+// pollConfig returns a function simulating ConfigAgents agents polling apm-server for their central configuration
+// every ConfigPollInterval, each of them with its own service name and sending the etag of the last configuration
+// received, until its context is done.
+// Agents start at random times within the first interval, so that requests are spread.
+func pollConfig(input models.Input, stats *pollStats) func(ctx context.Context) error {
+	rnd := newRand(input.Seed, "config")
+	return func(ctx context.Context) error {
+		client := &http.Client{Timeout: pollTimeout}
+		base := strings.TrimSuffix(input.ApmServerUrl, "/") + "/config/v1/agents"
+		var wg sync.WaitGroup
+		for i := 0; i < input.ConfigAgents; i++ {
+			q := url.Values{}
+			q.Set("service.name", fmt.Sprintf("%s-%d", input.ServiceName, i+1))
+			if input.ServiceEnvironment != "" {
+				q.Set("service.environment", input.ServiceEnvironment)
+			}
+			u := base + "?" + q.Encode()
+			delay := time.Duration(rnd.Int63n(int64(input.ConfigPollInterval)))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var etag string
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(delay):
+					}
+					delay = input.ConfigPollInterval
+					header := http.Header{}
+					if etag != "" {
+						header.Set("If-None-Match", etag)
+					}
+					start := time.Now()
+					status, respHeader, err := serverGet(client, input, u, header)
+					stats.add(status, err, time.Since(start))
+					if err == nil && status == http.StatusOK {
+						etag = respHeader.Get("Etag")
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		return nil
+	}
+}
+
+// addConfigPolling adds to the report and prints the central configuration requests sent, if any.
+func addConfigPolling(stats *pollStats, report models.Report, out io.Writer) models.Report {
+	if stats == nil {
+		return report
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	report.ConfigRequests = stats.requests
+	report.ConfigNotModified = stats.notModified
+	report.ConfigFailed = stats.failed
+	report.ConfigLatencyP99 = numbers.Percentile(stats.latencies, 99)
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("config requests", report.ConfigRequests)
+	metrics.Add(" - not modified", report.ConfigNotModified)
+	metrics.Add(" - failed", report.ConfigFailed)
+	if report.ConfigLatencyP99 != nil {
+		metrics.Add("config latency p99 (ms)", *report.ConfigLatencyP99)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
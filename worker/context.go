@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"go.elastic.co/apm"
+)
+
+// eventContext holds the user and custom context added to generated transactions and errors.
+type eventContext struct {
+	users  int
+	custom map[string]interface{}
+	rand   *rand.Rand
+}
+
+// newEventContext returns an eventContext with users distinct users, and a custom object nested
+// depth levels deep with size fields per level, or nil if there is nothing to add.
+// Users are picked at random with r.
+func newEventContext(users, depth, size int, r *rand.Rand) *eventContext {
+	if users <= 0 && (depth <= 0 || size <= 0) {
+		return nil
+	}
+	c := &eventContext{users: users, rand: r}
+	if depth > 0 && size > 0 {
+		c.custom = customObject(depth, size)
+	}
+	return c
+}
+
+func customObject(depth, size int) map[string]interface{} {
+	m := make(map[string]interface{}, size)
+	for i := 0; i < size; i++ {
+		k := "field" + strconv.Itoa(i)
+		if depth > 1 {
+			m[k] = customObject(depth-1, size)
+		} else {
+			m[k] = "generated"
+		}
+	}
+	return m
+}
+
+// set adds user and custom context to a transaction or error context.
+func (c *eventContext) set(ctx *apm.Context) {
+	if c == nil {
+		return
+	}
+	if c.users > 0 {
+		user := c.rand.Intn(c.users)
+		ctx.SetUserID(strconv.Itoa(user))
+		ctx.SetUserEmail(fmt.Sprintf("user%d@generated.local", user))
+		ctx.SetUsername(fmt.Sprintf("user%d", user))
+	}
+	if c.custom != nil {
+		ctx.SetCustom("generated", c.custom)
+	}
+}
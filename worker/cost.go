@@ -0,0 +1,31 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// addCost adds to the report and prints the price per hour of the deployment under test and the estimated price of
+// indexing a million events at the measured rate, if given the price of the deployment or of its memory.
+func addCost(input models.Input, report models.Report, out io.Writer) models.Report {
+	hourly := input.HourlyCost
+	if hourly == 0 && input.Cloud != nil {
+		hourly = input.CostPerGBHour * input.Cloud.MemoryGB
+	}
+	if hourly == 0 {
+		return report
+	}
+	report.DeploymentHourlyCost = &hourly
+	report = report.WithDerivedAttributes()
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("deployment cost per hour", fmt.Sprintf("%.2f", hourly))
+	if report.CostPerMillionEvents != nil {
+		metrics.Add("cost per million events", fmt.Sprintf("%.4f", *report.CostPerMillionEvents))
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,113 @@
+package worker
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// rateCurve is a 24 hour curve of multipliers of the rate of events, linearly interpolated between its points.
+type rateCurve struct {
+	points []curvePoint
+	// highest multiplier
+	max float64
+}
+
+type curvePoint struct {
+	at         time.Duration
+	multiplier float64
+}
+
+// loadRateCurve reads a rate curve from a CSV file with a time of the day and a multiplier per line,
+// eg. 13:30,2.5, with an optional header. Times can also be given as fractional hours, eg. 13.5.
+// It returns nil if path is empty.
+func loadRateCurve(path string) (*rateCurve, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 2
+	r.TrimLeadingSpace = true
+	c := &rateCurve{}
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rate curve %s: %s", path, err)
+		}
+		at, terr := timeOfDay(record[0])
+		multiplier, merr := strconv.ParseFloat(record[1], 64)
+		if terr != nil || merr != nil {
+			if line == 1 {
+				// header
+				continue
+			}
+			return nil, fmt.Errorf("rate curve %s line %d: expected a time of the day and a multiplier, got %s",
+				path, line, strings.Join(record, ","))
+		}
+		if multiplier < 0 {
+			return nil, fmt.Errorf("rate curve %s line %d: multipliers must not be negative", path, line)
+		}
+		c.points = append(c.points, curvePoint{at, multiplier})
+		if multiplier > c.max {
+			c.max = multiplier
+		}
+	}
+	if c.max == 0 {
+		return nil, fmt.Errorf("rate curve %s: no positive multipliers", path)
+	}
+	sort.Slice(c.points, func(i, j int) bool { return c.points[i].at < c.points[j].at })
+	return c, nil
+}
+
+// timeOfDay parses HH:MM or fractional hours into the time since midnight.
+func timeOfDay(s string) (time.Duration, error) {
+	var at time.Duration
+	if t, err := time.Parse("15:04", s); err == nil {
+		at = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	} else if h, err := strconv.ParseFloat(s, 64); err == nil {
+		at = time.Duration(h * float64(time.Hour))
+	} else {
+		return 0, err
+	}
+	if at < 0 || at >= day {
+		return 0, fmt.Errorf("time of the day out of range: %s", s)
+	}
+	return at, nil
+}
+
+// multiplier returns the multiplier at a time of the day, interpolated between the points around it,
+// wrapping around midnight.
+func (c *rateCurve) multiplier(at time.Duration) float64 {
+	at %= day
+	n := len(c.points)
+	next := sort.Search(n, func(i int) bool { return c.points[i].at > at })
+	prev := c.points[(next+n-1)%n]
+	following := c.points[next%n]
+	from, to := prev.at, following.at
+	if to <= from {
+		to += day
+	}
+	if at < from {
+		at += day
+	}
+	if to == from {
+		return prev.multiplier
+	}
+	f := float64(at-from) / float64(to-from)
+	return prev.multiplier + f*(following.multiplier-prev.multiplier)
+}
@@ -0,0 +1,27 @@
+package worker
+
+import (
+	"context"
+	"math/rand"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/agent"
+)
+
+// generateDroppedSpans starts and ends kept + dropped exit spans in the transaction of ctx, which must have room
+// for exactly kept more spans, so that the agent drops the last dropped ones.
+// The nth dropped span calls the nth of agent.DroppedSpanResources, as expected by the transport adding
+// dropped_spans_stats. Kept spans get random Ids from r.
+func generateDroppedSpans(ctx context.Context, r *rand.Rand, kept, dropped int) {
+	for i := 0; i < kept+dropped; i++ {
+		resource := agent.DroppedSpanResources[0]
+		if i >= kept {
+			resource = agent.DroppedSpanResources[(i-kept)%len(agent.DroppedSpanResources)]
+		}
+		span, _ := apm.StartSpanOptions(ctx, "call "+resource, "external."+resource,
+			apm.SpanOptions{SpanID: newSpanID(r)})
+		span.Context.SetDestinationService(apm.DestinationServiceSpanContext{Name: resource, Resource: resource})
+		span.End()
+	}
+}
@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"math/rand"
+	"strings"
+
+	"go.elastic.co/apm"
+)
+
+// edgeStrings are variants of a string exercising validation, truncation and mappings in apm-server
+// and Elasticsearch: each one takes the original string and returns an edge case based on it.
+var edgeStrings = []func(string) string{
+	// multibyte characters, including 4 byte sequences
+	func(s string) string { return s + " 生成された ñandú Ελληνικά 🚀🔥" },
+	// zero width spaces, joiners and byte order marks
+	func(s string) string { return "\ufeff" + strings.Join(strings.Split(s, ""), "\u200b") + "\u200d" },
+	// longer than the 1024 characters keyword fields are indexed up to
+	func(s string) string { return s + " " + strings.Repeat("long ", 2000) },
+	// control characters, including NUL and escape sequences
+	func(s string) string { return s + "\x00\x01\x07\x1b[31m\t\r\n\x7f" },
+	// right to left override and combining characters
+	func(s string) string { return "\u202e" + s + "\u202c e\u0301\u0301\u0301" },
+	// invalid UTF-8 sequences
+	func(s string) string { return s + " \xff\xfe\xc3\x28" },
+	// only whitespace
+	func(string) string { return " \t\u3000 " },
+}
+
+// stringFuzzer replaces strings with edge cases with a probability given by its ratio.
+type stringFuzzer struct {
+	ratio float64
+	rand  *rand.Rand
+}
+
+// newStringFuzzer returns nil if ratio is not positive. Strings are fuzzed at random with r.
+func newStringFuzzer(ratio float64, r *rand.Rand) *stringFuzzer {
+	if ratio <= 0 {
+		return nil
+	}
+	return &stringFuzzer{ratio, r}
+}
+
+// fuzz returns an edge case variant of s picked at random, or s itself if not fuzzed.
+func (f *stringFuzzer) fuzz(s string) string {
+	if f == nil || f.rand.Float64() >= f.ratio {
+		return s
+	}
+	return edgeStrings[f.rand.Intn(len(edgeStrings))](s)
+}
+
+// label sets a "text" label on an event context, fuzzed as any other string.
+func (f *stringFuzzer) label(ctx *apm.Context) {
+	if f != nil {
+		ctx.SetTag("text", f.fuzz("generated"))
+	}
+}
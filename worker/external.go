@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+)
+
+func init() {
+	RegisterGenerator("external", generateExternal)
+}
+
+// externalInit is written as a single JSON line to the standard input of external generators when they start.
+type externalInit struct {
+	RunId       string `json:"run_id"`
+	Seed        int64  `json:"seed"`
+	ServiceName string `json:"service_name,omitempty"`
+}
+
+// externalEvent is an event described by an external generator, one per line of its standard output,
+// eg. {"transaction": {"name": "GET /", "type": "request", "duration": 12.5, "spans": [{"name": "SELECT", "type": "db"}]}}
+// or {"error": {"message": "boom", "type": "TimeoutError"}}. Durations are in milliseconds, measured if 0.
+type externalEvent struct {
+	Transaction *struct {
+		Name     string            `json:"name"`
+		Type     string            `json:"type"`
+		Result   string            `json:"result"`
+		Duration float64           `json:"duration"`
+		Labels   map[string]string `json:"labels"`
+		Spans    []struct {
+			Name     string            `json:"name"`
+			Type     string            `json:"type"`
+			Duration float64           `json:"duration"`
+			Labels   map[string]string `json:"labels"`
+		} `json:"spans"`
+	} `json:"transaction"`
+	Error *struct {
+		Message string            `json:"message"`
+		Type    string            `json:"type"`
+		Culprit string            `json:"culprit"`
+		Labels  map[string]string `json:"labels"`
+	} `json:"error"`
+}
+
+// externalErr is an error described by an external generator.
+type externalErr struct {
+	message, typ string
+}
+
+func (e externalErr) Error() string {
+	return e.message
+}
+
+// Type overrides the exception type reported by the agent, if given.
+func (e externalErr) Type() string {
+	if e.typ == "" {
+		return "externalErr"
+	}
+	return e.typ
+}
+
+// generateExternal runs the GeneratorCmd command and sends the events it describes in its standard output,
+// one per line, up to once every GeneratorFrequency, through the Go agent as any other event.
+// The run id and seed are written to its standard input first, as a JSON line.
+// The generator is done once the command closes its output, and fails if it describes an invalid event.
+// The frequency is modulated over the run by RateCurve and spikes, if given.
+func generateExternal(sender agent.Sender, input models.Input) func(ctx context.Context) error {
+	args := strings.Fields(input.GeneratorCmd)
+	if len(args) == 0 {
+		return nil
+	}
+	rnd := newRand(input.Seed, "external")
+	// validated with the input
+	curve, _ := loadRateCurve(input.RateCurve)
+	return func(ctx context.Context) error {
+		init, err := json.Marshal(externalInit{RunId: input.RunId, Seed: input.Seed, ServiceName: input.ServiceName})
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stdin = bytes.NewReader(append(init, '\n'))
+		cmd.Stderr = os.Stderr
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("external generator: %s", err)
+		}
+		defer func() {
+			// it might be still writing
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		lines := bufio.NewScanner(stdout)
+		lines.Buffer(nil, 10<<20)
+
+		shape := newShaper(curve, input)
+		ticker := time.NewTicker(shape.interval(input.GeneratorFrequency))
+		defer ticker.Stop()
+		// the pace of shaped generators is not tracked, as their requested rate varies
+		var pace *pace
+		if shape == nil {
+			pace = trackPace(ctx, "external", input.GeneratorFrequency, input.Seed)
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			if !shape.admit() {
+				continue
+			}
+			pace.tick()
+
+			if !lines.Scan() {
+				if err := lines.Err(); err != nil {
+					return fmt.Errorf("external generator: %s", err)
+				}
+				return nil
+			}
+			var e externalEvent
+			if err := json.Unmarshal(lines.Bytes(), &e); err != nil {
+				return fmt.Errorf("external generator: invalid event %s: %s", lines.Bytes(), err)
+			}
+			sendExternal(sender, rnd, input.RunId, input.Labels, e)
+		}
+	}
+}
+
+// sendExternal sends the transaction with spans and the error described by an external event, if any,
+// labelled with the run id and labels, overridden by its own, with Ids picked at random with r.
+func sendExternal(sender agent.Sender, r *rand.Rand, runId string, labels map[string]string, e externalEvent) {
+	if t := e.Transaction; t != nil {
+		opts := apm.TransactionOptions{TraceContext: newTraceContext(r), TransactionID: newSpanID(r)}
+		d := millis(t.Duration)
+		if d > 0 {
+			opts.Start = time.Now().Add(-d)
+		}
+		tx := sender.StartTransactionOptions(t.Name, t.Type, opts)
+		tx.Result = t.Result
+		for _, s := range t.Spans {
+			span := tx.StartSpanOptions(s.Name, s.Type, apm.SpanOptions{SpanID: newSpanID(r), Start: opts.Start})
+			setLabels(&span.Context, runId, labels, s.Labels)
+			if d := millis(s.Duration); d > 0 {
+				span.Duration = d
+			}
+			span.End()
+		}
+		setLabels(&tx.Context, runId, labels, t.Labels)
+		if d > 0 {
+			tx.Duration = d
+		}
+		tx.End()
+	}
+	if x := e.Error; x != nil {
+		err := sender.NewError(externalErr{x.Message, x.Type})
+		r.Read(err.ID[:])
+		if x.Culprit != "" {
+			err.Culprit = x.Culprit
+		}
+		setLabels(&err.Context, runId, labels, x.Labels)
+		err.Send()
+	}
+}
+
+// setLabels sets the run_id label of an event, plus the given labels, later ones overriding earlier ones.
+func setLabels(ctx interface{ SetTag(k, v string) }, runId string, labels ...map[string]string) {
+	for _, l := range labels {
+		for k, v := range l {
+			ctx.SetTag(k, v)
+		}
+	}
+	ctx.SetTag("run_id", runId)
+}
+
+// millis returns a duration given in milliseconds.
+func millis(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,128 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/script"
+)
+
+// Generator returns a function that creates events with the given sender as defined by the input,
+// until ctx is done or there is nothing else to generate.
+// It returns nil if the input doesn't ask for any event.
+type Generator func(sender agent.Sender, input models.Input) func(ctx context.Context) error
+
+var generators = make(map[string]Generator)
+
+// RegisterGenerator makes a generator of events available by name, as an event type.
+// It panics if the name is already taken.
+func RegisterGenerator(name string, g Generator) {
+	if _, ok := generators[name]; ok {
+		panic("generator already registered: " + name)
+	}
+	generators[name] = g
+}
+
+// EventTypes returns the names of all the registered generators, sorted.
+func EventTypes() []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterGenerator("transaction", generateTransactions)
+	RegisterGenerator("error", generateErrors)
+}
+
+// Validate checks that the input and all its targets are valid, and only refer to registered event types.
+func Validate(input models.Input) error {
+	if err := input.Validate(); err != nil {
+		return err
+	}
+	for _, in := range append([]models.Input{input}, input.Targets...) {
+		if _, err := loadRateCurve(in.RateCurve); err != nil {
+			return err
+		}
+		if _, err := parsePhases(in.Phases); err != nil {
+			return err
+		}
+		if _, err := loadNameCatalog(in.TransactionNames); err != nil {
+			return err
+		}
+		if in.ScriptFile != "" {
+			feeds, err := script.LoadFeeds(in.Feeds, in.FeedOrder == "sample")
+			if err != nil {
+				return err
+			}
+			if _, err := script.Load(in.ScriptFile, in.Seed, feeds); err != nil {
+				return err
+			}
+		}
+		for _, name := range in.EventTypes {
+			if _, ok := generators[name]; !ok {
+				return fmt.Errorf("unknown event type %q, must be one of: %s", name, strings.Join(EventTypes(), ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// addGenerators adds to the worker the generators of the event types in the input, or of all types if none given.
+// Every event type is generated by GeneratorGoroutines goroutines, each one with its share of the workload,
+// locked to their own OS thread if LockThreads. They finish independently, after generating their share,
+// so that the first one to finish doesn't stop the rest.
+// Generators can track their pace with the monitor of the worker, carried by their context.
+func (w *worker) addGenerators(input models.Input) {
+	names := input.EventTypes
+	if len(names) == 0 {
+		names = EventTypes()
+	}
+	n := input.GeneratorGoroutines
+	if n < 1 {
+		n = 1
+	}
+	w.pacing = &pacingMonitor{}
+	for _, name := range names {
+		var shards []func(ctx context.Context) error
+		for i := 0; i < n; i++ {
+			if generate := generators[name](w.Sender, input.Shard(i, n)); generate != nil {
+				shards = append(shards, generate)
+			}
+		}
+		if len(shards) == 0 {
+			continue
+		}
+		w.Add(func(ctx context.Context) error {
+			ctx, cancel := context.WithCancel(withPacing(ctx, w.pacing))
+			defer cancel()
+			errs := make(chan error, len(shards))
+			for _, generate := range shards {
+				go func(generate func(ctx context.Context) error) {
+					if input.LockThreads {
+						runtime.LockOSThread()
+						defer runtime.UnlockOSThread()
+					}
+					errs <- generate(ctx)
+				}(generate)
+			}
+			var err error
+			for range shards {
+				// the first error stops all the shards
+				if serr := <-errs; serr != nil && err == nil {
+					err = serr
+					cancel()
+				}
+			}
+			return err
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/agent"
+)
+
+// httpContext populates transactions with a made-up HTTP request, including headers and body,
+// to exercise apm-server sanitization and the mapping pressure of context fields.
+type httpContext struct {
+	headers int
+	body    []byte
+}
+
+func newHTTPContext(headers int, bodySize int64) *httpContext {
+	if headers <= 0 && bodySize <= 0 {
+		return nil
+	}
+	var body []byte
+	if bodySize > 0 {
+		// password is sanitized by default by apm-server
+		prefix := `{"password":"generated","data":"`
+		suffix := `"}`
+		padding := int(bodySize) - len(prefix) - len(suffix)
+		if padding < 0 {
+			padding = 0
+		}
+		body = []byte(prefix + strings.Repeat("x", padding) + suffix)
+	}
+	return &httpContext{headers, body}
+}
+
+// set adds the HTTP request context to a transaction, if configured.
+func (c *httpContext) set(sender agent.Sender, tx *apm.Transaction, n int) {
+	if c == nil {
+		return
+	}
+	var body io.Reader
+	if c.body != nil {
+		body = bytes.NewReader(c.body)
+	}
+	req, _ := http.NewRequest("POST", fmt.Sprintf("http://generated.local/generated/%d?q=generated", n), body)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer generated")
+	for i := 0; i < c.headers; i++ {
+		req.Header.Set(fmt.Sprintf("X-Generated-%d", i), "generated")
+	}
+	bc := sender.CaptureHTTPRequestBody(req)
+	if req.Body != nil {
+		ioutil.ReadAll(req.Body)
+	}
+	tx.Context.SetHTTPRequest(req)
+	tx.Context.SetHTTPRequestBody(bc)
+	tx.Context.SetHTTPStatusCode(http.StatusOK)
+}
@@ -0,0 +1,124 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/server"
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
+)
+
+// idleMetadata returns the metadata of the intake requests of an idle agent, with its own service name.
+func idleMetadata(input models.Input, i int) types.M {
+	service := types.M{
+		"name":     fmt.Sprintf("%s-idle-%d", input.ServiceName, i+1),
+		"agent":    types.M{"name": "go", "version": "idle"},
+		"language": types.M{"name": "go"},
+	}
+	if input.ServiceEnvironment != "" {
+		service["environment"] = input.ServiceEnvironment
+	}
+	return types.M{"metadata": types.M{"service": service}}
+}
+
+// heartbeat returns the body of an intake request with the metadata of an idle agent and a single metricset,
+// as agents send periodically even when their service is idle.
+func heartbeat(metadata types.M, runId string) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(metadata)
+	enc.Encode(types.M{"metricset": types.M{
+		"timestamp": time.Now().UnixNano() / int64(time.Microsecond),
+		"tags":      types.M{"run_id": runId},
+		"samples":   types.M{"golang.goroutines": types.M{"value": 1}},
+	}})
+	return buf.Bytes()
+}
+
+// simulateIdleAgents returns a function simulating IdleAgents agents with almost no traffic, each of them with its
+// own service name and keep-alive connection to apm-server, over which it sends a heartbeat every
+// IdleHeartbeatInterval, until its context is done. Agents start at random times within the first interval,
+// so that requests are spread.
+func simulateIdleAgents(input models.Input, stats *pollStats) func(ctx context.Context) error {
+	rnd := newRand(input.Seed, "idle")
+	return func(ctx context.Context) error {
+		u := strings.TrimSuffix(input.ApmServerUrl, "/") + "/intake/v2/events"
+		auth := server.Authorization(input.ApmServerSecret, input.APIKey)
+		var wg sync.WaitGroup
+		for i := 0; i < input.IdleAgents; i++ {
+			metadata := idleMetadata(input, i)
+			delay := time.Duration(rnd.Int63n(int64(input.IdleHeartbeatInterval)))
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				// a transport per agent, so that each one keeps a connection of its own open
+				transport := &http.Transport{Proxy: http.ProxyFromEnvironment, MaxIdleConnsPerHost: 1}
+				defer transport.CloseIdleConnections()
+				client := &http.Client{Transport: transport, Timeout: pollTimeout}
+				for {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(delay):
+					}
+					delay = input.IdleHeartbeatInterval
+					req, err := http.NewRequest("POST", u, bytes.NewReader(heartbeat(metadata, input.RunId)))
+					if err != nil {
+						stats.add(0, err, 0)
+						return
+					}
+					req.Header.Set("Content-Type", "application/x-ndjson")
+					if auth != "" {
+						req.Header.Set("Authorization", auth)
+					}
+					start := time.Now()
+					var status int
+					resp, err := client.Do(req)
+					if err == nil {
+						// drained, so that the connection is reused
+						io.Copy(ioutil.Discard, resp.Body)
+						resp.Body.Close()
+						status = resp.StatusCode
+					}
+					stats.add(status, err, time.Since(start))
+				}
+			}()
+		}
+		wg.Wait()
+		return nil
+	}
+}
+
+// addIdleAgents adds to the report and prints the heartbeats sent by idle agents, if any.
+func addIdleAgents(stats *pollStats, input models.Input, report models.Report, out io.Writer) models.Report {
+	if stats == nil {
+		return report
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	report.IdleAgents = input.IdleAgents
+	report.IdleHeartbeats = stats.requests
+	report.IdleHeartbeatsFailed = stats.failed
+	report.IdleHeartbeatLatencyP99 = numbers.Percentile(stats.latencies, 99)
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("idle agents", report.IdleAgents)
+	metrics.Add(" - heartbeats", report.IdleHeartbeats)
+	metrics.Add(" - failed", report.IdleHeartbeatsFailed)
+	if report.IdleHeartbeatLatencyP99 != nil {
+		metrics.Add("heartbeat latency p99 (ms)", *report.IdleHeartbeatLatencyP99)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,64 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// pollInfo returns a function sending a request to the apm-server root endpoint every InfoInterval,
+// as agents do on startup to learn the server version, until its context is done.
+// Requests are sent regardless of previous ones having completed, so that slow responses don't lower the rate.
+func pollInfo(input models.Input, stats *pollStats) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		client := &http.Client{Timeout: pollTimeout}
+		u := strings.TrimSuffix(input.ApmServerUrl, "/") + "/"
+		ticker := time.NewTicker(input.InfoInterval)
+		defer ticker.Stop()
+		var wg sync.WaitGroup
+		defer wg.Wait()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				start := time.Now()
+				status, _, err := serverGet(client, input, u, nil)
+				stats.add(status, err, time.Since(start))
+			}()
+		}
+	}
+}
+
+// addInfoPolling adds to the report and prints the server information requests sent, if any.
+func addInfoPolling(stats *pollStats, report models.Report, out io.Writer) models.Report {
+	if stats == nil {
+		return report
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	report.InfoRequests = stats.requests
+	report.InfoFailed = stats.failed
+	report.InfoLatencyP99 = numbers.Percentile(stats.latencies, 99)
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("info requests", report.InfoRequests)
+	metrics.Add(" - failed", report.InfoFailed)
+	if report.InfoLatencyP99 != nil {
+		metrics.Add("info latency p99 (ms)", *report.InfoLatencyP99)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+)
+
+// snapshot returns the stats of the worker so far, since start.
+func (w *worker) snapshot(start, now time.Time) Result {
+	return Result{TracerStats: w.Stats(), TransportStats: w.TransportStats(), Start: start, End: now}
+}
+
+// intervals returns the stats of the intervals of time of a run delimited by snapshots of its stats:
+// from its start until the first snapshot, between consecutive snapshots, and from the last snapshot
+// until the end of the result. Events sent after generation stopped, while flushing, are accounted to the last interval.
+func intervals(result Result, snapshots []Result) []models.Interval {
+	bounds := append([]Result{{End: result.Start}}, snapshots...)
+	bounds = append(bounds, result)
+	stats := make([]models.Interval, len(bounds)-1)
+	latencies := make([][]float64, len(stats))
+	for _, s := range result.Samples {
+		if s.Timestamp.Before(result.Start) {
+			continue
+		}
+		// index of the first interval ending after the request started, or the last one
+		i := sort.Search(len(stats)-1, func(i int) bool { return s.Timestamp.Before(bounds[i+1].End) })
+		stats[i].Requests++
+		if s.Status == 0 || s.Status >= 300 {
+			stats[i].FailedRequests++
+		}
+		if s.Status > 0 {
+			latencies[i] = append(latencies[i], float64(s.Duration)/float64(time.Millisecond))
+		}
+	}
+	for i := range stats {
+		from, to, interval := bounds[i], bounds[i+1], &stats[i]
+		interval.Start = from.End.Sub(result.Start).Seconds()
+		interval.End = to.End.Sub(result.Start).Seconds()
+		interval.EventsDropped = dropped(to) - dropped(from)
+		if seconds := to.End.Sub(from.End).Seconds(); seconds > 0 {
+			interval.EventsSentPerSecond = float64(to.EventsSent()-from.EventsSent()) / seconds
+			if result.Verbose {
+				interval.EventsAcceptedPerSecond = numbers.Div(float64(to.Accepted-from.Accepted), seconds)
+			}
+		}
+		if result.Verbose {
+			interval.EventsRejected = to.Rejected - from.Rejected
+		}
+		interval.RequestLatencyP50 = numbers.Percentile(latencies[i], 50)
+		interval.RequestLatencyP99 = numbers.Percentile(latencies[i], 99)
+	}
+	return stats
+}
+
+func dropped(r Result) uint64 {
+	return r.TransactionsDropped + r.SpansDropped + r.ErrorsDropped
+}
+
+// bucketRecorder snapshots the stats of a worker at a fixed interval.
+type bucketRecorder struct {
+	size time.Duration
+
+	mu        sync.Mutex
+	snapshots []Result
+}
+
+// newBucketRecorder returns a recorder of the buckets of time given by the input, or nil if not given.
+func newBucketRecorder(input models.Input) *bucketRecorder {
+	if input.BucketSize <= 0 {
+		return nil
+	}
+	return &bucketRecorder{size: input.BucketSize}
+}
+
+// recordBuckets adds to the worker a routine snapshotting its stats at the end of every bucket.
+func (w *worker) recordBuckets(b *bucketRecorder) {
+	if b == nil {
+		return
+	}
+	w.Add(func(ctx context.Context) error {
+		start := time.Now()
+		ticker := time.NewTicker(b.size)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case now := <-ticker.C:
+				b.mu.Lock()
+				b.snapshots = append(b.snapshots, w.snapshot(start, now))
+				b.mu.Unlock()
+			}
+		}
+	})
+}
+
+// addBuckets adds to the report the stats of every bucket of time of the run, if recorded.
+// The last bucket is partial, and includes the events sent while flushing.
+func addBuckets(b *bucketRecorder, result Result, report models.Report, out io.Writer) models.Report {
+	if b == nil {
+		return report
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	report.BucketSize = b.size.Seconds()
+	report.Buckets = intervals(result, b.snapshots)
+	fmt.Fprintf(out, "%d buckets of %s recorded in the report\n", len(report.Buckets), b.size)
+	return report
+}
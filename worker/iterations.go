@@ -0,0 +1,70 @@
+package worker
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// RunIterations executes the same load test work input.Iterations times, waiting input.Cooldown between them,
+// and prints the results of each iteration plus their statistics across iterations.
+// It stops at the first error, except for failed assertions, which are returned after all iterations complete.
+func RunIterations(input models.Input) ([]models.Report, error) {
+	var reports []models.Report
+	var failed error
+	for i := 1; i <= input.Iterations; i++ {
+		if i > 1 && input.Cooldown > 0 {
+			fmt.Printf("cooling down for %s\n", input.Cooldown)
+			time.Sleep(input.Cooldown)
+		}
+		fmt.Printf("==== iteration %d/%d\n", i, input.Iterations)
+		report, err := Run(iterationInput(input, i))
+		if _, ok := err.(ThresholdError); ok {
+			failed = err
+		} else if err != nil {
+			if report.ReportId != "" {
+				// aborted iterations are reported as far as they went
+				reports = append(reports, report)
+			}
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+
+	fmt.Printf("==== %d iterations\n", len(reports))
+	fmt.Println(iterationStats(reports))
+	return reports, failed
+}
+
+// iterationInput returns the input of the ith iteration, seeded after it so that iterations send different IDs.
+func iterationInput(input models.Input, i int) models.Input {
+	iteration := input.Reseed(fmt.Sprintf("iteration %d", i))
+	iteration.Iteration = i
+	return iteration
+}
+
+// iterationStats formats the mean, standard deviation, min and max of the main metrics of reports.
+func iterationStats(reports []models.Report) string {
+	metrics := strcoll.NewTuples()
+	add := func(name string, value func(models.Report) *float64) {
+		var xs []float64
+		for _, r := range reports {
+			if v := value(r); v != nil {
+				xs = append(xs, *v)
+			}
+		}
+		if s := numbers.Summarize(xs); s != nil {
+			metrics.Add(name, fmt.Sprintf("mean %.2f, stddev %.2f, min %.2f, max %.2f", s.Mean, s.StdDev, s.Min, s.Max))
+		}
+	}
+	add("events sent per second", func(r models.Report) *float64 { return r.EventSendRate })
+	add("events accepted per second", func(r models.Report) *float64 { return r.EventAcceptRate })
+	add("events indexed per second", func(r models.Report) *float64 { return r.EventIndexRate })
+	add("requests per second", func(r models.Report) *float64 { return r.RequestRate })
+	add("request latency p99 (ms)", func(r models.Report) *float64 { return r.RequestLatencyP99 })
+	add("event loss %", func(r models.Report) *float64 { return r.EventLossRatio })
+	return metrics.Format(30)
+}
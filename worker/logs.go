@@ -0,0 +1,227 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+const (
+	logPollInterval = 250 * time.Millisecond
+	// maxLogMessages bounds the number of distinct log messages kept, messages seen after that are only counted.
+	maxLogMessages = 100
+	// topLogMessages is the number of most frequent log messages reported
+	topLogMessages = 10
+	// maxLogMessageLength is the length log messages are truncated to
+	maxLogMessageLength = 200
+)
+
+// logScraper counts the errors and warnings logged by apm-server while it runs,
+// following a log file or the logs of a docker container.
+type logScraper struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu       sync.Mutex
+	errors   uint64
+	warnings uint64
+	messages map[string]uint64
+}
+
+// startLogScraper starts following apm-server logs from source, either a file path or docker:<container>,
+// and returns nil if source is empty.
+func startLogScraper(logger *log.Logger, source string) *logScraper {
+	if source == "" {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &logScraper{
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		messages: make(map[string]uint64),
+	}
+	go func() {
+		defer close(s.done)
+		var err error
+		if strings.HasPrefix(source, "docker:") {
+			err = s.followContainer(ctx, strings.TrimPrefix(source, "docker:"))
+		} else {
+			err = s.followFile(ctx, source)
+		}
+		if err != nil {
+			logger.Println("error scraping apm-server logs: " + err.Error())
+		}
+	}()
+	return s
+}
+
+// followFile reads the lines appended to a file until ctx is done, and then the remaining ones.
+func (s *logScraper) followFile(ctx context.Context, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	r := bufio.NewReader(f)
+	var partial string
+	for stopping := false; ; {
+		line, err := r.ReadString('\n')
+		if err == nil {
+			s.add(partial + line)
+			partial = ""
+			continue
+		}
+		if err != io.EOF {
+			return err
+		}
+		partial += line
+		if stopping {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			// read what was logged until now before returning
+			stopping = true
+		case <-time.After(logPollInterval):
+		}
+	}
+}
+
+// followContainer reads the logs of a docker container with the docker CLI, until ctx is done.
+func (s *logScraper) followContainer(ctx context.Context, container string) error {
+	cmd := exec.CommandContext(ctx, "docker", "logs", "--follow", "--since", time.Now().Format(time.RFC3339), container)
+	pr, pw := io.Pipe()
+	cmd.Stdout, cmd.Stderr = pw, pw
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		pw.CloseWithError(cmd.Wait())
+	}()
+	scanner := bufio.NewScanner(pr)
+	for scanner.Scan() {
+		s.add(scanner.Text())
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return scanner.Err()
+}
+
+// add counts a log line if it is an error or a warning, in either JSON or console format.
+func (s *logScraper) add(line string) {
+	level, message := parseLogLine(strings.TrimSpace(line))
+	if level != "error" && level != "warn" {
+		return
+	}
+	if len(message) > maxLogMessageLength {
+		message = message[:maxLogMessageLength]
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if level == "error" {
+		s.errors++
+	} else {
+		s.warnings++
+	}
+	if _, ok := s.messages[message]; ok || len(s.messages) < maxLogMessages {
+		s.messages[message]++
+	}
+}
+
+// parseLogLine returns the lowercase level and message of a log line, as logged by beats in JSON,
+// eg. {"log.level":"error","message":"..."}, or in console format, eg. 2021-02-01T10:00:00.000Z ERROR [logger] file.go:10 message.
+func parseLogLine(line string) (string, string) {
+	if strings.HasPrefix(line, "{") {
+		var doc map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &doc); err != nil {
+			return "", ""
+		}
+		level, _ := doc["log.level"].(string)
+		if level == "" {
+			level, _ = doc["level"].(string)
+		}
+		message, _ := doc["message"].(string)
+		return normalizeLevel(level), message
+	}
+	fields := strings.Fields(line)
+	for i, field := range fields {
+		level := normalizeLevel(field)
+		if level != "error" && level != "warn" {
+			continue
+		}
+		rest := fields[i+1:]
+		// skip the logger name and caller
+		for len(rest) > 1 && (strings.HasPrefix(rest[0], "[") || strings.Contains(rest[0], ".go:")) {
+			rest = rest[1:]
+		}
+		return level, strings.Join(rest, " ")
+	}
+	return "", ""
+}
+
+func normalizeLevel(level string) string {
+	switch strings.ToUpper(level) {
+	case "ERROR":
+		return "error"
+	case "WARN", "WARNING":
+		return "warn"
+	default:
+		return strings.ToLower(level)
+	}
+}
+
+// stop stops following the logs, and returns the errors and warnings counted,
+// and the most frequent messages, most frequent first.
+func (s *logScraper) stop() (uint64, uint64, []string) {
+	s.cancel()
+	<-s.done
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var messages []string
+	for m := range s.messages {
+		messages = append(messages, m)
+	}
+	sort.Slice(messages, func(i, j int) bool {
+		if s.messages[messages[i]] != s.messages[messages[j]] {
+			return s.messages[messages[i]] > s.messages[messages[j]]
+		}
+		return messages[i] < messages[j]
+	})
+	if len(messages) > topLogMessages {
+		messages = messages[:topLogMessages]
+	}
+	return s.errors, s.warnings, messages
+}
+
+// addLogs stops the scraper, if any, and adds to the report and prints the errors and warnings logged by apm-server.
+func addLogs(scraper *logScraper, report models.Report, out io.Writer) models.Report {
+	if scraper == nil {
+		return report
+	}
+	report.ApmLogErrors, report.ApmLogWarnings, report.ApmLogMessages = scraper.stop()
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("apm-server errors logged", report.ApmLogErrors)
+	metrics.Add("apm-server warnings logged", report.ApmLogWarnings)
+	if len(report.ApmLogMessages) > 0 {
+		metrics.Add("apm-server log messages", report.ApmLogMessages)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+)
+
+func init() {
+	RegisterGenerator("long-transaction", generateLongTransactions)
+}
+
+// generateLongTransactions starts LongTransactions transactions that stay open until ctx is done,
+// each one ending a span every LongSpanInterval meanwhile, as long lived requests or background jobs do.
+// Spans are sent as they end, long before their transaction.
+func generateLongTransactions(sender agent.Sender, input models.Input) func(ctx context.Context) error {
+	if input.LongTransactions <= 0 {
+		return nil
+	}
+	rnd := newRand(input.Seed, "long-transaction")
+	fuzzer := newStringFuzzer(input.EdgeStringRatio, rnd)
+	return func(ctx context.Context) error {
+		txs := make([]*apm.Transaction, input.LongTransactions)
+		for i := range txs {
+			txs[i] = sender.StartTransactionOptions(fuzzer.fuzz("long-running"), "gen", apm.TransactionOptions{
+				TraceContext:  newTraceContext(rnd),
+				TransactionID: newSpanID(rnd),
+			})
+			setLabels(&txs[i].Context, input.RunId, input.Labels)
+		}
+		ticker := time.NewTicker(input.LongSpanInterval)
+		defer ticker.Stop()
+		var spans int
+		for {
+			select {
+			case <-ctx.Done():
+				for _, tx := range txs {
+					tx.Context.SetTag("spans", strconv.Itoa(spans))
+					fuzzer.label(&tx.Context)
+					tx.End()
+				}
+				return nil
+			case <-ticker.C:
+			}
+			for _, tx := range txs {
+				span := tx.StartSpanOptions(fuzzer.fuzz("I'm a streamed span"), "gen.era.ted",
+					apm.SpanOptions{SpanID: newSpanID(rnd)})
+				setLabels(&span.Context, input.RunId, input.Labels)
+				span.End()
+			}
+			spans++
+		}
+	}
+}
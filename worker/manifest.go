@@ -0,0 +1,41 @@
+package worker
+
+import (
+	"log"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/reports"
+)
+
+// manifestReporter writes the manifest of the run of a report to the ManifestFile, if given, and alongside
+// the report in the ReportsDir, if given.
+type manifestReporter struct {
+	noProgress
+	logger *log.Logger
+	input  models.Input
+}
+
+func newManifestReporter(logger *log.Logger, input models.Input) Reporter {
+	if input.ManifestFile == "" && input.ReportsDir == "" {
+		return nil
+	}
+	return manifestReporter{logger: logger, input: input}
+}
+
+func (r manifestReporter) Report(report models.Report, _ Result) error {
+	manifest := models.NewManifest(report)
+	if r.input.ManifestFile != "" {
+		path := targetPath(r.input.ManifestFile, r.input.TargetName)
+		if err := reports.WriteManifest(path, manifest); err != nil {
+			r.logger.Println(err.Error())
+		} else {
+			r.logger.Println("manifest written to " + path)
+		}
+	}
+	if r.input.ReportsDir != "" {
+		if err := reports.Dir(r.input.ReportsDir).SaveManifest(manifest); err != nil {
+			r.logger.Println(err.Error())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/server"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// mirrorer is implemented by senders mirroring requests to a second apm-server.
+type mirrorer interface {
+	MirrorTransportStats() (agent.TransportStats, bool)
+}
+
+// mirrorTarget is the second apm-server receiving a copy of every request, as seen at the start of the run.
+type mirrorTarget struct {
+	logger        *log.Logger
+	input         models.Input
+	conn          es.Connection
+	initialStatus server.Status
+}
+
+// newMirrorTarget returns the mirror apm-server of the input along with its current status,
+// or nil if requests are not mirrored.
+// Its input is the one of the run, pointed at the mirror apm-server and the Elasticsearch it uses,
+// which defaults to the one of the apm-server under test.
+func newMirrorTarget(logger *log.Logger, input models.Input) *mirrorTarget {
+	if input.MirrorUrl == "" {
+		return nil
+	}
+	mirrorInput := input
+	mirrorInput.ApmServerUrl, mirrorInput.ApmServerSecret, mirrorInput.APIKey =
+		input.MirrorUrl, input.MirrorSecret, input.MirrorAPIKey
+	mirrorInput.MirrorUrl, mirrorInput.Cloud = "", nil
+	if input.MirrorElasticsearchUrl != "" {
+		mirrorInput.ApmElasticsearchUrl = input.MirrorElasticsearchUrl
+		mirrorInput.ApmElasticsearchAuth = input.MirrorElasticsearchAuth
+	}
+	conn, err := es.NewConnection(mirrorInput.ApmElasticsearchUrl, mirrorInput.ApmElasticsearchAuth)
+	if err != nil {
+		logger.Println(err.Error())
+	}
+	return &mirrorTarget{
+		logger: logger,
+		input:  mirrorInput,
+		conn:   conn,
+		initialStatus: server.GetStatus(logger, server.Authorization(input.MirrorSecret, input.MirrorAPIKey),
+			expvarUrl(mirrorInput), conn),
+	}
+}
+
+// addMirror adds to the report the report of the mirror apm-server, if any, created from the requests mirrored
+// and its status now, and prints how both apm-servers compare.
+func addMirror(m *mirrorTarget, result Result, report models.Report, out io.Writer) models.Report {
+	if m == nil || result.Mirror == nil {
+		return report
+	}
+	mirrorResult := result
+	mirrorResult.TransportStats, mirrorResult.Mirror = *result.Mirror, nil
+	finalStatus := server.GetStatus(m.logger, server.Authorization(m.input.ApmServerSecret, m.input.APIKey),
+		expvarUrl(m.input), m.conn)
+	mirror := createReport(report.ReportId, m.input, mirrorResult, m.initialStatus, finalStatus, ioutil.Discard)
+	// the agent only accounts for the requests to the apm-server under test
+	mirror.FailedRequests = 0
+	for _, s := range result.Mirror.Samples {
+		if s.Status == 0 || s.Status >= 300 {
+			mirror.FailedRequests++
+		}
+	}
+	mirror = mirror.WithDerivedAttributes()
+	report.Mirror = &mirror
+
+	fmt.Fprintf(out, "%s vs mirror %s\n", report.ApmServerUrl, mirror.ApmServerUrl)
+	metrics := strcoll.NewTuples()
+	add := func(name string, value func(models.Report) *float64) {
+		metrics.Add(name, optional(value(report))+" vs "+optional(value(mirror)))
+	}
+	add("events accepted per second", func(r models.Report) *float64 { return r.EventAcceptRate })
+	add("events indexed per second", func(r models.Report) *float64 { return r.EventIndexRate })
+	add("accepted / sent", func(r models.Report) *float64 { return r.EventsAcceptedRatio })
+	add("event loss %", func(r models.Report) *float64 { return r.EventLossRatio })
+	add("request latency p50 (ms)", func(r models.Report) *float64 { return r.RequestLatencyP50 })
+	add("request latency p99 (ms)", func(r models.Report) *float64 { return r.RequestLatencyP99 })
+	add("request success ratio", func(r models.Report) *float64 { return r.RequestSuccessRatio })
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
+
+func optional(f *float64) string {
+	if f == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f", *f)
+}
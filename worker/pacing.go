@@ -0,0 +1,166 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+const (
+	// intervals below this mean "as fast as possible", so their pacing is not tracked
+	minPacedInterval = time.Microsecond
+	// delays sampled per generator to compute their distribution
+	pacingSampleSize = 10000
+	// fraction of the requested rate below which generators are considered behind
+	onPaceRatio = 0.95
+)
+
+type pacingKey struct{}
+
+// pacingMonitor tracks how closely generators keep up with the rate requested from them.
+type pacingMonitor struct {
+	mu    sync.Mutex
+	paces []*pace
+}
+
+// withPacing returns a context carrying the monitor, for generators to track their pace with.
+func withPacing(ctx context.Context, m *pacingMonitor) context.Context {
+	return context.WithValue(ctx, pacingKey{}, m)
+}
+
+// trackPace returns the pace of a generator of events named after their type, requested to generate one every interval,
+// or nil if ctx doesn't carry a monitor or the interval means "as fast as possible".
+// Generators call tick on it every time they generate an event, from a single goroutine.
+// Delays are sampled with randomness derived from seed.
+func trackPace(ctx context.Context, name string, interval time.Duration, seed int64) *pace {
+	m, ok := ctx.Value(pacingKey{}).(*pacingMonitor)
+	if !ok || interval < minPacedInterval {
+		return nil
+	}
+	p := &pace{name: name, interval: interval, rand: newRand(seed, "pacing "+name)}
+	m.mu.Lock()
+	m.paces = append(m.paces, p)
+	m.mu.Unlock()
+	return p
+}
+
+// pace holds when a generator generated events, compared to when it should have generated them:
+// at a regular interval since its first event.
+type pace struct {
+	name     string
+	interval time.Duration
+	rand     *rand.Rand
+
+	start, last time.Time
+	count       int
+	// sample of the delays of events from their scheduled time, in milliseconds
+	delays []float64
+	// events generated every second since the first one
+	perSecond []int
+}
+
+func (p *pace) tick() {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	if p.count == 0 {
+		p.start = now
+	}
+	delay := now.Sub(p.start.Add(time.Duration(p.count) * p.interval))
+	if delay < 0 {
+		delay = 0
+	}
+	ms := float64(delay) / float64(time.Millisecond)
+	if len(p.delays) < pacingSampleSize {
+		p.delays = append(p.delays, ms)
+	} else if i := p.rand.Intn(p.count + 1); i < pacingSampleSize {
+		p.delays[i] = ms
+	}
+	second := int(now.Sub(p.start) / time.Second)
+	for len(p.perSecond) <= second {
+		p.perSecond = append(p.perSecond, 0)
+	}
+	p.perSecond[second]++
+	p.count++
+	p.last = now
+}
+
+// stats summarizes the pace of a generator, given the events of its type dropped by the agent and generated in total.
+// Generators falling behind the requested rate are limited by hey-apm itself, while those keeping up whose events
+// are dropped by the agent, waiting to send them, are limited by apm-server.
+func (p *pace) stats(dropped, generated uint64) models.Pacing {
+	s := models.Pacing{
+		Generator:     p.name,
+		RequestedRate: float64(time.Second) / float64(p.interval),
+		DelayP50:      numbers.Percentile(p.delays, 50),
+		DelayP99:      numbers.Percentile(p.delays, 99),
+	}
+	if p.count > 1 {
+		s.AchievedRate = float64(p.count-1) / p.last.Sub(p.start).Seconds()
+	}
+	// the last second is partial
+	if len(p.perSecond) > 1 {
+		worst := p.perSecond[0]
+		for _, n := range p.perSecond[:len(p.perSecond)-1] {
+			if n < worst {
+				worst = n
+			}
+		}
+		rate := float64(worst)
+		s.WorstSecondRate = &rate
+	}
+	switch {
+	case p.count < 2:
+	case s.AchievedRate < onPaceRatio*s.RequestedRate:
+		s.LimitedBy = "hey-apm"
+	case generated > 0 && float64(dropped) > (1-onPaceRatio)*float64(generated):
+		s.LimitedBy = "apm-server"
+	}
+	return s
+}
+
+// addPacing adds to the report and prints how closely generators kept up with their requested rate.
+func addPacing(m *pacingMonitor, result Result, report models.Report, out io.Writer) models.Report {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	metrics := strcoll.NewTuples()
+	for _, p := range m.paces {
+		if p.count == 0 {
+			continue
+		}
+		var dropped, generated uint64
+		switch p.name {
+		case "transaction":
+			dropped, generated = result.TransactionsDropped, result.TransactionsSent+result.TransactionsDropped
+		case "error":
+			dropped, generated = result.ErrorsDropped, result.ErrorsSent+result.ErrorsDropped
+		}
+		s := p.stats(dropped, generated)
+		report.Pacing = append(report.Pacing, s)
+
+		metrics.Add(p.name+" rate requested", fmt.Sprintf("%.2f/s", s.RequestedRate))
+		metrics.Add(" - achieved", fmt.Sprintf("%.2f/s", s.AchievedRate))
+		if s.WorstSecondRate != nil {
+			metrics.Add(" - worst second", fmt.Sprintf("%.0f/s", *s.WorstSecondRate))
+		}
+		if s.DelayP99 != nil {
+			metrics.Add(" - delay p50 (ms)", *s.DelayP50)
+			metrics.Add(" - delay p99 (ms)", *s.DelayP99)
+		}
+		if s.LimitedBy != "" {
+			metrics.Add(" - limited by", s.LimitedBy)
+		}
+	}
+	if s := metrics.Format(30); s != "" {
+		fmt.Fprintln(out, s)
+	}
+	return report
+}
@@ -0,0 +1,229 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// recoveryTolerance is how much higher than before a spike the median request latency can be, to have recovered
+const recoveryTolerance = 1.1
+
+// ratePhase is a phase of a run, multiplying the rate of generators from one value at its start
+// linearly up to another one at its end.
+type ratePhase struct {
+	name     string
+	duration time.Duration
+	from, to float64
+}
+
+// parsePhases parses comma separated phases as name:duration:multiplier, or name:duration:from-to to ramp
+// the multiplier, eg. "ramp:1m:0-1,hold:5m:1".
+func parsePhases(s string) ([]ratePhase, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var phases []ratePhase
+	for _, spec := range strings.Split(s, ",") {
+		parts := strings.Split(strings.TrimSpace(spec), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid phase %q, must be name:duration:multiplier or name:duration:from-to", spec)
+		}
+		p := ratePhase{name: parts[0]}
+		var err error
+		if p.duration, err = time.ParseDuration(parts[1]); err != nil || p.duration <= 0 {
+			return nil, fmt.Errorf("invalid phase %q, its duration must be positive", spec)
+		}
+		multipliers := strings.SplitN(parts[2], "-", 2)
+		if p.from, err = strconv.ParseFloat(multipliers[0], 64); err != nil || p.from < 0 {
+			return nil, fmt.Errorf("invalid phase %q, multipliers must not be negative numbers", spec)
+		}
+		p.to = p.from
+		if len(multipliers) == 2 {
+			if p.to, err = strconv.ParseFloat(multipliers[1], 64); err != nil || p.to < 0 {
+				return nil, fmt.Errorf("invalid phase %q, multipliers must not be negative numbers", spec)
+			}
+		}
+		phases = append(phases, p)
+	}
+	if peakMultiplier(phases) == 0 {
+		return nil, fmt.Errorf("invalid phases %q, no positive multipliers", s)
+	}
+	return phases, nil
+}
+
+// runPhases returns the phases of the run given by the input, either before, during and after a spike
+// or as given by Phases, or nil if it has none.
+func runPhases(input models.Input) []ratePhase {
+	if input.SpikeDuration > 0 {
+		return []ratePhase{
+			{"pre-spike", input.SpikeAt, 1, 1},
+			{"spike", input.SpikeDuration, input.SpikeFactor, input.SpikeFactor},
+			{"recovery", 0, 1, 1},
+		}
+	}
+	// validated with the input
+	phases, _ := parsePhases(input.Phases)
+	return phases
+}
+
+// phaseMultiplier returns the multiplier of the rate at some time since the start of the phases,
+// the last one lasting until the run stops.
+func phaseMultiplier(phases []ratePhase, elapsed time.Duration) float64 {
+	for i, p := range phases {
+		if elapsed < p.duration || i == len(phases)-1 {
+			f := 1.0
+			if p.duration > 0 {
+				f = math.Min(1, float64(elapsed)/float64(p.duration))
+			}
+			return p.from + f*(p.to-p.from)
+		}
+		elapsed -= p.duration
+	}
+	return 1
+}
+
+// peakMultiplier returns the highest multiplier of the rate in the phases.
+func peakMultiplier(phases []ratePhase) float64 {
+	var peak float64
+	for _, p := range phases {
+		peak = math.Max(peak, math.Max(p.from, p.to))
+	}
+	return peak
+}
+
+// phaseRecorder snapshots the stats of a worker as each phase of a run starts.
+type phaseRecorder struct {
+	names []string
+	// time since the start of the run at which each phase starts, the first one at 0
+	starts []time.Duration
+	// whether the last phase is the recovery from a spike
+	recovery bool
+
+	mu        sync.Mutex
+	snapshots []Result
+}
+
+// newPhaseRecorder returns a recorder of the phases of the run given by the input, or nil if it has none.
+func newPhaseRecorder(input models.Input) *phaseRecorder {
+	phases := runPhases(input)
+	if len(phases) == 0 {
+		return nil
+	}
+	p := &phaseRecorder{recovery: input.SpikeDuration > 0}
+	var start time.Duration
+	for _, phase := range phases {
+		p.names = append(p.names, phase.name)
+		p.starts = append(p.starts, start)
+		start += phase.duration
+	}
+	return p
+}
+
+// recordPhases adds to the worker a routine snapshotting its stats as each phase but the first starts.
+func (w *worker) recordPhases(p *phaseRecorder) {
+	if p == nil {
+		return
+	}
+	w.Add(func(ctx context.Context) error {
+		start := time.Now()
+		for _, at := range p.starts[1:] {
+			timer := time.NewTimer(time.Until(start.Add(at)))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil
+			case now := <-timer.C:
+				p.mu.Lock()
+				p.snapshots = append(p.snapshots, w.snapshot(start, now))
+				p.mu.Unlock()
+			}
+		}
+		<-ctx.Done()
+		return nil
+	})
+}
+
+// stats returns the stats of the phases started before the run ended, and the seconds it took to recover
+// from a spike, if the last phase is the recovery from one.
+func (p *phaseRecorder) stats(result Result) ([]models.Phase, *float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := intervals(result, p.snapshots)
+	phases := make([]models.Phase, len(stats))
+	for i, interval := range stats {
+		phases[i] = models.Phase{Name: p.names[i], Interval: interval}
+	}
+
+	var recovery *float64
+	if p.recovery && len(phases) == len(p.names) && phases[0].RequestLatencyP50 != nil {
+		recovery = recoveryTime(result.Samples, p.snapshots[len(p.snapshots)-1].End, *phases[0].RequestLatencyP50)
+	}
+	return phases, recovery
+}
+
+// recoveryTime returns the seconds from since until the first second whose requests have a median latency
+// within recoveryTolerance of baseline, in milliseconds, or nil if none has.
+func recoveryTime(samples []agent.RequestSample, since time.Time, baseline float64) *float64 {
+	var seconds [][]float64
+	for _, s := range samples {
+		if s.Status == 0 || s.Timestamp.Before(since) {
+			continue
+		}
+		second := int(s.Timestamp.Sub(since) / time.Second)
+		for len(seconds) <= second {
+			seconds = append(seconds, nil)
+		}
+		seconds[second] = append(seconds[second], float64(s.Duration)/float64(time.Millisecond))
+	}
+	for i, latencies := range seconds {
+		if p50 := numbers.Percentile(latencies, 50); p50 != nil && *p50 <= baseline*recoveryTolerance {
+			recovered := float64(i)
+			return &recovered
+		}
+	}
+	return nil
+}
+
+// addPhases adds to the report and prints the stats of each phase of the run, if it has phases.
+func addPhases(p *phaseRecorder, result Result, report models.Report, out io.Writer) models.Report {
+	if p == nil {
+		return report
+	}
+	report.Phases, report.SpikeRecoveryTime = p.stats(result)
+	metrics := strcoll.NewTuples()
+	for _, phase := range report.Phases {
+		metrics.Add(phase.Name+" phase", fmt.Sprintf("%.0fs - %.0fs", phase.Start, phase.End))
+		metrics.Add(" - events sent per second", phase.EventsSentPerSecond)
+		if phase.EventsAcceptedPerSecond != nil {
+			metrics.Add(" - accepted per second", *phase.EventsAcceptedPerSecond)
+			metrics.Add(" - rejected", phase.EventsRejected)
+		}
+		metrics.Add(" - events dropped", phase.EventsDropped)
+		metrics.Add(" - requests", phase.Requests)
+		metrics.Add(" - failed", phase.FailedRequests)
+		if phase.RequestLatencyP50 != nil {
+			metrics.Add(" - latency p50 (ms)", *phase.RequestLatencyP50)
+			metrics.Add(" - latency p99 (ms)", *phase.RequestLatencyP99)
+		}
+	}
+	if report.SpikeRecoveryTime != nil {
+		metrics.Add("spike recovery (s)", *report.SpikeRecoveryTime)
+	} else if p.recovery && len(report.Phases) == len(p.names) {
+		metrics.Add("spike recovery", "not recovered")
+	}
+	if s := metrics.Format(30); s != "" {
+		fmt.Fprintln(out, s)
+	}
+	return report
+}
@@ -0,0 +1,139 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
+)
+
+const (
+	probeIndex        = "apm*transaction*"
+	probePollInterval = 100 * time.Millisecond
+	// probes not searchable after this time are given up as missing
+	probeTimeout = time.Minute
+)
+
+// latencyProbe sends sentinel transactions with known Ids, and measures the time until they are
+// searchable in Elasticsearch, which includes agent buffering, intake and indexing.
+type latencyProbe struct {
+	conn   es.Connection
+	runId  string
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	sent      int
+	latencies []float64
+}
+
+func newLatencyProbe(conn es.Connection, runId string) *latencyProbe {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &latencyProbe{conn: conn, runId: runId, ctx: ctx, cancel: cancel}
+}
+
+// send returns a function sending a sentinel transaction every interval, until its context is done.
+// Sentinels are polled for until they are found, they time out or the probe is stopped.
+func (p *latencyProbe) send(sender agent.Sender, interval time.Duration) func(context.Context) error {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			id := shortId()
+			tx := sender.StartTransactionOptions("hey-apm-probe", "probe", apm.TransactionOptions{})
+			tx.Context.SetTag("probe_id", id)
+			tx.Context.SetTag("run_id", p.runId)
+			tx.End()
+			sent := time.Now()
+
+			p.mu.Lock()
+			p.sent++
+			p.mu.Unlock()
+			p.wg.Add(1)
+			go p.poll(id, sent)
+		}
+	}
+}
+
+func (p *latencyProbe) poll(id string, sent time.Time) {
+	defer p.wg.Done()
+	ticker := time.NewTicker(probePollInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(probeTimeout)
+	defer timeout.Stop()
+	query := types.M{"query": types.M{"term": types.M{"labels.probe_id": id}}}
+	for {
+		if n, err := es.CountQuery(p.conn, probeIndex, query); err == nil && n > 0 {
+			p.mu.Lock()
+			p.latencies = append(p.latencies, float64(time.Since(sent))/float64(time.Millisecond))
+			p.mu.Unlock()
+			return
+		}
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-timeout.C:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop waits until all the sentinels sent are found, time out or ctx is done,
+// and returns how many were sent and the latencies in milliseconds of those found.
+func (p *latencyProbe) stop(ctx context.Context) (int, []float64) {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-ctx.Done():
+	case <-done:
+	}
+	p.cancel()
+	p.wg.Wait()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sent, p.latencies
+}
+
+// addIndexingLatency stops the probe, if any, and adds to the report and prints the latencies measured.
+func addIndexingLatency(ctx context.Context, probe *latencyProbe, report models.Report, out io.Writer) models.Report {
+	if probe == nil {
+		return report
+	}
+	sent, latencies := probe.stop(ctx)
+	report.IndexingProbes = uint64(sent)
+	report.IndexingProbesMissing = uint64(sent - len(latencies))
+	report.IndexingLatencyP50 = numbers.Percentile(latencies, 50)
+	report.IndexingLatencyP90 = numbers.Percentile(latencies, 90)
+	report.IndexingLatencyP99 = numbers.Percentile(latencies, 99)
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("indexing probes", sent)
+	metrics.Add(" - missing", report.IndexingProbesMissing)
+	if report.IndexingLatencyP50 != nil {
+		metrics.Add("indexing latency p50 (ms)", *report.IndexingLatencyP50)
+		metrics.Add("indexing latency p99 (ms)", *report.IndexingLatencyP99)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,30 @@
+package worker
+
+import (
+	"math/rand"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/random"
+)
+
+// newRand returns the source of randomness of a generator, derived from the seed of the run and the name
+// of the generator, so that the same seed reproduces the same sequence of events in every generator
+// regardless of the others. It is not safe for concurrent use.
+func newRand(seed int64, name string) *rand.Rand {
+	return random.New(seed, name)
+}
+
+// newTraceContext returns the context of a new sampled trace with a random Id, as the agent would start.
+func newTraceContext(r *rand.Rand) apm.TraceContext {
+	tc := apm.TraceContext{Options: apm.TraceOptions(0).WithRecorded(true)}
+	r.Read(tc.Trace[:])
+	return tc
+}
+
+// newSpanID returns a random transaction or span Id.
+func newSpanID(r *rand.Rand) apm.SpanID {
+	var id apm.SpanID
+	r.Read(id[:])
+	return id
+}
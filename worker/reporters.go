@@ -0,0 +1,221 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/pushgateway"
+	"github.com/elastic/hey-apm/render"
+	"github.com/elastic/hey-apm/reports"
+)
+
+// Reporter is a destination of runs: it receives their progress while events are generated, and their report
+// once created. Reporters log their own errors, and only return those failing the run.
+type Reporter interface {
+	// Progress is called every second with the results so far, until the work is done.
+	Progress(result Result)
+	// Report is called with the report of a completed run and its results.
+	Report(report models.Report, result Result) error
+}
+
+// ReporterFactory returns the Reporter of a run with the given input, or nil if the input doesn't ask for it.
+type ReporterFactory func(logger *log.Logger, input models.Input) Reporter
+
+type namedReporter struct {
+	name    string
+	factory ReporterFactory
+}
+
+// reporters are called in the order registered
+var reporters []namedReporter
+
+// RegisterReporter makes a destination of runs available by name, after the ones already registered.
+// It panics if the name is already taken.
+func RegisterReporter(name string, f ReporterFactory) {
+	for _, r := range reporters {
+		if r.name == name {
+			panic("reporter already registered: " + name)
+		}
+	}
+	reporters = append(reporters, namedReporter{name, f})
+}
+
+func init() {
+	RegisterReporter("console", newConsoleReporter)
+	RegisterReporter("pushgateway", newPushgatewayReporter)
+	RegisterReporter("render", newRenderReporter)
+	RegisterReporter("reports-dir", newDirReporter)
+	RegisterReporter("manifest", newManifestReporter)
+	RegisterReporter("elasticsearch", newIndexReporter)
+}
+
+// newReporters returns the reporters of a run with the given input.
+func newReporters(logger *log.Logger, input models.Input) []Reporter {
+	var rs []Reporter
+	for _, r := range reporters {
+		if reporter := r.factory(logger, input); reporter != nil {
+			rs = append(rs, reporter)
+		}
+	}
+	return rs
+}
+
+// sendReport sends the report of a run to all the reporters, and returns the first error failing the run.
+func sendReport(rs []Reporter, report models.Report, result Result) error {
+	var err error
+	for _, r := range rs {
+		if rerr := r.Report(report, result); rerr != nil && err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// progressTo returns a function passing the results so far to all the reporters and then to progress, if not nil.
+func progressTo(rs []Reporter, progress func(Result)) func(Result) {
+	return func(result Result) {
+		for _, r := range rs {
+			r.Progress(result)
+		}
+		if progress != nil {
+			progress(result)
+		}
+	}
+}
+
+// noProgress can be embedded by reporters only interested in reports.
+type noProgress struct{}
+
+func (noProgress) Progress(Result) {}
+
+// noReport can be embedded by reporters only interested in progress.
+type noReport struct{}
+
+func (noReport) Report(models.Report, Result) error { return nil }
+
+// consoleReporter prints the progress of a run every second.
+type consoleReporter struct {
+	noReport
+	out    io.Writer
+	prefix string
+}
+
+func newConsoleReporter(_ *log.Logger, input models.Input) Reporter {
+	if !input.Progress {
+		return nil
+	}
+	var prefix string
+	if input.TargetName != "" {
+		prefix = "[" + input.TargetName + "] "
+	}
+	return consoleReporter{out: os.Stderr, prefix: prefix}
+}
+
+func (r consoleReporter) Progress(result Result) {
+	fmt.Fprintf(r.out, "%s%s: %d events sent (%.0f/s), %d accepted, %d rejected, %d failed requests\n",
+		r.prefix, result.End.Sub(result.Start).Truncate(time.Second), result.EventsSent(),
+		result.EventsSentPerSecond(), result.Accepted, result.Rejected, result.Errors.SendStream)
+}
+
+// pushgatewayReporter pushes the metrics of reports to a Prometheus pushgateway.
+type pushgatewayReporter struct {
+	noProgress
+	logger *log.Logger
+	url    string
+}
+
+func newPushgatewayReporter(logger *log.Logger, input models.Input) Reporter {
+	if input.PushgatewayUrl == "" {
+		return nil
+	}
+	return pushgatewayReporter{logger: logger, url: input.PushgatewayUrl}
+}
+
+func (r pushgatewayReporter) Report(report models.Report, _ Result) error {
+	if err := pushgateway.Push(r.url, report); err != nil {
+		r.logger.Println(err.Error())
+	} else {
+		r.logger.Println("report metrics pushed to " + r.url)
+	}
+	return nil
+}
+
+// renderReporter renders reports with charts over time to a file.
+type renderReporter struct {
+	noProgress
+	logger *log.Logger
+	path   string
+}
+
+func newRenderReporter(logger *log.Logger, input models.Input) Reporter {
+	if input.RenderFile == "" {
+		return nil
+	}
+	return renderReporter{logger: logger, path: targetPath(input.RenderFile, input.TargetName)}
+}
+
+func (r renderReporter) Report(report models.Report, result Result) error {
+	if err := render.File(r.path, report, render.NewSeries(result.Samples)); err != nil {
+		r.logger.Println(err.Error())
+	} else {
+		r.logger.Println("report rendered to " + r.path)
+	}
+	return nil
+}
+
+// dirReporter saves reports as JSON files in a directory.
+type dirReporter struct {
+	noProgress
+	logger *log.Logger
+	dir    reports.Dir
+}
+
+func newDirReporter(logger *log.Logger, input models.Input) Reporter {
+	if input.ReportsDir == "" {
+		return nil
+	}
+	return dirReporter{logger: logger, dir: reports.Dir(input.ReportsDir)}
+}
+
+func (r dirReporter) Report(report models.Report, _ Result) error {
+	if err := r.dir.Save(report); err != nil {
+		r.logger.Println(err.Error())
+	} else {
+		r.logger.Println("report saved in " + string(r.dir))
+	}
+	return nil
+}
+
+// indexReporter indexes reports in the Elasticsearch instance used for reporting.
+// Runs whose report can't be indexed fail.
+type indexReporter struct {
+	noProgress
+	logger *log.Logger
+	input  models.Input
+}
+
+func newIndexReporter(logger *log.Logger, input models.Input) Reporter {
+	if input.SkipIndexReport {
+		return nil
+	}
+	return indexReporter{logger: logger, input: input}
+}
+
+func (r indexReporter) Report(report models.Report, _ Result) error {
+	if r.input.ElasticsearchUrl == "" {
+		r.logger.Println("es-url unset: not indexing report")
+		return nil
+	}
+	conn, _ := es.NewConnection(r.input.ElasticsearchUrl, r.input.ElasticsearchAuth)
+	if err := es.IndexReport(conn, report); err != nil {
+		r.logger.Println(err.Error())
+		return err
+	}
+	r.logger.Println("report indexed with document Id " + report.ReportId)
+	return nil
+}
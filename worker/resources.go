@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/server"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// queryStats returns the stats of apm-server from its monitoring endpoint, or nil if not known.
+func queryStats(logger *log.Logger, input models.Input) *server.BeatStats {
+	if input.MonitoringUrl == "" {
+		return nil
+	}
+	stats, err := server.QueryStats(input.MonitoringUrl)
+	if err != nil {
+		logger.Println(err.Error())
+		return nil
+	}
+	return &stats
+}
+
+// addResourceUsage adds to the report the resource usage of apm-server and its host since the run started,
+// from its monitoring endpoint and a Metricbeat index, as given by the input, and prints it.
+// before are the stats of apm-server when the run started.
+func addResourceUsage(logger *log.Logger, input models.Input, conn es.Connection, before *server.BeatStats,
+	start time.Time, report models.Report, out io.Writer) models.Report {
+	if before != nil {
+		if after := queryStats(logger, input); after != nil {
+			cpu := float64(after.Beat.CPU.Total.Time.MS-before.Beat.CPU.Total.Time.MS) / 1000
+			report.ApmCPUSeconds = &cpu
+			report.ApmMemoryRSS = &after.Beat.Memstats.RSS
+			if after.System.CPU.Cores > 0 {
+				report.CPUCores = &after.System.CPU.Cores
+			}
+		}
+	}
+	if input.MetricsIndex != "" {
+		host, err := es.FetchHostMetrics(conn, input.MetricsIndex, input.MetricsHost, start, time.Now())
+		if err != nil {
+			logger.Println(err.Error())
+		} else {
+			report.HostCPUPct, report.HostMemoryPct = host.CPUPct, host.MemoryPct
+			report.DiskReadBytes, report.DiskWriteBytes = host.DiskReadBytes, host.DiskWriteBytes
+			if report.CPUCores == nil {
+				report.CPUCores = host.Cores
+			}
+		}
+	}
+	report = report.WithDerivedAttributes()
+
+	metrics := strcoll.NewTuples()
+	if report.CPUCores != nil {
+		metrics.Add("cpu cores", *report.CPUCores)
+	}
+	if report.ApmCPUSeconds != nil {
+		metrics.Add("apm-server cpu seconds", fmt.Sprintf("%.2f", *report.ApmCPUSeconds))
+		metrics.Add("apm-server rss", conv.ByteCountDecimal(*report.ApmMemoryRSS))
+	}
+	if report.HostCPUPct != nil {
+		metrics.Add("host cpu %", fmt.Sprintf("%.2f", *report.HostCPUPct))
+	}
+	if report.HostMemoryPct != nil {
+		metrics.Add("host memory %", fmt.Sprintf("%.2f", *report.HostMemoryPct))
+	}
+	if report.DiskReadBytes != nil {
+		metrics.Add("disk read", conv.ByteCountDecimal(*report.DiskReadBytes))
+		metrics.Add("disk written", conv.ByteCountDecimal(*report.DiskWriteBytes))
+	}
+	if report.EventsPerCPUSecond != nil {
+		metrics.Add("accepted per cpu second", *report.EventsPerCPUSecond)
+	}
+	if s := metrics.Format(30); s != "" {
+		fmt.Fprintln(out, s)
+	}
+	return report
+}
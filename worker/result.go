@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/elastic/hey-apm/agent"
@@ -17,6 +18,65 @@ type Result struct {
 	Start   time.Time
 	End     time.Time
 	Flushed time.Time
+	// when all events sent were acknowledged, or gave up waiting
+	Drained time.Time
+	// events accepted or rejected by apm-server by the time generation stopped
+	AcknowledgedAtStop uint64
+	// requests mirrored to a second apm-server, if any
+	Mirror *agent.TransportStats
+}
+
+// add aggregates the stats of 2 results, spanning the time window of both.
+func (r Result) add(r2 Result) Result {
+	r.Errors.SetContext += r2.Errors.SetContext
+	r.Errors.SendStream += r2.Errors.SendStream
+	r.ErrorsSent += r2.ErrorsSent
+	r.ErrorsDropped += r2.ErrorsDropped
+	r.TransactionsSent += r2.TransactionsSent
+	r.TransactionsDropped += r2.TransactionsDropped
+	r.SpansSent += r2.SpansSent
+	r.SpansDropped += r2.SpansDropped
+
+	r.Accepted += r2.Accepted
+	r.Rejected += r2.Rejected
+	r.NumRequests += r2.NumRequests
+	r.AuthFailures += r2.AuthFailures
+	r.Samples = append(r.Samples, r2.Samples...)
+	r.SamplesDropped += r2.SamplesDropped
+	r.Verbose = r.Verbose || r2.Verbose
+	r.Metrics = r.Metrics || r2.Metrics
+	if len(r2.Destinations) > 0 {
+		destinations := make(map[string]agent.DestinationStats)
+		for _, m := range []map[string]agent.DestinationStats{r.Destinations, r2.Destinations} {
+			for resource, s := range m {
+				total := destinations[resource]
+				total.Count += s.Count
+				total.DurationSum += s.DurationSum
+				destinations[resource] = total
+			}
+		}
+		r.Destinations = destinations
+	}
+	for _, e := range r2.TopErrors {
+		if !strcoll.Contains(e, r.TopErrors) {
+			r.TopErrors = append(r.TopErrors, e)
+		}
+	}
+
+	if r.Start.IsZero() || r2.Start.Before(r.Start) {
+		r.Start = r2.Start
+	}
+	if r2.End.After(r.End) {
+		r.End = r2.End
+	}
+	if r2.Flushed.After(r.Flushed) {
+		r.Flushed = r2.Flushed
+	}
+	if r2.Drained.After(r.Drained) {
+		r.Drained = r2.Drained
+	}
+	r.AcknowledgedAtStop += r2.AcknowledgedAtStop
+	return r
 }
 
 func (r Result) TransactionSuccess() *float64 {
@@ -51,10 +111,54 @@ func (r Result) EventSuccess() *float64 {
 	return numbers.Perct(r.Accepted, r.EventsSent())
 }
 
+// EventsUnacknowledged returns the number of events sent but neither accepted nor rejected by apm-server,
+// eg. because their request failed or its response could not be read.
+func (r Result) EventsUnacknowledged() uint64 {
+	if !r.Verbose {
+		return 0
+	}
+	if acked := r.Accepted + r.Rejected; acked < r.EventsSent() {
+		return r.EventsSent() - acked
+	}
+	return 0
+}
+
+// DrainDuration returns the time from generation stop until apm-server acknowledged all events sent.
+func (r Result) DrainDuration() time.Duration {
+	return r.Drained.Sub(r.End)
+}
+
+// AcknowledgedAfterStop returns the number of events accepted or rejected by apm-server after generation stopped.
+func (r Result) AcknowledgedAfterStop() uint64 {
+	return r.Accepted + r.Rejected - r.AcknowledgedAtStop
+}
+
+// Reconciled returns true if apm-server acknowledged exactly the events sent, either accepting or rejecting them.
+// Always true when responses are not verbose, as there is nothing to reconcile with.
+// Metricsets are acknowledged too but not counted as sent, so with metrics any surplus is also reconciled.
+func (r Result) Reconciled() bool {
+	if !r.Verbose {
+		return true
+	}
+	acked := r.Accepted + r.Rejected
+	return acked == r.EventsSent() || r.Metrics && acked > r.EventsSent()
+}
+
 func (r Result) SpansPerTransaction() *float64 {
 	return numbers.Div(r.SpansSent, r.TransactionsSent)
 }
 
+// LatencyPercentile returns the pth percentile of request latencies in milliseconds.
+func (r Result) LatencyPercentile(p float64) *float64 {
+	var ms []float64
+	for _, s := range r.Samples {
+		if s.Status > 0 {
+			ms = append(ms, float64(s.Duration)/float64(time.Millisecond))
+		}
+	}
+	return numbers.Percentile(ms, p)
+}
+
 func (r Result) String() string {
 	metrics := strcoll.NewTuples()
 
@@ -79,14 +183,27 @@ func (r Result) String() string {
 	if r.ElapsedSeconds() > 0 {
 		metrics.Add("total events sent", r.EventsSent())
 		metrics.Add(" - per second", r.EventsSentPerSecond())
-		metrics.Add(" - accepted", int64(r.Accepted))
-		if r.ErrorSuccess() != nil {
-			metrics.Add("   - per second", r.EventsAcceptedPerSecond())
-			metrics.Add("   - success %", *r.ErrorSuccess())
+		if r.Verbose {
+			metrics.Add(" - accepted", int64(r.Accepted))
+			if r.ErrorSuccess() != nil {
+				metrics.Add("   - per second", r.EventsAcceptedPerSecond())
+				metrics.Add("   - success %", *r.ErrorSuccess())
+			}
+			metrics.Add(" - rejected", int64(r.Rejected))
+			metrics.Add(" - unacknowledged", int64(r.EventsUnacknowledged()))
+			metrics.Add(" - acknowledged after stop", int64(r.AcknowledgedAfterStop()))
+			metrics.Add("drain duration", r.DrainDuration().String())
 		}
 	}
 	metrics.Add("total requests", r.NumRequests)
 	metrics.Add("failed", r.Errors.SendStream)
+	if p99 := r.LatencyPercentile(99); p99 != nil {
+		metrics.Add("request latency p99 (ms)", *p99)
+	}
+	if !r.Reconciled() {
+		metrics.Add("MISMATCH", fmt.Sprintf("%d events sent, %d accepted + %d rejected by apm-server",
+			r.EventsSent(), r.Accepted, r.Rejected))
+	}
 	if len(r.TopErrors) > 0 {
 		metrics.Add("server errors", r.TopErrors)
 	}
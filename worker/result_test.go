@@ -0,0 +1,26 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconciled(t *testing.T) {
+	r := Result{}
+	r.TransactionsSent, r.SpansSent, r.ErrorsSent = 10, 20, 5
+	r.Accepted, r.Rejected = 30, 5
+	assert.True(t, r.Reconciled(), "not verbose")
+
+	r.Verbose = true
+	assert.True(t, r.Reconciled())
+
+	r.Accepted = 32
+	assert.False(t, r.Reconciled(), "surplus without metrics")
+	r.Metrics = true
+	assert.True(t, r.Reconciled(), "surplus of metricsets")
+
+	r.Accepted = 28
+	assert.False(t, r.Reconciled(), "unacknowledged events")
+	assert.Equal(t, uint64(2), r.EventsUnacknowledged())
+}
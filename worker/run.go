@@ -1,17 +1,22 @@
 package worker
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
 	"os"
+	"runtime"
 	"time"
 
 	"github.com/pkg/errors"
+	"go.elastic.co/apm"
 
 	"github.com/elastic/hey-apm/models"
 
 	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/buildinfo"
 	"github.com/elastic/hey-apm/es"
 	"github.com/elastic/hey-apm/server"
 )
@@ -21,28 +26,141 @@ const quiesceTimeout = 5 * time.Minute
 // Run executes a load test work with the given input, prints the results,
 // indexes a performance report, and returns it along any error.
 func Run(input models.Input) (models.Report, error) {
+	return RunContext(context.Background(), input)
+}
+
+// RunContext is like Run, but stops generating events and returns as soon as ctx is done.
+func RunContext(ctx context.Context, input models.Input) (models.Report, error) {
+	_, report, err := run(ctx, input, os.Stdout, nil)
+	return report, err
+}
+
+// RunWithProgress is like RunContext, and calls progress every second with the results so far
+// while events are generated, as registered reporters get them.
+func RunWithProgress(ctx context.Context, input models.Input, progress func(Result)) (models.Report, error) {
+	_, report, err := run(ctx, input, os.Stdout, progress)
+	return report, err
+}
+
+func run(ctx context.Context, input models.Input, out io.Writer, progress func(Result)) (result Result, report models.Report, err error) {
 	testNode, err := es.NewConnection(input.ApmElasticsearchUrl, input.ApmElasticsearchAuth)
 	if err != nil {
-		return models.Report{}, errors.Wrap(err, "Elasticsearch used by APM Server not known or reachable")
+		return Result{}, models.Report{}, errors.Wrap(err, "Elasticsearch used by APM Server not known or reachable")
 	}
 
-	worker := prepareWork(input)
+	if input.GoMaxProcs > 0 {
+		// restored, so that it doesn't leak into later runs of the same process, as in daemon mode
+		prev := runtime.GOMAXPROCS(input.GoMaxProcs)
+		defer runtime.GOMAXPROCS(prev)
+	}
+	if input.RunId == "" {
+		input.RunId = shortId()
+	}
+	runId := input.RunId
+	worker, err := prepareWork(input)
+	if err != nil {
+		return Result{}, models.Report{}, err
+	}
+	sinks := newReporters(worker.Logger, input)
+	if progress != nil || len(sinks) > 0 {
+		worker.addProgress(progressTo(sinks, progress))
+	}
+	var probe *latencyProbe
+	if input.ProbeInterval > 0 {
+		probe = newLatencyProbe(testNode, runId)
+		defer probe.cancel()
+		worker.Add(probe.send(worker.Sender, input.ProbeInterval))
+	}
+	var configStats *pollStats
+	if input.ConfigAgents > 0 {
+		configStats = &pollStats{}
+		worker.Add(pollConfig(input, configStats))
+	}
+	var idleStats *pollStats
+	if input.IdleAgents > 0 {
+		idleStats = &pollStats{}
+		worker.Add(simulateIdleAgents(input, idleStats))
+	}
+	var sourcemapStats *pollStats
+	if input.SourcemapInterval > 0 {
+		if err := uploadSourcemap(input); err != nil {
+			return Result{}, models.Report{}, errors.Wrap(err, "error uploading sourcemap")
+		}
+		sourcemapStats = &pollStats{}
+		worker.Add(sendSourcemappedErrors(input, sourcemapStats))
+	}
+	chaos := worker.addChaos(input)
+	phases := newPhaseRecorder(input)
+	worker.recordPhases(phases)
+	buckets := newBucketRecorder(input)
+	worker.recordBuckets(buckets)
+	shards := newShards(input)
+	worker.addShards(shards)
+	var infoStats *pollStats
+	if input.InfoInterval > 0 {
+		infoStats = &pollStats{}
+		worker.Add(pollInfo(input, infoStats))
+	}
 	logger := worker.Logger
-	initialStatus := server.GetStatus(logger, input.ApmServerSecret, input.ApmServerUrl, testNode)
+	self := startInstrumentation(input, worker.apmLogger)
+	defer func() { self.end(err) }()
+	auth := server.Authorization(input.ApmServerSecret, input.APIKey)
+	initialStatus := server.GetStatus(logger, auth, expvarUrl(input), testNode)
+	mirror := newMirrorTarget(logger, input)
 
-	result, err := worker.work()
-	if err != nil {
+	statsBefore := queryStats(logger, input)
+	sizeBefore := apmIndicesSize(logger, input, testNode)
+	scraper := startLogScraper(logger, input.ApmLogs)
+	if scraper != nil {
+		defer scraper.cancel()
+	}
+	endAnnotation := annotate(logger, input, runId, time.Now())
+	result, err = worker.work(ctx)
+	result = shards.add(result)
+	endAnnotation(result.End)
+	self.timed("generate", result.Start, result.End)
+	self.timed("flush", result.End, result.Flushed)
+	self.timed("drain", result.Flushed, result.Drained)
+	if err == nil && result.AuthFailures > 0 {
+		err = AuthError{result.AuthFailures}
+	}
+	if input.SamplesFile != "" {
+		path := targetPath(input.SamplesFile, input.TargetName)
+		if werr := writeSamples(path, result.Samples); werr != nil {
+			logger.Println(werr.Error())
+		} else {
+			logger.Printf("%d request samples written to %s", len(result.Samples), path)
+		}
+	}
+	// runs aborted by a stop condition are reported as far as they went, before returning the error
+	var stopped error
+	switch err.(type) {
+	case nil:
+	case StopError, AuthError:
+		logger.Println(err.Error())
+		stopped, err = err, nil
+	default:
 		logger.Println(err.Error())
-		return models.Report{}, err
+		fmt.Fprintln(out, result)
+		return result, models.Report{}, err
 	}
 	logger.Printf("%s elapsed since event generation completed", result.Flushed.Sub(result.End))
-	fmt.Println(result)
+	if !result.Reconciled() {
+		logger.Printf("WARNING: %d events sent but %d accepted, %d rejected and %d unacknowledged by apm-server",
+			result.EventsSent(), result.Accepted, result.Rejected, result.EventsUnacknowledged())
+	}
+	fmt.Fprintln(out, result)
 
 	// Wait for apm-server to quiesce before proceeding.
+	endQuiesce := self.phase("quiesce")
+	quiesceStart := time.Now()
 	var finalStatus server.Status
 	deadline := time.Now().Add(quiesceTimeout)
 	for {
-		finalStatus = server.GetStatus(logger, input.ApmServerSecret, input.ApmServerUrl, testNode)
+		finalStatus = server.GetStatus(logger, auth, expvarUrl(input), testNode)
+		if finalStatus.Metrics == nil {
+			break
+		}
 		activeEvents := finalStatus.Metrics.LibbeatMetrics.PipelineEventsActive
 		if activeEvents == nil || *activeEvents == 0 {
 			break
@@ -52,60 +170,165 @@ func Run(input models.Input) (models.Report, error) {
 			break
 		}
 		logger.Printf("waiting for %d active events to be processed", *activeEvents)
-		time.Sleep(time.Second)
+		select {
+		case <-ctx.Done():
+			endQuiesce()
+			return result, models.Report{}, ctx.Err()
+		case <-time.After(time.Second):
+		}
 	}
-	report := createReport(input, result, initialStatus, finalStatus)
-
-	if input.SkipIndexReport {
-		return report, err
+	endQuiesce()
+	defer self.phase("report")()
+	report = createReport(runId, input, result, initialStatus, finalStatus, out)
+	if stopped != nil {
+		report.StopReason = stopped.Error()
 	}
-
-	if input.ElasticsearchUrl == "" {
-		logger.Println("es-url unset: not indexing report")
-	} else {
-		reportNode, _ := es.NewConnection(input.ElasticsearchUrl, input.ElasticsearchAuth)
-		if err = es.IndexReport(reportNode, report); err != nil {
-			logger.Println(err.Error())
+	report.QuiesceDuration = time.Since(quiesceStart).Seconds()
+	report = addApdex(input, result, report, out)
+	report = addPacing(worker.pacing, result, report, out)
+	report = addPhases(phases, result, report, out)
+	report = addBuckets(buckets, result, report, out)
+	report = addIndexingLatency(ctx, probe, report, out)
+	report = addAggregation(ctx, logger, input, testNode, result, report, out)
+	report = addConfigPolling(configStats, report, out)
+	report = addIdleAgents(idleStats, input, report, out)
+	report = addInfoPolling(infoStats, report, out)
+	report = addSourcemappedErrors(sourcemapStats, report, out)
+	report = addChaosStats(chaos, report, out)
+	report = addLogs(scraper, report, out)
+	report = addStorage(logger, input, testNode, sizeBefore, report, out)
+	report = addResourceUsage(logger, input, testNode, statsBefore, result.Start, report, out)
+	report = addCost(input, report, out)
+	report = addMirror(mirror, result, report, out)
+	if input.Cleanup {
+		if deleted, cerr := es.DeleteRun(testNode, runId); cerr != nil {
+			logger.Println(cerr.Error())
 		} else {
-			logger.Println("report indexed with document Id " + report.ReportId)
+			logger.Printf("%d documents of run %s deleted", deleted, runId)
 		}
 	}
-	return report, err
+
+	err = sendReport(sinks, report, result)
+	if stopped != nil {
+		// assertions don't apply to partial reports
+		return result, report, stopped
+	}
+	if err == nil {
+		err = checkAssertions(input, report, out)
+	}
+	return result, report, err
 }
 
 // prepareWork returns a worker with with a workload defined by the input.
-func prepareWork(input models.Input) worker {
+func prepareWork(input models.Input) (worker, error) {
 
-	logger := newApmLogger(log.New(os.Stderr, "", log.Ldate|log.Ltime|log.Lshortfile))
-	tracer := agent.NewTracer(logger, input.ApmServerUrl, input.ApmServerSecret, input.APIKey, input.ServiceName, input.SpanMaxLimit)
+	var prefix string
+	if input.TargetName != "" {
+		prefix = "[" + input.TargetName + "] "
+	}
+	logger := newApmLogger(log.New(os.Stderr, prefix, log.Ldate|log.Ltime|log.Lshortfile))
+	tracer, err := agent.NewTracer(logger, agentConfig(input))
+	if err != nil {
+		return worker{}, err
+	}
+	if input.HTTPBodySize > 0 {
+		tracer.SetCaptureBody(apm.CaptureBodyTransactions)
+	}
+	if input.ErrorSourceLines > 0 {
+		tracer.SetContextSetter(sourceContext{input.ErrorSourceLines})
+	}
 
 	w := worker{
 		apmLogger:    logger,
-		Tracer:       tracer,
+		Sender:       tracer,
 		RunTimeout:   input.RunTimeout,
-		FlushTimeout: input.FlushTimeout,
+		DrainTimeout: input.DrainTimeout,
+	}
+	if input.Procs > 1 && input.ShardOutput == "" {
+		// child processes generate the workload of sharded runs
+		w.pacing = &pacingMonitor{}
+	} else {
+		w.addGenerators(input)
 	}
-	w.addErrors(input.ErrorFrequency, input.ErrorLimit, input.ErrorFrameMinLimit, input.ErrorFrameMaxLimit)
-	w.addTransactions(input.TransactionFrequency, input.TransactionLimit, input.SpanMinLimit, input.SpanMaxLimit)
+	w.addStopConditions(input.MaxRequestErrors, input.MaxErrorRate)
 	w.addSignalHandling()
 
-	return w
+	return w, nil
 }
 
-func createReport(input models.Input, result Result, initialStatus, finalStatus server.Status) models.Report {
+// agentConfig returns the configuration of the agent sending the events of a run.
+func agentConfig(input models.Input) agent.Config {
+	capture := agent.CaptureVerbose
+	if input.StatusOnly {
+		capture = agent.CaptureStatus
+	}
+	var recordFile, sentEventsFile string
+	if input.SentEventsFile != "" {
+		sentEventsFile = targetPath(input.SentEventsFile, input.TargetName)
+	}
+	if input.RecordFile != "" {
+		recordFile = targetPath(input.RecordFile, input.TargetName)
+	}
+	maxSpans := input.SpanMaxLimit + input.ExitSpans
+	if input.LongTransactions > 0 {
+		// long transactions get spans for as long as the run lasts
+		maxSpans = -1
+	}
+	return agent.Config{
+		ServerUrl:          input.ApmServerUrl,
+		ServerSecret:       input.ApmServerSecret,
+		APIKey:             input.APIKey,
+		ServiceName:        input.ServiceName,
+		ServiceVersion:     input.ServiceVersion,
+		ServiceEnvironment: input.ServiceEnvironment,
+		MaxSpans:           maxSpans,
+		MetricsInterval:    input.MetricsInterval,
+		BreakdownMetrics:   input.BreakdownMetrics,
+		FlushTimeout:       input.FlushTimeout,
+		Capture:            capture,
+		MaxBytesPerSecond:  input.MaxBytesPerSecond,
+		Latency:            input.Latency,
+		LatencyJitter:      input.LatencyJitter,
+		ResetRatio:         input.ResetRatio,
+		OutOfOrderRatio:    input.OutOfOrderRatio,
+		Seed:               input.Seed,
+		DroppedSpansStats:  input.DroppedSpansRatio > 0,
+		CompressSpans:      input.CompressSpans,
+		OTelAttributes:     input.OTelAttributes,
+		ScriptFile:         input.ScriptFile,
+		Feeds:              input.Feeds,
+		SampleFeeds:        input.FeedOrder == "sample",
+		CountDestinations:  input.CheckAggregation,
+		RUM:                input.RUM,
+		ClientIPs:          input.ClientIPs,
+		MirrorUrl:          input.MirrorUrl,
+		MirrorSecret:       input.MirrorSecret,
+		MirrorAPIKey:       input.MirrorAPIKey,
+		RecordFile:         recordFile,
+		RecordOnly:         input.RecordOnly,
+		ScrubRules:         input.ScrubRules,
+		SentEventsFile:     sentEventsFile,
+		SentEventsEvery:    input.SentEventsEvery,
+	}
+}
+
+func createReport(id string, input models.Input, result Result, initialStatus, finalStatus server.Status, out io.Writer) models.Report {
 	this, _ := os.Hostname()
 	r := models.Report{
 		Input: input,
 
-		ReportId:     shortId(),
+		ReportId:     id,
 		ReportDate:   time.Now().Format(models.GITRFC),
 		ReporterHost: this,
 
 		Timestamp: time.Now(),
 		Elapsed:   result.Flushed.Sub(result.Start).Seconds(),
 
-		Requests:       result.NumRequests,
-		FailedRequests: result.Errors.SendStream,
+		Requests:          result.NumRequests,
+		FailedRequests:    result.Errors.SendStream,
+		RequestLatencyP50: result.LatencyPercentile(50),
+		RequestLatencyP90: result.LatencyPercentile(90),
+		RequestLatencyP99: result.LatencyPercentile(99),
 
 		ErrorsGenerated: result.ErrorsSent + result.ErrorsDropped,
 		ErrorsSent:      result.ErrorsSent,
@@ -119,21 +342,39 @@ func createReport(input models.Input, result Result, initialStatus, finalStatus
 		SpansSent:      result.SpansSent,
 		SpansIndexed:   finalStatus.SpanIndexCount - initialStatus.SpanIndexCount,
 
-		EventsAccepted: result.Accepted,
+		EventsAccepted:       result.Accepted,
+		EventsRejected:       result.Rejected,
+		RejectionReasons:     result.TopErrors,
+		EventsUnacknowledged: result.EventsUnacknowledged(),
+
+		DrainDuration:               result.DrainDuration().Seconds(),
+		EventsAcknowledgedAfterStop: result.AcknowledgedAfterStop(),
+
+		ClientCPUs:       runtime.NumCPU(),
+		ClientGoMaxProcs: runtime.GOMAXPROCS(0),
+
+		HeyApmVersion:   buildinfo.Version,
+		HeyApmCommit:    buildinfo.Commit,
+		HeyApmBuildDate: buildinfo.Date,
+		GoVersion:       buildinfo.GoVersion(),
+		AgentVersion:    buildinfo.AgentVersion(),
 	}
 
-	info, ierr := server.QueryInfo(input.ApmServerSecret, input.ApmServerUrl)
+	info, ierr := server.QueryInfo(server.Authorization(input.ApmServerSecret, input.APIKey), input.ApmServerUrl)
 	if ierr == nil {
-		fmt.Println(info)
+		fmt.Fprintln(out, info)
 
 		r.ApmBuild = info.BuildSha
 		r.ApmBuildDate = info.BuildDate
 		r.ApmVersion = info.Version
 	}
+	if input.Cloud != nil {
+		fmt.Fprintln(out, *input.Cloud)
+	}
 
 	if initialStatus.Metrics != nil && finalStatus.Metrics != nil {
 		memstats := finalStatus.Metrics.Memstats.Sub(initialStatus.Metrics.Memstats)
-		fmt.Println(memstats)
+		fmt.Fprintln(out, memstats)
 
 		r.TotalAlloc = &memstats.TotalAlloc
 		r.HeapAlloc = &memstats.HeapAlloc
@@ -146,7 +387,17 @@ func createReport(input models.Input, result Result, initialStatus, finalStatus
 	return r.WithDerivedAttributes()
 }
 
-// shortId returns a short docId for elasticsearch documents. It is not an UUID
+// expvarUrl returns the URL of the apm-server under test to query memory stats and queued events from,
+// or an empty string if it doesn't expose them.
+func expvarUrl(input models.Input) string {
+	if input.SkipExpvar {
+		return ""
+	}
+	return input.ApmServerUrl
+}
+
+// shortId returns a short docId for elasticsearch documents. It is not an UUID.
+// It doesn't depend on the seed of the run, so that replayed runs get ids of their own.
 func shortId() string {
 	b := make([]byte, 16)
 	rand.Read(b)
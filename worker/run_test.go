@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/transport"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+	"github.com/stretchr/testify/assert"
+)
+
+// idSender records the IDs of the transactions it starts, with a tracer discarding them.
+type idSender struct {
+	agent.Sender
+	tracer *apm.Tracer
+	mu     sync.Mutex
+	ids    []apm.SpanID
+}
+
+func (s *idSender) StartTransactionOptions(name, transactionType string, opts apm.TransactionOptions) *apm.Transaction {
+	s.mu.Lock()
+	s.ids = append(s.ids, opts.TransactionID)
+	s.mu.Unlock()
+	return s.tracer.StartTransactionOptions(name, transactionType, opts)
+}
+
+// transactionIDs returns the IDs of the transactions generated for input.
+func transactionIDs(t *testing.T, input models.Input) []apm.SpanID {
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{ServiceName: "hey-apm", Transport: transport.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Close()
+	sender := &idSender{tracer: tracer}
+	assert.NoError(t, generateTransactions(sender, input)(context.Background()))
+	return sender.ids
+}
+
+func TestGeneratorGoroutines(t *testing.T) {
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{ServiceName: "hey-apm", Transport: transport.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracer.Close()
+	sender := &idSender{tracer: tracer}
+	input := models.Input{TransactionLimit: 10, TransactionFrequency: time.Millisecond, SpanMaxLimit: 1, Seed: 42,
+		EventTypes: []string{"transaction"}, GeneratorGoroutines: 3}
+	w := worker{Sender: sender}
+	w.addGenerators(input)
+	assert.NoError(t, w.Run(context.Background()))
+
+	// the shards generating 3 transactions don't stop the one generating 4
+	assert.Len(t, sender.ids, 10)
+	unique := make(map[apm.SpanID]bool)
+	for _, id := range sender.ids {
+		unique[id] = true
+	}
+	assert.Len(t, unique, 10)
+}
+
+func TestSeeds(t *testing.T) {
+	input := models.Input{TransactionLimit: 5, TransactionFrequency: time.Nanosecond, SpanMaxLimit: 1, Seed: 42}
+	assert.Len(t, transactionIDs(t, input), 5)
+	// reproducible
+	assert.Equal(t, transactionIDs(t, iterationInput(input, 1)), transactionIDs(t, iterationInput(input, 1)))
+
+	assert.NotEqual(t, transactionIDs(t, iterationInput(input, 1)), transactionIDs(t, iterationInput(input, 2)))
+
+	a, b := input, input
+	a.TargetName, b.TargetName = "a", "b"
+	assert.NotEqual(t, transactionIDs(t, targetInput(a)), transactionIDs(t, targetInput(b)))
+	// targets differing in their service only
+	b.TargetName, a.ServiceName, b.ServiceName = "a", "svc-1", "svc-2"
+	assert.NotEqual(t, transactionIDs(t, targetInput(a)), transactionIDs(t, targetInput(b)))
+}
+
+func TestAgentConfig(t *testing.T) {
+	cfg := agentConfig(models.Input{BreakdownMetrics: true, MetricsInterval: 5 * time.Second})
+	assert.True(t, cfg.BreakdownMetrics)
+	assert.Equal(t, 5*time.Second, cfg.MetricsInterval)
+
+	cfg = agentConfig(models.Input{MetricsInterval: 10 * time.Second})
+	assert.False(t, cfg.BreakdownMetrics)
+	assert.Equal(t, 10*time.Second, cfg.MetricsInterval)
+}
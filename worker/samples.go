@@ -0,0 +1,83 @@
+package worker
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/agent"
+)
+
+// writeSamples dumps every request sample to a file, in a format given by its extension:
+// tab separated values for .tsv, gzipped NDJSON for .ndjson.gz, and comma separated values otherwise.
+func writeSamples(path string, samples []agent.RequestSample) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch {
+	case strings.HasSuffix(path, ".ndjson.gz"):
+		err = writeNDJSON(f, samples)
+	case filepath.Ext(path) == ".tsv":
+		err = writeCSV(f, '\t', samples)
+	default:
+		err = writeCSV(f, ',', samples)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeCSV(w io.Writer, comma rune, samples []agent.RequestSample) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	cw.Write([]string{"timestamp", "duration_ms", "status", "bytes_sent"})
+	for _, s := range samples {
+		cw.Write([]string{
+			s.Timestamp.Format(time.RFC3339Nano),
+			strconv.FormatFloat(float64(s.Duration)/float64(time.Millisecond), 'f', 3, 64),
+			strconv.Itoa(s.Status),
+			strconv.FormatInt(s.BytesSent, 10),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeNDJSON(w io.Writer, samples []agent.RequestSample) error {
+	gw := gzip.NewWriter(w)
+	enc := json.NewEncoder(gw)
+	for _, s := range samples {
+		err := enc.Encode(map[string]interface{}{
+			"@timestamp":  s.Timestamp,
+			"duration_ms": float64(s.Duration) / float64(time.Millisecond),
+			"status":      s.Status,
+			"bytes_sent":  s.BytesSent,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return gw.Close()
+}
+
+// targetPath inserts the target name in a file path, before its extension.
+func targetPath(path, target string) string {
+	if target == "" {
+		return path
+	}
+	dir, file := filepath.Split(path)
+	if idx := strings.Index(file, "."); idx > 0 {
+		return dir + file[:idx] + "-" + target + file[idx:]
+	}
+	return path + "-" + target
+}
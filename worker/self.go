@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"time"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+)
+
+const (
+	selfFlushTimeout    = 10 * time.Second
+	selfMetricsInterval = 30 * time.Second
+)
+
+// instrumentation traces the phases of a run with its own Go agent, so that hey-apm behavior can be
+// analyzed without polluting the apm-server under test.
+// A nil instrumentation is valid and does nothing.
+type instrumentation struct {
+	tracer *agent.Tracer
+	tx     *apm.Transaction
+}
+
+// startInstrumentation returns a new instrumentation if the input asks for it, nil otherwise.
+func startInstrumentation(input models.Input, logger apm.Logger) *instrumentation {
+	if input.SelfApmServerUrl == "" {
+		return nil
+	}
+	tracer, err := agent.NewTracer(logger, agent.Config{
+		ServerUrl:       input.SelfApmServerUrl,
+		ServerSecret:    input.SelfApmServerSecret,
+		APIKey:          input.SelfAPIKey,
+		ServiceName:     "hey-apm",
+		MetricsInterval: selfMetricsInterval,
+		FlushTimeout:    selfFlushTimeout,
+		Capture:         agent.CaptureNone,
+	})
+	if err != nil {
+		logger.Errorf("self instrumentation disabled: %s", err.Error())
+		return nil
+	}
+	name := "run"
+	if input.TargetName != "" {
+		name += " " + input.TargetName
+	}
+	tx := tracer.StartTransaction(name, "hey-apm")
+	tx.Context.SetTag("apm_url", input.ApmServerUrl)
+	return &instrumentation{tracer, tx}
+}
+
+// phase starts a span for a phase of the run, and returns a function to end it.
+func (i *instrumentation) phase(name string) func() {
+	if i == nil {
+		return func() {}
+	}
+	span := i.tx.StartSpan(name, "hey-apm.phase", nil)
+	return span.End
+}
+
+// timed records a phase of the run that already happened.
+func (i *instrumentation) timed(name string, start, end time.Time) {
+	if i == nil || start.IsZero() || end.Before(start) {
+		return
+	}
+	span := i.tx.StartSpanOptions(name, "hey-apm.phase", apm.SpanOptions{Start: start})
+	span.Duration = end.Sub(start)
+	span.End()
+}
+
+// end reports the error if any, ends the run transaction and flushes all data.
+func (i *instrumentation) end(err error) {
+	if i == nil {
+		return
+	}
+	if err != nil {
+		e := i.tracer.NewError(err)
+		e.SetTransaction(i.tx)
+		e.Send()
+		i.tx.Result = "failure"
+	} else {
+		i.tx.Result = "success"
+	}
+	i.tx.End()
+	i.tracer.Flush(nil)
+	i.tracer.Close()
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+// shaper modulates the rate of a generator over the run, with a rate curve compressed into the run duration
+// and the multipliers of the phases of the run, if given:
+// the generator ticks at the peak rate, and admits the fraction of ticks given by the multiplier at each time.
+type shaper struct {
+	start time.Time
+	// played once over period, if not nil
+	curve  *rateCurve
+	period time.Duration
+	// phases of the run, if any
+	phases []ratePhase
+	// highest multiplier
+	peak float64
+	// fraction of a tick accumulated since the last admitted one
+	credit float64
+}
+
+// newShaper returns a shaper of the rate of a generator starting now, or nil if the input doesn't modulate rates.
+func newShaper(curve *rateCurve, input models.Input) *shaper {
+	s := &shaper{start: time.Now(), peak: 1}
+	if curve != nil && input.RunTimeout > 0 {
+		s.curve, s.period, s.peak = curve, input.RunTimeout, curve.max
+	}
+	if s.phases = runPhases(input); len(s.phases) > 0 {
+		s.peak *= peakMultiplier(s.phases)
+	}
+	if s.curve == nil && len(s.phases) == 0 {
+		return nil
+	}
+	return s
+}
+
+// multiplier returns the multiplier of the rate at some time since the start.
+func (s *shaper) multiplier(elapsed time.Duration) float64 {
+	m := 1.0
+	if s.curve != nil {
+		m = s.curve.multiplier(time.Duration(float64(elapsed) / float64(s.period) * float64(day)))
+	}
+	if len(s.phases) > 0 {
+		m *= phaseMultiplier(s.phases, elapsed)
+	}
+	return m
+}
+
+// interval returns the interval between ticks of a generator with the given interval at a multiplier of 1.
+func (s *shaper) interval(base time.Duration) time.Duration {
+	if s == nil {
+		return base
+	}
+	if d := time.Duration(float64(base) / s.peak); d > 0 {
+		return d
+	}
+	return 1
+}
+
+// admit returns whether the generator generates an event on this tick.
+func (s *shaper) admit() bool {
+	if s == nil {
+		return true
+	}
+	s.credit += s.multiplier(time.Since(s.start)) / s.peak
+	if s.credit >= 1 {
+		s.credit--
+		return true
+	}
+	return false
+}
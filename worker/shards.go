@@ -0,0 +1,138 @@
+package worker
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/elastic/hey-apm/models"
+)
+
+// shards runs the workload of a sharded run in child processes, each one generating its share of it.
+type shards struct {
+	input models.Input
+
+	mu      sync.Mutex
+	results []Result
+}
+
+// newShards returns the shards of the input, or nil if it is not sharded across processes.
+func newShards(input models.Input) *shards {
+	if input.Procs <= 1 {
+		return nil
+	}
+	return &shards{input: input}
+}
+
+// addShards adds to the worker a routine running the child processes and collecting their results,
+// which returns when all of them exit. They are interrupted if the worker stops first.
+func (w *worker) addShards(s *shards) {
+	if s == nil {
+		return
+	}
+	w.Add(func(ctx context.Context) error {
+		dir, err := ioutil.TempDir("", "hey-apm-shards")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+		self, err := os.Executable()
+		if err != nil {
+			return err
+		}
+
+		cmds := make([]*exec.Cmd, s.input.Procs)
+		exited := make(chan error, len(cmds))
+		for i := range cmds {
+			args := append(append([]string(nil), s.input.ShardArgs...),
+				"-replay-seed", strconv.FormatInt(s.input.Seed, 10),
+				"-shard", strconv.Itoa(i), "-shard-output", filepath.Join(dir, strconv.Itoa(i)))
+			cmds[i] = exec.Command(self, args...)
+			cmds[i].Stdout, cmds[i].Stderr = os.Stderr, os.Stderr
+			if err := cmds[i].Start(); err != nil {
+				return err
+			}
+			go func(cmd *exec.Cmd) {
+				exited <- cmd.Wait()
+			}(cmds[i])
+		}
+		go func() {
+			<-ctx.Done()
+			for _, cmd := range cmds {
+				cmd.Process.Signal(os.Interrupt)
+			}
+		}()
+		for range cmds {
+			<-exited
+		}
+
+		// shards exit with an error if interrupted, so only missing results are errors
+		for i := range cmds {
+			result, err := readShardResult(filepath.Join(dir, strconv.Itoa(i)))
+			if err != nil {
+				return fmt.Errorf("shard %d of %d failed: %s", i, len(cmds), err)
+			}
+			s.mu.Lock()
+			s.results = append(s.results, result)
+			s.mu.Unlock()
+		}
+		return nil
+	})
+}
+
+// add aggregates the results of all the shards into result.
+func (s *shards) add(result Result) Result {
+	if s == nil {
+		return result
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.results {
+		result = result.add(r)
+	}
+	return result
+}
+
+// RunShard generates the share of the workload of a sharded run given by input.ShardIndex,
+// and writes the stats captured to input.ShardOutput for the parent process to merge them.
+func RunShard(input models.Input) error {
+	input.TargetName = fmt.Sprintf("shard-%d", input.ShardIndex)
+	w, err := prepareWork(input.Shard(input.ShardIndex, input.Procs))
+	if err != nil {
+		return err
+	}
+	result, err := w.work(context.Background())
+	if werr := writeShardResult(input.ShardOutput, result); werr != nil {
+		return werr
+	}
+	return err
+}
+
+func writeShardResult(path string, result Result) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := gob.NewEncoder(f).Encode(result); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func readShardResult(path string) (Result, error) {
+	var result Result
+	f, err := os.Open(path)
+	if err != nil {
+		return result, err
+	}
+	defer f.Close()
+	err = gob.NewDecoder(f).Decode(&result)
+	return result, err
+}
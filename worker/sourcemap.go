@@ -0,0 +1,193 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/numbers"
+	"github.com/elastic/hey-apm/server"
+	"github.com/elastic/hey-apm/strcoll"
+	"github.com/elastic/hey-apm/types"
+)
+
+const (
+	// bundleFilepath is the URL of the made-up javascript bundle the generated sourcemap maps
+	bundleFilepath = "http://hey-apm.local/static/bundle.js"
+	// bundleLines is the number of lines of the bundle, each one mapped to a line of the original source
+	bundleLines = 1000
+	// sourcemapServiceVersion is the service version sourcemaps are uploaded for, unless given in the input
+	sourcemapServiceVersion = "1.0.0"
+)
+
+// generateSourcemap returns a sourcemap mapping each line of the bundle to the same line of an original source file.
+func generateSourcemap() []byte {
+	// AAAA maps the first column of the first line to the first line of the first source,
+	// AACA maps the first column of each following line to the next line of the same source
+	mappings := "AAAA" + strings.Repeat(";AACA", bundleLines-1)
+	b, _ := json.Marshal(types.M{
+		"version":  3,
+		"file":     "bundle.js",
+		"sources":  []string{"webpack:///./src/generated.js"},
+		"names":    []string{},
+		"mappings": mappings,
+	})
+	return b
+}
+
+// bundleVersion returns the service version sourcemaps are uploaded for, and RUM errors are sent with.
+func bundleVersion(input models.Input) string {
+	if input.ServiceVersion != "" {
+		return input.ServiceVersion
+	}
+	return sourcemapServiceVersion
+}
+
+// uploadSourcemap uploads a generated sourcemap for the bundle to Kibana if KibanaUrl is given,
+// or to apm-server otherwise.
+func uploadSourcemap(input models.Input) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("service_name", input.ServiceName)
+	form.WriteField("service_version", bundleVersion(input))
+	form.WriteField("bundle_filepath", bundleFilepath)
+	part, err := form.CreateFormFile("sourcemap", "bundle.js.map")
+	if err != nil {
+		return err
+	}
+	part.Write(generateSourcemap())
+	form.Close()
+
+	var req *http.Request
+	if input.KibanaUrl != "" {
+		req, err = http.NewRequest("POST", strings.TrimSuffix(input.KibanaUrl, "/")+"/api/apm/sourcemaps", &body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("kbn-xsrf", "true")
+		if input.KibanaAuth != "" {
+			req.SetBasicAuth(strcoll.SplitKV(input.KibanaAuth, ":"))
+		}
+	} else {
+		req, err = http.NewRequest("POST", strings.TrimSuffix(input.ApmServerUrl, "/")+"/assets/v1/sourcemaps", &body)
+		if err != nil {
+			return err
+		}
+		if auth := server.Authorization(input.ApmServerSecret, input.APIKey); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		rb, _ := ioutil.ReadAll(resp.Body)
+		return errors.New(fmt.Sprintf("sourcemap upload status not OK: %s %s", resp.Status, rb))
+	}
+	return nil
+}
+
+// rumErrors returns an NDJSON payload for the RUM intake endpoint with one error whose stacktrace frames
+// reference lines of the bundle, so that apm-server applies the uploaded sourcemap to them.
+func rumErrors(input models.Input, frames int) []byte {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.Encode(types.M{"metadata": types.M{"service": types.M{
+		"name":     input.ServiceName,
+		"version":  bundleVersion(input),
+		"agent":    types.M{"name": "rum-js", "version": "5.6.3"},
+		"language": types.M{"name": "javascript"},
+	}}})
+	stacktrace := make([]types.M, frames)
+	for i := range stacktrace {
+		stacktrace[i] = types.M{
+			"abs_path": bundleFilepath,
+			"filename": "static/bundle.js",
+			"function": fmt.Sprintf("generated%d", i),
+			"lineno":   i%bundleLines + 1,
+			"colno":    1,
+		}
+	}
+	enc.Encode(types.M{"error": types.M{
+		"id":        shortId() + shortId(),
+		"timestamp": time.Now().UnixNano() / int64(time.Microsecond),
+		"culprit":   "static/bundle.js",
+		"exception": types.M{
+			"message":    "Generated sourcemapped error",
+			"type":       "Error",
+			"stacktrace": stacktrace,
+		},
+	}})
+	return buf.Bytes()
+}
+
+// sendSourcemappedErrors returns a function sending a RUM error referencing the uploaded sourcemap every
+// SourcemapInterval, with as many stacktrace frames as ErrorFrameMaxLimit, until its context is done.
+func sendSourcemappedErrors(input models.Input, stats *pollStats) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		client := &http.Client{Timeout: pollTimeout}
+		u := strings.TrimSuffix(input.ApmServerUrl, "/") + "/intake/v2/rum/events"
+		frames := input.ErrorFrameMaxLimit
+		if frames < 1 {
+			frames = 1
+		}
+		ticker := time.NewTicker(input.SourcemapInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			req, err := http.NewRequest("POST", u, bytes.NewReader(rumErrors(input, frames)))
+			if err != nil {
+				return err
+			}
+			req.Header.Set("Content-Type", "application/x-ndjson")
+			start := time.Now()
+			var status int
+			resp, err := client.Do(req)
+			if err == nil {
+				io.Copy(ioutil.Discard, resp.Body)
+				resp.Body.Close()
+				status = resp.StatusCode
+			}
+			stats.add(status, err, time.Since(start))
+		}
+	}
+}
+
+// addSourcemappedErrors adds to the report and prints the sourcemapped RUM error requests sent, if any.
+func addSourcemappedErrors(stats *pollStats, report models.Report, out io.Writer) models.Report {
+	if stats == nil {
+		return report
+	}
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	report.SourcemapRequests = stats.requests
+	report.SourcemapFailed = stats.failed
+	report.SourcemapLatencyP50 = numbers.Percentile(stats.latencies, 50)
+	report.SourcemapLatencyP99 = numbers.Percentile(stats.latencies, 99)
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("sourcemapped error requests", report.SourcemapRequests)
+	metrics.Add(" - failed", report.SourcemapFailed)
+	if report.SourcemapLatencyP50 != nil {
+		metrics.Add("sourcemap latency p50 (ms)", *report.SourcemapLatencyP50)
+		metrics.Add("sourcemap latency p99 (ms)", *report.SourcemapLatencyP99)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
@@ -0,0 +1,29 @@
+package worker
+
+import (
+	"fmt"
+
+	"go.elastic.co/apm/model"
+)
+
+// sourceContext sets lines of made-up source code around stacktrace frames,
+// so that the cost of storing source context is represented.
+type sourceContext struct {
+	lines int
+}
+
+// SetContext sets c.lines lines of pre and post context, regardless of the agent configuration.
+func (c sourceContext) SetContext(frame *model.StacktraceFrame, _, _ int) error {
+	frame.ContextLine = sourceLine(frame.Line)
+	frame.PreContext = make([]string, c.lines)
+	frame.PostContext = make([]string, c.lines)
+	for i := 0; i < c.lines; i++ {
+		frame.PreContext[i] = sourceLine(frame.Line - c.lines + i)
+		frame.PostContext[i] = sourceLine(frame.Line + i + 1)
+	}
+	return nil
+}
+
+func sourceLine(n int) string {
+	return fmt.Sprintf("\tgenerated[%d] = oops(%d) // generated source code", n, n)
+}
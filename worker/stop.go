@@ -0,0 +1,88 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// errorRateWindow is the time window over which the rolling request error rate is computed.
+const errorRateWindow = 10 * time.Second
+
+// StopError is returned when a run is aborted early because a stop condition was met.
+type StopError struct {
+	Condition string
+}
+
+func (e StopError) Error() string {
+	return "run aborted: " + e.Condition
+}
+
+// AuthError is returned when apm-server rejects requests as unauthorized.
+type AuthError struct {
+	Failures uint64
+}
+
+func (e AuthError) Error() string {
+	return fmt.Sprintf("run aborted: %d requests rejected as unauthorized, check the secret token or API key", e.Failures)
+}
+
+type requestSample struct {
+	requests, failed, authFailures uint64
+}
+
+// addStopConditions aborts the work as soon as apm-server rejects a request as unauthorized,
+// when the cumulative failed requests exceed maxErrors, or when the percentage of failed requests
+// over the last errorRateWindow exceeds maxErrorRate.
+// Zero values disable the respective condition.
+func (w *worker) addStopConditions(maxErrors int, maxErrorRate float64) {
+	w.Add(func(ctx context.Context) error {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		var samples []requestSample
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			stats := w.TransportStats()
+			samples = append(samples, requestSample{
+				requests:     stats.NumRequests,
+				failed:       w.Stats().Errors.SendStream,
+				authFailures: stats.AuthFailures,
+			})
+			if len(samples) > int(errorRateWindow/time.Second)+1 {
+				samples = samples[1:]
+			}
+			if err := stopCondition(samples, maxErrors, maxErrorRate); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// stopCondition returns the error of the first stop condition met by samples taken every second, oldest first,
+// or nil if none is.
+// Failed requests are also counted as requests, so the error rate is relative to the requests in the window.
+func stopCondition(samples []requestSample, maxErrors int, maxErrorRate float64) error {
+	oldest, current := samples[0], samples[len(samples)-1]
+	if current.authFailures > 0 {
+		return AuthError{current.authFailures}
+	}
+	if maxErrors > 0 && current.failed > uint64(maxErrors) {
+		return StopError{fmt.Sprintf("%d failed requests exceed the limit of %d", current.failed, maxErrors)}
+	}
+	failed, total := current.failed-oldest.failed, current.requests-oldest.requests
+	if maxErrorRate > 0 && total > 0 {
+		// requests failing between reading both stats are counted as failed before they are as requests
+		rate := math.Min(float64(failed)*100/float64(total), 100)
+		if rate > maxErrorRate {
+			return StopError{fmt.Sprintf("%.2f%% failed requests in the last %s exceed the limit of %.2f%%",
+				rate, errorRateWindow, maxErrorRate)}
+		}
+	}
+	return nil
+}
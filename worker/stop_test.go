@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStopCondition(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		samples      []requestSample
+		maxErrors    int
+		maxErrorRate float64
+		err          error
+	}{
+		{"none", []requestSample{{}, {requests: 10, failed: 10}}, 0, 0, nil},
+		{"unauthorized", []requestSample{{requests: 1, authFailures: 1}}, 0, 0, AuthError{1}},
+		{"max errors", []requestSample{{requests: 10, failed: 3}}, 3, 0, nil},
+		{"max errors exceeded", []requestSample{{requests: 10, failed: 4}}, 3, 0,
+			StopError{"4 failed requests exceed the limit of 3"}},
+		{"no requests", []requestSample{{requests: 10, failed: 5}, {requests: 10, failed: 5}}, 0, 10, nil},
+		{"error rate", []requestSample{{requests: 10, failed: 5}, {requests: 20, failed: 6}}, 0, 10, nil},
+		// failed requests are not counted twice, which would make it 50%
+		{"error rate exceeded", []requestSample{{requests: 10}, {requests: 20, failed: 10}}, 0, 60,
+			StopError{"100.00% failed requests in the last 10s exceed the limit of 60.00%"}},
+		{"error rate of window", []requestSample{{requests: 10, failed: 10}, {requests: 20, failed: 11}}, 0, 10, nil},
+		{"error rate capped", []requestSample{{requests: 10}, {requests: 11, failed: 2}}, 0, 99,
+			StopError{"100.00% failed requests in the last 10s exceed the limit of 99.00%"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.err, stopCondition(tc.samples, tc.maxErrors, tc.maxErrorRate))
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package worker
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/elastic/hey-apm/conv"
+	"github.com/elastic/hey-apm/es"
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// apmIndicesSize returns the size of apm-server indices, after force merging them if so requested,
+// or nil if index stats are not requested or not known.
+func apmIndicesSize(logger *log.Logger, input models.Input, conn es.Connection) *int64 {
+	if !input.IndexStats {
+		return nil
+	}
+	if input.Forcemerge {
+		if err := es.ForcemergeApmIndices(conn); err != nil {
+			logger.Println(err.Error())
+		}
+	}
+	size, err := es.ApmIndicesSize(conn)
+	if err != nil {
+		logger.Println(err.Error())
+		return nil
+	}
+	return &size
+}
+
+// addStorage adds to the report and prints the bytes stored by apm-server indices since the run started,
+// given their size back then.
+func addStorage(logger *log.Logger, input models.Input, conn es.Connection, before *int64,
+	report models.Report, out io.Writer) models.Report {
+	if before == nil {
+		return report
+	}
+	after := apmIndicesSize(logger, input, conn)
+	if after == nil {
+		return report
+	}
+	stored := *after - *before
+	report.IndexBytes = &stored
+	report = report.WithDerivedAttributes()
+
+	metrics := strcoll.NewTuples()
+	metrics.Add("bytes stored", conv.ByteCountDecimal(stored))
+	if report.BytesPerEvent != nil {
+		metrics.Add(" - per event indexed", *report.BytesPerEvent)
+	}
+	fmt.Fprintln(out, metrics.Format(30))
+	return report
+}
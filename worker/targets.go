@@ -0,0 +1,97 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/elastic/hey-apm/server"
+)
+
+// RunTargets executes concurrently a load test work for each of the input targets,
+// prints per-target and aggregated results, and returns the per-target reports followed by their aggregate,
+// along the last error found.
+// The aggregate report is sent to the reporters and checked against the assertions of the input, as a single run.
+func RunTargets(input models.Input) ([]models.Report, error) {
+	n := len(input.Targets)
+	results := make([]Result, n)
+	reports := make([]models.Report, n)
+	outs := make([]bytes.Buffer, n)
+	errs := make([]error, n)
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for idx, target := range input.Targets {
+		target = targetInput(target)
+		go func(idx int, target models.Input) {
+			defer wg.Done()
+			results[idx], reports[idx], errs[idx] = run(context.Background(), target, &outs[idx], nil)
+		}(idx, target)
+	}
+	wg.Wait()
+
+	var err error
+	var total Result
+	for idx, target := range input.Targets {
+		fmt.Printf("==== target %s (%s)\n", target.TargetName, target.ApmServerUrl)
+		fmt.Print(outs[idx].String())
+		if errs[idx] != nil {
+			fmt.Println(errs[idx])
+			err = errs[idx]
+		}
+		total = total.add(results[idx])
+	}
+	fmt.Println("==== all targets")
+	fmt.Println(total)
+
+	aggregate := aggregateReport(input, total, reports, os.Stdout)
+	logger := log.New(os.Stderr, "[all targets] ", log.Ldate|log.Ltime|log.Lshortfile)
+	if rerr := sendReport(newReporters(logger, input), aggregate, total); rerr != nil && err == nil {
+		err = rerr
+	}
+	if aerr := checkAssertions(input, aggregate, os.Stdout); aerr != nil && err == nil {
+		err = aerr
+	}
+	return append(reports, aggregate), err
+}
+
+// aggregateReport returns the report of the total results of all the targets of input.
+// Events indexed are summed across the Elasticsearch clusters of the targets, taking the most seen by the targets of
+// each cluster, as all of them see the events indexed by the others. Aggregation checks are left to each target.
+func aggregateReport(input models.Input, total Result, reports []models.Report, out io.Writer) models.Report {
+	input.CheckAggregation = false
+	report := createReport(shortId(), input, total, server.Status{}, server.Status{}, ioutil.Discard)
+	clusters := make(map[string]models.Report)
+	for _, r := range reports {
+		c := clusters[r.ApmElasticsearchUrl]
+		c.TransactionsIndexed = max64(c.TransactionsIndexed, r.TransactionsIndexed)
+		c.SpansIndexed = max64(c.SpansIndexed, r.SpansIndexed)
+		c.ErrorsIndexed = max64(c.ErrorsIndexed, r.ErrorsIndexed)
+		clusters[r.ApmElasticsearchUrl] = c
+	}
+	for _, c := range clusters {
+		report.TransactionsIndexed += c.TransactionsIndexed
+		report.SpansIndexed += c.SpansIndexed
+		report.ErrorsIndexed += c.ErrorsIndexed
+	}
+	report = report.WithDerivedAttributes()
+	return addApdex(input, total, report, out)
+}
+
+func max64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// targetInput returns the input of a target, seeded after its name and service so that targets send different IDs.
+func targetInput(target models.Input) models.Input {
+	return target.Reseed("target " + target.TargetName + " " + target.ServiceName)
+}
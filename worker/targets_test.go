@@ -0,0 +1,35 @@
+package worker
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/elastic/hey-apm/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAggregateReport(t *testing.T) {
+	start := time.Now()
+	a := Result{Start: start, End: start.Add(time.Second), Flushed: start.Add(2 * time.Second)}
+	a.NumRequests, a.TransactionsSent, a.Accepted = 10, 100, 100
+	b := Result{Start: start, End: start.Add(time.Second), Flushed: start.Add(2 * time.Second)}
+	b.NumRequests, b.TransactionsSent, b.Accepted = 30, 300, 300
+	reports := []models.Report{
+		{Input: models.Input{ApmElasticsearchUrl: "http://es1"}, TransactionsIndexed: 390},
+		{Input: models.Input{ApmElasticsearchUrl: "http://es1"}, TransactionsIndexed: 400},
+		{Input: models.Input{ApmElasticsearchUrl: "http://es2"}, TransactionsIndexed: 50},
+	}
+
+	report := aggregateReport(models.Input{CheckAggregation: true}, a.add(b), reports, ioutil.Discard)
+	assert.NotEmpty(t, report.ReportId)
+	assert.False(t, report.CheckAggregation)
+	assert.Equal(t, uint64(40), report.Requests)
+	assert.Equal(t, uint64(400), report.TransactionsSent)
+	assert.Equal(t, uint64(400), report.EventsAccepted)
+	// all the events indexed in each cluster are seen by every target
+	assert.Equal(t, uint64(450), report.TransactionsIndexed)
+	if assert.NotNil(t, report.EventAcceptRate) {
+		assert.Equal(t, 200.0, *report.EventAcceptRate)
+	}
+}
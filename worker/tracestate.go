@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"math/rand"
+	"strings"
+
+	"go.elastic.co/apm"
+
+	"github.com/elastic/hey-apm/strcoll"
+)
+
+// upstream makes transactions continue traces started by an upstream service, propagating a W3C tracestate
+// and baggage to them as in the tracestate and baggage headers.
+type upstream struct {
+	state   apm.TraceState
+	baggage [][2]string
+}
+
+// newUpstream returns an upstream with the given key=value tracestate entries and baggage members,
+// or nil if none are given.
+func newUpstream(tracestate, baggage []string) *upstream {
+	if len(tracestate) == 0 && len(baggage) == 0 {
+		return nil
+	}
+	u := &upstream{}
+	var entries []apm.TraceStateEntry
+	for _, kv := range tracestate {
+		k, v := strcoll.SplitKV(kv, "=")
+		entries = append(entries, apm.TraceStateEntry{Key: k, Value: v})
+	}
+	u.state = apm.NewTraceState(entries...)
+	for _, kv := range baggage {
+		k, v := strcoll.SplitKV(kv, "=")
+		u.baggage = append(u.baggage, [2]string{k, v})
+	}
+	return u
+}
+
+// traceContext returns the context of a new sampled trace with random Ids, as propagated by the upstream service.
+// Agents supporting it take the sample rate of the transaction from the es tracestate entry, eg. es=s:0.5.
+func (u *upstream) traceContext(r *rand.Rand) apm.TraceContext {
+	tc := newTraceContext(r)
+	tc.Span = newSpanID(r)
+	tc.State = u.state
+	return tc
+}
+
+// label adds the baggage to ctx as labels prefixed with baggage_, as agents configured to attach baggage do.
+func (u *upstream) label(ctx *apm.Context) {
+	if u == nil {
+		return
+	}
+	for _, member := range u.baggage {
+		ctx.SetTag("baggage_"+strings.Replace(member[0], ".", "_", -1), member[1])
+	}
+}
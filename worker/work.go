@@ -2,8 +2,8 @@ package worker
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"os/signal"
@@ -14,173 +14,508 @@ import (
 	"github.com/elastic/hey-apm/internal/heptio/workgroup"
 
 	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/distribution"
+	"github.com/elastic/hey-apm/models"
 
 	"go.elastic.co/apm"
 	"go.elastic.co/apm/stacktrace"
 )
 
+const drainPollInterval = 100 * time.Millisecond
+
 type worker struct {
 	*apmLogger
-	*agent.Tracer
+	// creates events and delivers them
+	agent.Sender
 	RunTimeout   time.Duration
-	FlushTimeout time.Duration
+	DrainTimeout time.Duration
+	// tracks the pace of generators
+	pacing *pacingMonitor
 
 	// not to be modified concurrently
 	workgroup.Group
 }
 
-// work uses the Go agent API to generate events and send them to apm-server.
-func (w *worker) work() (Result, error) {
+// work generates events with the sender, which sends them to apm-server,
+// until the run timeout expires, any generator or stop condition returns, or ctx is done.
+func (w *worker) work(ctx context.Context) (Result, error) {
+	runCtx := ctx
 	if w.RunTimeout > 0 {
-		w.Add(func(done <-chan struct{}) error {
-			select {
-			case <-done:
-				return nil
-			case <-time.After(w.RunTimeout):
-				return nil // time expired
-			}
-		})
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, w.RunTimeout)
+		defer cancel()
 	}
 
 	result := Result{}
 	result.Start = time.Now()
-	err := w.Run()
+	err := w.Run(runCtx)
+	if err == nil {
+		err = ctx.Err()
+	}
 	result.End = time.Now()
-	w.flush()
+	atStop := w.TransportStats()
+	result.AcknowledgedAtStop = atStop.Accepted + atStop.Rejected
+	w.Flush(ctx.Done())
 	result.Flushed = time.Now()
+	w.drain(ctx)
+	result.Drained = time.Now()
+	w.Close()
 	result.TracerStats = w.Stats()
-	result.TransportStats = *w.TransportStats
+	result.TransportStats = w.TransportStats()
+	if m, ok := w.Sender.(mirrorer); ok {
+		if stats, ok := m.MirrorTransportStats(); ok {
+			result.Mirror = &stats
+		}
+	}
 
 	return result, err
 }
 
-// flush ensures that the entire workload defined is pushed to the apm-server, within the worker timeout limit.
-func (w *worker) flush() {
-	flushed := make(chan struct{})
-	go func() {
-		w.Flush(nil)
-		close(flushed)
-	}()
-
-	flushWait := time.After(w.FlushTimeout)
-	if w.FlushTimeout == 0 {
-		flushWait = make(<-chan time.Time)
+// drain waits until apm-server acknowledges all the events sent, the drain timeout expires, or ctx is done.
+// Events are only acknowledged with verbose responses, otherwise it returns right away.
+func (w *worker) drain(ctx context.Context) {
+	if w.DrainTimeout <= 0 || !w.TransportStats().Verbose {
+		return
 	}
-	select {
-	case <-flushed:
-	case <-flushWait:
-		// give up waiting for flush
-		w.Errorf("timed out waiting for flush to complete")
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(w.DrainTimeout)
+	defer timeout.Stop()
+	for {
+		r := Result{TracerStats: w.Stats(), TransportStats: w.TransportStats()}
+		if r.EventsUnacknowledged() == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeout.C:
+			w.Errorf("timed out waiting for %d events to be acknowledged", r.EventsUnacknowledged())
+			return
+		case <-ticker.C:
+		}
 	}
-	w.Close()
 }
 
 type generatedErr struct {
 	frames int
+	// fraction of frames belonging to vendored libraries
+	libraryRatio float64
+	// variant indexes, to pick one of a pool of exception types and messages
+	typ, message int
+	// wrapped error, if any
+	cause *generatedErr
+	// message overriding the generated one, if not empty
+	text string
+}
+
+// newGeneratedErr returns an error wrapping depth nested errors.
+func newGeneratedErr(frames int, libraryRatio float64, typ, message, depth int) *generatedErr {
+	e := &generatedErr{frames: frames, libraryRatio: libraryRatio, typ: typ, message: message}
+	if depth > 0 {
+		e.cause = newGeneratedErr(frames, libraryRatio, typ, message, depth-1)
+	}
+	return e
+}
+
+// Cause returns the wrapped error, reported as exception cause by agents supporting it.
+func (e *generatedErr) Cause() error {
+	if e.cause == nil {
+		return nil
+	}
+	return e.cause
+}
+
+// Unwrap is like Cause, for the standard library errors package.
+func (e *generatedErr) Unwrap() error {
+	return e.Cause()
 }
 
 func (e *generatedErr) Error() string {
+	if e.text != "" {
+		return e.text
+	}
 	plural := "s"
 	if e.frames == 1 {
 		plural = ""
 	}
+	if e.message > 0 {
+		return fmt.Sprintf("Generated error #%d with %d stacktrace frame%s", e.message, e.frames, plural)
+	}
 	return fmt.Sprintf("Generated error with %d stacktrace frame%s", e.frames, plural)
 }
 
+// Type overrides the exception type reported by the agent, which otherwise is the Go type name.
+func (e *generatedErr) Type() string {
+	if e.typ > 0 {
+		return fmt.Sprintf("GeneratedError%d", e.typ)
+	}
+	return "generatedErr"
+}
+
 // must be public for apm agent to use it - https://www.elastic.co/guide/en/apm/agent/go/current/api.html#error-api
 func (e *generatedErr) StackTrace() []stacktrace.Frame {
 	st := make([]stacktrace.Frame, e.frames)
+	libraryFrames := int(e.libraryRatio * float64(e.frames))
 	for i := 0; i < e.frames; i++ {
 		st[i] = stacktrace.Frame{
 			File:     "fake.go",
 			Function: "oops",
 			Line:     i + 100,
 		}
+		// innermost frames are library code called from the application
+		if i < libraryFrames {
+			st[i].File = "/go/src/app/vendor/github.com/generated/lib/fake.go"
+			st[i].Function = "app/vendor/github.com/generated/lib.oops"
+		}
 	}
 	return st
 }
 
-func (w *worker) addErrors(frequency time.Duration, limit, framesMin, framesMax int) {
+// generateErrors generates errors with a random number of stacktrace frames, as defined by the input,
+// with a fraction of them being library frames.
+// Exception types, messages and culprits are picked at random from pools with the given cardinality.
+// A fraction of errors given by ErrorLogRatio are generated as log records instead of exceptions.
+// The error frequency is modulated over the run by RateCurve and spikes, if given.
+func generateErrors(sender agent.Sender, input models.Input) func(ctx context.Context) error {
+	limit, framesMin, framesMax := input.ErrorLimit, input.ErrorFrameMinLimit, input.ErrorFrameMaxLimit
 	if limit <= 0 {
-		return
+		return nil
 	}
-	t := throttle(time.NewTicker(frequency).C)
-	w.Add(func(done <-chan struct{}) error {
+	rnd := newRand(input.Seed, "error")
+	eventCtx := newEventContext(input.Users, input.CustomContextDepth, input.CustomContextSize, rnd)
+	fuzzer := newStringFuzzer(input.EdgeStringRatio, rnd)
+	// validated with the input
+	curve, _ := loadRateCurve(input.RateCurve)
+	return func(ctx context.Context) error {
+		shape := newShaper(curve, input)
+		ticker := time.NewTicker(shape.interval(input.ErrorFrequency))
+		defer ticker.Stop()
+		// the pace of shaped generators is not tracked, as their requested rate varies
+		var pace *pace
+		if shape == nil {
+			pace = trackPace(ctx, "error", input.ErrorFrequency, input.Seed)
+		}
 		var count int
 		for count < limit {
 			select {
-			case <-done:
+			case <-ctx.Done():
 				return nil
-			case <-t:
+			case <-ticker.C:
+			}
+			if !shape.admit() {
+				continue
 			}
+			pace.tick()
 
-			w.Tracer.NewError(&generatedErr{frames: rand.Intn(framesMax-framesMin+1) + framesMin}).Send()
+			err := newGeneratedErr(rnd.Intn(framesMax-framesMin+1)+framesMin, input.ErrorLibraryFrames,
+				pick(rnd, input.ErrorTypes), pick(rnd, input.ErrorMessages), input.ErrorCauseDepth)
+			err.text = fuzzer.fuzz(err.Error())
+			var e *apm.Error
+			if rnd.Float64() < input.ErrorLogRatio {
+				e = sender.NewErrorLog(apm.ErrorLogRecord{
+					Message:    err.Error(),
+					Level:      "error",
+					LoggerName: "generated",
+				})
+			} else {
+				e = sender.NewError(err)
+			}
+			rnd.Read(e.ID[:])
+			eventCtx.set(&e.Context)
+			setLabels(&e.Context, input.RunId, input.Labels)
+			fuzzer.label(&e.Context)
+			if input.ClockSkew != 0 {
+				e.Timestamp = e.Timestamp.Add(input.ClockSkew)
+			}
+			if culprit := pick(rnd, input.ErrorCulprits); culprit > 0 {
+				e.Culprit = fuzzer.fuzz(fmt.Sprintf("generated.oops%d", culprit))
+			}
+			e.Send()
 			count++
 		}
 		return nil
-	})
+	}
 }
 
-func (w *worker) addTransactions(frequency time.Duration, limit, spanMin, spanMax int) {
+// generateTransactions generates transactions as defined by the input, with a random number of spans
+// of up to SpanTypes distinct types, followed by ExitSpans identical and consecutive exit spans,
+// as compressible by agents.
+// Transaction names are picked from the TransactionNames catalog, if given, except for a fraction given by
+// UniqueNameRatio, named after their own Id so that each one is a transaction group of its own.
+// Spans form trees SpanDepth levels deep, where every span but the deepest ones has SpanFanOut children,
+// under the transaction.
+// Transactions and spans last as sampled from their duration distributions, if given,
+// with timestamps set back so that they end when generated.
+// Timestamps are offset by ClockSkew, as agents with a bad clock do.
+// A fraction of transactions given by DroppedSpansRatio start more spans than allowed, so that the agent
+// drops between 1 and SpanMaxLimit of them.
+// A fraction of transactions given by IDCollisionRatio reuse the Ids of a previous transaction and its spans.
+// If TraceState or Baggage are given, the other transactions continue traces propagating them.
+// The transaction frequency is modulated over the run by RateCurve and spikes, if given.
+func generateTransactions(sender agent.Sender, input models.Input) func(ctx context.Context) error {
+	limit, spanMin, spanMax, spanTypes := input.TransactionLimit, input.SpanMinLimit, input.SpanMaxLimit, input.SpanTypes
 	if limit <= 0 {
-		return
+		return nil
 	}
-	t := throttle(time.NewTicker(frequency).C)
-	generateSpan := func(ctx context.Context) {
-		span, ctx := apm.StartSpan(ctx, "I'm a span", "gen.era.ted")
+	txDuration, _ := distribution.Parse(input.TransactionDuration)
+	spanDuration, _ := distribution.Parse(input.SpanDuration)
+	rnd := newRand(input.Seed, "transaction")
+	httpCtx := newHTTPContext(input.HTTPHeaders, input.HTTPBodySize)
+	eventCtx := newEventContext(input.Users, input.CustomContextDepth, input.CustomContextSize, rnd)
+	collider := newIdCollider(input.IDCollisionRatio, rnd)
+	propagated := newUpstream(input.TraceState, input.Baggage)
+	fuzzer := newStringFuzzer(input.EdgeStringRatio, rnd)
+	// validated with the input
+	curve, _ := loadRateCurve(input.RateCurve)
+	names, _ := loadNameCatalog(input.TransactionNames)
+
+	depth, fanOut := input.SpanDepth, input.SpanFanOut
+	treeSize := spanTreeSize(depth, fanOut)
+
+	// formatted once, rather than for every span
+	spanTypeNames := []string{"gen.era.ted"}
+	if spanTypes > 1 {
+		spanTypeNames = make([]string, spanTypes)
+		for i := range spanTypeNames {
+			spanTypeNames[i] = fmt.Sprintf("gen%d.era.ted", i)
+		}
+	}
+
+	// generateSpan generates a span and calls children, if not nil, with the span context before ending it
+	generateSpan := func(ctx context.Context, i int, name string, opts apm.SpanOptions, d time.Duration,
+		children func(ctx context.Context, d time.Duration)) {
+		span, ctx := apm.StartSpanOptions(ctx, name, spanTypeNames[i%len(spanTypeNames)], opts)
+		setLabels(&span.Context, input.RunId, input.Labels)
+		if children != nil {
+			children(ctx, d)
+		}
+		if d >= 0 {
+			span.Duration = d
+		} else if input.ClockSkew != 0 {
+			span.Duration = time.Since(opts.Start.Add(-input.ClockSkew))
+		}
+		span.End()
+	}
+	generateExitSpan := func(ctx context.Context) {
+		opts := apm.SpanOptions{SpanID: newSpanID(rnd)}
+		start := time.Now()
+		if input.ClockSkew != 0 {
+			opts.Start = start.Add(input.ClockSkew)
+		}
+		span, _ := apm.StartSpanOptions(ctx, fuzzer.fuzz("SELECT FROM generated"), "db.mysql.query", opts)
+		setLabels(&span.Context, input.RunId, input.Labels)
+		span.Context.SetDatabase(apm.DatabaseSpanContext{
+			Instance:  "generated",
+			Statement: "SELECT * FROM generated WHERE id = ?",
+			Type:      "sql",
+		})
+		span.Context.SetDestinationService(apm.DestinationServiceSpanContext{Name: "mysql", Resource: "mysql"})
+		if input.ClockSkew != 0 {
+			span.Duration = time.Since(start)
+		}
 		span.End()
 	}
 
-	generator := func(done <-chan struct{}) error {
+	return func(ctx context.Context) error {
+		shape := newShaper(curve, input)
+		ticker := time.NewTicker(shape.interval(input.TransactionFrequency))
+		defer ticker.Stop()
+		// the pace of shaped generators is not tracked, as their requested rate varies
+		var pace *pace
+		if shape == nil {
+			pace = trackPace(ctx, "transaction", input.TransactionFrequency, input.Seed)
+		}
 		var count int
 		for count < limit {
 			select {
-			case <-done:
+			case <-ctx.Done():
 				return nil
-			case <-t:
+			case <-ticker.C:
+			}
+			if !shape.admit() {
+				continue
+			}
+			pace.tick()
+
+			spanCount := rnd.Intn(spanMax-spanMin+1) + spanMin
+			txOpts, spanOpts := apm.TransactionOptions{}, apm.SpanOptions{}
+			d, spanDurations := sampleDurations(rnd, txDuration, spanDuration, spanCount)
+			start := time.Now()
+			if d >= 0 || input.ClockSkew != 0 {
+				txOpts.Start = start.Add(input.ClockSkew)
+				if d >= 0 {
+					txOpts.Start = txOpts.Start.Add(-d)
+				}
+				spanOpts.Start = txOpts.Start
 			}
 
-			tx := w.Tracer.StartTransaction("generated", "gen")
-			ctx := apm.ContextWithTransaction(context.Background(), tx)
+			previous, spanIds, colliding := collider.collide()
+			if colliding {
+				txOpts.TraceContext = apm.TraceContext{Trace: previous.Trace, Options: previous.Options}
+				txOpts.TransactionID = previous.Span
+			} else if propagated != nil {
+				txOpts.TraceContext = propagated.traceContext(rnd)
+				txOpts.TransactionID = newSpanID(rnd)
+			} else {
+				txOpts.TraceContext = newTraceContext(rnd)
+				txOpts.TransactionID = newSpanID(rnd)
+			}
+			name := names.pick(rnd)
+			if input.UniqueNameRatio > 0 && rnd.Float64() < input.UniqueNameRatio {
+				name = fmt.Sprintf("GET /unique/%x", txOpts.TransactionID[:])
+			}
+			tx := sender.StartTransactionOptions(fuzzer.fuzz(name), "gen", txOpts)
+			if colliding {
+				tx.Context.SetTag("id_collision", "true")
+			}
+			httpCtx.set(sender, tx, count)
+			eventCtx.set(&tx.Context)
+			propagated.label(&tx.Context)
+			txCtx := apm.ContextWithTransaction(ctx, tx)
+			// spans are generated concurrently, so their random names and Ids are picked beforehand
+			spanNames, spanIDs := make([]string, spanCount), make([]apm.SpanID, spanCount)
+			for i := range spanNames {
+				spanNames[i] = fuzzer.fuzz("I'm a span")
+				if i < len(spanIds) {
+					spanIDs[i] = spanIds[i]
+				} else {
+					spanIDs[i] = newSpanID(rnd)
+				}
+			}
+			if !colliding {
+				collider.setTransaction(tx, spanIDs)
+			}
 			var wg sync.WaitGroup
-			spanCount := rand.Intn(spanMax-spanMin+1) + spanMin
-			for i := 0; i < spanCount; i++ {
+			// every tree is generated concurrently with the others, depth first, with consecutive span indexes
+			for first := 0; first < spanCount; first += treeSize {
 				wg.Add(1)
-				go func() {
-					generateSpan(ctx)
+				go func(next int) {
+					var grow func(ctx context.Context, level int, parent time.Duration)
+					grow = func(ctx context.Context, level int, parent time.Duration) {
+						i := next
+						next++
+						opts := spanOpts
+						opts.SpanID = spanIDs[i]
+						d := spanDurations[i]
+						if parent >= 0 && d > parent {
+							d = parent
+						}
+						var children func(ctx context.Context, d time.Duration)
+						if level < depth {
+							children = func(ctx context.Context, d time.Duration) {
+								for c := 0; c < fanOut && next < spanCount; c++ {
+									grow(ctx, level+1, d)
+								}
+							}
+						}
+						generateSpan(ctx, i, spanNames[i], opts, d, children)
+					}
+					grow(txCtx, 1, -1)
 					wg.Done()
-				}()
+				}(first)
 			}
 			wg.Wait()
+			for i := 0; i < input.ExitSpans; i++ {
+				generateExitSpan(txCtx)
+			}
+			if spanMax > 0 && rnd.Float64() < input.DroppedSpansRatio {
+				// fill up to the max spans, and then overflow
+				generateDroppedSpans(txCtx, rnd, spanMax-spanCount, rnd.Intn(spanMax)+1)
+			}
 			tx.Context.SetTag("spans", strconv.Itoa(spanCount))
+			setLabels(&tx.Context, input.RunId, input.Labels)
+			fuzzer.label(&tx.Context)
+			if d >= 0 {
+				tx.Duration = d
+			} else if input.ClockSkew != 0 {
+				tx.Duration = time.Since(start)
+			}
 			tx.End()
 			count++
 		}
 		return nil
 	}
-	w.Add(generator)
+}
+
+// spanTreeSize returns the number of spans in a tree with the given depth and fan out,
+// 1 if depth is lower than 2.
+func spanTreeSize(depth, fanOut int) int {
+	size, level := 1, 1
+	for d := 1; d < depth && size < math.MaxInt32; d++ {
+		level *= fanOut
+		size += level
+	}
+	return size
+}
+
+// pick returns a random number between 1 and cardinality, or 0 if cardinality is lower than 2.
+func pick(r *rand.Rand, cardinality int) int {
+	if cardinality < 2 {
+		return 0
+	}
+	return r.Intn(cardinality) + 1
+}
+
+// sampleDurations returns a duration for a transaction and each of its spans, or -1 where no distribution is given.
+// Span durations are capped to the transaction duration, and the transaction lasts as long as its
+// longest span if only span durations are given.
+func sampleDurations(r *rand.Rand, txDuration, spanDuration distribution.Duration, spans int) (time.Duration, []time.Duration) {
+	d := time.Duration(-1)
+	if txDuration != nil {
+		d = txDuration.Sample(r)
+	}
+	ds := make([]time.Duration, spans)
+	for i := range ds {
+		ds[i] = -1
+		if spanDuration == nil {
+			continue
+		}
+		ds[i] = spanDuration.Sample(r)
+		if ds[i] > d {
+			if txDuration == nil {
+				d = ds[i]
+			} else {
+				ds[i] = d
+			}
+		}
+	}
+	return d, ds
 }
 
 func (w *worker) addSignalHandling() {
-	w.Add(func(done <-chan struct{}) error {
+	w.Add(func(ctx context.Context) error {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt)
+		defer signal.Stop(c)
 		select {
-		case <-done:
+		case <-ctx.Done():
 			return nil
 		case sig := <-c:
-			return errors.New(sig.String())
+			return StopError{"received " + sig.String()}
 		}
 	})
 }
 
-// throttle converts a time ticker to a channel of things.
-func throttle(c <-chan time.Time) chan interface{} {
-	throttle := make(chan interface{})
-	go func() {
-		for range c {
-			throttle <- struct{}{}
+// addProgress calls progress every second with the results so far, until the work is done.
+func (w *worker) addProgress(progress func(Result)) {
+	w.Add(func(ctx context.Context) error {
+		start := time.Now()
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case now := <-ticker.C:
+				progress(Result{
+					TracerStats:    w.Stats(),
+					TransportStats: w.TransportStats(),
+					Start:          start,
+					End:            now,
+					Flushed:        now,
+				})
+			}
 		}
-	}()
-	return throttle
+	})
 }
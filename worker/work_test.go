@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/transport"
+
+	"github.com/elastic/hey-apm/agent"
+	"github.com/elastic/hey-apm/models"
+)
+
+// discardSender creates events with a tracer discarding them.
+type discardSender struct {
+	*apm.Tracer
+}
+
+func (discardSender) TransportStats() agent.TransportStats {
+	return agent.TransportStats{}
+}
+
+// benchmarkGenerator measures generating b.N events with a tracer discarding them.
+func benchmarkGenerator(b *testing.B, generator Generator, input models.Input) {
+	tracer, err := apm.NewTracerOptions(apm.TracerOptions{ServiceName: "hey-apm", Transport: transport.Discard})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tracer.Close()
+	input.Seed = 42
+	generate := generator(discardSender{tracer}, input)
+	b.ReportAllocs()
+	b.ResetTimer()
+	if err := generate(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func benchmarkTransactions(b *testing.B, spans, spanTypes int) {
+	benchmarkGenerator(b, generateTransactions, models.Input{TransactionLimit: b.N, TransactionFrequency: time.Nanosecond,
+		SpanMinLimit: spans, SpanMaxLimit: spans, SpanTypes: spanTypes})
+}
+
+func BenchmarkGenerateTransactions1(b *testing.B)        { benchmarkTransactions(b, 1, 1) }
+func BenchmarkGenerateTransactions10(b *testing.B)       { benchmarkTransactions(b, 10, 1) }
+func BenchmarkGenerateTransactions10Types(b *testing.B)  { benchmarkTransactions(b, 10, 10) }
+func BenchmarkGenerateTransactions100Types(b *testing.B) { benchmarkTransactions(b, 100, 10) }
+
+func BenchmarkGenerateErrors(b *testing.B) {
+	benchmarkGenerator(b, generateErrors, models.Input{ErrorLimit: b.N, ErrorFrequency: time.Nanosecond,
+		ErrorFrameMinLimit: 10, ErrorFrameMaxLimit: 10})
+}